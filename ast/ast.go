@@ -2,13 +2,21 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"gomadoufu/monkey-interpreter-go/token"
+	"path"
+	"reflect"
+	"sort"
 	"strings"
 )
 
 // ASTノード
 type Node interface {
 	TokenLiteral() string
+	// ノードのソースコード上の位置。複数のトークンからなるノードは最初のトークンの位置
+	Pos() token.Position
+	// ノードの型名。直列化したASTに現れるので、一度決めた値は変えないこと
+	NodeType() string
 	// デバッグ用のメソッド
 	String() string
 }
@@ -27,6 +35,17 @@ type Expression interface {
 	expressionNode()
 }
 
+// 子ノードを文字列にする。パースに失敗して子がnil(型付きのnilを含む)のときは空文字列を返す
+func nodeString(n Node) string {
+	if n == nil {
+		return ""
+	}
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
+	}
+	return n.String()
+}
+
 // ASTのルートノード
 type Program struct {
 	Statements []Statement
@@ -40,12 +59,21 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) NodeType() string { return "Program" }
+
 // バッファを作成し、それぞれの文のString()メソッドの戻り値を書き込む
 func (p *Program) String() string {
 	var out bytes.Buffer
 
 	for _, s := range p.Statements {
-		out.WriteString(s.String())
+		out.WriteString(nodeString(s))
 	}
 
 	return out.String()
@@ -57,8 +85,14 @@ type LetStatement struct {
 	Token token.Token
 	// 左辺の識別子(変数名)を保持する
 	Name *Identifier
+	// let x, y = ... のように複数の名前に分割代入するときの左辺。このときNameはNames[0]
+	Names []*Identifier
 	// 右辺の式を保持する
 	Value Expression
+	// letrecなら右辺を評価する前に名前を束縛しておき、右辺から自分自身を参照できるようにする
+	Recursive bool
+	// export let ... なら、モジュールをimportした側から名前が見える
+	Exported bool
 }
 
 // Statementインターフェイスを満たす
@@ -66,17 +100,30 @@ func (ls *LetStatement) statementNode() {}
 
 // Nodeインターフェイスを満たす
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) NodeType() string     { return "LetStatement" }
 
 // ast.Program.String()に呼ばれる
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if len(ls.Names) > 0 {
+		names := []string{}
+		for _, n := range ls.Names {
+			names = append(names, nodeString(n))
+		}
+		out.WriteString(strings.Join(names, ", "))
+	} else {
+		out.WriteString(nodeString(ls.Name))
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
-		out.WriteString(ls.Value.String())
+		out.WriteString(nodeString(ls.Value))
 	}
 
 	out.WriteString(";")
@@ -84,6 +131,39 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// let x = 5 in x * 2 のように、Bodyを評価する間だけ名前を束縛する式
+type LetExpression struct {
+	// let式であることを示すtoken.LETトークン
+	Token token.Token
+	// let文と同じ形の束縛
+	Binding *LetStatement
+	// 束縛した名前が見える式
+	Body Expression
+}
+
+// Expressionインターフェイスを満たす
+func (le *LetExpression) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (le *LetExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LetExpression) Pos() token.Position  { return le.Token.Pos }
+func (le *LetExpression) NodeType() string     { return "LetExpression" }
+
+// ast.Program.String()に呼ばれる
+func (le *LetExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(strings.TrimSuffix(nodeString(le.Binding), ";"))
+	out.WriteString(" in ")
+	if le.Body != nil {
+		out.WriteString(nodeString(le.Body))
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // 識別子
 type Identifier struct {
 	//token.IDENTトークン
@@ -97,6 +177,8 @@ func (i *Identifier) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) NodeType() string     { return "Identifier" }
 
 // ast.Program.String()に呼ばれる
 func (i *Identifier) String() string { return i.Value }
@@ -114,6 +196,8 @@ func (rs *ReturnStatement) statementNode() {}
 
 // Nodeインターフェイスを満たす
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) NodeType() string     { return "ReturnStatement" }
 
 // ast.Program.String()に呼ばれる
 func (rs *ReturnStatement) String() string {
@@ -122,7 +206,7 @@ func (rs *ReturnStatement) String() string {
 	out.WriteString(rs.TokenLiteral() + " ")
 
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(nodeString(rs.ReturnValue))
 	}
 
 	out.WriteString(";")
@@ -130,6 +214,291 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// unlet文 unlet x; 今のスコープから束縛を取り除く
+type UnletStatement struct {
+	// 'unlet' トークン
+	Token token.Token
+	// 取り除く変数名
+	Name *Identifier
+}
+
+func (us *UnletStatement) statementNode()       {}
+func (us *UnletStatement) TokenLiteral() string { return us.Token.Literal }
+func (us *UnletStatement) Pos() token.Position  { return us.Token.Pos }
+func (us *UnletStatement) NodeType() string     { return "UnletStatement" }
+func (us *UnletStatement) String() string {
+	return us.TokenLiteral() + " " + nodeString(us.Name) + ";"
+}
+
+// import文 import "math" や import "math" as m
+type ImportStatement struct {
+	// 'import' トークン
+	Token token.Token
+	// モジュールの名前。拡張子.monkeyは省略できる
+	Path *StringLiteral
+	// as で付けた名前。付けなければnil
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) NodeType() string     { return "ImportStatement" }
+func (is *ImportStatement) String() string {
+	out := is.TokenLiteral() + " " + `"` + is.Path.Value + `"`
+	if is.Alias != nil {
+		out += " as " + nodeString(is.Alias)
+	}
+	return out + ";"
+}
+
+// モジュールを束縛する名前。asがなければパスの最後の要素から拡張子を除いたもの
+func (is *ImportStatement) Name() string {
+	if is.Alias != nil {
+		return is.Alias.Value
+	}
+	return strings.TrimSuffix(path.Base(is.Path.Value), ".monkey")
+}
+
+// defer文 関数を抜けるときに実行する呼び出し
+type DeferStatement struct {
+	// 'defer' トークン
+	Token token.Token
+	// 遅延実行する関数呼び出し
+	Call *CallExpression
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeferStatement) Pos() token.Position  { return ds.Token.Pos }
+func (ds *DeferStatement) NodeType() string     { return "DeferStatement" }
+func (ds *DeferStatement) String() string {
+	return ds.TokenLiteral() + " " + nodeString(ds.Call) + ";"
+}
+
+// while文 条件式が真である間ブロックを繰り返す
+type WhileStatement struct {
+	// 'while' トークン
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) NodeType() string     { return "WhileStatement" }
+func (ws *WhileStatement) String() string {
+	return "while" + nodeString(ws.Condition) + " " + nodeString(ws.Body)
+}
+
+// do-while文 do { ... } while (x < 10) 本体を実行してから条件を調べる
+type DoWhileStatement struct {
+	// 'do' トークン
+	Token     token.Token
+	Body      *BlockStatement
+	Condition Expression
+}
+
+func (ds *DoWhileStatement) statementNode()       {}
+func (ds *DoWhileStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DoWhileStatement) Pos() token.Position  { return ds.Token.Pos }
+func (ds *DoWhileStatement) NodeType() string     { return "DoWhileStatement" }
+func (ds *DoWhileStatement) String() string {
+	return "do " + nodeString(ds.Body) + " while" + nodeString(ds.Condition)
+}
+
+// repeat文 repeat(5) { ... } 本体を決まった回数だけ実行する
+type RepeatStatement struct {
+	// 'repeat' トークン
+	Token token.Token
+	Count Expression
+	Body  *BlockStatement
+}
+
+func (rs *RepeatStatement) statementNode()       {}
+func (rs *RepeatStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RepeatStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *RepeatStatement) NodeType() string     { return "RepeatStatement" }
+func (rs *RepeatStatement) String() string {
+	return "repeat(" + nodeString(rs.Count) + ") " + nodeString(rs.Body)
+}
+
+// try文 try { ... } catch (err) { ... } finally { ... }
+// catchとfinallyはどちらか一方を省略できる。catchの名前も省略できる
+type TryCatchStatement struct {
+	// 'try' トークン
+	Token token.Token
+	Body  *BlockStatement
+	// 省略されていればnil
+	ErrorBinding *Identifier
+	Handler      *BlockStatement
+	Finally      *BlockStatement
+}
+
+func (ts *TryCatchStatement) statementNode()       {}
+func (ts *TryCatchStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryCatchStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *TryCatchStatement) NodeType() string     { return "TryCatchStatement" }
+func (ts *TryCatchStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try " + nodeString(ts.Body))
+	if ts.Handler != nil {
+		out.WriteString(" catch")
+		if ts.ErrorBinding != nil {
+			out.WriteString("(" + nodeString(ts.ErrorBinding) + ")")
+		}
+		out.WriteString(" " + nodeString(ts.Handler))
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally " + nodeString(ts.Finally))
+	}
+
+	return out.String()
+}
+
+// throw文 throw "message"; 値をエラーにして投げる
+type ThrowStatement struct {
+	// 'throw' トークン
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) NodeType() string     { return "ThrowStatement" }
+func (ts *ThrowStatement) String() string {
+	return "throw " + nodeString(ts.Value) + ";"
+}
+
+// for文 for (let i = 0; i < 10; i += 1) { ... }
+// Init・Condition・Postは省略されていればnil。Conditionを省略すると常に真
+type ForStatement struct {
+	// 'for' トークン
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) NodeType() string     { return "ForStatement" }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(nodeString(fs.Init), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(nodeString(fs.Condition))
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(strings.TrimSuffix(nodeString(fs.Post), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(nodeString(fs.Body))
+
+	return out.String()
+}
+
+// for-in文 for (x in iterable) { ... }
+type ForInStatement struct {
+	// 'for' トークン
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForInStatement) NodeType() string     { return "ForInStatement" }
+func (fs *ForInStatement) String() string {
+	return "for (" + nodeString(fs.Variable) + " in " + nodeString(fs.Iterable) + ") " + nodeString(fs.Body)
+}
+
+// yield式 ジェネレータの本体を止めて値を返す。値を省略するとnull
+type YieldExpression struct {
+	// 'yield' トークン
+	Token token.Token
+	// なければnil
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) Pos() token.Position  { return ye.Token.Pos }
+func (ye *YieldExpression) NodeType() string     { return "YieldExpression" }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return ye.TokenLiteral()
+	}
+	return ye.TokenLiteral() + " " + nodeString(ye.Value)
+}
+
+// break文 ラベルがあればそのラベルの付いたループを抜ける
+type BreakStatement struct {
+	// 'break' トークン
+	Token token.Token
+	// なければnil
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) NodeType() string     { return "BreakStatement" }
+func (bs *BreakStatement) String() string {
+	if bs.Label != nil {
+		return bs.TokenLiteral() + " " + nodeString(bs.Label) + ";"
+	}
+	return bs.TokenLiteral() + ";"
+}
+
+// continue文 ラベルがあればそのラベルの付いたループの次の繰り返しへ進む
+type ContinueStatement struct {
+	// 'continue' トークン
+	Token token.Token
+	// なければnil
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) NodeType() string     { return "ContinueStatement" }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return cs.TokenLiteral() + " " + nodeString(cs.Label) + ";"
+	}
+	return cs.TokenLiteral() + ";"
+}
+
+// ラベル付きの文 outer: while (true) { ... }
+type LabeledStatement struct {
+	// ラベルの識別子トークン
+	Token     token.Token
+	Label     *Identifier
+	Statement Statement
+}
+
+func (ls *LabeledStatement) statementNode()       {}
+func (ls *LabeledStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LabeledStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LabeledStatement) NodeType() string     { return "LabeledStatement" }
+func (ls *LabeledStatement) String() string {
+	return nodeString(ls.Label) + ": " + nodeString(ls.Statement)
+}
+
 // 式文
 type ExpressionStatement struct {
 	//式の最初のトークン
@@ -143,11 +512,13 @@ func (es *ExpressionStatement) statementNode() {}
 
 // Nodeインターフェイスを満たす
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) NodeType() string     { return "ExpressionStatement" }
 
 // ast.Program.String()に呼ばれる
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
-		return es.Expression.String()
+		return nodeString(es.Expression)
 	}
 	return ""
 }
@@ -165,10 +536,30 @@ func (il *IntegerLiteral) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) NodeType() string     { return "IntegerLiteral" }
 
 // ast.Program.String()に呼ばれる
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
+// 浮動小数点数リテラル
+type FloatLiteral struct {
+	// FLOATトークン
+	Token token.Token
+	Value float64
+}
+
+// Expressionインターフェイスを満たす
+func (fl *FloatLiteral) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) NodeType() string     { return "FloatLiteral" }
+
+// ast.Program.String()に呼ばれる
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
 // 前置演算子
 type PrefixExpression struct {
 	//前置トークン、例えば「!」
@@ -184,6 +575,8 @@ func (pe *PrefixExpression) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) NodeType() string     { return "PrefixExpression" }
 
 // ast.Program.String()に呼ばれる
 func (pe *PrefixExpression) String() string {
@@ -191,7 +584,7 @@ func (pe *PrefixExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(pe.Operator)
-	out.WriteString(pe.Right.String())
+	out.WriteString(nodeString(pe.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -215,14 +608,23 @@ func (oe *InfixExpression) expressionNode() {}
 // Nodeインターフェイスを満たす
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
 
+// 中置演算子の式の位置は、演算子ではなく左辺の先頭
+func (oe *InfixExpression) Pos() token.Position {
+	if oe.Left != nil {
+		return oe.Left.Pos()
+	}
+	return oe.Token.Pos
+}
+func (oe *InfixExpression) NodeType() string { return "InfixExpression" }
+
 // ast.Program.String()に呼ばれる
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(oe.Left.String())
+	out.WriteString(nodeString(oe.Left))
 	out.WriteString(" " + oe.Operator + " ")
-	out.WriteString(oe.Right.String())
+	out.WriteString(nodeString(oe.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -241,6 +643,8 @@ func (b *Boolean) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
+func (b *Boolean) NodeType() string     { return "Boolean" }
 
 // ast.Program.String()に呼ばれる
 func (b *Boolean) String() string { return b.Token.Literal }
@@ -262,19 +666,21 @@ func (ie *IfExpression) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) NodeType() string     { return "IfExpression" }
 
 // ast.Program.String()に呼ばれる
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("if")
-	out.WriteString(ie.Condition.String())
+	out.WriteString(nodeString(ie.Condition))
 	out.WriteString(" ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(nodeString(ie.Consequence))
 
 	if ie.Alternative != nil {
 		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(nodeString(ie.Alternative))
 	}
 
 	return out.String()
@@ -285,6 +691,8 @@ type BlockStatement struct {
 	Token token.Token
 	// ブロック内の文
 	Statements []Statement
+	// '}' の位置。ブロックの範囲を調べるのに使う
+	End token.Position
 }
 
 // Statementインターフェイスを満たす
@@ -292,13 +700,15 @@ func (bs *BlockStatement) statementNode() {}
 
 // Nodeインターフェイスを満たす
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) NodeType() string     { return "BlockStatement" }
 
 // ast.Program.String()に呼ばれる
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
 	for _, s := range bs.Statements {
-		out.WriteString(s.String())
+		out.WriteString(nodeString(s))
 	}
 
 	return out.String()
@@ -312,6 +722,11 @@ type FunctionLiteral struct {
 	Parameters []*Identifier
 	// 関数の本体
 	Body *BlockStatement
+	// let文で束縛される名前(コンパイラが再帰呼び出しの解決に使う)
+	// fn name() { } と書いたときはその名前
+	Name string
+	// fn* で定義したジェネレータ関数かどうか
+	Generator bool
 }
 
 // Expressionインターフェイスを満たす
@@ -319,6 +734,8 @@ func (fl *FunctionLiteral) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) NodeType() string     { return "FunctionLiteral" }
 
 // ast.Program.String()に呼ばれる
 func (fl *FunctionLiteral) String() string {
@@ -326,14 +743,20 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, nodeString(p))
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Generator {
+		out.WriteString("*")
+	}
+	if fl.Name != "" {
+		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
-	out.WriteString(fl.Body.String())
+	out.WriteString(nodeString(fl.Body))
 
 	return out.String()
 }
@@ -354,16 +777,71 @@ func (ce *CallExpression) expressionNode() {}
 // Nodeインターフェイスを満たす
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 
+// 呼び出し式の位置は、'('ではなく呼び出される関数の先頭
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+func (ce *CallExpression) NodeType() string { return "CallExpression" }
+
 // ast.Program.String()に呼ばれる
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
 	args := []string{}
 	for _, a := range ce.Arguments {
-		args = append(args, a.String())
+		args = append(args, nodeString(a))
 	}
 
-	out.WriteString(ce.Function.String())
+	out.WriteString(nodeString(ce.Function))
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// メソッド呼び出し obj.method(args)。評価器はmethod(obj, args)のように組み込み関数を呼び出す
+type MethodCallExpression struct {
+	// '.' トークン
+	Token token.Token
+	// レシーバ
+	Object Expression
+	// メソッド名
+	Method *Identifier
+	// 引数リスト。レシーバは含まない
+	Arguments []Expression
+}
+
+// Expressionインターフェイスを満たす
+func (mc *MethodCallExpression) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+
+// 呼び出し式と同じく、位置はレシーバの先頭
+func (mc *MethodCallExpression) Pos() token.Position {
+	if mc.Object != nil {
+		return mc.Object.Pos()
+	}
+	return mc.Token.Pos
+}
+func (mc *MethodCallExpression) NodeType() string { return "MethodCallExpression" }
+
+// ast.Program.String()に呼ばれる
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range mc.Arguments {
+		args = append(args, nodeString(a))
+	}
+
+	out.WriteString(nodeString(mc.Object))
+	out.WriteString(".")
+	out.WriteString(nodeString(mc.Method))
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
@@ -384,10 +862,41 @@ func (sl *StringLiteral) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) NodeType() string     { return "StringLiteral" }
 
 // ast.Program.String()に呼ばれる
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// タプルリテラル (1, "a", true) や、return a, b の返り値
+type TupleLiteral struct {
+	// '(' トークン。return a, b のときは最初の ',' トークン
+	Token    token.Token
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+
+// return a, b のタプルはトークンが最初のカンマなので、最初の要素の位置を返す
+func (tl *TupleLiteral) Pos() token.Position {
+	if tl.Token.Type == token.COMMA && len(tl.Elements) > 0 {
+		return tl.Elements[0].Pos()
+	}
+	return tl.Token.Pos
+}
+func (tl *TupleLiteral) NodeType() string { return "TupleLiteral" }
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, e := range tl.Elements {
+		elements = append(elements, nodeString(e))
+	}
+	if len(elements) == 1 {
+		return "(" + elements[0] + ",)"
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
 type ArrayLiteral struct {
 	// '[' トークン
 	Token token.Token
@@ -401,6 +910,8 @@ func (al *ArrayLiteral) expressionNode() {}
 // Nodeインターフェイスを満たす
 
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) NodeType() string     { return "ArrayLiteral" }
 
 // ast.Program.String()に呼ばれる
 func (al *ArrayLiteral) String() string {
@@ -408,7 +919,7 @@ func (al *ArrayLiteral) String() string {
 
 	elements := []string{}
 	for _, e := range al.Elements {
-		elements = append(elements, e.String())
+		elements = append(elements, nodeString(e))
 	}
 
 	out.WriteString("[")
@@ -430,17 +941,64 @@ type IndexExpression struct {
 // Expressionインターフェイスを満たす
 func (ie *IndexExpression) expressionNode() {}
 
+// スライス式 a[low:high]
+type SliceExpression struct {
+	// '[' トークン
+	Token token.Token
+	// 文字列か配列
+	Left Expression
+	// 省略されていればnil
+	Low  Expression
+	High Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+func (se *SliceExpression) Pos() token.Position {
+	if se.Left != nil {
+		return se.Left.Pos()
+	}
+	return se.Token.Pos
+}
+func (se *SliceExpression) NodeType() string { return "SliceExpression" }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(nodeString(se.Left))
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(nodeString(se.Low))
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(nodeString(se.High))
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // Nodeインターフェイスを満たす
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) NodeType() string { return "IndexExpression" }
+
 // ast.Program.String()に呼ばれる
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	out.WriteString(nodeString(ie.Index))
 	out.WriteString("])")
 
 	return out.String()
@@ -458,14 +1016,35 @@ func (hl *HashLiteral) expressionNode() {}
 
 // Nodeインターフェイスを満たす
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) NodeType() string     { return "HashLiteral" }
+
+// キーをソースコードに書かれた順に返す。位置の同じキー(マクロで作ったものなど)は文字列表現の順にする
+func (hl *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].Pos(), keys[j].Pos()
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
 
 // ast.Program.String()に呼ばれる
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys() {
+		pairs = append(pairs, nodeString(key)+":"+nodeString(hl.Pairs[key]))
 	}
 
 	out.WriteString("{")
@@ -474,3 +1053,159 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// 代入式 x = 5
+type AssignExpression struct {
+	// '=' トークン
+	Token token.Token
+	// 代入先の識別子
+	Name *Identifier
+	// 代入する値
+	Value Expression
+}
+
+// Expressionインターフェイスを満たす
+func (ae *AssignExpression) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Name != nil {
+		return ae.Name.Pos()
+	}
+	return ae.Token.Pos
+}
+func (ae *AssignExpression) NodeType() string { return "AssignExpression" }
+
+// ast.Program.String()に呼ばれる
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(nodeString(ae.Name))
+	out.WriteString(" = ")
+	out.WriteString(nodeString(ae.Value))
+
+	return out.String()
+}
+
+// マクロリテラル macro(x, y) { x + y; }
+type MacroLiteral struct {
+	// 'macro' トークン
+	Token token.Token
+	// 引数リスト
+	Parameters []*Identifier
+	// マクロの本体
+	Body *BlockStatement
+}
+
+// Expressionインターフェイスを満たす
+func (ml *MacroLiteral) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
+func (ml *MacroLiteral) NodeType() string     { return "MacroLiteral" }
+
+// ast.Program.String()に呼ばれる
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, nodeString(p))
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(nodeString(ml.Body))
+
+	return out.String()
+}
+
+// match式 match x { case 0: "zero"; case n if n < 0: "negative"; default: "positive" }
+type MatchExpression struct {
+	// 'match' トークン
+	Token token.Token
+	// 照合される値
+	Subject Expression
+	// 上から順に照合する分岐
+	Arms []*MatchArm
+}
+
+// Expressionインターフェイスを満たす
+func (me *MatchExpression) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) NodeType() string     { return "MatchExpression" }
+
+// ast.Program.String()に呼ばれる
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match ")
+	out.WriteString(nodeString(me.Subject))
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, "; "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// match式の分岐
+// Patternはリテラル・束縛する識別子・ワイルドカード(_)のいずれか。defaultの分岐ではnil
+type MatchArm struct {
+	// 'case' または 'default' トークン
+	Token   token.Token
+	Pattern Expression
+	// ifの後に続く条件式。なければnil
+	Guard Expression
+	Body  Expression
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	if ma.Pattern == nil {
+		out.WriteString("default")
+	} else {
+		out.WriteString("case ")
+		out.WriteString(nodeString(ma.Pattern))
+	}
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(nodeString(ma.Guard))
+	}
+	out.WriteString(": ")
+	out.WriteString(nodeString(ma.Body))
+
+	return out.String()
+}
+
+// シンボルリテラル :ok
+type SymbolLiteral struct {
+	// COLON_IDENTトークン
+	Token token.Token
+	// :を除いた名前
+	Value string
+}
+
+// Expressionインターフェイスを満たす
+func (sl *SymbolLiteral) expressionNode() {}
+
+// Nodeインターフェイスを満たす
+func (sl *SymbolLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SymbolLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *SymbolLiteral) NodeType() string     { return "SymbolLiteral" }
+
+// ast.Program.String()に呼ばれる
+func (sl *SymbolLiteral) String() string { return ":" + sl.Value }
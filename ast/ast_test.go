@@ -26,3 +26,131 @@ func TestString(t *testing.T) {
 	}
 
 }
+
+func TestEqualNil(t *testing.T) {
+	ident := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+	moved := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 3, Column: 7}}, Value: "x"}
+
+	tests := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{nil, nil, true},
+		{ident, nil, false},
+		{nil, ident, false},
+		{ident, moved, true},
+		{ident, &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "x"}, Value: "x"}, false},
+		{&IfExpression{Condition: ident, Consequence: &BlockStatement{}},
+			&IfExpression{Condition: ident, Consequence: &BlockStatement{}, Alternative: &BlockStatement{}}, false},
+		{&ReturnStatement{}, &ReturnStatement{ReturnValue: ident}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] - Equal wrong. want=%t, got=%t", i, tt.expected, got)
+		}
+	}
+}
+
+func TestCloneFunctionLiteral(t *testing.T) {
+	original := &FunctionLiteral{
+		Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: []*Identifier{
+			{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+		},
+		Body: &BlockStatement{
+			Statements: []Statement{
+				&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+			},
+		},
+	}
+
+	clone, ok := Clone(original).(*FunctionLiteral)
+	if !ok {
+		t.Fatalf("Clone returned %T", Clone(original))
+	}
+	if clone == original || !Equal(clone, original) {
+		t.Fatalf("clone is not an independent equal copy")
+	}
+
+	clone.Parameters[0].Value = "y"
+	clone.Parameters = append(clone.Parameters, &Identifier{Value: "z"})
+	clone.Body.Statements[0].(*ExpressionStatement).Expression = &Identifier{Value: "y"}
+	clone.Token.Literal = "changed"
+
+	if original.String() != "fn(x)x" {
+		t.Errorf("original was modified. got=%q", original.String())
+	}
+	if len(original.Parameters) != 1 || original.Parameters[0].Value != "x" {
+		t.Errorf("original parameters were modified. got=%v", original.Parameters)
+	}
+	if original.Token.Literal != "fn" {
+		t.Errorf("original token was modified. got=%q", original.Token.Literal)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	if Clone(nil) != nil {
+		t.Errorf("Clone(nil) is not nil")
+	}
+
+	ifExp := &IfExpression{Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}}
+	clone := Clone(ifExp).(*IfExpression)
+	if clone.Alternative != nil {
+		t.Errorf("nil Alternative was cloned as %+v", clone.Alternative)
+	}
+}
+
+func TestNodeType(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&Program{}, "Program"},
+		{&LetStatement{}, "LetStatement"},
+		{&LetExpression{}, "LetExpression"},
+		{&Identifier{}, "Identifier"},
+		{&ReturnStatement{}, "ReturnStatement"},
+		{&ImportStatement{}, "ImportStatement"},
+		{&DeferStatement{}, "DeferStatement"},
+		{&WhileStatement{}, "WhileStatement"},
+		{&DoWhileStatement{}, "DoWhileStatement"},
+		{&RepeatStatement{}, "RepeatStatement"},
+		{&TryCatchStatement{}, "TryCatchStatement"},
+		{&ThrowStatement{}, "ThrowStatement"},
+		{&ForStatement{}, "ForStatement"},
+		{&ForInStatement{}, "ForInStatement"},
+		{&YieldExpression{}, "YieldExpression"},
+		{&UnletStatement{}, "UnletStatement"},
+		{&BreakStatement{}, "BreakStatement"},
+		{&ContinueStatement{}, "ContinueStatement"},
+		{&LabeledStatement{}, "LabeledStatement"},
+		{&ExpressionStatement{}, "ExpressionStatement"},
+		{&IntegerLiteral{}, "IntegerLiteral"},
+		{&FloatLiteral{}, "FloatLiteral"},
+		{&MethodCallExpression{}, "MethodCallExpression"},
+		{&PrefixExpression{}, "PrefixExpression"},
+		{&InfixExpression{}, "InfixExpression"},
+		{&Boolean{}, "Boolean"},
+		{&IfExpression{}, "IfExpression"},
+		{&BlockStatement{}, "BlockStatement"},
+		{&FunctionLiteral{}, "FunctionLiteral"},
+		{&CallExpression{}, "CallExpression"},
+		{&StringLiteral{}, "StringLiteral"},
+		{&TupleLiteral{}, "TupleLiteral"},
+		{&ArrayLiteral{}, "ArrayLiteral"},
+		{&IndexExpression{}, "IndexExpression"},
+		{&SliceExpression{}, "SliceExpression"},
+		{&HashLiteral{}, "HashLiteral"},
+		{&AssignExpression{}, "AssignExpression"},
+		{&MacroLiteral{}, "MacroLiteral"},
+		{&MatchExpression{}, "MatchExpression"},
+		{&SymbolLiteral{}, "SymbolLiteral"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.NodeType() != tt.expected {
+			t.Errorf("NodeType wrong. want=%q, got=%q", tt.expected, tt.node.NodeType())
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package ast
+
+// ノードを深くコピーする。コピーを書き換えても元のノードには影響しない
+// トークンは値としてコピーし、スライスやマップは作り直す
+func Clone(node Node) Node {
+	if node == nil {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: cloneStatements(node.Statements)}
+
+	case *LetStatement:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Names = cloneIdentifiers(node.Names)
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *LetExpression:
+		c := *node
+		c.Binding, _ = Clone(node.Binding).(*LetStatement)
+		c.Body = cloneExpression(node.Body)
+		return &c
+
+	case *Identifier:
+		return cloneIdentifier(node)
+
+	case *ReturnStatement:
+		c := *node
+		c.ReturnValue = cloneExpression(node.ReturnValue)
+		return &c
+
+	case *DeferStatement:
+		c := *node
+		c.Call = cloneCall(node.Call)
+		return &c
+
+	case *WhileStatement:
+		c := *node
+		c.Condition = cloneExpression(node.Condition)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *DoWhileStatement:
+		c := *node
+		c.Body = cloneBlock(node.Body)
+		c.Condition = cloneExpression(node.Condition)
+		return &c
+
+	case *RepeatStatement:
+		c := *node
+		c.Count = cloneExpression(node.Count)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *TryCatchStatement:
+		c := *node
+		c.Body = cloneBlock(node.Body)
+		c.ErrorBinding = cloneIdentifier(node.ErrorBinding)
+		c.Handler = cloneBlock(node.Handler)
+		c.Finally = cloneBlock(node.Finally)
+		return &c
+
+	case *ThrowStatement:
+		c := *node
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *ForStatement:
+		c := *node
+		c.Init = cloneStatement(node.Init)
+		c.Condition = cloneExpression(node.Condition)
+		c.Post = cloneStatement(node.Post)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *ForInStatement:
+		c := *node
+		c.Variable = cloneIdentifier(node.Variable)
+		c.Iterable = cloneExpression(node.Iterable)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *YieldExpression:
+		c := *node
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *UnletStatement:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		return &c
+
+	case *ImportStatement:
+		c := *node
+		c.Path, _ = Clone(node.Path).(*StringLiteral)
+		c.Alias = cloneIdentifier(node.Alias)
+		return &c
+
+	case *BreakStatement:
+		c := *node
+		c.Label = cloneIdentifier(node.Label)
+		return &c
+
+	case *ContinueStatement:
+		c := *node
+		c.Label = cloneIdentifier(node.Label)
+		return &c
+
+	case *LabeledStatement:
+		c := *node
+		c.Label = cloneIdentifier(node.Label)
+		c.Statement = cloneStatement(node.Statement)
+		return &c
+
+	case *ExpressionStatement:
+		c := *node
+		c.Expression = cloneExpression(node.Expression)
+		return &c
+
+	case *IntegerLiteral:
+		c := *node
+		return &c
+
+	case *FloatLiteral:
+		c := *node
+		return &c
+
+	case *PrefixExpression:
+		c := *node
+		c.Right = cloneExpression(node.Right)
+		return &c
+
+	case *InfixExpression:
+		c := *node
+		c.Left = cloneExpression(node.Left)
+		c.Right = cloneExpression(node.Right)
+		return &c
+
+	case *Boolean:
+		c := *node
+		return &c
+
+	case *IfExpression:
+		c := *node
+		c.Condition = cloneExpression(node.Condition)
+		c.Consequence = cloneBlock(node.Consequence)
+		c.Alternative = cloneBlock(node.Alternative)
+		return &c
+
+	case *BlockStatement:
+		return cloneBlock(node)
+
+	case *FunctionLiteral:
+		c := *node
+		c.Parameters = cloneIdentifiers(node.Parameters)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *CallExpression:
+		return cloneCall(node)
+
+	case *MethodCallExpression:
+		c := *node
+		c.Object = cloneExpression(node.Object)
+		c.Method = cloneIdentifier(node.Method)
+		c.Arguments = cloneExpressions(node.Arguments)
+		return &c
+
+	case *StringLiteral:
+		c := *node
+		return &c
+
+	case *TupleLiteral:
+		c := *node
+		c.Elements = cloneExpressions(node.Elements)
+		return &c
+
+	case *ArrayLiteral:
+		c := *node
+		c.Elements = cloneExpressions(node.Elements)
+		return &c
+
+	case *IndexExpression:
+		c := *node
+		c.Left = cloneExpression(node.Left)
+		c.Index = cloneExpression(node.Index)
+		return &c
+
+	case *SliceExpression:
+		c := *node
+		c.Left = cloneExpression(node.Left)
+		c.Low = cloneExpression(node.Low)
+		c.High = cloneExpression(node.High)
+		return &c
+
+	case *HashLiteral:
+		c := *node
+		c.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for key, val := range node.Pairs {
+			c.Pairs[cloneExpression(key)] = cloneExpression(val)
+		}
+		return &c
+
+	case *AssignExpression:
+		c := *node
+		c.Name = cloneIdentifier(node.Name)
+		c.Value = cloneExpression(node.Value)
+		return &c
+
+	case *MacroLiteral:
+		c := *node
+		c.Parameters = cloneIdentifiers(node.Parameters)
+		c.Body = cloneBlock(node.Body)
+		return &c
+
+	case *MatchExpression:
+		c := *node
+		c.Subject = cloneExpression(node.Subject)
+		c.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			c.Arms[i] = &MatchArm{
+				Token:   arm.Token,
+				Pattern: cloneExpression(arm.Pattern),
+				Guard:   cloneExpression(arm.Guard),
+				Body:    cloneExpression(arm.Body),
+			}
+		}
+		return &c
+
+	case *SymbolLiteral:
+		c := *node
+		return &c
+	}
+
+	return node
+}
+
+// 省略できるフィールドは型付きのnilになるので、Cloneに渡す前にnilかどうかを調べる
+func cloneIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	return &c
+}
+
+func cloneBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: cloneStatements(block.Statements), End: block.End}
+}
+
+func cloneCall(call *CallExpression) *CallExpression {
+	if call == nil {
+		return nil
+	}
+	return &CallExpression{
+		Token:     call.Token,
+		Function:  cloneExpression(call.Function),
+		Arguments: cloneExpressions(call.Arguments),
+	}
+}
+
+func cloneExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	c, _ := Clone(exp).(Expression)
+	return c
+}
+
+func cloneStatement(stmt Statement) Statement {
+	if stmt == nil {
+		return nil
+	}
+	c, _ := Clone(stmt).(Statement)
+	return c
+}
+
+func cloneIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	c := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		c[i] = cloneIdentifier(ident)
+	}
+	return c
+}
+
+func cloneStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	c := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		c[i] = cloneStatement(stmt)
+	}
+	return c
+}
+
+func cloneExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	c := make([]Expression, len(exps))
+	for i, exp := range exps {
+		c[i] = cloneExpression(exp)
+	}
+	return c
+}
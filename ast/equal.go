@@ -0,0 +1,276 @@
+package ast
+
+// 2つの部分木が同じ構造かどうかを調べる
+// トークンは位置を含めて比べず、ノードの種類と演算子や値などのフィールドだけを比べる
+// マクロ展開で作られた式文のように、構造が同じでもトークンが異なるノードがあるため
+func Equal(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && statementsEqual(a.Statements, b.Statements)
+
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && identifierEqual(a.Name, b.Name) && identifiersEqual(a.Names, b.Names) &&
+			Equal(a.Value, b.Value) && a.Recursive == b.Recursive && a.Exported == b.Exported
+
+	case *LetExpression:
+		b, ok := b.(*LetExpression)
+		return ok && Equal(a.Binding, b.Binding) && Equal(a.Body, b.Body)
+
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && identifierEqual(a, b)
+
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+
+	case *DeferStatement:
+		b, ok := b.(*DeferStatement)
+		return ok && callEqual(a.Call, b.Call)
+
+	case *WhileStatement:
+		b, ok := b.(*WhileStatement)
+		return ok && Equal(a.Condition, b.Condition) && blockEqual(a.Body, b.Body)
+
+	case *DoWhileStatement:
+		b, ok := b.(*DoWhileStatement)
+		return ok && blockEqual(a.Body, b.Body) && Equal(a.Condition, b.Condition)
+
+	case *RepeatStatement:
+		b, ok := b.(*RepeatStatement)
+		return ok && Equal(a.Count, b.Count) && blockEqual(a.Body, b.Body)
+
+	case *TryCatchStatement:
+		b, ok := b.(*TryCatchStatement)
+		return ok && blockEqual(a.Body, b.Body) && identifierEqual(a.ErrorBinding, b.ErrorBinding) &&
+			blockEqual(a.Handler, b.Handler) && blockEqual(a.Finally, b.Finally)
+
+	case *ThrowStatement:
+		b, ok := b.(*ThrowStatement)
+		return ok && Equal(a.Value, b.Value)
+
+	case *ForStatement:
+		b, ok := b.(*ForStatement)
+		return ok && Equal(a.Init, b.Init) && Equal(a.Condition, b.Condition) && Equal(a.Post, b.Post) &&
+			blockEqual(a.Body, b.Body)
+
+	case *ForInStatement:
+		b, ok := b.(*ForInStatement)
+		return ok && identifierEqual(a.Variable, b.Variable) && Equal(a.Iterable, b.Iterable) &&
+			blockEqual(a.Body, b.Body)
+
+	case *YieldExpression:
+		b, ok := b.(*YieldExpression)
+		return ok && Equal(a.Value, b.Value)
+
+	case *UnletStatement:
+		b, ok := b.(*UnletStatement)
+		return ok && identifierEqual(a.Name, b.Name)
+
+	case *ImportStatement:
+		b, ok := b.(*ImportStatement)
+		return ok && a.Path.Value == b.Path.Value && identifierEqual(a.Alias, b.Alias)
+
+	case *BreakStatement:
+		b, ok := b.(*BreakStatement)
+		return ok && identifierEqual(a.Label, b.Label)
+
+	case *ContinueStatement:
+		b, ok := b.(*ContinueStatement)
+		return ok && identifierEqual(a.Label, b.Label)
+
+	case *LabeledStatement:
+		b, ok := b.(*LabeledStatement)
+		return ok && identifierEqual(a.Label, b.Label) && Equal(a.Statement, b.Statement)
+
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+
+	case *FloatLiteral:
+		b, ok := b.(*FloatLiteral)
+		return ok && a.Value == b.Value
+
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Right, b.Right)
+
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Left, b.Left) && Equal(a.Right, b.Right)
+
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) &&
+			blockEqual(a.Consequence, b.Consequence) && blockEqual(a.Alternative, b.Alternative)
+
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && blockEqual(a, b)
+
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && identifiersEqual(a.Parameters, b.Parameters) && blockEqual(a.Body, b.Body) &&
+			a.Name == b.Name && a.Generator == b.Generator
+
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && callEqual(a, b)
+
+	case *MethodCallExpression:
+		b, ok := b.(*MethodCallExpression)
+		return ok && Equal(a.Object, b.Object) && identifierEqual(a.Method, b.Method) &&
+			expressionsEqual(a.Arguments, b.Arguments)
+
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+
+	case *TupleLiteral:
+		b, ok := b.(*TupleLiteral)
+		return ok && expressionsEqual(a.Elements, b.Elements)
+
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && expressionsEqual(a.Elements, b.Elements)
+
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+
+	case *SliceExpression:
+		b, ok := b.(*SliceExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Low, b.Low) && Equal(a.High, b.High)
+
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		return ok && pairsEqual(a.Pairs, b.Pairs)
+
+	case *AssignExpression:
+		b, ok := b.(*AssignExpression)
+		return ok && identifierEqual(a.Name, b.Name) && Equal(a.Value, b.Value)
+
+	case *MacroLiteral:
+		b, ok := b.(*MacroLiteral)
+		return ok && identifiersEqual(a.Parameters, b.Parameters) && blockEqual(a.Body, b.Body)
+
+	case *MatchExpression:
+		b, ok := b.(*MatchExpression)
+		if !ok || !Equal(a.Subject, b.Subject) || len(a.Arms) != len(b.Arms) {
+			return false
+		}
+		for i := range a.Arms {
+			if !matchArmEqual(a.Arms[i], b.Arms[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *SymbolLiteral:
+		b, ok := b.(*SymbolLiteral)
+		return ok && a.Value == b.Value
+	}
+
+	return false
+}
+
+// 省略できるフィールドは型付きのnilになるので、Nodeに変換する前にnilかどうかを比べる
+func identifierEqual(a, b *Identifier) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Value == b.Value
+}
+
+func blockEqual(a, b *BlockStatement) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return statementsEqual(a.Statements, b.Statements)
+}
+
+func callEqual(a, b *CallExpression) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return Equal(a.Function, b.Function) && expressionsEqual(a.Arguments, b.Arguments)
+}
+
+func matchArmEqual(a, b *MatchArm) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return Equal(a.Pattern, b.Pattern) && Equal(a.Guard, b.Guard) && Equal(a.Body, b.Body)
+}
+
+func identifiersEqual(a, b []*Identifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !identifierEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func statementsEqual(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func expressionsEqual(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ハッシュリテラルのキーはポインタなので、同じ構造のキーを持つ組を探して対応付ける
+func pairsEqual(a, b map[Expression]Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	used := map[Expression]bool{}
+	for aKey, aVal := range a {
+		found := false
+		for bKey, bVal := range b {
+			if !used[bKey] && Equal(aKey, bKey) && Equal(aVal, bVal) {
+				used[bKey] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"errors"
+	"gomadoufu/monkey-interpreter-go/token"
+	"sort"
+)
+
+// 命令のオフセットから、その命令を出力したソース上の位置を引くための表
+type SourceMap struct {
+	entries []sourceMapEntry
+}
+
+// Offset以降、次のエントリまでの命令はすべてPosから出力されたもの
+type sourceMapEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// 直前のエントリと同じ位置なら追加しない。同じ位置から続けて出力された命令はひとつのエントリにまとまる
+func (sm *SourceMap) add(offset int, pos token.Position) {
+	if !pos.IsValid() {
+		return
+	}
+	if n := len(sm.entries); n > 0 && sm.entries[n-1].Pos == pos {
+		return
+	}
+	sm.entries = append(sm.entries, sourceMapEntry{Offset: offset, Pos: pos})
+}
+
+// 命令を取り除いたときに、offset以降のエントリを捨てる
+func (sm *SourceMap) truncate(offset int) {
+	i := sort.Search(len(sm.entries), func(i int) bool {
+		return sm.entries[i].Offset >= offset
+	})
+	sm.entries = sm.entries[:i]
+}
+
+// offsetの命令に対応するソース上の位置。分からなければゼロ値を返す
+func (sm *SourceMap) Lookup(offset int) token.Position {
+	if sm == nil {
+		return token.Position{}
+	}
+	i := sort.Search(len(sm.entries), func(i int) bool {
+		return sm.entries[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return sm.entries[i-1].Pos
+}
+
+// バイトコードと一緒に保存するための形式にする
+// 先頭にファイル名を置き、続けて各エントリを直前のエントリとの差分(オフセット、行、列)の可変長整数で並べる
+func (sm *SourceMap) MarshalBinary() ([]byte, error) {
+	var file string
+	if len(sm.entries) > 0 {
+		file = sm.entries[0].Pos.File
+	}
+
+	buf := binary.AppendUvarint(nil, uint64(len(file)))
+	buf = append(buf, file...)
+	buf = binary.AppendUvarint(buf, uint64(len(sm.entries)))
+
+	var prev sourceMapEntry
+	for _, e := range sm.entries {
+		if e.Pos.File != file {
+			return nil, errors.New("source map spans multiple files")
+		}
+		buf = binary.AppendUvarint(buf, uint64(e.Offset-prev.Offset))
+		buf = binary.AppendVarint(buf, int64(e.Pos.Line-prev.Pos.Line))
+		buf = binary.AppendVarint(buf, int64(e.Pos.Column-prev.Pos.Column))
+		prev = e
+	}
+	return buf, nil
+}
+
+// MarshalBinaryで作った形式から読み戻す
+func (sm *SourceMap) UnmarshalBinary(data []byte) error {
+	r := sourceMapReader{data: data}
+
+	fileLen := r.uvarint()
+	if r.err == nil && fileLen > uint64(len(r.data)) {
+		r.err = errSourceMapTruncated
+	}
+	if r.err != nil {
+		return r.err
+	}
+	file := string(r.data[:fileLen])
+	r.data = r.data[fileLen:]
+
+	count := r.uvarint()
+	if r.err == nil && count > uint64(len(r.data)) {
+		r.err = errSourceMapTruncated
+	}
+
+	var entries []sourceMapEntry
+	var prev sourceMapEntry
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		e := sourceMapEntry{
+			Offset: prev.Offset + int(r.uvarint()),
+			Pos: token.Position{
+				File:   file,
+				Line:   prev.Pos.Line + int(r.varint()),
+				Column: prev.Pos.Column + int(r.varint()),
+			},
+		}
+		entries = append(entries, e)
+		prev = e
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return errors.New("source map has trailing data")
+	}
+
+	sm.entries = entries
+	return nil
+}
+
+var errSourceMapTruncated = errors.New("source map is truncated")
+
+// 最初に起きたエラーを覚えておき、以降の読み出しはゼロを返す
+type sourceMapReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sourceMapReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errSourceMapTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *sourceMapReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errSourceMapTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
@@ -0,0 +1,108 @@
+package compiler
+
+import (
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/token"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	input := `1;
+let x = 2 +
+  3;
+fn(a) {
+  a
+};
+if (true) { 4 };`
+
+	l := lexer.NewWithFile(input, "main.mnk")
+	program := parser.New(l).ParseProgram()
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	tests := []struct {
+		offset       int
+		expectedLine int
+		expectedCol  int
+	}{
+		{-1, 0, 0},
+		{0, 1, 1},  // OpConstant 0
+		{3, 1, 1},  // OpPop
+		{4, 2, 9},  // OpConstant 1
+		{7, 3, 3},  // OpConstant 2
+		{10, 2, 9}, // OpAdd
+		{11, 2, 1}, // OpSetGlobal
+		{14, 4, 1}, // OpClosure
+		{18, 4, 1}, // OpPop
+		{19, 7, 5}, // OpTrue
+		{20, 7, 1}, // OpJumpNotTruthy
+		{23, 7, 13},
+	}
+
+	for _, tt := range tests {
+		pos := bytecode.SourceMap.Lookup(tt.offset)
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedCol {
+			t.Errorf("offset %d: wrong position. want=%d:%d, got=%d:%d",
+				tt.offset, tt.expectedLine, tt.expectedCol, pos.Line, pos.Column)
+		}
+		if tt.expectedLine != 0 && pos.File != "main.mnk" {
+			t.Errorf("offset %d: wrong file. got=%q", tt.offset, pos.File)
+		}
+	}
+
+	// if式の中の式文から取り除いたOpPopの分は残らない
+	for _, e := range bytecode.SourceMap.entries {
+		if e.Offset >= len(bytecode.Instructions) {
+			t.Errorf("entry beyond instructions: %+v", e)
+		}
+	}
+
+	fnMap, ok := bytecode.FunctionSourceMaps[3]
+	if !ok {
+		t.Fatalf("no source map for function. got=%v", bytecode.FunctionSourceMaps)
+	}
+	if pos := fnMap.Lookup(2); pos.Line != 5 || pos.Column != 3 {
+		t.Errorf("wrong position in function. got=%s", pos)
+	}
+}
+
+func TestSourceMapEncoding(t *testing.T) {
+	sm := &SourceMap{}
+	sm.add(0, token.Position{File: "main.mnk", Line: 3, Column: 5})
+	sm.add(3, token.Position{File: "main.mnk", Line: 3, Column: 5})
+	sm.add(4, token.Position{File: "main.mnk", Line: 1, Column: 1})
+	sm.add(300, token.Position{File: "main.mnk", Line: 120, Column: 14})
+
+	if len(sm.entries) != 3 {
+		t.Fatalf("runs with the same position should be merged. got=%d entries", len(sm.entries))
+	}
+
+	data, err := sm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	decoded := &SourceMap{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+	for _, offset := range []int{0, 3, 4, 299, 300, 1000} {
+		if decoded.Lookup(offset) != sm.Lookup(offset) {
+			t.Errorf("offset %d: want=%s, got=%s", offset, sm.Lookup(offset), decoded.Lookup(offset))
+		}
+	}
+
+	for i := 0; i < len(data); i++ {
+		if err := (&SourceMap{}).UnmarshalBinary(data[:i]); err == nil {
+			t.Errorf("expected error for data truncated at %d", i)
+		}
+	}
+	if err := (&SourceMap{}).UnmarshalBinary(append(data, 0)); err == nil {
+		t.Errorf("expected error for trailing data")
+	}
+}
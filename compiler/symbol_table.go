@@ -0,0 +1,106 @@
+package compiler
+
+// シンボルのスコープ
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	// 組み込み関数。Indexはobject.Builtinsでの位置
+	BuiltinScope SymbolScope = "BUILTIN"
+	// 外側の関数のローカル変数を捕捉したもの(自由変数)
+	FreeScope SymbolScope = "FREE"
+	// 関数リテラル自身を指す名前(let f = fn() { f() } の f)
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// 識別子に紐づく情報。Indexはスコープごとに0から振られる
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// 識別子をスコープとインデックスに解決するための表
+// 関数本体をコンパイルするたびに、外側の表を指す新しい表を作る
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// この関数が捕捉する、外側のスコープでの元のシンボル
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+// 関数本体用の入れ子の表を作る
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// 識別子を定義する。最も外側の表ならグローバル、そうでなければローカルになる
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// 識別子を解決する。見つからなければ外側の表を探す
+// 外側の関数のローカル変数(または自由変数)だった場合は、この関数の自由変数として登録し直す
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
+
+// 捕捉した変数を自由変数として定義する。Indexは自由変数の並びの中での位置
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// 関数リテラルに束縛される名前を定義する。ローカル変数のスロットは消費しない
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// 組み込み関数を定義する。numDefinitionsは増やさない
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
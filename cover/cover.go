@@ -0,0 +1,254 @@
+// Monkeyスクリプトのカバレッジを集計し、レポートを書き出す
+// 評価器がEvalOptions.Coverageに記録した位置と、プログラム中の文と式の位置を突き合わせる
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 1つの位置の計測結果。同じ位置から始まる文と式はまとめて1つに数える
+type Entry struct {
+	Pos token.Position
+	Hit bool
+}
+
+type Profile struct {
+	Entries []Entry
+	lines   []string
+}
+
+// programの文と式の位置ごとに、hitsに記録されているかを調べる
+// srcはレポートに抜粋を載せるための元のソースコード
+func New(program *ast.Program, src string, hits map[token.Position]bool) *Profile {
+	positions := map[token.Position]bool{}
+	collect(program, positions)
+
+	p := &Profile{lines: strings.Split(strings.TrimSuffix(src, "\n"), "\n")}
+	for pos := range positions {
+		p.Entries = append(p.Entries, Entry{Pos: pos, Hit: hits[pos]})
+	}
+	sort.Slice(p.Entries, func(i, j int) bool {
+		a, b := p.Entries[i].Pos, p.Entries[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return p
+}
+
+// 評価された位置の数
+func (p *Profile) Covered() int {
+	n := 0
+	for _, e := range p.Entries {
+		if e.Hit {
+			n++
+		}
+	}
+	return n
+}
+
+// 評価された位置の割合(%)。計測する位置がなければ100を返す
+func (p *Profile) Percent() float64 {
+	if len(p.Entries) == 0 {
+		return 100
+	}
+	return float64(p.Covered()) * 100 / float64(len(p.Entries))
+}
+
+// 位置ごとに ファイル名:行:列、hit/miss、その行の抜粋を1行ずつ書き、最後に割合を書く
+func (p *Profile) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range p.Entries {
+		status := "miss"
+		if e.Hit {
+			status = "hit"
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", e.Pos, status, p.excerpt(e.Pos))
+	}
+	fmt.Fprintf(bw, "coverage: %.1f%% of statements and expressions (%d/%d)\n",
+		p.Percent(), p.Covered(), len(p.Entries))
+	return bw.Flush()
+}
+
+// ソースコードの各行の先頭に印を付けて書く
+// 行内の位置がすべて評価されていれば"+"、1つでも評価されていなければ"-"、位置がなければ空白
+func (p *Profile) WriteAnnotated(w io.Writer) error {
+	marks := map[int]string{}
+	for _, e := range p.Entries {
+		if !e.Hit {
+			marks[e.Pos.Line] = "-"
+		} else if marks[e.Pos.Line] == "" {
+			marks[e.Pos.Line] = "+"
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, line := range p.lines {
+		mark := marks[i+1]
+		if mark == "" {
+			mark = " "
+		}
+		fmt.Fprintf(bw, "%s %4d  %s\n", mark, i+1, line)
+	}
+	return bw.Flush()
+}
+
+func (p *Profile) excerpt(pos token.Position) string {
+	if pos.Line < 1 || pos.Line > len(p.lines) {
+		return ""
+	}
+	line := p.lines[pos.Line-1]
+	if pos.Column-1 < len(line) {
+		line = line[pos.Column-1:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// 評価器が評価する文と式の位置を集める
+// 変数名や引数名、matchのパターンのように評価されずに束縛に使われるノードは数えない
+func collect(node ast.Node, positions map[token.Position]bool) {
+	add := func(n ast.Node) {
+		if n.Pos().IsValid() {
+			positions[n.Pos()] = true
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			collect(s, positions)
+		}
+		return
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			collect(s, positions)
+		}
+	case *ast.ExpressionStatement:
+		collect(node.Expression, positions)
+	case *ast.LetStatement:
+		collect(node.Value, positions)
+	case *ast.LetExpression:
+		collect(node.Binding, positions)
+		collect(node.Body, positions)
+	case *ast.ReturnStatement:
+		if node.ReturnValue != nil {
+			collect(node.ReturnValue, positions)
+		}
+	case *ast.ThrowStatement:
+		collect(node.Value, positions)
+	case *ast.DeferStatement:
+		// defer文は呼び出し式そのものではなく、関数と引数を評価する
+		add(node)
+		collect(node.Call.Function, positions)
+		for _, a := range node.Call.Arguments {
+			collect(a, positions)
+		}
+		return
+	case *ast.WhileStatement:
+		collect(node.Condition, positions)
+		collect(node.Body, positions)
+	case *ast.ForStatement:
+		if node.Init != nil {
+			collect(node.Init, positions)
+		}
+		if node.Condition != nil {
+			collect(node.Condition, positions)
+		}
+		if node.Post != nil {
+			collect(node.Post, positions)
+		}
+		collect(node.Body, positions)
+	case *ast.DoWhileStatement:
+		collect(node.Body, positions)
+		collect(node.Condition, positions)
+	case *ast.RepeatStatement:
+		collect(node.Count, positions)
+		collect(node.Body, positions)
+	case *ast.TryCatchStatement:
+		collect(node.Body, positions)
+		if node.Handler != nil {
+			collect(node.Handler, positions)
+		}
+		if node.Finally != nil {
+			collect(node.Finally, positions)
+		}
+	case *ast.ForInStatement:
+		collect(node.Iterable, positions)
+		collect(node.Body, positions)
+	case *ast.LabeledStatement:
+		collect(node.Statement, positions)
+	case *ast.YieldExpression:
+		if node.Value != nil {
+			collect(node.Value, positions)
+		}
+	case *ast.PrefixExpression:
+		collect(node.Right, positions)
+	case *ast.InfixExpression:
+		collect(node.Left, positions)
+		collect(node.Right, positions)
+	case *ast.IfExpression:
+		collect(node.Condition, positions)
+		collect(node.Consequence, positions)
+		if node.Alternative != nil {
+			collect(node.Alternative, positions)
+		}
+	case *ast.FunctionLiteral:
+		collect(node.Body, positions)
+	case *ast.CallExpression:
+		collect(node.Function, positions)
+		// quoteの引数は評価されない
+		if node.Function.TokenLiteral() != "quote" {
+			for _, a := range node.Arguments {
+				collect(a, positions)
+			}
+		}
+	case *ast.MethodCallExpression:
+		collect(node.Object, positions)
+		for _, a := range node.Arguments {
+			collect(a, positions)
+		}
+	case *ast.TupleLiteral:
+		for _, e := range node.Elements {
+			collect(e, positions)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			collect(e, positions)
+		}
+	case *ast.HashLiteral:
+		for k, v := range node.Pairs {
+			collect(k, positions)
+			collect(v, positions)
+		}
+	case *ast.IndexExpression:
+		collect(node.Left, positions)
+		collect(node.Index, positions)
+	case *ast.SliceExpression:
+		collect(node.Left, positions)
+		if node.Low != nil {
+			collect(node.Low, positions)
+		}
+		if node.High != nil {
+			collect(node.High, positions)
+		}
+	case *ast.AssignExpression:
+		collect(node.Value, positions)
+	case *ast.MatchExpression:
+		collect(node.Subject, positions)
+		for _, arm := range node.Arms {
+			if arm.Guard != nil {
+				collect(arm.Guard, positions)
+			}
+			collect(arm.Body, positions)
+		}
+	}
+
+	add(node)
+}
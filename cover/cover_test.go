@@ -0,0 +1,134 @@
+package cover
+
+import (
+	"bytes"
+	"gomadoufu/monkey-interpreter-go/evaluator"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/token"
+	"strings"
+	"testing"
+)
+
+func TestDeadBranchIsUncovered(t *testing.T) {
+	src := `let f = fn(x) {
+  if (x > 0) {
+    "pos"
+  } else {
+    "neg"
+  }
+};
+f(1);`
+	profile := run(t, src)
+
+	tests := []struct {
+		pos      token.Position
+		expected bool
+	}{
+		{token.Position{File: "test.monkey", Line: 1, Column: 1}, true},   // let f = ...
+		{token.Position{File: "test.monkey", Line: 2, Column: 3}, true},   // if
+		{token.Position{File: "test.monkey", Line: 2, Column: 7}, true},   // x > 0
+		{token.Position{File: "test.monkey", Line: 3, Column: 5}, true},   // "pos"
+		{token.Position{File: "test.monkey", Line: 4, Column: 10}, false}, // elseのブロック
+		{token.Position{File: "test.monkey", Line: 5, Column: 5}, false},  // "neg"
+		{token.Position{File: "test.monkey", Line: 8, Column: 1}, true},   // f(1)
+	}
+
+	for _, tt := range tests {
+		entry, ok := findEntry(profile, tt.pos)
+		if !ok {
+			t.Errorf("no entry at %s", tt.pos)
+			continue
+		}
+		if entry.Hit != tt.expected {
+			t.Errorf("wrong hit at %s. want=%t, got=%t", tt.pos, tt.expected, entry.Hit)
+		}
+	}
+
+	if profile.Covered() != len(profile.Entries)-2 {
+		t.Errorf("wrong covered count. got=%d of %d", profile.Covered(), len(profile.Entries))
+	}
+}
+
+func TestUncalledFunctionAndLoops(t *testing.T) {
+	src := `let unused = fn() { 1 };
+let i = 0;
+while (i < 3) { i += 1; }
+for (x in []) { x }`
+	profile := run(t, src)
+
+	tests := []struct {
+		pos      token.Position
+		expected bool
+	}{
+		{token.Position{File: "test.monkey", Line: 1, Column: 14}, true},  // fn() { 1 } 自体は評価される
+		{token.Position{File: "test.monkey", Line: 1, Column: 21}, false}, // 本体の 1 は呼ばれていない
+		{token.Position{File: "test.monkey", Line: 3, Column: 17}, true},  // i += 1
+		{token.Position{File: "test.monkey", Line: 4, Column: 17}, false}, // 空配列なので本体は評価されない
+	}
+
+	for _, tt := range tests {
+		entry, ok := findEntry(profile, tt.pos)
+		if !ok {
+			t.Errorf("no entry at %s", tt.pos)
+			continue
+		}
+		if entry.Hit != tt.expected {
+			t.Errorf("wrong hit at %s. want=%t, got=%t", tt.pos, tt.expected, entry.Hit)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	profile := run(t, "if (false) {\n  1\n}")
+
+	var out bytes.Buffer
+	if err := profile.WriteReport(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"test.monkey:1:1\thit\tif (false) {",
+		"test.monkey:1:5\thit\tfalse) {",
+		"test.monkey:1:12\tmiss\t{",
+		"test.monkey:2:3\tmiss\t1",
+		"coverage: 50.0% of statements and expressions (2/4)",
+	}
+	if got := strings.TrimSuffix(out.String(), "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong report.\nwant=%q\ngot=%q", strings.Join(expected, "\n"), got)
+	}
+
+	out.Reset()
+	if err := profile.WriteAnnotated(&out); err != nil {
+		t.Fatal(err)
+	}
+	annotated := "-    1  if (false) {\n-    2    1\n     3  }\n"
+	if out.String() != annotated {
+		t.Errorf("wrong annotation.\nwant=%q\ngot=%q", annotated, out.String())
+	}
+}
+
+func run(t *testing.T, src string) *Profile {
+	t.Helper()
+
+	p := parser.New(lexer.NewWithFile(src, "test.monkey"))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	hits := map[token.Position]bool{}
+	e := evaluator.NewWithOptions(evaluator.EvalOptions{Coverage: hits})
+	e.Eval(program, object.NewEnvironment())
+	return New(program, src, hits)
+}
+
+func findEntry(profile *Profile, pos token.Position) (Entry, bool) {
+	for _, e := range profile.Entries {
+		if e.Pos == pos {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
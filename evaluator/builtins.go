@@ -2,96 +2,1004 @@ package evaluator
 
 import (
 	"fmt"
+	"gomadoufu/monkey-interpreter-go/lexer"
 	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// 計算だけを行う組み込み関数。サンドボックスでも使える
 var builtins = map[string]*object.Builtin{
-	"len": {
+	"len":    object.GetBuiltinByName("len"),
+	"first":  object.GetBuiltinByName("first"),
+	"last":   object.GetBuiltinByName("last"),
+	"rest":   object.GetBuiltinByName("rest"),
+	"push":   object.GetBuiltinByName("push"),
+	"type":   object.GetBuiltinByName("type"),
+	"str":    object.GetBuiltinByName("str"),
+	"to_s":   object.GetBuiltinByName("to_s"),
+	"copy":   object.GetBuiltinByName("copy"),
+	"int":    object.GetBuiltinByName("int"),
+	"float":  object.GetBuiltinByName("float"),
+	"bigint": object.GetBuiltinByName("bigint"),
+	"sort":   object.GetBuiltinByName("sort"),
+	"min":    object.GetBuiltinByName("min"),
+	"max":    object.GetBuiltinByName("max"),
+
+	"cursor":       object.GetBuiltinByName("cursor"),
+	"cursor_next":  object.GetBuiltinByName("cursor_next"),
+	"cursor_peek":  object.GetBuiltinByName("cursor_peek"),
+	"cursor_reset": object.GetBuiltinByName("cursor_reset"),
+
+	"keys":  object.GetBuiltinByName("keys"),
+	"merge": object.GetBuiltinByName("merge"),
+	"range": object.GetBuiltinByName("range"),
+	"mixin": object.GetBuiltinByName("mixin"),
+
+	"record":        object.GetBuiltinByName("record"),
+	"record_update": object.GetBuiltinByName("record_update"),
+
+	// 時計は評価器がEvalOptions.ClockFuncで差し替える
+	"clock": object.GetBuiltinByName("clock"),
+	"time":  object.GetBuiltinByName("time"),
+	"sleep": object.GetBuiltinByName("sleep"),
+
+	// 送受信は評価器がタイムアウトで止められるようにする
+	"chan":       object.GetBuiltinByName("chan"),
+	"chan_send":  object.GetBuiltinByName("chan_send"),
+	"chan_recv":  object.GetBuiltinByName("chan_recv"),
+	"chan_close": object.GetBuiltinByName("chan_close"),
+
+	// 関数を受け取る組み込み関数は、評価器が関数を呼び出す
+	"map":         mapBuiltin,
+	"filter":      filterBuiltin,
+	"count":       countBuiltin,
+	"partition":   partitionBuiltin,
+	"map_values":  mapValuesBuiltin,
+	"filter_keys": filterKeysBuiltin,
+	"times":       timesBuiltin,
+	"upto":        uptoBuiltin,
+	"downto":      downtoBuiltin,
+	"partial":     partialBuiltin,
+	"curry":       curryBuiltin,
+	"memoize": {
+		Name: "memoize",
+		Doc:  "memoize(fn) — returns a function that remembers its result for each list of hashable arguments",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
-			switch arg := args[0].(type) {
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+			if !isCallable(args[0]) {
+				return newError("argument to `memoize` must be a function, got %s", args[0].Type())
 			}
+			return &object.Memoized{Fn: args[0], Cache: &object.Hash{}}
 		},
 	},
-	"first": {
+	"once": {
+		Name: "once",
+		Doc:  "once(fn) — returns a function that calls fn the first time and returns that first result on every later call",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			if !isCallable(args[0]) {
+				return newError("argument to `once` must be a function, got %s", args[0].Type())
 			}
-			arr := args[0].(*object.Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-			return NULL
+			return &object.Once{Fn: args[0]}
 		},
 	},
-	"last": {
+	"assert": {
+		Name: "assert",
+		Doc:  "assert(cond) or assert(cond, message) — returns null if cond is truthy and fails with message (default \"assertion failed\") otherwise",
+		Fn:   assertFunc("assert"),
+	},
+	"assert_eq": {
+		Name: "assert_eq",
+		Doc:  "assert_eq(a, b) or assert_eq(a, b, message) — fails unless a equals b; arrays, tuples and hashes are compared element by element",
+		Fn:   assertFunc("assert_eq"),
+	},
+	"assert_ne": {
+		Name: "assert_ne",
+		Doc:  "assert_ne(a, b) or assert_ne(a, b, message) — fails if a equals b; arrays, tuples and hashes are compared element by element",
+		Fn:   assertFunc("assert_ne"),
+	},
+	"get_cache": {
+		Name: "get_cache",
+		Doc:  "get_cache(fn) — returns a copy of the results a memoized function remembers, keyed by argument tuples",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			m, ok := args[0].(*object.Memoized)
+			if !ok {
+				return newError("argument to `get_cache` must be MEMOIZED, got %s", args[0].Type())
 			}
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length-1]
+			return m.Cache.Copy()
+		},
+	},
+	"compose": {
+		Name: "compose",
+		Doc:  "compose(f, g, ...) — returns a function that applies the functions from right to left: compose(f, g)(x) is f(g(x))",
+		Fn: func(args ...object.Object) object.Object {
+			fns := make([]object.Object, len(args))
+			for i, arg := range args {
+				fns[len(args)-1-i] = arg
 			}
-			return NULL
+			return composeFunctions("compose", fns)
+		},
+	},
+	"pipe": {
+		Name: "pipe",
+		Doc:  "pipe(f, g, ...) — returns a function that applies the functions from left to right: pipe(f, g)(x) is g(f(x))",
+		Fn: func(args ...object.Object) object.Object {
+			return composeFunctions("pipe", append([]object.Object{}, args...))
 		},
 	},
-	"rest": {
+
+	"sprintf":        object.GetBuiltinByName("sprintf"),
+	"scan":           object.GetBuiltinByName("scan"),
+	"uuid_parse":     object.GetBuiltinByName("uuid_parse"),
+	"json_parse":     object.GetBuiltinByName("json_parse"),
+	"json_stringify": object.GetBuiltinByName("json_stringify"),
+
+	"base64_encode":     object.GetBuiltinByName("base64_encode"),
+	"base64_decode":     object.GetBuiltinByName("base64_decode"),
+	"base64_url_encode": object.GetBuiltinByName("base64_url_encode"),
+	"base64_url_decode": object.GetBuiltinByName("base64_url_decode"),
+
+	"sha256":       object.GetBuiltinByName("sha256"),
+	"sha256_bytes": object.GetBuiltinByName("sha256_bytes"),
+	"md5":          object.GetBuiltinByName("md5"),
+
+	"url_encode":       object.GetBuiltinByName("url_encode"),
+	"url_decode":       object.GetBuiltinByName("url_decode"),
+	"url_query_encode": object.GetBuiltinByName("url_query_encode"),
+	"url_query_decode": object.GetBuiltinByName("url_query_decode"),
+
+	"regexp_match":    object.GetBuiltinByName("regexp_match"),
+	"regexp_find":     object.GetBuiltinByName("regexp_find"),
+	"regexp_find_all": object.GetBuiltinByName("regexp_find_all"),
+	"regexp_replace":  object.GetBuiltinByName("regexp_replace"),
+	"regexp":          object.GetBuiltinByName("regexp"),
+
+	"chars":      object.GetBuiltinByName("chars"),
+	"bytes":      object.GetBuiltinByName("bytes"),
+	"codepoints": object.GetBuiltinByName("codepoints"),
+	"format":     object.GetBuiltinByName("format"),
+	"split":      object.GetBuiltinByName("split"),
+	"pad_left":   object.GetBuiltinByName("pad_left"),
+	"pad_right":  object.GetBuiltinByName("pad_right"),
+	"center":     object.GetBuiltinByName("center"),
+	"to_char":    object.GetBuiltinByName("to_char"),
+	"to_int":     object.GetBuiltinByName("to_int"),
+
+	"zip":     object.GetBuiltinByName("zip"),
+	"flatten": object.GetBuiltinByName("flatten"),
+	"uniq":    object.GetBuiltinByName("uniq"),
+	"chunk":   object.GetBuiltinByName("chunk"),
+
+	"set_field": object.GetBuiltinByName("set_field"),
+	"self":      object.GetBuiltinByName("self"),
+
+	"set":              object.GetBuiltinByName("set"),
+	"set_add":          object.GetBuiltinByName("set_add"),
+	"set_remove":       object.GetBuiltinByName("set_remove"),
+	"set_has":          object.GetBuiltinByName("set_has"),
+	"set_union":        object.GetBuiltinByName("set_union"),
+	"set_intersection": object.GetBuiltinByName("set_intersection"),
+	"set_difference":   object.GetBuiltinByName("set_difference"),
+
+	// パニックは評価器だけが扱う
+	"panic": {
+		Name: "panic",
+		Doc:  "panic(val) — stops the current function and unwinds the call stack until a deferred recover() catches val",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]object.Object, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
-			}
-			return NULL
+			return &object.Panic{Value: args[0]}
 		},
 	},
-	"push": {
+	"recover": recoverBuiltin,
+	// エラーは値として持てないので、Errorの結果はそのまま外側に伝わる
+	"Error": {
+		Name: "Error",
+		Doc:  "Error(message) — raises an error with the String message, like throw message; written as throw Error(message)",
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			newElements := make([]object.Object, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-			return &object.Array{Elements: newElements}
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			msg, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `Error` must be STRING, got %s", args[0].Type())
+			}
+			return &object.Error{Message: msg.Value}
 		},
 	},
-	"puts": {
+	// ジェネレータも評価器だけが扱う
+	"next": {
+		Name: "next",
+		Doc:  "next(gen) — resumes a generator and returns the next yielded value, or null when it is exhausted",
 		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			gen, ok := args[0].(*object.Generator)
+			if !ok {
+				return newError("argument to `next` must be GENERATOR, got %s", args[0].Type())
 			}
-			return NULL
+			val, ok := gen.Next()
+			if !ok {
+				return NULL
+			}
+			return val
 		},
 	},
 }
+
+// 入出力など外部に触れる組み込み関数。サンドボックスでは使えない
+var unsafeBuiltins = map[string]*object.Builtin{
+	"puts":     object.GetBuiltinByName("puts"),
+	"println":  object.GetBuiltinByName("println"),
+	"eprint":   object.GetBuiltinByName("eprint"),
+	"eprintln": object.GetBuiltinByName("eprintln"),
+	"printf":   object.GetBuiltinByName("printf"),
+	"readline": object.GetBuiltinByName("readline"),
+	"eval":     evalBuiltin,
+
+	"file_read":   object.GetBuiltinByName("file_read"),
+	"file_write":  object.GetBuiltinByName("file_write"),
+	"file_append": object.GetBuiltinByName("file_append"),
+	"file_exists": object.GetBuiltinByName("file_exists"),
+
+	"env_save": envSaveBuiltin,
+	"env_load": envLoadBuiltin,
+
+	"os_args": object.GetBuiltinByName("os_args"),
+	"os_env":  object.GetBuiltinByName("os_env"),
+	"exit":    object.GetBuiltinByName("exit"),
+
+	// OSの乱数源を読むので、サンドボックスでは使えない
+	"uuid": object.GetBuiltinByName("uuid"),
+
+	// 起動した関数には命令数の制限が引き継がれないので、サンドボックスでは使えない
+	"go": goBuiltin,
+}
+
+// 結果が再現できないので、サンドボックスではEvalOptions.AllowRandomのときだけ使える
+var randomBuiltins = map[string]*object.Builtin{
+	"random_seed":   object.GetBuiltinByName("random_seed"),
+	"random_int":    object.GetBuiltinByName("random_int"),
+	"random_float":  object.GetBuiltinByName("random_float"),
+	"random_choice": object.GetBuiltinByName("random_choice"),
+}
+
+// recoverとevalは呼び出し元の環境が必要なので、実際の処理はapplyEnvBuiltinで行う
+// ここのFnは環境を渡せない場面(deferした呼び出しなど)での結果を返すだけ
+var recoverBuiltin = &object.Builtin{
+	Name: "recover",
+	Doc:  "recover() — inside a deferred function, stops a panic and returns its value; otherwise returns null",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return NULL
+	},
+}
+
+var evalBuiltin = &object.Builtin{
+	Name: "eval",
+	Doc:  "eval(src) — parses and evaluates the String src in the caller's environment and returns the result",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("eval must be called directly")
+	},
+}
+
+var envSaveBuiltin = &object.Builtin{
+	Name: "env_save",
+	Doc:  "env_save(path) — writes the caller's integer, boolean, string, array and hash bindings to path as JSON and returns how many were saved; other bindings are skipped with a warning",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("env_save must be called directly")
+	},
+}
+
+var envLoadBuiltin = &object.Builtin{
+	Name: "env_load",
+	Doc:  "env_load(path) — binds the names saved by env_save in the caller's environment and returns how many were restored",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("env_load must be called directly")
+	},
+}
+
+// 呼び出し元の環境が必要な組み込み関数を呼び出す。該当しなければfalseを返す
+func (e *Evaluator) applyEnvBuiltin(builtin *object.Builtin, args []object.Object, env *object.Environment) (object.Object, bool) {
+	switch builtin {
+	case recoverBuiltin:
+		if len(args) != 0 {
+			return nil, false
+		}
+		// recover()は呼び出した関数の環境からパニックを探す
+		if recovered := env.Recover(); recovered != nil {
+			return recovered, true
+		}
+		return NULL, true
+
+	case evalBuiltin:
+		return e.evalString(args, env), true
+
+	case envSaveBuiltin, envLoadBuiltin:
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args)), true
+		}
+		path, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `%s` must be STRING, got %s", builtin.Name, args[0].Type()), true
+		}
+		if builtin == envSaveBuiltin {
+			return object.SaveEnvironment(env, path.Value, e.stderr()), true
+		}
+		return object.LoadEnvironment(env, path.Value), true
+	}
+	return nil, false
+}
+
+// 実際の処理はapplyCallbackBuiltinで行う
+var mapBuiltin = &object.Builtin{
+	Name: "map",
+	Doc:  "map(arr, fn) — returns a new Array with fn applied to each element of arr",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("map must be called by the evaluator")
+	},
+}
+
+var filterBuiltin = &object.Builtin{
+	Name: "filter",
+	Doc:  "filter(arr, fn) — returns a new Array with the elements of arr for which fn returns a truthy value",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("filter must be called by the evaluator")
+	},
+}
+
+var mapValuesBuiltin = &object.Builtin{
+	Name: "map_values",
+	Doc:  "map_values(hash, fn) — returns a new Hash with the same keys as hash and fn applied to each value",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("map_values must be called by the evaluator")
+	},
+}
+
+var filterKeysBuiltin = &object.Builtin{
+	Name: "filter_keys",
+	Doc:  "filter_keys(hash, fn) — returns a new Hash with the pairs of hash whose key fn returns a truthy value for",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("filter_keys must be called by the evaluator")
+	},
+}
+
+var partitionBuiltin = &object.Builtin{
+	Name: "partition",
+	Doc:  "partition(arr, fn) — returns [matching, rest]: the elements of arr for which fn returns a truthy value, then the others",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("partition must be called by the evaluator")
+	},
+}
+
+var countBuiltin = &object.Builtin{
+	Name: "count",
+	Doc:  "count(arr), count(arr, val) or count(arr, fn) — returns the length of arr, how many elements equal val (compared like uniq), or for how many elements fn returns a truthy value",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("count must be called by the evaluator")
+	},
+}
+
+var timesBuiltin = &object.Builtin{
+	Name: "times",
+	Doc:  "times(n, fn) or n.times(fn) — calls fn(0), fn(1), ..., fn(n-1) and returns null; does nothing when n is not positive",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("times must be called by the evaluator")
+	},
+}
+
+var uptoBuiltin = &object.Builtin{
+	Name: "upto",
+	Doc:  "upto(n, m, fn) or n.upto(m, fn) — calls fn(n), fn(n+1), ..., fn(m) and returns null; does nothing when n > m",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("upto must be called by the evaluator")
+	},
+}
+
+var downtoBuiltin = &object.Builtin{
+	Name: "downto",
+	Doc:  "downto(n, m, fn) or n.downto(m, fn) — calls fn(n), fn(n-1), ..., fn(m) and returns null; does nothing when n < m",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("downto must be called by the evaluator")
+	},
+}
+
+var curryBuiltin = &object.Builtin{
+	Name: "curry",
+	Doc:  "curry(fn) or curry(builtin, arity) — returns a function that collects arguments over one or more calls and calls fn once it has all of them",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("curry must be called by the evaluator")
+	},
+}
+
+// 呼び出す順に並べた関数をつなぐ。引数を1つ受け取る関数でなければならない
+func composeFunctions(name string, fns []object.Object) object.Object {
+	if len(fns) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+	for _, fn := range fns {
+		if !isCallable(fn) {
+			return newError("argument to `%s` must be a function, got %s", name, fn.Type())
+		}
+		if f, ok := fn.(*object.Function); ok && len(f.Parameters) != 1 {
+			return newError("functions passed to `%s` must take one argument, got %d", name, len(f.Parameters))
+		}
+	}
+	return &object.Composed{Fns: fns}
+}
+
+// applyFunctionで呼び出せる値ならtrueを返す
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin, *object.PartiallyApplied,
+		*object.Curried, *object.Composed, *object.Memoized, *object.Once:
+		return true
+	}
+	return false
+}
+
+var partialBuiltin = &object.Builtin{
+	Name: "partial",
+	Doc:  "partial(fn, args...) — returns a function that calls fn with args followed by the arguments it is called with",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) < 1 {
+			return newError("wrong number of arguments. got=%d, want=at least 1", len(args))
+		}
+		fn, bound := args[0], append([]object.Object{}, args[1:]...)
+		// 入れ子にせず、束縛した引数をつなげる
+		if inner, ok := fn.(*object.PartiallyApplied); ok {
+			fn, bound = inner.Fn, append(append([]object.Object{}, inner.Args...), bound...)
+		}
+
+		switch fn := fn.(type) {
+		case *object.Function:
+			if len(bound) > len(fn.Parameters) {
+				return newError("partial: too many arguments: want at most %d, got=%d", len(fn.Parameters), len(bound))
+			}
+			return &object.PartiallyApplied{Fn: fn, Args: bound}
+		case *object.Builtin:
+			return &object.PartiallyApplied{Fn: fn, Args: bound}
+		default:
+			return newError("argument to `partial` must be a function, got %s", args[0].Type())
+		}
+	},
+}
+
+// 関数を受け取る組み込み関数を、評価器で関数を呼び出しながら実行する。該当しなければfalseを返す
+func (e *Evaluator) applyCallbackBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	switch {
+	case builtin == builtins["sort"] && len(args) == 2:
+		return e.sortWithComparator(args[0], args[1]), true
+	case builtin == mapBuiltin:
+		return e.mapArray("map", args, false), true
+	case builtin == filterBuiltin:
+		return e.mapArray("filter", args, true), true
+	case builtin == mapValuesBuiltin:
+		return e.mapHash("map_values", args, false), true
+	case builtin == filterKeysBuiltin:
+		return e.mapHash("filter_keys", args, true), true
+	case builtin == partitionBuiltin:
+		return e.partition(args), true
+	case builtin == countBuiltin:
+		return e.countElements(args), true
+	case builtin == timesBuiltin:
+		return e.countLoop("times", args), true
+	case builtin == uptoBuiltin:
+		return e.countLoop("upto", args), true
+	case builtin == downtoBuiltin:
+		return e.countLoop("downto", args), true
+	case builtin == curryBuiltin:
+		return e.curry(args), true
+	case builtin == goBuiltin:
+		return e.spawn(args), true
+	}
+	return nil, false
+}
+
+// 関数の引数の数を調べてカリー化する。組み込み関数は引数の数が決まっていないので、引数の数を渡す必要がある
+func (e *Evaluator) curry(args []object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	var arity int
+	switch fn := args[0].(type) {
+	case *object.Function:
+		if len(args) == 2 {
+			return newError("curry: arity can only be given for a builtin function")
+		}
+		arity = len(fn.Parameters)
+	case *object.Builtin:
+		if len(args) == 1 {
+			return newError("curry: cannot curry a variadic builtin function without its arity")
+		}
+		n, ok := args[1].(*object.Integer)
+		if !ok {
+			return newError("arity passed to `curry` must be INTEGER, got %s", args[1].Type())
+		}
+		if n.Value < 0 {
+			return newError("curry: arity must not be negative, got %d", n.Value)
+		}
+		arity = int(n.Value)
+	default:
+		return newError("argument to `curry` must be FUNCTION or BUILTIN, got %s", args[0].Type())
+	}
+
+	// 引数のいらない関数はすぐに呼び出す
+	if arity == 0 {
+		return e.applyFunction(args[0], nil)
+	}
+	return &object.Curried{Fn: args[0], Arity: arity}
+}
+
+// カリー化した関数に引数を足す。引数がそろったら元の関数を呼び出す
+func (e *Evaluator) applyCurried(c *object.Curried, args []object.Object) object.Object {
+	collected := append(append([]object.Object{}, c.Args...), args...)
+	switch {
+	case len(collected) < c.Arity:
+		return &object.Curried{Fn: c.Fn, Arity: c.Arity, Args: collected}
+	case len(collected) > c.Arity:
+		return newError("wrong number of arguments: want at most %d, got=%d", c.Arity-len(c.Args), len(args))
+	}
+	return e.applyFunction(c.Fn, collected)
+}
+
+// 配列の要素ごとにfnを呼び出す。filterならfnが真を返した要素を、そうでなければfnの結果を集める
+func (e *Evaluator) mapArray(name string, args []object.Object, filter bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	elements := []object.Object{}
+	for _, elem := range arr.Elements {
+		result := e.applyFunction(args[1], []object.Object{elem})
+		if isError(result) {
+			return result
+		}
+		if !filter {
+			elements = append(elements, result)
+		} else if isTruthy(result) {
+			elements = append(elements, elem)
+		}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// ハッシュのペアごとにfnを呼び出す。filterならキーを渡してfnが真を返したペアを、そうでなければ値を渡してfnの結果を集める
+// どちらもペアの順序は保つ
+func (e *Evaluator) mapHash(name string, args []object.Object, filter bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	mapped := &object.Hash{}
+	for _, pair := range hash.Pairs() {
+		key, _ := object.HashKeyOf(pair.Key)
+		if !filter {
+			result := e.applyFunction(args[1], []object.Object{pair.Value})
+			if isError(result) {
+				return result
+			}
+			mapped.Set(key, object.HashPair{Key: pair.Key, Value: result})
+			continue
+		}
+		result := e.applyFunction(args[1], []object.Object{pair.Key})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			mapped.Set(key, pair)
+		}
+	}
+	return mapped
+}
+
+// 要素の順序は保ったまま、fnが真を返した要素とそれ以外に分ける
+func (e *Evaluator) partition(args []object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `partition` must be ARRAY, got %s", args[0].Type())
+	}
+
+	matched, rest := []object.Object{}, []object.Object{}
+	for _, el := range arr.Elements {
+		result := e.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			matched = append(matched, el)
+		} else {
+			rest = append(rest, el)
+		}
+	}
+	return &object.Array{Elements: []object.Object{
+		&object.Array{Elements: matched},
+		&object.Array{Elements: rest},
+	}}
+}
+
+// 関数を渡されたら真を返した要素を、値を渡されたら等しい要素を数える
+func (e *Evaluator) countElements(args []object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `count` must be ARRAY, got %s", args[0].Type())
+	}
+	if len(args) == 1 {
+		return &object.Integer{Value: int64(len(arr.Elements))}
+	}
+
+	var n int64
+	for _, el := range arr.Elements {
+		if !isCallable(args[1]) {
+			if object.KeyEqual(el, args[1]) {
+				n++
+			}
+			continue
+		}
+		result := e.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			n++
+		}
+	}
+	return &object.Integer{Value: n}
+}
+
+// times(n, fn)、upto(n, m, fn)、downto(n, m, fn) の共通部分。数えた整数を順にfnに渡す
+// fnが組み込み関数だとノードを評価しないので、呼び出すたびに制限を調べる
+func (e *Evaluator) countLoop(name string, args []object.Object) object.Object {
+	want := 3
+	if name == "times" {
+		want = 2
+	}
+	if len(args) != want {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+	bounds := make([]int64, want-1)
+	for i, arg := range args[:want-1] {
+		n, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("argument to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+		bounds[i] = n.Value
+	}
+	fn := args[want-1]
+	if !isCallable(fn) {
+		return newError("argument to `%s` must be a function, got %s", name, fn.Type())
+	}
+
+	// n <= 0ならbounds[0]-1を計算せずに終える。最小の整数では溢れるため
+	if name == "times" && bounds[0] <= 0 {
+		return NULL
+	}
+
+	from, to, step := int64(0), bounds[0]-1, int64(1)
+	switch name {
+	case "upto":
+		from, to = bounds[0], bounds[1]
+	case "downto":
+		from, to, step = bounds[0], bounds[1], -1
+	}
+
+	for i := from; (step > 0 && i <= to) || (step < 0 && i >= to); i += step {
+		if err := e.checkLimits(); err != nil {
+			return err
+		}
+		if result := e.applyFunction(fn, []object.Object{&object.Integer{Value: i}}); isError(result) {
+			return result
+		}
+		// toが整数の端のときに溢れないようにする
+		if i == to {
+			break
+		}
+	}
+	return NULL
+}
+
+// 比較関数fn(a, b)の返す整数の符号で並べる。並べ替えは安定
+func (e *Evaluator) sortWithComparator(arg, fn object.Object) object.Object {
+	arr, ok := arg.(*object.Array)
+	if !ok {
+		return newError("argument to `sort` must be ARRAY, got %s", arg.Type())
+	}
+
+	sorted := make([]object.Object, len(arr.Elements))
+	copy(sorted, arr.Elements)
+
+	// 比較関数がエラーやパニック、exit()の結果を返したら、それ以降は比較せずにそのまま返す
+	var failed object.Object
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if failed != nil {
+			return false
+		}
+		result := e.applyFunction(fn, []object.Object{sorted[i], sorted[j]})
+		if isError(result) {
+			failed = result
+			return false
+		}
+		c, ok := result.(*object.Integer)
+		if !ok {
+			failed = newError("sort: comparator must return INTEGER, got %s", result.Type())
+			return false
+		}
+		return c.Value < 0
+	})
+	if failed != nil {
+		return failed
+	}
+	return &object.Array{Elements: sorted}
+}
+
+// 失敗したアサーションはエラーになる
+func assertFunc(name string) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		failure, err := checkAssertion(name, args)
+		if err != nil {
+			return err
+		}
+		if failure != "" {
+			return newError("%s", failure)
+		}
+		return NULL
+	}
+}
+
+// アサーションを確かめ、失敗していればそのメッセージを返す。引数が誤っていればエラーを返す
+func checkAssertion(name string, args []object.Object) (string, *object.Error) {
+	want := 2
+	if name == "assert" {
+		want = 1
+	}
+	if len(args) != want && len(args) != want+1 {
+		return "", newError("wrong number of arguments. got=%d, want=%d or %d", len(args), want, want+1)
+	}
+
+	var ok bool
+	var failure string
+	switch name {
+	case "assert":
+		ok, failure = isTruthy(args[0]), "assertion failed"
+	case "assert_eq":
+		ok = valuesEqual(args[0], args[1])
+		failure = fmt.Sprintf("assertion failed: %s != %s", args[0].Inspect(), args[1].Inspect())
+	case "assert_ne":
+		ok = !valuesEqual(args[0], args[1])
+		failure = fmt.Sprintf("assertion failed: %s == %s", args[0].Inspect(), args[1].Inspect())
+	}
+	if ok {
+		return "", nil
+	}
+	if len(args) == want+1 {
+		if name == "assert" {
+			failure = args[want].Inspect()
+		} else {
+			failure = args[want].Inspect() + ": " + strings.TrimPrefix(failure, "assertion failed: ")
+		}
+	}
+	return failure, nil
+}
+
+// EvalOptions.Assertionsがあれば、アサーションの結果を数えて、失敗しても評価を続ける。該当しなければfalseを返す
+func (e *Evaluator) applyAssertBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	if e.opts.Assertions == nil {
+		return nil, false
+	}
+	name := builtin.Name
+	if builtin != builtins[name] || (name != "assert" && name != "assert_eq" && name != "assert_ne") {
+		return nil, false
+	}
+
+	failure, err := checkAssertion(name, args)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case err != nil:
+		return err, true
+	case failure != "":
+		e.opts.Assertions.Failures = append(e.opts.Assertions.Failures, failure)
+	default:
+		e.opts.Assertions.Passed++
+	}
+	return NULL, true
+}
+
+// サンドボックスでsleepが止まってよい最大の時間
+const sandboxMaxSleep = 1000 * time.Millisecond
+
+// 時刻を扱う組み込み関数を、EvalOptions.ClockFuncの時計で呼び出す。該当しなければfalseを返す
+// sleepは評価のタイムアウトが来たら途中で戻る
+func (e *Evaluator) applyTimeBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	var result object.Object
+	switch builtin {
+	case builtins["clock"]:
+		result = object.Clock(e.start, e.now(), args)
+	case builtins["time"]:
+		result = object.UnixTime(e.now(), args)
+	case builtins["sleep"]:
+		var limit time.Duration
+		if e.opts.Sandbox {
+			limit = sandboxMaxSleep
+		}
+		result = object.Sleep(args, limit, e.done)
+	default:
+		return nil, false
+	}
+
+	if result == nil {
+		return NULL, true
+	}
+	return result, true
+}
+
+// 乱数を扱う組み込み関数を、評価器の乱数の生成器で呼び出す。該当しなければfalseを返す
+func (e *Evaluator) applyRandomBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	var result object.Object
+	switch builtin {
+	case randomBuiltins["random_seed"]:
+		result = e.random.Seed(args)
+	case randomBuiltins["random_int"]:
+		result = e.random.Int(args)
+	case randomBuiltins["random_float"]:
+		result = e.random.Float(args)
+	case randomBuiltins["random_choice"]:
+		result = e.random.Choice(args)
+	default:
+		return nil, false
+	}
+
+	if result == nil {
+		return NULL, true
+	}
+	return result, true
+}
+
+func (e *Evaluator) now() time.Time {
+	if e.opts.ClockFunc != nil {
+		return e.opts.ClockFunc()
+	}
+	return time.Now()
+}
+
+// 入出力を行う組み込み関数を、EvalOptionsで指定された入出力先やコマンドライン引数で呼び出す。該当しなければfalseを返す
+func (e *Evaluator) applyIOBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	var result object.Object
+	switch builtin {
+	case unsafeBuiltins["puts"], unsafeBuiltins["println"]:
+		result = object.Puts(e.stdout(), args)
+	case unsafeBuiltins["eprint"]:
+		result = object.Print(e.stderr(), args)
+	case unsafeBuiltins["eprintln"]:
+		result = object.Puts(e.stderr(), args)
+	case unsafeBuiltins["printf"]:
+		result = object.Printf(e.stdout(), args)
+	case unsafeBuiltins["readline"]:
+		result = object.ReadLine(e.stdin, e.stdout(), args)
+	case unsafeBuiltins["os_args"]:
+		argv := e.opts.Args
+		if argv == nil {
+			argv = os.Args[1:]
+		}
+		result = object.OSArgs(argv, args)
+	default:
+		return nil, false
+	}
+
+	if result == nil {
+		return NULL, true
+	}
+	return result, true
+}
+
+func (e *Evaluator) stdout() io.Writer {
+	if e.opts.Stdout != nil {
+		return &lockedWriter{mu: e.mu, w: e.opts.Stdout}
+	}
+	return os.Stdout
+}
+
+func (e *Evaluator) stderr() io.Writer {
+	if e.opts.Stderr != nil {
+		return &lockedWriter{mu: e.mu, w: e.opts.Stderr}
+	}
+	return os.Stderr
+}
+
+// go()で起動した関数と出力先を共有するので、書き込みが混ざらないようにする
+// 値のInspectはユーザー定義の関数を呼ぶことがあるので、書き込みの間だけロックする
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// 文字列をプログラムとして構文解析し、呼び出し元の環境で評価する
+// 時間や命令数の制限は呼び出し元の評価と共有する
+func (e *Evaluator) evalString(args []object.Object, env *object.Environment) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	src, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `eval` must be STRING, got %s", args[0].Type())
+	}
+
+	l := lexer.New(src.Value)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("eval: parser errors: %s", strings.Join(p.Errors(), ", "))
+	}
+
+	result := e.eval(program, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// 名前から組み込み関数を引く。REPLの:helpで説明を表示するのに使う
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	if builtin, ok := builtins[name]; ok {
+		return builtin, true
+	}
+	if builtin, ok := unsafeBuiltins[name]; ok {
+		return builtin, true
+	}
+	builtin, ok := randomBuiltins[name]
+	return builtin, ok
+}
+
+// 組み込み関数の名前を辞書順で返す
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(unsafeBuiltins)+len(randomBuiltins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range unsafeBuiltins {
+		names = append(names, name)
+	}
+	for name := range randomBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
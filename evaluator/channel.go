@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/object"
+)
+
+// go(fn, args...)は、fnを別のゴルーチンで呼び出してすぐにnullを返す
+// ここのFnは関数を呼び出せない場面での結果を返すだけで、実際の処理はspawnで行う
+var goBuiltin = &object.Builtin{
+	Name: "go",
+	Doc:  "go(fn, args...) — calls fn with args in the background and returns null at once; use channels to get results back",
+	Fn: func(args ...object.Object) object.Object {
+		return newError("go must be called directly")
+	},
+}
+
+// 送受信を評価のタイムアウトで打ち切れるようにする。該当しなければfalseを返す
+func (e *Evaluator) applyChannelBuiltin(builtin *object.Builtin, args []object.Object) (object.Object, bool) {
+	switch builtin {
+	case builtins["chan_send"]:
+		return object.ChanSend(args, e.done), true
+	case builtins["chan_recv"]:
+		return object.ChanRecv(args, e.done), true
+	}
+	return nil, false
+}
+
+// 関数を新しいゴルーチンで呼び出す。呼び出しには自分の評価器を複製したものを使う
+// 関数と引数は、そこから呼べる関数の環境や配列などの中身も含めてこの時点で写しておくので、
+// ゴルーチンでの代入は呼び出し元から見えず、呼び出し元での代入もゴルーチンから見えない
+// ジェネレータのように写せない値が届くときは、ゴルーチンを起動せずにエラーを返す
+// 関数がエラーで終わったら、標準エラー出力に書く
+func (e *Evaluator) spawn(args []object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want=at least 1", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("argument to `go` must be a function, got %s", args[0].Type())
+	}
+
+	child := e.fork()
+	args, err := object.Snapshot(args, func(copied *object.Function) {
+		copied.Call = func(args ...object.Object) object.Object { return child.applyFunction(copied, args) }
+	})
+	if err != nil {
+		return newError("go: %s", err)
+	}
+	fn, fnArgs := args[0], args[1:]
+	go func() {
+		result := child.applyFunction(fn, fnArgs)
+		if result == nil || !isError(result) || result.Type() == object.EXIT_SIGNAL_OBJ || child.stopped() {
+			return
+		}
+		fmt.Fprintf(child.stderr(), "go: %s\n", result.Inspect())
+	}()
+	return NULL
+}
+
+// ゴルーチンで使う評価器を作る。タイムアウトと、入出力やカバレッジなどの共有する状態は引き継ぐ
+// 命令数は別に数え、読み込んだモジュールは共有しない。readlineを複数のゴルーチンから同時に呼ぶことは考えない
+func (e *Evaluator) fork() *Evaluator {
+	return &Evaluator{
+		opts:   e.opts,
+		done:   e.done,
+		stdin:  e.stdin,
+		start:  e.start,
+		mu:     e.mu,
+		random: e.random,
+	}
+}
+
+// 評価のタイムアウトが来ていればtrueを返す
+func (e *Evaluator) stopped() bool {
+	if e.done == nil {
+		return false
+	}
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
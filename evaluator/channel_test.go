@@ -0,0 +1,178 @@
+package evaluator
+
+import (
+	"bytes"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"testing"
+	"time"
+)
+
+func TestChannels(t *testing.T) {
+	// 受け取った値を閉じられるまで配列に集める。first([])はnull
+	collect := `let collect = fn(ch) {
+		let received = [];
+		let v = chan_recv(ch);
+		while (v != first([])) {
+			received = push(received, v);
+			v = chan_recv(ch);
+		}
+		received
+	};`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			collect + `let ch = chan();
+			let producer = fn(n) {
+				let i = 0;
+				while (i < n) { chan_send(ch, i * i); i = i + 1; }
+				chan_close(ch);
+			};
+			go(producer, 5);
+			collect(ch)`,
+			"[0, 1, 4, 9, 16]",
+		},
+		{
+			// 受け手が先に待っていても届く
+			`let requests = chan(); let replies = chan();
+			go(fn() { chan_send(replies, chan_recv(requests) * 2) });
+			chan_send(requests, 21);
+			chan_recv(replies)`,
+			"42",
+		},
+		{
+			collect + `let ch = chan(3);
+			let done = chan(3);
+			let worker = fn(id) { chan_send(ch, id); chan_send(done, true); };
+			go(worker, 1); go(worker, 2); go(worker, 3);
+			chan_recv(done); chan_recv(done); chan_recv(done);
+			chan_close(ch);
+			let sum = 0;
+			for (v in collect(ch)) { sum = sum + v; }
+			sum`,
+			"6",
+		},
+		{`let ch = chan(2); chan_send(ch, 1); chan_send(ch, 2); [chan_recv(ch), chan_recv(ch)]`, "[1, 2]"},
+		// 閉じた後も、バッファに残った値は受け取れる
+		{`let ch = chan(1); chan_send(ch, 1); chan_close(ch); [chan_recv(ch), chan_recv(ch)]`, "[1, null]"},
+		{`type(chan())`, "CHANNEL"},
+		{`let ch = chan(1); chan_close(ch); chan_send(ch, 1)`, "ERROR: send on closed channel"},
+		{`let ch = chan(); chan_close(ch); chan_close(ch)`, "ERROR: close of closed channel"},
+		{`chan(-1)`, "ERROR: chan: capacity must not be negative, got -1"},
+		{`chan("1")`, "ERROR: argument to `chan` must be INTEGER, got STRING"},
+		{`chan_recv(1)`, "ERROR: argument to `chan_recv` must be CHANNEL, got INTEGER"},
+		{`chan_send(chan())`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`go(1)`, "ERROR: argument to `go` must be a function, got INTEGER"},
+		{`go()`, "ERROR: wrong number of arguments. got=0, want=at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestGoCopiesEnvironment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// ゴルーチンでの代入は呼び出し元に見えない
+		{`let x = 1; let done = chan();
+		go(fn() { x = 2; chan_send(done, x); });
+		[chan_recv(done), x]`, "[2, 1]"},
+		// 起動した後の代入もゴルーチンには見えない
+		{`let x = 1; let start = chan(); let done = chan();
+		go(fn() { chan_recv(start); chan_send(done, x); });
+		x = 5;
+		chan_send(start, true);
+		[chan_recv(done), x]`, "[1, 5]"},
+		// ゴルーチンから呼ぶ関数も、同じ写しの環境を見る
+		{`let x = 1; let get = fn() { x }; let start = chan(); let done = chan();
+		go(fn() { chan_recv(start); chan_send(done, [x, get()]); });
+		x = 5;
+		chan_send(start, true);
+		chan_recv(done)`, "[1, 1]"},
+		{`let x = 1; let set = fn(v) { x = v }; let done = chan();
+		go(fn() { set(2); chan_send(done, x); });
+		[chan_recv(done), x]`, "[2, 1]"},
+		// カーソルやメモ化した関数は、状態ごと写してそれぞれが別々に使う
+		{`let c = cursor([1, 2, 3, 4]); let m = memoize(fn(x) { x * 2 }); let done = chan();
+		go(fn() { chan_send(done, [cursor_next(c), cursor_next(c), m(1), m(2)]); });
+		[cursor_next(c), m(1), m(3), chan_recv(done)]`, "[1, 2, 6, [1, 2, 2, 4]]"},
+		{`let h = {"c": cursor([1, 2])}; let done = chan();
+		go(fn(arg) { chan_send(done, [cursor_next(h["c"]), cursor_next(arg["c"])]); }, h);
+		[cursor_next(h["c"]), chan_recv(done)]`, "[1, [1, 2]]"},
+		// ジェネレータは写せないので、起動せずにエラーにする
+		{`let gen = fn*() { yield 1; }; let g = gen(); go(fn() { next(g) })`,
+			"ERROR: go: cannot share GENERATOR with another task"},
+		{`let f = once(fn() { 1 }); go(f)`, "ERROR: go: cannot share ONCE with another task"},
+		// チャネルは写さずに共有する
+		{`let results = chan(2);
+		let worker = fn(n) { chan_send(results, n * 10) };
+		go(worker, 1); go(worker, 1);
+		chan_recv(results) + chan_recv(results)`, "20"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestChannelTimeout(t *testing.T) {
+	tests := []string{
+		`chan_recv(chan())`,
+		`chan_send(chan(), 1)`,
+	}
+
+	for _, input := range tests {
+		e := NewWithOptions(EvalOptions{Timeout: 20 * time.Millisecond})
+		program := parser.New(lexer.New(input)).ParseProgram()
+		evaluated := e.Eval(program, object.NewEnvironment())
+		if evaluated.Inspect() != "ERROR: execution timeout" {
+			t.Errorf("wrong result for %s. got=%q", input, evaluated.Inspect())
+		}
+	}
+}
+
+func TestGoReportsErrors(t *testing.T) {
+	var stderr bytes.Buffer
+	e := NewWithOptions(EvalOptions{Stderr: &stderr})
+	input := `let ch = chan();
+	go(fn() { chan_send(ch, 1); chan_send(ch, 1 + true); });
+	chan_recv(ch);`
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+
+	// エラーを書き終わるまで待つ
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		e.mu.Lock()
+		got := stderr.String()
+		e.mu.Unlock()
+		if got != "" {
+			if got != "go: ERROR: type mismatch: INTEGER + BOOLEAN\n" {
+				t.Errorf("wrong error output. got=%q", got)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("error in go was not reported")
+}
+
+func TestGoInSandbox(t *testing.T) {
+	e := NewWithOptions(EvalOptions{Sandbox: true})
+	evaluated := e.Eval(parser.New(lexer.New(`go(fn() { 1 })`)).ParseProgram(), object.NewEnvironment())
+	if evaluated.Inspect() != "ERROR: identifier not found: go" {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
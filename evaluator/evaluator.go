@@ -1,146 +1,375 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"gomadoufu/monkey-interpreter-go/ast"
 	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/token"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// 評価の制限。ゼロ値なら制限しない
+type EvalOptions struct {
+	// 1回のEvalにかけてよい時間
+	Timeout time.Duration
+	// 1回のEvalで評価してよいノードの数
+	MaxInstructions int64
+	// trueなら入出力を行う組み込み関数を使えなくする。信頼できないスクリプトを実行するときに使う
+	Sandbox bool
+	// trueならサンドボックスでもrandom_*を使えるようにする
+	AllowRandom bool
+	// readlineの入力元とputs・println・printf・readlineの出力先。nilなら標準入出力を使う
+	Stdin  io.Reader
+	Stdout io.Writer
+	// eprint・eprintlnの出力先。nilなら標準エラー出力を使う
+	Stderr io.Writer
+	// os_argsが返すコマンドライン引数。nilならos.Args[1:]を使う
+	Args []string
+	// nilでなければ、評価したノードの位置をtrueにする。カバレッジの計測に使う
+	Coverage map[token.Position]bool
+	// nilでなければ、assert・assert_eq・assert_neは失敗しても止まらずに、ここに結果を数える
+	Assertions *Assertions
+	// nilでなければ、評価したノードの種類ごとに回数と時間を記録する
+	Profile *Profile
+	// clock・timeが使う現在時刻。nilならtime.Nowを使う。テストで時計を固定するときに使う
+	ClockFunc func() time.Time
+}
+
+// assert系の組み込み関数の結果
+type Assertions struct {
+	Passed int
+	// 失敗したアサーションのメッセージ。失敗した順に並ぶ
+	Failures []string
+}
+
+// ASTを評価する評価器
+// 制限付きで評価するときは、カウンタなどの状態を持つのでEvalごとに使い回してよいが、並行には使わないこと
+type Evaluator struct {
+	opts EvalOptions
+
+	instructions int64
+	done         <-chan struct{}
+
+	// 評価器を作った時刻。clockはここからの経過時間を返す
+	start time.Time
+
+	// go()で起動した評価器と共有する、カバレッジ・アサーションの結果と出力先を守る
+	mu *sync.Mutex
+
+	// opts.Stdinを包んだReader。Evalをまたいで読み残しを保持する
+	stdin *bufio.Reader
+
+	// random_*が使う乱数の生成器。go()で起動した評価器と共有する
+	random *object.Random
+
+	// プロファイル中に、評価している途中のノードの数を種類ごとに数える
+	profileDepth map[string]int
+
+	// 読み込んだモジュール。キーはファイルの絶対パス
+	modules map[string]*object.Module
+	// 読み込んでいる途中のモジュール。循環importを見つけるのに使う
+	importing map[string]bool
+}
+
+func New() *Evaluator {
+	return NewWithOptions(EvalOptions{})
+}
+
+func NewWithOptions(opts EvalOptions) *Evaluator {
+	e := &Evaluator{opts: opts, mu: &sync.Mutex{}, random: object.NewRandom(time.Now().UnixNano())}
+	e.start = e.now()
+	if opts.Stdin != nil {
+		e.stdin = bufio.NewReader(opts.Stdin)
+	}
+	return e
+}
+
+// 制限なしで評価する
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// 制限はこの呼び出しごとに数え直す。時間か命令数の制限を超えると"execution timeout"のエラーを返す
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	e.instructions = 0
+	e.done = nil
+
+	if e.opts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), e.opts.Timeout)
+		defer cancel()
+		e.done = ctx.Done()
+	}
+
+	return e.eval(node, env)
+}
+
+// 制限を超えていればエラーを返す。ノードを評価するたびに呼ばれる
+func (e *Evaluator) checkLimits() *object.Error {
+	if e.opts.MaxInstructions > 0 {
+		e.instructions++
+		if e.instructions > e.opts.MaxInstructions {
+			return newError("execution timeout")
+		}
+	}
+	if e.done != nil {
+		select {
+		case <-e.done:
+			return newError("execution timeout")
+		default:
+		}
+	}
+	return nil
+}
+
+// ノードを評価する前に呼ぶ。制限を確かめ、カバレッジを記録する
+func (e *Evaluator) enter(node ast.Node) *object.Error {
+	if err := e.checkLimits(); err != nil {
+		return err
+	}
+	e.markCovered(node)
+	return nil
+}
+
+func (e *Evaluator) markCovered(node ast.Node) {
+	if e.opts.Coverage != nil && node != nil {
+		e.mu.Lock()
+		e.opts.Coverage[node.Pos()] = true
+		e.mu.Unlock()
+	}
+}
+
+// エラーとパニック、exit()の結果はどれも評価を中断して呼び出し元へ伝播する
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.PANIC_OBJ, object.EXIT_SIGNAL_OBJ:
+			return true
+		}
 	}
 	return false
 }
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.enter(node); err != nil {
+		return err
+	}
+	if e.opts.Profile != nil && node != nil {
+		name, outermost := e.profileEnter(node)
+		defer e.profileExit(name, outermost, time.Now())
+	}
+
 	switch node := node.(type) {
 
 	// 文
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 	case *ast.BlockStatement:
-		return evalBlockStatements(node, env)
+		return e.evalBlockStatements(node, env, false)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env, false)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		return e.evalLetStatement(node, env)
+	case *ast.LetExpression:
+		return e.evalLetExpression(node, env, false)
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node, env)
+	case *ast.UnletStatement:
+		if !env.Delete(node.Name.Value) {
+			return newError("cannot unlet %s: not defined in this scope", node.Name.Value)
+		}
+		return nil
+	case *ast.DeferStatement:
+		return e.evalDeferStatement(node, env)
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, "", env)
+	case *ast.DoWhileStatement:
+		return e.evalDoWhileStatement(node, "", env)
+	case *ast.RepeatStatement:
+		return e.evalRepeatStatement(node, "", env)
+	case *ast.TryCatchStatement:
+		return e.evalTryCatchStatement(node, env)
+	case *ast.ThrowStatement:
+		val := e.eval(node.Value, env)
+		// throw Error("...") のように、値がすでにエラーならそのまま投げる
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		return thrownError(val)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, "", env)
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, "", env)
+	case *ast.LabeledStatement:
+		return e.evalLabeledStatement(node, env)
+	case *ast.BreakStatement:
+		return &object.BreakSignal{Label: labelName(node.Label)}
+	case *ast.ContinueStatement:
+		return &object.ContinueSignal{Label: labelName(node.Label)}
 
 	// 式
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, left, env)
+		}
+		right := e.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		fn := &object.Function{Parameters: params, Env: env, Body: body, Generator: node.Generator}
+		fn.Call = func(args ...object.Object) object.Object { return e.applyFunction(fn, args) }
+		return fn
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
+		return e.evalCallExpression(node, env, false)
+	case *ast.MethodCallExpression:
+		return e.evalMethodCallExpression(node, env)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.SymbolLiteral:
+		return object.InternSymbol(node.Value)
 
+	case *ast.TupleLiteral:
+		values := e.evalExpressions(node.Elements, env)
+		if len(values) == 1 && isError(values[0]) {
+			return values[0]
+		}
+		return &object.Tuple{Elements: values}
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.YieldExpression:
+		return e.evalYieldExpression(node, env)
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env)
+	case *ast.AssignExpression:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !env.Assign(node.Name.Value, val) {
+			return newError("identifier not found: " + node.Name.Value)
+		}
+		return val
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
-		case *object.Error:
+		case *object.Error, *object.ExitSignal:
 			return result
+		case *object.Panic:
+			return newError("panic: %s", result.Value.Inspect())
+		case *object.BreakSignal, *object.ContinueSignal:
+			return loopSignalError(result)
 		}
 	}
 
 	return result
 }
 
-func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
+// tailなら最後の文を末尾の位置として評価する
+func (e *Evaluator) evalBlockStatements(block *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
 	var result object.Object
 
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	for i, statement := range block.Statements {
+		if tail && i == len(block.Statements)-1 {
+			return e.evalTail(statement, env)
+		}
+		result = e.eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if isInterrupted(result) {
+			return result
 		}
 	}
 	return result
 }
 
+// 残りの文を評価せずに外側へ伝播させる値かどうか
+func isInterrupted(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.PANIC_OBJ, object.EXIT_SIGNAL_OBJ,
+		object.BREAK_SIGNAL_OBJ, object.CONTINUE_SIGNAL_OBJ:
+		return true
+	}
+	return false
+}
+
+// 評価器は真偽値をTRUE/FALSEのインスタンスの同一性で比較するので、
+// 外部から真偽値を渡すときはこれを使ってインスタンスを得る
+func NativeBoolToBooleanObject(input bool) *object.Boolean {
+	return nativeBoolToBooleanObject(input)
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -173,30 +402,101 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	case *object.BigInt:
+		return &object.BigInt{Value: new(big.Int).Neg(right.Value)}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+}
+
+// &&は左辺がfalsyなら、||は左辺がtruthyなら右辺を評価せずに結果を決める
+// 結果は右辺の値ではなく、真偽値にする
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+	right := e.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
+	case operator == "in":
+		return evalInExpression(left, right)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		// 片方が多倍長整数なら、もう片方も多倍長整数にしてから計算する
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// 片方が浮動小数点数なら、もう片方も浮動小数点数にしてから計算する
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.RECORD_OBJ && right.Type() == object.RECORD_OBJ && (operator == "==" || operator == "!="):
+		// レコードは同一性ではなく中身で比べる
+		return nativeBoolToBooleanObject(valuesEqual(left, right) == (operator == "=="))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// x in c。配列とタプルは要素を、ハッシュとレコードはキーを、文字列は部分文字列を探す
+func evalInExpression(item, container object.Object) object.Object {
+	switch container := container.(type) {
+	case *object.Array:
+		return nativeBoolToBooleanObject(containsElement(container.Elements, item))
+	case *object.Tuple:
+		return nativeBoolToBooleanObject(containsElement(container.Elements, item))
+	case *object.Hash:
+		key, ok := object.HashKeyOf(item)
+		if !ok {
+			return newError("unusable as hash key: %s", item.Type())
+		}
+		_, ok = container.Get(key)
+		return nativeBoolToBooleanObject(ok)
+	case *object.Record:
+		key, ok := object.HashKeyOf(item)
+		if !ok {
+			return newError("unusable as hash key: %s", item.Type())
+		}
+		_, ok = container.Get(key)
+		return nativeBoolToBooleanObject(ok)
+	case *object.String:
+		sub, ok := item.(*object.String)
+		if !ok {
+			return newError("type mismatch: %s in STRING", item.Type())
+		}
+		return nativeBoolToBooleanObject(strings.Contains(container.Value, sub.Value))
+	case *object.Null:
+		return FALSE
+	}
+	return newError("unknown operator: %s in %s", item.Type(), container.Type())
+}
+
+func containsElement(elements []object.Object, item object.Object) bool {
+	for _, el := range elements {
+		if valuesEqual(el, item) {
+			return true
+		}
+	}
+	return false
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
@@ -209,7 +509,42 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %% 0", leftVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		// 浮動小数点数の0除算はIEEE 754に従って無限大かNaNになる
+		return &object.Float{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -223,20 +558,442 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return &object.BigInt{Value: new(big.Int).Add(leftVal, rightVal)}
+	case "-":
+		return &object.BigInt{Value: new(big.Int).Sub(leftVal, rightVal)}
+	case "*":
+		return &object.BigInt{Value: new(big.Int).Mul(leftVal, rightVal)}
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero: %s / 0", leftVal)
+		}
+		// 整数と同じように0の方向に切り捨てる
+		return &object.BigInt{Value: new(big.Int).Quo(leftVal, rightVal)}
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero: %s %% 0", leftVal)
+		}
+		return &object.BigInt{Value: new(big.Int).Rem(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// 整数か多倍長整数かどうか
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+// isIntegerで確かめた値をbig.Intにする
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// isNumberで確かめた値をfloat64にする
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// tailなら分岐を末尾の位置として評価する
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
+	condition := e.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
+	evalBranch := e.eval
+	if tail {
+		evalBranch = e.evalTail
+	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return evalBranch(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return evalBranch(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// labelはこのループに付いたラベル。付いていなければ空文字列
+func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement, label string, env *object.Environment) object.Object {
+	for {
+		condition := e.eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := e.eval(ws.Body, env)
+		if stop, result := handleLoopSignal(result, label); stop {
+			return result
+		}
+	}
+}
+
+// 最初の1回は条件を調べずに本体を実行する。continueしたときも条件は調べる
+func (e *Evaluator) evalDoWhileStatement(ds *ast.DoWhileStatement, label string, env *object.Environment) object.Object {
+	for {
+		result := e.eval(ds.Body, env)
+		if stop, result := handleLoopSignal(result, label); stop {
+			return result
+		}
+
+		condition := e.eval(ds.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+	}
+}
+
+// 回数は最初に1回だけ評価する
+func (e *Evaluator) evalRepeatStatement(rs *ast.RepeatStatement, label string, env *object.Environment) object.Object {
+	count := e.eval(rs.Count, env)
+	if isError(count) {
+		return count
+	}
+	n, ok := count.(*object.Integer)
+	if !ok {
+		return newError("repeat: count must be INTEGER, got %s", count.Type())
+	}
+	if n.Value < 0 {
+		return newError("repeat: count must not be negative, got %d", n.Value)
+	}
+
+	for i := int64(0); i < n.Value; i++ {
+		result := e.eval(rs.Body, env)
+		if stop, result := handleLoopSignal(result, label); stop {
+			return result
+		}
+	}
+	return NULL
+}
+
+// 本体がエラーになったら、エラーをrecord({"message": ...})にしてcatchの名前に束縛し、ハンドラを実行する
+// パニックやreturnは捕まえない。finallyはどの場合も最後に実行し、finallyが途中で抜けたらそちらを優先する
+func (e *Evaluator) evalTryCatchStatement(ts *ast.TryCatchStatement, env *object.Environment) object.Object {
+	result := e.eval(ts.Body, env)
+
+	if errObj, ok := result.(*object.Error); ok && ts.Handler != nil {
+		handlerEnv := object.NewEnclosedEnvironment(env)
+		if ts.ErrorBinding != nil {
+			handlerEnv.Set(ts.ErrorBinding.Value, caughtError(errObj))
+		}
+		result = e.eval(ts.Handler, handlerEnv)
+	}
+
+	if ts.Finally != nil {
+		if finally := e.eval(ts.Finally, env); isInterrupted(finally) {
+			return finally
+		}
+	}
+	return result
+}
+
+var errorMessageKey = &object.String{Value: "message"}
+
+// catchで束縛する値
+func caughtError(err *object.Error) *object.Record {
+	return object.NewRecord([]object.HashPair{
+		{Key: errorMessageKey, Value: &object.String{Value: err.Message}},
+	})
+}
+
+// throwした値をエラーにする。文字列はそのままメッセージにし、それ以外はInspectした結果をメッセージにする
+// catchで束縛したエラーを投げ直したときは、元のメッセージを使う
+func thrownError(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.String:
+		return &object.Error{Message: val.Value}
+	case *object.Record:
+		key, _ := object.HashKeyOf(errorMessageKey)
+		if pair, ok := val.Get(key); ok && val.Len() == 1 {
+			if msg, ok := pair.Value.(*object.String); ok {
+				return &object.Error{Message: msg.Value}
+			}
+		}
+	}
+	return &object.Error{Message: val.Inspect()}
+}
+
+// 初期化文で束縛した変数はfor文の中だけで見える
+func (e *Evaluator) evalForStatement(fs *ast.ForStatement, label string, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fs.Init != nil {
+		init := e.eval(fs.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := e.eval(fs.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		result := e.eval(fs.Body, loopEnv)
+		if stop, result := handleLoopSignal(result, label); stop {
+			return result
+		}
+
+		// continueしたときも後処理は実行する
+		if fs.Post != nil {
+			post := e.eval(fs.Post, loopEnv)
+			if isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+// ループ変数はfor文の中だけで見える
+func (e *Evaluator) evalForInStatement(fs *ast.ForInStatement, label string, env *object.Environment) object.Object {
+	iterable := e.eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	it, ok := object.Iterate(iterable)
+	if !ok {
+		return newError("not iterable: %s", iterable.Type())
+	}
+
+	loopEnv := object.NewEnclosedEnvironment(env)
+	for {
+		val, ok := it.Next()
+		if !ok {
+			return NULL
+		}
+		// ジェネレータの本体がエラーで終わった
+		if isError(val) {
+			return val
+		}
+		loopEnv.Set(fs.Variable.Value, val)
+
+		result := e.eval(fs.Body, loopEnv)
+		if stop, result := handleLoopSignal(result, label); stop {
+			return result
+		}
+	}
+}
+
+// ループ本体の評価結果を見て、ループを終えるならtrueとループの評価結果を返す
+// このループ宛てのbreakならNULLで終わり、このループ宛てのcontinueなら続ける
+// 他のループ宛ての信号やreturn・エラーはそのまま外側へ伝播させる
+func handleLoopSignal(result object.Object, label string) (bool, object.Object) {
+	switch result := result.(type) {
+	case *object.BreakSignal:
+		if result.Label == "" || result.Label == label {
+			return true, NULL
+		}
+		return true, result
+	case *object.ContinueSignal:
+		if result.Label == "" || result.Label == label {
+			return false, nil
+		}
+		return true, result
+	}
+	return isInterrupted(result), result
+}
+
+func (e *Evaluator) evalLabeledStatement(ls *ast.LabeledStatement, env *object.Environment) object.Object {
+	label := ls.Label.Value
+	// ループはevalを通らずに評価するので、ここで評価したことにする
+	e.markCovered(ls.Statement)
+
+	switch stmt := ls.Statement.(type) {
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(stmt, label, env)
+	case *ast.DoWhileStatement:
+		return e.evalDoWhileStatement(stmt, label, env)
+	case *ast.RepeatStatement:
+		return e.evalRepeatStatement(stmt, label, env)
+	case *ast.ForStatement:
+		return e.evalForStatement(stmt, label, env)
+	case *ast.ForInStatement:
+		return e.evalForInStatement(stmt, label, env)
+	}
+
+	// ループ以外の文のラベルにはbreakでだけ抜けられる
+	result := e.eval(ls.Statement, env)
+	if signal, ok := result.(*object.BreakSignal); ok && signal.Label == label {
+		return NULL
+	}
+	return result
+}
+
+func labelName(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
+// ループの外に出てしまったbreak/continueをエラーにする
+func loopSignalError(signal object.Object) *object.Error {
+	switch signal := signal.(type) {
+	case *object.BreakSignal:
+		if signal.Label != "" {
+			return newError("break label not found: %s", signal.Label)
+		}
+		return newError("break outside loop")
+	case *object.ContinueSignal:
+		if signal.Label != "" {
+			return newError("continue label not found: %s", signal.Label)
+		}
+		return newError("continue outside loop")
+	}
+	return nil
+}
+
+// 分岐を上から順に照合し、最初に一致した分岐の本体を評価する
+// パターンの識別子は照合される値に束縛され、条件式と本体から参照できる
+func (e *Evaluator) evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := e.eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		matched, err := e.matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := e.eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return e.eval(arm.Body, armEnv)
+	}
+
+	return NULL
+}
+
+func (e *Evaluator) matchPattern(pattern ast.Expression, subject object.Object, env *object.Environment) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case nil:
+		return true, nil
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, subject)
+		}
+		return true, nil
+	default:
+		value := e.eval(pattern, env)
+		if isError(value) {
+			return false, value
+		}
+		return objectsEqual(value, subject), nil
+	}
+}
+
+func objectsEqual(left, right object.Object) bool {
+	if isNumber(left) && isNumber(right) && (left.Type() == object.FLOAT_OBJ || right.Type() == object.FLOAT_OBJ) {
+		return toFloat(left) == toFloat(right)
+	}
+	if isInteger(left) && isInteger(right) && (left.Type() == object.BIGINT_OBJ || right.Type() == object.BIGINT_OBJ) {
+		return toBigInt(left).Cmp(toBigInt(right)) == 0
+	}
+	switch left := left.(type) {
+	case *object.Integer:
+		r, ok := right.(*object.Integer)
+		return ok && left.Value == r.Value
+	case *object.String:
+		r, ok := right.(*object.String)
+		return ok && left.Value == r.Value
+	default:
+		return left == right
+	}
+}
+
+// assert_eqの比較。配列・タプル・ハッシュは要素を比べる
+func valuesEqual(left, right object.Object) bool {
+	switch left := left.(type) {
+	case *object.Array:
+		r, ok := right.(*object.Array)
+		return ok && elementsEqual(left.Elements, r.Elements)
+	case *object.Tuple:
+		r, ok := right.(*object.Tuple)
+		return ok && elementsEqual(left.Elements, r.Elements)
+	case *object.Hash:
+		r, ok := right.(*object.Hash)
+		return ok && left.Len() == r.Len() && pairsEqual(left.Pairs(), r.Get)
+	case *object.Record:
+		r, ok := right.(*object.Record)
+		return ok && left.Len() == r.Len() && pairsEqual(left.Pairs(), r.Get)
+	}
+	return objectsEqual(left, right)
+}
+
+// pairsのどのキーもgetで引けて、値が等しければtrueを返す。ペアの順序は問わない
+func pairsEqual(pairs []object.HashPair, get func(object.HashKey) (object.HashPair, bool)) bool {
+	for _, pair := range pairs {
+		key, _ := object.HashKeyOf(pair.Key)
+		other, ok := get(key)
+		if !ok || !valuesEqual(pair.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func elementsEqual(left, right []object.Object) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if !valuesEqual(left[i], right[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -254,21 +1011,27 @@ func newError(format string, a ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
+	if builtin, ok := unsafeBuiltins[node.Value]; ok && !e.opts.Sandbox {
+		return builtin
+	}
+	if builtin, ok := randomBuiltins[node.Value]; ok && (!e.opts.Sandbox || e.opts.AllowRandom) {
+		return builtin
+	}
 	return newError("identifier not found: " + node.Value)
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -277,29 +1040,231 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// tailなら、ユーザー定義の関数の呼び出しをThunkにして返す
+// deferされた呼び出しは呼び出した関数が戻ってから実行しなければならないので、そのときは普通に呼び出す
+func (e *Evaluator) evalCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	// quoteは引数を評価しない特別な形式
+	if node.Function.TokenLiteral() == "quote" {
+		return e.quote(node.Arguments[0], env)
+	}
+
+	function := e.eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := e.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if builtin, ok := function.(*object.Builtin); ok {
+		if result, ok := e.applyEnvBuiltin(builtin, args, env); ok {
+			return result
+		}
+	}
+
+	if fn, ok := function.(*object.Function); ok && tail && !fn.Generator && !env.HasDeferred() {
+		return &object.Thunk{Function: fn, Args: args}
+	}
+	return e.applyFunction(function, args)
+}
+
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		if fn.Generator {
+			return e.newGenerator(fn, args)
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return e.evalFunctionBody(fn, extendedEnv)
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if result, ok := e.applyIOBuiltin(fn, args); ok {
+			return result
+		}
+		if result, ok := e.applyAssertBuiltin(fn, args); ok {
+			return result
+		}
+		if result, ok := e.applyTimeBuiltin(fn, args); ok {
+			return result
+		}
+		if result, ok := e.applyRandomBuiltin(fn, args); ok {
+			return result
+		}
+		if result, ok := e.applyChannelBuiltin(fn, args); ok {
+			return result
+		}
+		if result, ok := e.applyCallbackBuiltin(fn, args); ok {
+			return result
+		}
+		if result := fn.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
+
+	case *object.PartiallyApplied:
+		// 残りの引数の数が合わなければ、束縛した分を除いた数で報告する
+		if f, ok := fn.Fn.(*object.Function); ok && len(fn.Args)+len(args) != len(f.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(f.Parameters)-len(fn.Args), len(args))
+		}
+		return e.applyFunction(fn.Fn, append(append([]object.Object{}, fn.Args...), args...))
+
+	case *object.Curried:
+		return e.applyCurried(fn, args)
+
+	case *object.Memoized:
+		return e.applyMemoized(fn, args)
+
+	case *object.Once:
+		return fn.Do(func() object.Object { return e.applyFunction(fn.Fn, args) })
+
+	case *object.Composed:
+		// 最初の関数にはそのまま引数を渡すので、引数の数の誤りは最初の関数が報告する
+		result := e.applyFunction(fn.Fns[0], args)
+		for _, f := range fn.Fns[1:] {
+			if isError(result) {
+				return result
+			}
+			result = e.applyFunction(f, []object.Object{result})
+		}
+		return result
 
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// 引数がすべてハッシュのキーにできるときだけ結果を覚える。エラーは覚えない
+func (e *Evaluator) applyMemoized(m *object.Memoized, args []object.Object) object.Object {
+	key := &object.Tuple{Elements: args}
+	hashKey, ok := object.HashKeyOf(key)
+	if !ok {
+		return e.applyFunction(m.Fn, args)
+	}
+	if pair, ok := m.Cache.Get(hashKey); ok {
+		return pair.Value
+	}
+
+	result := e.applyFunction(m.Fn, args)
+	if !isError(result) {
+		m.Cache.Set(hashKey, object.HashPair{Key: key, Value: result})
+	}
+	return result
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewFunctionEnvironment(fn.Env)
+	bindParameters(env, fn, args)
+	return env
+}
 
+func bindParameters(env *object.Environment, fn *object.Function, args []object.Object) {
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
 	}
-	return env
+}
+
+// ジェネレータ関数の呼び出し。本体は最初のnext()で別のゴルーチンから評価される
+func (e *Evaluator) newGenerator(fn *object.Function, args []object.Object) object.Object {
+	return object.NewGenerator(func(y *object.Yielder) object.Object {
+		env := object.NewGeneratorEnvironment(fn.Env, y)
+		bindParameters(env, fn, args)
+		return e.evalFunctionBody(fn, env)
+	})
+}
+
+// yield式そのものの値はNULL
+func (e *Evaluator) evalYieldExpression(ye *ast.YieldExpression, env *object.Environment) object.Object {
+	yielder := env.Yielder()
+	if yielder == nil {
+		return newError("yield outside generator")
+	}
+
+	var val object.Object = NULL
+	if ye.Value != nil {
+		val = e.eval(ye.Value, env)
+		if isError(val) {
+			return val
+		}
+	}
+
+	yielder.Yield(val)
+	return NULL
+}
+
+// 本体が末尾呼び出しのThunkを返したら、Goの再帰を使わずにこのループで呼び出された関数の本体を評価する
+func (e *Evaluator) evalFunctionBody(fn *object.Function, env *object.Environment) object.Object {
+	for {
+		evaluated := e.evalTail(fn.Body, env)
+		switch evaluated.(type) {
+		case *object.BreakSignal, *object.ContinueSignal:
+			evaluated = loopSignalError(evaluated)
+		}
+		evaluated = e.runDeferredCalls(env, evaluated)
+
+		thunk, ok := evaluated.(*object.Thunk)
+		if !ok {
+			return unwrapReturnValue(evaluated)
+		}
+		fn = thunk.Function
+		if len(thunk.Args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(thunk.Args))
+		}
+		env = extendFunctionEnv(fn, thunk.Args)
+	}
+}
+
+// Goと同じく、呼び出す関数と引数はdefer文の時点で評価し、実行は関数を抜けるときに行う
+func (e *Evaluator) evalDeferStatement(ds *ast.DeferStatement, env *object.Environment) object.Object {
+	function := e.eval(ds.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := e.evalExpressions(ds.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if !env.Defer(object.DeferredCall{Fn: function, Args: args}) {
+		return newError("defer outside function")
+	}
+	return nil
+}
+
+// deferされた呼び出しを登録と逆順に実行する
+// 呼び出しがエラーになった場合は、関数の結果の代わりにそのエラーを返す
+// パニックがrecoverされた場合は、関数はNULLを返して普通に終了する
+func (e *Evaluator) runDeferredCalls(env *object.Environment, result object.Object) object.Object {
+	deferred := env.TakeDeferred()
+	for i := len(deferred) - 1; i >= 0; i-- {
+		panicking, _ := result.(*object.Panic)
+		if evaluated := e.applyDeferredCall(deferred[i], panicking); isError(evaluated) {
+			result = evaluated
+		}
+	}
+
+	if panicking, ok := result.(*object.Panic); ok && panicking.Recovered {
+		return NULL
+	}
+	return result
+}
+
+// パニック中なら、deferした関数の中からrecover()でパニックを取り出せるようにして呼び出す
+func (e *Evaluator) applyDeferredCall(call object.DeferredCall, panicking *object.Panic) object.Object {
+	fn, ok := call.Fn.(*object.Function)
+	if !ok || panicking == nil {
+		return e.applyFunction(call.Fn, call.Args)
+	}
+
+	env := object.NewDeferredEnvironment(fn.Env, panicking)
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, call.Args[paramIdx])
+	}
+	return e.evalFunctionBody(fn, env)
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -309,21 +1274,36 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+// 文字列は同一性ではなく中身で比べる
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.TUPLE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalTupleIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.RECORD_OBJ:
+		return evalRecordIndexExpression(left.(*object.Record), index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleMember(left.(*object.Module), index.(*object.String).Value)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -331,49 +1311,214 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
+	idx, ok := resolveIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
+		return NULL
+	}
+	return arrayObject.Elements[idx]
+}
+
+// 1文字の文字列を返す。添字は文字単位で数える
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx, ok := resolveIndex(index.(*object.Integer).Value, len(runes))
+	if !ok {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
+}
+
+// 負の添字は末尾から数える(-1が最後の要素)。範囲外ならfalseを返す
+func resolveIndex(idx int64, length int) (int64, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func (e *Evaluator) evalLetStatement(node *ast.LetStatement, env *object.Environment) object.Object {
+	// letrecは先にNULLで束縛しておき、右辺の関数がその束縛を捕捉できるようにする
+	if node.Recursive {
+		for _, name := range letNames(node) {
+			env.Set(name.Value, NULL)
+		}
+	}
+
+	val := e.eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if node.Names != nil {
+		return unpackTuple(node.Names, val, env)
+	}
+	env.Set(node.Name.Value, val)
+	return nil
+}
+
+// 束縛は新しい環境に作るので、本体を評価し終えると見えなくなる
+func (e *Evaluator) evalLetExpression(node *ast.LetExpression, env *object.Environment, tail bool) object.Object {
+	inner := object.NewEnclosedEnvironment(env)
+	if result := e.evalLetStatement(node.Binding, inner); isError(result) {
+		return result
+	}
+	if tail {
+		return e.evalTail(node.Body, inner)
+	}
+	return e.eval(node.Body, inner)
+}
+
+func letNames(node *ast.LetStatement) []*ast.Identifier {
+	if node.Names != nil {
+		return node.Names
+	}
+	return []*ast.Identifier{node.Name}
+}
+
+func (e *Evaluator) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	// 省略された端はnilのまま渡す
+	var bounds [2]object.Object
+	for i, exp := range []ast.Expression{node.Low, node.High} {
+		if exp == nil {
+			continue
+		}
+		bound := e.eval(exp, env)
+		if isError(bound) {
+			return bound
+		}
+		if bound.Type() != object.INTEGER_OBJ {
+			return newError("slice index must be INTEGER, got %s", bound.Type())
+		}
+		bounds[i] = bound
+	}
+
+	switch left := left.(type) {
+	case *object.String:
+		// 文字単位で切り出す
+		runes := []rune(left.Value)
+		low, high := sliceBounds(len(runes), bounds[0], bounds[1])
+		return &object.String{Value: string(runes[low:high])}
+	case *object.Array:
+		low, high := sliceBounds(len(left.Elements), bounds[0], bounds[1])
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return &object.Array{Elements: elements}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// スライスの範囲を長さlengthの列の中に収める。Pythonと同じく負の値は末尾から数え、
+// 範囲外はエラーにせず端に丸める
+func sliceBounds(length int, lowObj, highObj object.Object) (int, int) {
+	clamp := func(obj object.Object, def int) int {
+		if obj == nil {
+			return def
+		}
+		i := int(obj.(*object.Integer).Value)
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+
+	low := clamp(lowObj, 0)
+	high := clamp(highObj, length)
+	if high < low {
+		high = low
+	}
+	return low, high
+}
+
+// 範囲外は配列と同じくNULLを返す
+func evalTupleIndexExpression(tuple, index object.Object) object.Object {
+	tupleObject := tuple.(*object.Tuple)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	max := int64(len(tupleObject.Elements) - 1)
 
 	if idx < 0 || idx > max {
 		return NULL
 	}
-	return arrayObject.Elements[idx]
+	return tupleObject.Elements[idx]
+}
+
+// let x, y = ... の右辺のタプルを分解して、それぞれの名前に束縛する
+func unpackTuple(names []*ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	tuple, ok := val.(*object.Tuple)
+	if !ok {
+		return newError("cannot unpack %s into %d names", val.Type(), len(names))
+	}
+	if len(tuple.Elements) != len(names) {
+		return newError("wrong number of values to unpack: want=%d, got=%d",
+			len(names), len(tuple.Elements))
+	}
+
+	for i, name := range names {
+		env.Set(name.Value, tuple.Elements[i])
+	}
+	return nil
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := &object.Hash{}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	// 書かれた順にキーを追加する
+	for _, keyNode := range node.Keys() {
+		key := e.eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashed, ok := object.HashKeyOf(key)
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashed, object.HashPair{Key: key, Value: value})
+	}
+	return hash
+}
+
+func evalRecordIndexExpression(record *object.Record, index object.Object) object.Object {
+	key, ok := object.HashKeyOf(index)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
 	}
-	return &object.Hash{Pairs: pairs}
+
+	pair, ok := record.Get(key)
+	if !ok {
+		return NULL
+	}
+	return pair.Value
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
@@ -1,10 +1,25 @@
 package evaluator
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
 	"gomadoufu/monkey-interpreter-go/lexer"
 	"gomadoufu/monkey-interpreter-go/object"
 	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/token"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/quick"
+	"time"
 )
 
 func TestEvelIntegerExpression(t *testing.T) {
@@ -27,18 +42,25 @@ func TestEvelIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"let x = 10; x %= 4; x", 2},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
-func testEval(input string) object.Object {
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs)
+	}
 	env := object.NewEnvironment()
 
 	return Eval(program, env)
@@ -59,6 +81,201 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1_000.5", 1000.5},
+		{"3.14 + 1.0", 4.14},
+		{"3 + 1.5", 4.5},
+		{"1.5 + 3", 4.5},
+		{"3.0 / 2", 1.5},
+		{"2 * 0.25", 0.5},
+		{"10 - 0.5", 9.5},
+		{"float(3)", 3},
+		{"float(\"2.5\")", 2.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	// 3.14 + 1.0 のような計算には丸め誤差が出るので、十分近ければ同じとみなす
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestNumberConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3 / 2", "1"},
+		{"int(3.7)", "3"},
+		{"int(-3.7)", "-3"},
+		{"int(\"42\")", "42"},
+		{"float(3)", "3.0"},
+		{"1.5 * 2", "3.0"},
+		{"0.1", "0.1"},
+		{"1.0 / 0", "+Inf"},
+		{"type(1.0)", "FLOAT"},
+		{"1 < 1.5", "true"},
+		{"2.5 > 3", "false"},
+		{"1 == 1.0", "true"},
+		{"1.0 != 1", "false"},
+		{"match 2 { case 2.0: \"two\"; default: \"other\" }", "two"},
+		{"int(\"x\")", "ERROR: int: could not parse \"x\" as integer"},
+		{"int(1.0 / 0)", "ERROR: int: cannot convert +Inf to INTEGER"},
+		{"float(true)", "ERROR: argument to `float` must be INTEGER, FLOAT or STRING, got BOOLEAN"},
+		{"-true", "ERROR: unknown operator: -BOOLEAN"},
+		{"1.5 + \"a\"", "ERROR: type mismatch: FLOAT + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestBigInts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 2つの大きな素数の和
+		{`bigint("170141183460469231731687303715884105727") + bigint("618970019642690137449562111")`, "170141183461088201751329993853333667838"},
+		{`bigint("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{`bigint(9223372036854775807) + 1`, "9223372036854775808"},
+		{`1 - bigint("10000000000000000000")`, "-9999999999999999999"},
+		{`bigint("100000000000000000000") * bigint("100000000000000000000")`, "10000000000000000000000000000000000000000"},
+		{`bigint("100000000000000000007") / 10`, "10000000000000000000"},
+		{`bigint("-100000000000000000007") / 10`, "-10000000000000000000"},
+		{`bigint("100000000000000000007") % 10`, "7"},
+		{`-bigint(5)`, "-5"},
+		{`bigint("100000000000000000000") > 1`, "true"},
+		{`bigint(1) < bigint(2)`, "true"},
+		{`bigint(3) == 3`, "true"},
+		{`3 != bigint(3)`, "false"},
+		{`type(bigint(1))`, "BIGINT"},
+		{`str(bigint("99999999999999999999"))`, "99999999999999999999"},
+		{`int(bigint("9223372036854775807"))`, "9223372036854775807"},
+		{`type(int(bigint(42)))`, "INTEGER"},
+		{`sprintf("%d", bigint("12345678901234567890"))`, "12345678901234567890"},
+		{`int(bigint("9223372036854775808"))`, "ERROR: int: 9223372036854775808 overflows INTEGER"},
+		{`bigint("12x")`, "ERROR: bigint: could not parse \"12x\" as integer"},
+		{`bigint(1.5)`, "ERROR: argument to `bigint` must be INTEGER or STRING, got FLOAT"},
+		{`bigint(1) / 0`, "ERROR: division by zero: 1 / 0"},
+		{`bigint(1) + 1.5`, "ERROR: type mismatch: BIGINT + FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestSortBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, `[a, b, c]`},
+		{`sort([true, false, true])`, "[false, true, true]"},
+		{`sort([2.5, 1, bigint(2)])`, "[1, 2, 2.5]"},
+		{`sort([])`, "[]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`sort([1, 3, 2], fn(a, b) { b - a })`, "[3, 2, 1]"},
+		// 比較関数で等しい要素は元の順序のまま
+		{`sort(["bb", "a", "cc", "d"], fn(a, b) { len(a) - len(b) })`, "[a, d, bb, cc]"},
+		{`min([3, 1, 2])`, "1"},
+		{`max([3, 1, 2])`, "3"},
+		{`min(5, 2.5, 4)`, "2.5"},
+		{`max("apple", "pear", "fig")`, "pear"},
+		{`sort([1, "a"])`, "ERROR: sort: cannot compare STRING with INTEGER"},
+		{`sort([[1], [2]])`, "ERROR: sort: ARRAY is not comparable"},
+		{`sort(1)`, "ERROR: argument to `sort` must be ARRAY, got INTEGER"},
+		{`sort([1, 2], fn(a, b) { true })`, "ERROR: sort: comparator must return INTEGER, got BOOLEAN"},
+		{`sort([1, 2], fn(a, b) { a + "x" })`, "ERROR: type mismatch: INTEGER + STRING"},
+		{`max([])`, "ERROR: max: no elements"},
+		{`min(1, "a")`, "ERROR: min: cannot compare STRING with INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCustomInspect(t *testing.T) {
+	point := `
+	let Point = fn(x, y) {
+		let p = {
+			"x": x,
+			"y": y,
+			"__inspect__": fn() { "(x=" + str(p["x"]) + ", y=" + str(p["y"]) + ")" }
+		};
+		p
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{point + `Point(1, 2)`, "(x=1, y=2)"},
+		{point + `str(Point(1, 2))`, "(x=1, y=2)"},
+		{point + `[Point(1, 2), Point(3, 4)]`, "[(x=1, y=2), (x=3, y=4)]"},
+		{point + `type(Point(1, 2))`, "HASH"},
+		{`{"__inspect__": fn() { return 42; }}`, "42"},
+		// 空文字列も独自の表示として使う
+		{`{"__inspect__": fn() { "" }}`, ""},
+		// 自分自身を表示してもハッシュとして表示して止まる
+		{`let h = {"__inspect__": fn() { "<" + str(h) + ">" }}; h`, "<{__inspect__: fn() {\n((< + str(h)) + >)\n}}>"},
+		// 引数のある関数や関数以外の値、エラーになる関数では普段どおりに表示する
+		{`{"__inspect__": 1}`, "{__inspect__: 1}"},
+		{`{"__inspect__": fn(x) { x }}`, "{__inspect__: fn(x) {\nx\n}}"},
+		{`{"__inspect__": fn() { 1 + true }}`, "{__inspect__: fn() {\n(1 + true)\n}}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	var stdout bytes.Buffer
+	e := NewWithOptions(EvalOptions{Stdout: &stdout})
+	program := parser.New(lexer.New(point + `puts(Point(1, 2));`)).ParseProgram()
+	e.Eval(program, object.NewEnvironment())
+	if stdout.String() != "(x=1, y=2)\n" {
+		t.Errorf("wrong puts output. got=%q", stdout.String())
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -83,10 +300,28 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{"true && true", true},
+		{"true and false", false},
+		{"false || true", true},
+		{"false or false", false},
+		{"1 < 2 and 2 < 3", true},
+		{"1 > 2 or 2 > 3", false},
+		{"true && false or true", true},
+		// 結果は右辺の値ではなく真偽値になる
+		{"true and 5", true},
+		{"false or 0", true},
+		{"false or first([])", false},
+		// 右辺は評価しない
+		{"false and undefined", false},
+		{"true or undefined", true},
+		{"let n = 0; let f = fn() { n = n + 1; true }; false and f(); true or f(); n == 0", true},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
@@ -117,10 +352,17 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"not true", false},
+		{"not false", true},
+		{"not not true", true},
+		// !と同じく、0はtruthyなのでnot 0はfalse
+		{"not 0", false},
+		{"not (1 > 2)", true},
+		{"if (not (1 > 2)) { true } else { false }", true},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
@@ -137,10 +379,15 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"unless (false) { 1 }", 1},
+		{"unless (true) { 1 }", nil},
+		{"unless (1 > 2) { 10 }", 10},
+		{"unless (first([])) { 10 }", 10},
+		{"let x = 5; unless (x > 10) { x * 2 }", 10},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -179,7 +426,7 @@ func TestReturnStatements(t *testing.T) {
 						`, 10},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -192,6 +439,10 @@ func TestErrorHandling(t *testing.T) {
 		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
 		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
 		{"-true", "unknown operator: -BOOLEAN"},
+		{"10 / (5 - 5)", "division by zero: 10 / 0"},
+		{"10 % 0", "division by zero: 10 % 0"},
+		{"fn(a, b) { a }(1)", "wrong number of arguments: want=2, got=1"},
+		{"fn(a) { a }(1, 2)", "wrong number of arguments: want=1, got=2"},
 		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
@@ -209,7 +460,7 @@ func TestErrorHandling(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -234,14 +485,67 @@ func TestLetStatements(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestUnletStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let a = 5; unlet a; a;", "identifier not found: a"},
+		{"let a = 5; unlet a; let a = 6; a;", 6},
+		// 関数の中からは外側の束縛を消せない
+		{"let a = 5; let f = fn() { unlet a; }; f();", "cannot unlet a: not defined in this scope"},
+		// 内側の束縛を消すと外側の束縛が見える
+		{"let a = 5; let f = fn(a) { unlet a; a }; f(1);", 5},
+		{"unlet b;", "cannot unlet b: not defined in this scope"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLetrecStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"letrec fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(4)", 24},
+		{
+			`letrec isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			letrec isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(10)) { if (isOdd(7)) { 1 } else { 0 } } else { 0 }`,
+			1,
+		},
+		{"let f = fn() { letrec count = fn(n) { if (n == 0) { 0 } else { count(n - 1) + 1 } }; count(3) }; f()", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not function. got=%T (%+v)", evaluated, evaluated)
@@ -276,7 +580,7 @@ func TestFunctionApplication(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
@@ -290,158 +594,2684 @@ func TestClosures(t *testing.T) {
 	addTwo(2);
 	`
 
-	testIntegerObject(t, testEval(input), 4)
+	testIntegerObject(t, testEval(t, input), 4)
 }
 
-func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; let b = 1; a = b = 5; a + b", 10},
+		{"let a = 1; let f = fn() { a = a + 1 }; f(); f(); a", 3},
+		{`
+		let makeCounter = fn() {
+			let count = 0;
+			fn() { count = count + 1; count }
+		};
+		let first = makeCounter();
+		let second = makeCounter();
+		first();
+		first();
+		second();
+		first() * 10 + second();
+		`, 32},
+		{"let a = 10; a += 5; a -= 3; a *= 2; a /= 4; a", 6},
+		{`let s = "a"; s += "b"; len(s)`, 2},
+		{"b = 1", "identifier not found: b"},
 	}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
 	}
 }
 
-func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+func TestTailCalls(t *testing.T) {
+	evenOdd := `
+	let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+	let isOdd = fn(n) { if (n == 0) { false } else { return isEven(n - 1); } };
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 相互再帰でもGoのスタックが伸びない
+		{evenOdd + `isEven(1_000_000)`, "true"},
+		{evenOdd + `isOdd(1_000_001)`, "true"},
+		{evenOdd + `isEven(7)`, "false"},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } sum(n - 1, acc + n) }; sum(1_000_000, 0)`, "500000500000"},
+		{`let count = fn(n) { if (n > 0) { count(n - 1) } else { "done" } }; count(1_000_000)`, "done"},
+		// 末尾の位置にない呼び出しは普通に評価する
+		{`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(10)`, "3628800"},
+		{`let f = fn(x) { x }; let g = fn(x) { f(x); 2 }; g(1)`, "2"},
+		// deferがあれば、呼び出した関数が戻ってから実行する
+		{`let order = []; let log = fn(x) { order = push(order, x) };
+		let inner = fn() { log("inner") };
+		let outer = fn() { defer log("deferred"); inner() };
+		outer(); order`, "[inner, deferred]"},
+		{`let gen = fn*(n) { yield n; }; let f = fn() { gen(5) }; next(f())`, "5"},
+		{`let f = fn(a, b) { a }; let g = fn() { f(1) }; g()`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`let f = fn() { 1 + true }; let g = fn() { f() }; g()`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
 	}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
 	}
 }
 
-func TestBuiltinFunctions(t *testing.T) {
+func TestDeferStatements(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected any
 	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
-		{`len([1, 2, 3])`, 3},
-		{`len([])`, 0},
-		{`first([1, 2, 3])`, 1},
-		{`first([])`, nil},
-		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
-		{`last([1, 2, 3])`, 3},
-		{`last([])`, nil},
-		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
-		{`rest([1, 2, 3])`, []int64{2, 3}},
-		{`rest([])`, nil},
-		{`push([], 1)`, []int64{1}},
-		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`
+		let order = "";
+		let f = fn() {
+			defer fn() { order = order + "a" }();
+			defer fn() { order = order + "b" }();
+			order = order + "body";
+		};
+		f();
+		order
+		`, "bodyba"},
+		{`
+		let order = "";
+		let f = fn() {
+			defer fn() { order = order + "deferred" }();
+			return 1;
+			order = order + "unreachable";
+		};
+		f();
+		order
+		`, "deferred"},
+		{`
+		let f = fn() {
+			defer fn() { 100 }();
+			if (true) { return 5; }
+			10
+		};
+		f()
+		`, 5},
+		{`
+		let seen = 0;
+		let record = fn(v) { seen = v };
+		let f = fn() {
+			let x = 1;
+			defer record(x);
+			x = 2;
+		};
+		f();
+		seen
+		`, 1},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
 		case string:
-			errObj, ok := evaluated.(*object.Error)
+			str, ok := evaluated.(*object.String)
 			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
 				continue
 			}
-			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
 			}
 		}
 	}
 }
 
-func TestArrayLiteral(t *testing.T) {
-	input := `[1, 2 * 2, 3 + 3]`
-
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+func TestDeferErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`defer puts("done")`, "defer outside function"},
+		{`let f = fn() { defer missing(); 1 }; f()`, "identifier not found: missing"},
+		{`let f = fn() { defer fn() { 1 + true }(); 1 }; f()`, "type mismatch: INTEGER + BOOLEAN"},
 	}
 
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong number of elements. got=%d", len(result.Elements))
-	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
 }
 
-func TestArrayIndexExpressions(t *testing.T) {
+func TestPanicAndRecover(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected any
 	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
-		{
-			"[1, 2, 3][1]",
-			2,
-		},
-		{
-			"[1, 2, 3][2]",
-			3,
-		},
-		{
-			"let i = 0; [1][i]",
-			1,
-		},
-		{
-			"[1, 2, 3][1 + 1]",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[2]",
-			3,
-		},
-		{
-			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2]",
-			6,
-		},
-		{
-			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
-			2,
-		},
-		{
-			"[1, 2, 3][3]",
-			nil,
-		},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		},
+		{`
+		let log = "";
+		let safeDivide = fn(a, b) {
+			defer fn() {
+				let r = recover();
+				if (r) { log = log + "recovered: " + r; }
+			}();
+			if (b == 0) { panic("division by zero"); }
+			log = log + "unreachable";
+			a / b
+		};
+		safeDivide(1, 0);
+		log
+		`, "recovered: division by zero"},
+		{`
+		let f = fn() {
+			defer fn() { recover() }();
+			panic("boom");
+			1
+		};
+		f()
+		`, nil},
+		{`
+		let caught = "";
+		let inner = fn() { panic("deep"); 1 };
+		let outer = fn() {
+			defer fn() { caught = recover() }();
+			inner() + 1;
+		};
+		outer();
+		caught
+		`, "deep"},
+		{`
+		let f = fn() {
+			defer fn() { recover() }();
+			10
+		};
+		f()
+		`, 10},
+		{`recover()`, nil},
 	}
+
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		default:
 			testNullObject(t, evaluated)
 		}
 	}
 }
 
-func TestHashLiterals(t *testing.T) {
-	input := `let two = "two";
-	{
+func TestUnrecoveredPanic(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`panic("something went wrong")`, "panic: something went wrong"},
+		{`let f = fn() { panic(1); 2 }; f() + 3`, "panic: 1"},
+		{`let f = fn() { defer fn() { 1 }(); panic("still") }; f()`, "panic: still"},
+		{`let f = fn() { recover(); panic("not deferred") }; f()`, "panic: not deferred"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1; }; i", 10},
+		{"let i = 0; while (false) { i = i + 1; }; i", 0},
+		{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i == 3) { return i; } } }; f()", 3},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; until (i == 10) { i = i + 1; }; i", 10},
+		{"let i = 0; until (true) { i = i + 1; }; i", 0},
+		{"let i = 0; until (false) { i = i + 1; break; }; i", 1},
+		{"let i = 0; let n = 0; until (i == 5) { i = i + 1; if (i % 2 == 0) { continue; } n = n + i; }; n", 9},
+		{"let x = 0; do { x += 1 } while (x < 0); x", 1},
+		{"let x = 0; do { x += 1 } while (x < 10); x", 10},
+		{"let x = 0; do { x += 1; break; } while (true); x", 1},
+		{"let x = 0; let n = 0; do { x += 1; if (x % 2 == 0) { continue; } n += x; } while (x < 5); n", 9},
+		{"let x = 0; outer: do { while (true) { x += 1; break outer; } } while (true); x", 1},
+		{"do { 1 } while (false)", nil},
+		{"let x = 0; repeat (5) { x += 1 }; x", 5},
+		{"let x = 0; repeat (0) { x += 1 }; x", 0},
+		{"let x = 0; repeat (10) { x += 1; if (x == 3) { break; } }; x", 3},
+		{"let x = 0; let n = 0; repeat (4) { x += 1; if (x % 2 == 0) { continue; } n += x }; n", 4},
+		// 回数は最初に1回だけ評価する
+		{"let n = 3; let x = 0; repeat (n) { n += 1; x += 1 }; x", 3},
+		{"repeat (2) { 1 }", nil},
+		{"let i = 0; outer: until (false) { until (false) { i = i + 1; break outer; } }; i", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRepeatStatementErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`repeat ("3") { 1 }`, "repeat: count must be INTEGER, got STRING"},
+		{`repeat (1.5) { 1 }`, "repeat: count must be INTEGER, got FLOAT"},
+		{`repeat (-1) { 1 }`, "repeat: count must not be negative, got -1"},
+		{`repeat (missing) { 1 }`, "identifier not found: missing"},
+		{`repeat (2) { missing }`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestTryCatchStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (err) { 2 }`, "1"},
+		{`try { missing } catch (err) { err.message }`, "identifier not found: missing"},
+		{`try { 1 + "a" } catch (err) { "Caught: " + err.message }`, "Caught: type mismatch: INTEGER + STRING"},
+		{`try { missing } catch { "caught" }`, "caught"},
+		{`try { missing; 1 } catch (err) { 2 }`, "2"},
+		// 関数の中で起きたエラーも捕まえる
+		{`let f = fn() { 1 / 0 }; try { f() } catch (err) { err.message }`, "division by zero: 1 / 0"},
+		// catchの名前はハンドラの中だけで見える
+		{`try { missing } catch (err) { 1 }; err`, "ERROR: identifier not found: err"},
+		{`let log = []; try { log = push(log, 1) } finally { log = push(log, 2) }; log`, "[1, 2]"},
+		{`let log = []; try { missing } catch { log = push(log, 1) } finally { log = push(log, 2) }; log`, "[1, 2]"},
+		// catchがなければエラーはfinallyの後に伝わる
+		{`let n = 0; try { try { missing } finally { n = 1 } } catch { }; n`, "1"},
+		{`try { missing } finally { 1 }`, "ERROR: identifier not found: missing"},
+		// ハンドラのエラーは外側に伝わる
+		{`try { missing } catch (err) { other }`, "ERROR: identifier not found: other"},
+		{`try { try { missing } catch (err) { other } } catch (err) { err.message }`, "identifier not found: other"},
+		// returnやbreakは捕まえずにそのまま抜ける
+		{`let f = fn() { try { return 1 } finally { 2 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, "2"},
+		{`let i = 0; while (true) { try { i += 1; break } finally { i += 10 } }; i`, "11"},
+		// パニックはrecoverで扱う
+		{`try { panic("boom") } catch (err) { "caught" }; "after"`, "ERROR: panic: boom"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestThrowStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "something went wrong"`, "ERROR: something went wrong"},
+		{`throw Error("something went wrong")`, "ERROR: something went wrong"},
+		{`throw 42`, "ERROR: 42"},
+		{`throw [1, 2]`, "ERROR: [1, 2]"},
+		{`throw "stop"; 1`, "ERROR: stop"},
+		{`throw missing`, "ERROR: identifier not found: missing"},
+		{`Error(1)`, "ERROR: argument to `Error` must be STRING, got INTEGER"},
+		{`try { throw "oops" } catch (err) { err.message }`, "oops"},
+		{`try { throw Error("oops") } catch (err) { err.message }`, "oops"},
+		{`try { throw 1 + 2 } catch (err) { err.message }`, "3"},
+		// 関数の呼び出しをさかのぼって伝わる
+		{`let f = fn() { throw "deep" }; let g = fn() { f(); 1 }; try { g() } catch (err) { err.message }`, "deep"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f(); 1 }; g()`, "ERROR: deep"},
+		// 捕まえたエラーを投げ直すと、元のメッセージのまま伝わる
+		{`try { try { throw "inner" } catch (err) { throw err } } catch (err) { err.message }`, "inner"},
+		{`throw record({"message": "custom"})`, "ERROR: custom"},
+		{`let n = 0; try { throw "x" } finally { n = 1 }`, "ERROR: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"fn swap(a, b) { return b, a; }; let x, y = swap(1, 2); x * 10 + y", 21},
+		{"fn pair() { return 1, 2 }; pair()[1]", 2},
+		{"fn pair() { return 1, 2 }; pair()[2]", nil},
+		{"fn pair() { return 1, 2 }; pair()[-1]", nil},
+		{"fn one() { return 1 }; one()", 1},
+		{"fn pair() { return 1, 2 }; pair()", "(1, 2)"},
+		{"let x, y = 1", "cannot unpack INTEGER into 2 names"},
+		{"fn pair() { return 1, 2 }; let a, b, c = pair()", "wrong number of values to unpack: want=3, got=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let sum = 0; for (let i = 0; i < 5; i += 1) { sum += i; }; sum", 10},
+		{"let sum = 0; for (let i = 0; i < 10; i += 1) { if (i == 3) { break; } sum += i; }; sum", 3},
+		{"let sum = 0; for (let i = 0; i < 5; i += 1) { if (i == 2) { continue; } sum += i; }; sum", 8},
+		{"let i = 0; for (; i < 3;) { i += 1 }; i", 3},
+		{"let n = 0; for (;;) { n += 1; if (n == 4) { break; } }; n", 4},
+		{
+			`let n = 0;
+			outer: for (let i = 0; i < 3; i += 1) {
+				for (let j = 0; j < 3; j += 1) {
+					if (j == 1) { continue outer; }
+					n += 1;
+				}
+			};
+			n`,
+			3,
+		},
+		{"for (let i = 0; i < 3; i += 1) { }", nil},
+		{"for (let i = 0; i < 3; i += 1) { }; i", "identifier not found: i"},
+		{"let f = fn() { for (let i = 0; true; i += 1) { if (i == 7) { return i; } } }; f()", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{`let s = ""; for (c in "abc") { s = c + s }; s`, "cba"},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { s += k }; s`, "ba"},
+		{"let sum = 0; for (x in (1, 2)) { sum += x }; sum", 3},
+		{"let sum = 0; for (x in set([1, 2, 2])) { sum += x }; sum", 3},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } sum += x }; sum", 4},
+		{"for (x in [1]) { x }", nil},
+		{"for (x in 5) { x }", "not iterable: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil {
+				t.Errorf("no result for %s", tt.input)
+				continue
+			}
+			actual := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				actual = errObj.Message
+			}
+			if actual != expected {
+				t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, expected, actual)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: "x", 1: "y", 2: "z"}`, "{3: x, 1: y, 2: z}"},
+		{`keys({"z": 1, "y": 2, "x": 3})`, "[z, y, x]"},
+		{`keys({})`, "[]"},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, "{b: 4, a: 2, c: 3}"},
+		{`let h = {"a": 1}; merge(h, {"b": 2}); h`, "{a: 1}"},
+		{`copy({"y": 1, "x": 2})`, "{y: 1, x: 2}"},
+		{`keys(1)`, "ERROR: argument to `keys` must be HASH, got INTEGER"},
+		{`merge({}, [])`, "ERROR: argument to `merge` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let arr = [1, 2, 3]; let f = fn(x) { x * 2 }; arr.map(f)[2] == map(arr, f)[2]`, "true"},
+		{`range(5).map(fn(x) { x * x }).filter(fn(x) { x > 5 })`, "[9, 16]"},
+		{`[3, 1, 2].sort().first()`, "1"},
+		{`[1, 2].push(3).len()`, "3"},
+		{`"héllo".len()`, "5"},
+		{`"42".int() + 1`, "43"},
+		{`[1, 2, 3].zip([4, 5, 6])`, "[[1, 4], [2, 5], [3, 6]]"},
+		{`[1, 2, 3].zip([4, 5])`, "[[1, 4], [2, 5]]"},
+		{`[1, 2].zip([3, 4], [5, 6])`, "[[1, 3, 5], [2, 4, 6]]"},
+		{`[1, 2].zip([])`, "[]"},
+		{`[1, 2].zip()`, "[[1], [2]]"},
+		{`zip([1], 2)`, "ERROR: argument to `zip` must be ARRAY, got INTEGER"},
+		{`[[1, [2]], [3]].flatten()`, "[1, 2, 3]"},
+		{`[1, [2, [3, [4]]]].flatten(1)`, "[1, 2, [3, [4]]]"},
+		{`[1, [2, [3, [4]]]].flatten(2)`, "[1, 2, 3, [4]]"},
+		{`[1, [2]].flatten(0)`, "[1, [2]]"},
+		{`[1, "a", {"k": [2]}, (3, [4]), [[]]].flatten()`, "[1, a, {k: [2]}, (3, [4])]"},
+		{`let xs = [[1], [2]]; xs.flatten(); xs`, "[[1], [2]]"},
+		{`[1].flatten(-1)`, "ERROR: flatten: depth must not be negative, got -1"},
+		{`[1].flatten("1")`, "ERROR: depth passed to `flatten` must be INTEGER, got STRING"},
+		{`flatten(1)`, "ERROR: argument to `flatten` must be ARRAY, got INTEGER"},
+		{`[1, 2, 1, 3, 2].uniq()`, "[1, 2, 3]"},
+		{`[1, "a", 1, "b", "a", 2].uniq()`, "[1, a, b, 2]"},
+		{`[3, 1, 2, 2, 2].uniq()`, "[3, 1, 2]"},
+		{`[true, false, true, :ok, :ok].uniq()`, "[true, false, :ok]"},
+		{`let a = [1]; [a, a, [1]].uniq()`, "[[1], [1]]"},
+		{`[].uniq()`, "[]"},
+		{`uniq("ab")`, "ERROR: argument to `uniq` must be ARRAY, got STRING"},
+		{`[1, 2, 1, 1].count(1)`, "3"},
+		{`["a", "b", "a"].count("a")`, "2"},
+		{`[1, 2, 3].count(4)`, "0"},
+		{`[1, 2, 3, 4].count(fn(x) { x > 2 })`, "2"},
+		{`let limit = 1; let over = fn(x) { x > limit }; [1, 2, 3].count(over)`, "2"},
+		{`[1, 2, 3].count()`, "3"},
+		{`[1, 2].count(fn(x) { x + "a" })`, "ERROR: type mismatch: INTEGER + STRING"},
+		{`count(1, 1)`, "ERROR: argument to `count` must be ARRAY, got INTEGER"},
+		{`[1, 2, 3, 4, 5].chunk(2)`, "[[1, 2], [3, 4], [5]]"},
+		{`[1, 2, 3, 4].chunk(2)`, "[[1, 2], [3, 4]]"},
+		{`[1, 2].chunk(5)`, "[[1, 2]]"},
+		{`[].chunk(3)`, "[]"},
+		{`[1].chunk(0)`, "ERROR: chunk: size must be positive, got 0"},
+		{`[1].chunk("2")`, "ERROR: size passed to `chunk` must be INTEGER, got STRING"},
+		{`[1, 2, 3, 4, 5].partition(fn(x) { x % 2 == 0 })`, "[[2, 4], [1, 3, 5]]"},
+		{`[1, 3].partition(fn(x) { x % 2 == 0 })`, "[[], [1, 3]]"},
+		{`[2, 4].partition(fn(x) { x % 2 == 0 })`, "[[2, 4], []]"},
+		{`[].partition(fn(x) { true })`, "[[], []]"},
+		{`let lo = 1; [1, 2, 3].partition(fn(x) { x > lo })`, "[[2, 3], [1]]"},
+		{`[1].partition(fn(x) { x + "a" })`, "ERROR: type mismatch: INTEGER + STRING"},
+		{`partition(1, fn(x) { x })`, "ERROR: argument to `partition` must be ARRAY, got INTEGER"},
+		{`"hello".chars()`, "[h, e, l, l, o]"},
+		{`"héllo".chars()`, "[h, é, l, l, o]"},
+		{`len("héllo".chars())`, "5"},
+		{`"héllo".chars()[1]`, "é"},
+		{`len("héllo".chars()[1])`, "1"},
+		{`"".chars()`, "[]"},
+		{`"hi".bytes()`, "[104, 105]"},
+		{`"é".bytes()`, "[195, 169]"},
+		{`"hé".codepoints()`, "[104, 233]"},
+		{`"🙂".codepoints()`, "[128578]"},
+		{`chars(1)`, "ERROR: argument to `chars` must be STRING, got INTEGER"},
+		{`bytes("a", "b")`, "ERROR: wrong number of arguments. got=2, want=1"},
+		{`{"b": 1, "a": 2}.keys()`, "[b, a]"},
+		{`{"a": 1}.merge({"b": 2})`, "{a: 1, b: 2}"},
+		{`{"a": 1}.merge({"b": 2, "a": 3})`, "{a: 3, b: 2}"},
+		{`{"a": 1}.merge({"a": 2, "b": 2}, {"b": 3, "c": 3})`, "{a: 2, b: 3, c: 3}"},
+		{`{}.merge({"a": 1}, {})`, "{a: 1}"},
+		{`let h = {"a": 1}; let g = {"a": 2}; h.merge(g); [h, g]`, "[{a: 1}, {a: 2}]"},
+		{`{"a": 1}.merge([1])`, "ERROR: argument to `merge` must be HASH, got ARRAY"},
+		{`merge({"a": 1})`, "ERROR: wrong number of arguments. got=1, want=at least 2"},
+		{`{"a": 1, "b": 2}.map_values(fn(v) { v * 10 })`, "{a: 10, b: 20}"},
+		{`{}.map_values(fn(v) { v * 10 })`, "{}"},
+		{`let h = {"a": 1}; h.map_values(fn(v) { v + 1 }); h`, "{a: 1}"},
+		{`{"a": 1, "b": 2, "c": 3}.filter_keys(fn(k) { len(k.chars().filter(fn(c) { c.codepoints()[0] == 98 })) == 0 })`, "{a: 1, c: 3}"},
+		{`{1: "x", 2: "y", 3: "z"}.filter_keys(fn(k) { k % 2 == 1 })`, "{1: x, 3: z}"},
+		{`{1: "x"}.filter_keys(fn(k) { false })`, "{}"},
+		{`let h = {1: "x"}; h.filter_keys(fn(k) { false }); h`, "{1: x}"},
+		{`{"a": 1}.map_values(fn(v) { v + "s" })`, "ERROR: type mismatch: INTEGER + STRING"},
+		{`map_values([1], fn(v) { v })`, "ERROR: argument to `map_values` must be HASH, got ARRAY"},
+		{`42.str()`, "42"},
+		{`42.to_s()`, "42"},
+		{`255.to_s(16)`, "ff"},
+		{`255.to_s(16, true)`, "FF"},
+		{`255.to_s(16, false)`, "ff"},
+		{`8.to_s(2)`, "1000"},
+		{`10.to_s(8)`, "12"},
+		{`10.to_s(10)`, "10"},
+		{`35.to_s(36, true)`, "Z"},
+		{`(-255).to_s(16)`, "-ff"},
+		{`let n = -8; n.to_s(2)`, "-1000"},
+		{`0.to_s(2)`, "0"},
+		{`to_s(255, 16)`, "ff"},
+		{`255.to_s(1)`, "ERROR: to_s: base must be between 2 and 36, got 1"},
+		{`255.to_s(37)`, "ERROR: to_s: base must be between 2 and 36, got 37"},
+		{`255.to_s("16")`, "ERROR: base passed to `to_s` must be INTEGER, got STRING"},
+		{`255.to_s(16, 1)`, "ERROR: upper passed to `to_s` must be BOOLEAN, got INTEGER"},
+		{`"a".to_s()`, "ERROR: undefined method to_s on type STRING"},
+		{`65.to_char()`, "A"},
+		{`"A".to_int()`, "65"},
+		{`"AB".to_int()`, "65"},
+		{`"日本".to_int()`, "26085"},
+		{`26085.to_char()`, "日"},
+		{`0.to_char().len()`, "1"},
+		{`0.to_char().to_int()`, "0"},
+		{`"A".to_int().to_char()`, "A"},
+		{`"A".to_int().to_char() == "A"`, "true"},
+		{`"A".to_int().to_char() != "A"`, "false"},
+		{`"é".to_int().to_char().to_int()`, "233"},
+		{`"ff".to_int(16)`, "255"},
+		{`"-1010".to_int(2)`, "-10"},
+		{`"z".to_int(36)`, "35"},
+		{`"42".to_int(10)`, "42"},
+		{`"".to_int()`, "ERROR: to_int: empty string has no characters"},
+		{`"fg".to_int(16)`, "ERROR: to_int: could not parse \"fg\" as base 16 integer"},
+		{`"1".to_int(37)`, "ERROR: to_int: base must be between 2 and 36, got 37"},
+		{`(-1).to_char()`, "ERROR: to_char: invalid code point -1"},
+		{`55296.to_char()`, "ERROR: to_char: invalid code point 55296"},
+		{`1114112.to_char()`, "ERROR: to_char: invalid code point 1114112"},
+		{`let n = 3; n.float()`, "3.0"},
+		{`[1, 2].map(fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`[1].nope()`, "ERROR: undefined method nope on type ARRAY"},
+		{`true.str()`, "ERROR: undefined method str on type BOOLEAN"},
+		{`"a".map(fn(x) { x })`, "ERROR: undefined method map on type STRING"},
+		{`[1].map(1)`, "ERROR: not a function: INTEGER"},
+		{`undefined_thing.len()`, "ERROR: identifier not found: undefined_thing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestHashMethods(t *testing.T) {
+	builder := `
+let builder = fn() {
+	{
+		"sql": "",
+		"add": fn(self, kw, arg) {
+			let sql = if (len(self["sql"]) == 0) { "" } else { self["sql"] + " " };
+			set_field(self, "sql", sql + kw + " " + arg)
+		},
+		"select": fn(self, cols) { self.add("SELECT", cols) },
+		"from": fn(self, table) { self.add("FROM", table) },
+		"where": fn(self, cond) { self.add("WHERE", cond) },
+		"order_by": fn(self, col) { self.add("ORDER BY", col) },
+		"limit": fn(self, n) { self.add("LIMIT", str(n)) },
+		"build": fn(self) { self["sql"] },
+	}
+};
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{builder + `builder().select("*").from("users").where("id = 1").order_by("name").limit(10).build()`,
+			"SELECT * FROM users WHERE id = 1 ORDER BY name LIMIT 10"},
+		// 途中の結果は変わらないので、枝分かれさせられる
+		{builder + `let base = builder().select("id").from("users"); [base.limit(1).build(), base.build()]`,
+			"[SELECT id FROM users LIMIT 1, SELECT id FROM users]"},
+		{`let counter = {"n": 0, "inc": fn(self) { set_field(self, "n", self["n"] + 1) }}; counter.inc().inc().inc()["n"]`, "3"},
+		// 自分自身を返すメソッド
+		{`let obj = {"tag": "x", "touch": fn(this) { self(this) }}; obj.touch().touch()["tag"]`, "x"},
+		{`let obj = {"f": fn(this) { self(this) }}; obj.f() == obj`, "true"},
+		// 組み込みのメソッドより、ハッシュに入れた関数を優先する
+		{`{"keys": fn(self) { "mine" }}.keys()`, "mine"},
+		{`{"keys": 1}.keys()`, "[keys]"},
+		// partialやonceなどで包んだ関数もメソッドとして呼べる
+		{`{"n": 2, "scale": partial(fn(k, self, x) { self["n"] * k * x }, 10)}.scale(3)`, "60"},
+		{`let h = {"n": 7, "f": once(fn(self) { self["n"] })}; [h.f(), h.f()]`, "[7, 7]"},
+		{`{"n": 4, "f": memoize(fn(self) { self["n"] + 1 })}.f()`, "5"},
+		{`{"n": 3, "add": curry(fn(self, x, y) { self["n"] + x + y })}.add(1)(2)`, "6"},
+		{`{"n": 3, "f": compose(fn(x) { x * 2 }, fn(self) { self["n"] })}.f()`, "6"},
+		{`{"a": 1}.set_field("b", 2).set_field("a", 3)`, "{a: 3, b: 2}"},
+		{`let h = {"a": 1}; set_field(set_field(h, "b", 2), "c", 3); h`, "{a: 1}"},
+		{`set_field(set_field({}, "a", 1), "b", 2)`, "{a: 1, b: 2}"},
+		{`{"f": fn() { 1 }}.f()`, "ERROR: wrong number of arguments: want=0, got=1"},
+		{`{"a": 1}.nope()`, "ERROR: undefined method nope on type HASH"},
+		{`set_field([], "a", 1)`, "ERROR: argument to `set_field` must be HASH, got ARRAY"},
+		{`set_field({}, [], 1)`, "ERROR: unusable as hash key: ARRAY"},
+		{`self(1)`, "ERROR: argument to `self` must be HASH, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestIntegerIterationMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let xs = []; 5.times(fn(i) { xs = push(xs, i) }); xs`, "[0, 1, 2, 3, 4]"},
+		{`3.times(fn(i) { i })`, "null"},
+		{`let n = 0; 0.times(fn(i) { n += 1 }); n`, "0"},
+		{`let n = 0; let m = -3; m.times(fn(i) { n += 1 }); n`, "0"},
+		{`let n = 0; let m = -9223372036854775807 - 1; m.times(fn(i) { n += 1 }); n`, "0"},
+		{`let n = 0; times(-9223372036854775807 - 1, fn(i) { n += 1 }); n`, "0"},
+		{`let xs = []; times(2, fn(i) { xs = push(xs, i) }); xs`, "[0, 1]"},
+		{`let xs = []; 2.upto(5, fn(i) { xs = push(xs, i) }); xs`, "[2, 3, 4, 5]"},
+		{`let xs = []; 5.downto(2, fn(i) { xs = push(xs, i) }); xs`, "[5, 4, 3, 2]"},
+		{`let xs = []; 3.upto(3, fn(i) { xs = push(xs, i) }); xs`, "[3]"},
+		{`let n = 0; 5.upto(2, fn(i) { n += 1 }); n`, "0"},
+		{`let n = 0; 2.downto(5, fn(i) { n += 1 }); n`, "0"},
+		{`let xs = []; 9223372036854775806.upto(9223372036854775807, fn(i) { xs = push(xs, i) }); len(xs)`, "2"},
+		{`let s = 0; 4.times(partial(fn(a, i) { s += a * i }, 10)); s`, "60"},
+		{`3.times(1)`, "ERROR: argument to `times` must be a function, got INTEGER"},
+		{`1.upto("5", fn(i) { i })`, "ERROR: argument to `upto` must be INTEGER, got STRING"},
+		{`1.downto(fn(i) { i })`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`3.times(fn(i) { if (i == 1) { missing } })`, "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestLetExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 5 in x * 2`, "10"},
+		{`1 + let x = 5 in x * 2`, "11"},
+		{`[let x = 2 in x * x, 3]`, "[4, 3]"},
+		{`let x = 1 in let y = 2 in x + y`, "3"},
+		{`let a, b = (1, 2) in a + b`, "3"},
+		// 束縛はlet式の外に漏れない
+		{`let y = let x = 5 in x * 2; x`, "ERROR: identifier not found: x"},
+		{`let x = 1; let y = let x = 5 in x; [x, y]`, "[1, 5]"},
+		// 右辺では外側の同じ名前が見える
+		{`let x = 1; let x = x + 1 in x`, "2"},
+		{`let x = 1; let f = fn() { let x = 10 in x }; [f(), x]`, "[10, 1]"},
+		{`let n = 0; let x = 5 in n = x; n`, "5"},
+		{`let f = fn(n) { if (n == 0) { "done" } else { let m = n - 1 in f(m) } }; f(100_000)`, "done"},
+		{`let x = missing in x`, "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`3 in [1, 2, 3]`, "true"},
+		{`4 in [1, 2, 3]`, "false"},
+		{`"b" in ["a", "b"]`, "true"},
+		{`[1, 2] in [[1, 2], [3]]`, "true"},
+		{`1 in []`, "false"},
+		{`2 in (1, 2)`, "true"},
+		{`"key" in {"key": 1}`, "true"},
+		{`"other" in {"key": 1}`, "false"},
+		{`1 in {"1": 1}`, "false"},
+		{`"x" in record({"x": 1})`, "true"},
+		{`"ell" in "hello"`, "true"},
+		{`"hello" in "world"`, "false"},
+		{`"" in "world"`, "true"},
+		{`5 in first([])`, "false"},
+		{`let xs = [1, 2]; if (2 in xs and 3 in xs) { "both" } else { "not both" }`, "not both"},
+		{`let found = (2 in [1, 2]) in found`, "true"},
+		{`[1] in {}`, "ERROR: unusable as hash key: ARRAY"},
+		{`1 in "123"`, "ERROR: type mismatch: INTEGER in STRING"},
+		{`1 in 2`, "ERROR: unknown operator: INTEGER in INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(true)`, "null"},
+		{`let x = 5; assert_eq(x, 5)`, "null"},
+		{`assert(1 < 2, "math is broken")`, "null"},
+		{`assert_eq("a" + "b", "ab")`, "null"},
+		{`assert_eq([1, (2, 3), {"a": [4]}], [1, (2, 3), {"a": [4]}])`, "null"},
+		{`assert_eq(1, 1.0)`, "null"},
+		{`assert_ne(1, 2)`, "null"},
+		{`assert_ne([1], [2])`, "null"},
+		{`assert(false)`, "ERROR: assertion failed"},
+		{`assert(0 > 1, "zero is not positive")`, "ERROR: zero is not positive"},
+		{`assert_eq(1 + 1, 3)`, "ERROR: assertion failed: 2 != 3"},
+		{`assert_eq({"a": 1}, {"a": 1, "b": 2})`, "ERROR: assertion failed: {a: 1} != {a: 1, b: 2}"},
+		{`assert_eq([1], (1,))`, "ERROR: assertion failed: [1] != (1,)"},
+		{`assert_eq(1, 2, "sum")`, "ERROR: sum: 1 != 2"},
+		{`assert_ne("x", "x")`, "ERROR: assertion failed: x == x"},
+		// 失敗すると残りの文は評価しない
+		{`let ran = false; let f = fn() { assert(false); ran = true }; f(); ran`, "ERROR: assertion failed"},
+		{`assert()`, "ERROR: wrong number of arguments. got=0, want=1 or 2"},
+		{`assert_eq(1)`, "ERROR: wrong number of arguments. got=1, want=2 or 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCollectAssertions(t *testing.T) {
+	input := `
+	let x = 5;
+	assert(x > 1);
+	assert_eq(x, 6);
+	assert_ne(x, 5, "x should change");
+	assert_eq(x, 5);
+	"done"
+	`
+	assertions := &Assertions{}
+	e := NewWithOptions(EvalOptions{Assertions: assertions})
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := e.Eval(program, object.NewEnvironment())
+
+	// 失敗しても最後まで評価する
+	if evaluated.Inspect() != "done" {
+		t.Errorf("evaluation stopped early. got=%q", evaluated.Inspect())
+	}
+	if assertions.Passed != 2 {
+		t.Errorf("wrong number of passed assertions. got=%d", assertions.Passed)
+	}
+	expected := []string{"assertion failed: 5 != 6", "x should change: 5 == 5"}
+	if len(assertions.Failures) != len(expected) {
+		t.Fatalf("wrong failures. got=%q", assertions.Failures)
+	}
+	for i, failure := range expected {
+		if assertions.Failures[i] != failure {
+			t.Errorf("wrong failure %d. expected=%q, got=%q", i, failure, assertions.Failures[i])
+		}
+	}
+
+	// 引数の誤りはアサーションの失敗ではなくエラー
+	evaluated = e.Eval(parser.New(lexer.New(`assert()`)).ParseProgram(), object.NewEnvironment())
+	if evaluated.Inspect() != "ERROR: wrong number of arguments. got=0, want=1 or 2" {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestStructLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let p = struct { x: 1, y: 2 }; p.x`, "1"},
+		{`let p = struct { x: 1, y: 2 }; p.x == 1`, "true"},
+		{`let p = struct { x: 1, y: 2 }; type(p)`, "HASH"},
+		{`let p = struct { x: 1, y: 2 }; p`, "{x: 1, y: 2}"},
+		{`let p = struct { x: 1, y: 2 }; p.x + p["y"]`, "3"},
+		{`struct {}`, "{}"},
+		{`type(struct {})`, "HASH"},
+		{`let line = struct { from: struct { x: 1 }, to: struct { x: 4 } }; line.to.x - line.from.x`, "3"},
+		{`let p = struct { x: 1 }; p.keys()`, "[x]"},
+		{`let p = struct { x: 1 }; p.z`, "null"},
+		{`let a = [1]; a.x`, "ERROR: index operator not supported: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMixin(t *testing.T) {
+	point := `let Point = struct { x: 1, y: 2, inspect: fn() { "point" } };`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{point + `let p = mixin(Point, struct { z: 0 }); [p.keys(), p.z, p["inspect"]()]`, "[[x, y, inspect, z], 0, point]"},
+		{point + `let p = mixin(Point, struct { z: 0, inspect: fn() { "3D point" } }); p["inspect"]()`, "3D point"},
+		{point + `let p = mixin(Point, struct { y: 5 }); [p.x, p.y]`, "[1, 5]"},
+		{point + `mixin(Point, struct { y: 5 }, struct { y: 6, z: 7 }).keys()`, "[x, y, inspect, z]"},
+		{point + `mixin(Point, struct { y: 5 }, struct { y: 6 }).y`, "6"},
+		{point + `Point.mixin(struct { x: 9 }).x`, "9"},
+		// 元のハッシュは変わらない
+		{point + `let extra = struct { x: 9 }; mixin(Point, extra); [Point.x, extra.keys()]`, "[1, [x]]"},
+		// 値はコピーしない
+		{`let a = struct { inner: struct { n: 1 } }; let m = mixin(a, struct { z: 0 }); m.inner == a.inner`, "true"},
+		{`mixin(struct {})`, "ERROR: wrong number of arguments. got=1, want=at least 2"},
+		{`mixin(struct {}, [1])`, "ERROR: argument to `mixin` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`record({"x": 1, "y": 2})`, "record({x: 1, y: 2})"},
+		{`type(record({}))`, "RECORD"},
+		{`let r = record({"x": 1, "y": 2}); [r["x"], r.y, r["z"]]`, "[1, 2, null]"},
+		// 別々に作っても、中身が同じなら等しい
+		{`record({"x": 1, "y": 2}) == record({"x": 1, "y": 2})`, "true"},
+		{`record({"x": 1, "y": 2}) == record({"y": 2, "x": 1})`, "true"},
+		{`record({"x": 1, "y": [1, 2]}) == record({"x": 1, "y": [1, 2]})`, "true"},
+		{`record({"x": 1}) != record({"x": 2})`, "true"},
+		{`record({"x": 1}) == record({"x": 1, "y": 2})`, "false"},
+		// ハッシュは同一性で比べるまま
+		{`{"x": 1} == {"x": 1}`, "false"},
+		{`record({"x": 1}) == {"x": 1}`, "false"},
+		// 中身から作ったハッシュ値で、ハッシュのキーにできる
+		{`let h = {record({"x": 1, "y": 2}): "point"}; h[record({"y": 2, "x": 1})]`, "point"},
+		{`{record({"x": [1]}): 1}`, "ERROR: unusable as hash key: RECORD"},
+		{`let r = record({"x": 1, "y": 2}); let s = record_update(r, "x", 5); [r, s]`, "[record({x: 1, y: 2}), record({x: 5, y: 2})]"},
+		{`record_update(record({"x": 1}), "x", 5) == record({"x": 5})`, "true"},
+		// 変更しようとするとエラーになる
+		{`record_update(record({"x": 1}), "z", 5)`, "ERROR: record_update: record has no key z"},
+		{`mixin(record({"x": 1}), {"x": 2})`, "ERROR: argument to `mixin` must be HASH, got RECORD"},
+		{`merge(record({"x": 1}), {"x": 2})`, "ERROR: argument to `merge` must be HASH, got RECORD"},
+		{`record_update({"x": 1}, "x", 5)`, "ERROR: argument to `record_update` must be RECORD, got HASH"},
+		{`record([1])`, "ERROR: argument to `record` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestPartial(t *testing.T) {
+	add := `let add = fn(a, b) { a + b };`
+	addThree := `let addThree = fn(a, b, c) { a + b + c };`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{add + `let addFive = partial(add, 5); addFive(3)`, "8"},
+		{add + `partial(add, 1, 2)()`, "3"},
+		{addThree + `partial(addThree, 1, 2)(3)`, "6"},
+		{addThree + `partial(partial(addThree, 1), 2)(3)`, "6"},
+		{add + `[1, 2, 3].map(partial(add, 10))`, "[11, 12, 13]"},
+		{`let double = partial(map, [1, 2, 3]); double(fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let double = partial(map, [1, 2, 3]); double()`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`partial(len, "abc")()`, "3"},
+		{add + `type(partial(add, 1))`, "PARTIAL"},
+		{add + `partial(add, 5)()`, "ERROR: wrong number of arguments: want=1, got=0"},
+		{add + `partial(add, 5)(1, 2)`, "ERROR: wrong number of arguments: want=1, got=2"},
+		{add + `partial(add, 1, 2, 3)`, "ERROR: partial: too many arguments: want at most 2, got=3"},
+		{`partial(1, 2)`, "ERROR: argument to `partial` must be a function, got INTEGER"},
+		{`partial()`, "ERROR: wrong number of arguments. got=0, want=at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCurry(t *testing.T) {
+	sum := `let curried = curry(fn(a, b, c) { a + b + c });`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{sum + `curried(1)(2)(3)`, "6"},
+		{sum + `curried(1, 2)(3)`, "6"},
+		{sum + `curried(1)(2, 3)`, "6"},
+		{sum + `curried(1, 2, 3)`, "6"},
+		{sum + `let addOne = curried(1); [addOne(2)(3), addOne(10, 20)]`, "[6, 31]"},
+		{sum + `type(curried(1))`, "CURRIED"},
+		{`let add = fn(a, b) { a + b }; curry(add)(1)(2) == 3`, "true"},
+		{`[1, 2, 3].map(curry(fn(a, b) { a * b })(10))`, "[10, 20, 30]"},
+		{`curry(fn() { 42 })`, "42"},
+		{`curry(push, 2)([1])(2)`, "[1, 2]"},
+		{`curry(len, 1)("abc")`, "3"},
+		{sum + `curried(1, 2)(3, 4)`, "ERROR: wrong number of arguments: want at most 1, got=2"},
+		{`curry(len)`, "ERROR: curry: cannot curry a variadic builtin function without its arity"},
+		{`curry(fn(a) { a }, 1)`, "ERROR: curry: arity can only be given for a builtin function"},
+		{`curry(len, -1)`, "ERROR: curry: arity must not be negative, got -1"},
+		{`curry(1)`, "ERROR: argument to `curry` must be FUNCTION or BUILTIN, got INTEGER"},
+		{`curry()`, "ERROR: wrong number of arguments. got=0, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestComposeAndPipe(t *testing.T) {
+	fns := `let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; let square = fn(x) { x * x };`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fns + `compose(inc, double)(5)`, "11"},
+		{fns + `pipe(inc, double)(5)`, "12"},
+		{fns + `compose(square, double, inc)(2)`, "36"},
+		{fns + `compose(square, double, inc)(2) == square(double(inc(2)))`, "true"},
+		{fns + `pipe(square, double, inc)(2)`, "9"},
+		{fns + `compose(inc)(1)`, "2"},
+		{fns + `let f = compose(len, str); f(12345)`, "5"},
+		{fns + `pipe(partial(fn(a, b) { a + b }, 10), curry(fn(a, b) { a * b })(3))(1)`, "33"},
+		{fns + `compose(compose(inc, inc), pipe(double, double))(1)`, "6"},
+		{fns + `[1, 2].map(pipe(inc, square))`, "[4, 9]"},
+		{fns + `type(pipe(inc))`, "COMPOSED"},
+		{fns + `compose(inc, double)()`, "ERROR: wrong number of arguments: want=1, got=0"},
+		{fns + `compose(inc, double)(1, 2)`, "ERROR: wrong number of arguments: want=1, got=2"},
+		{fns + `pipe(double, fn(x) { x + true }, inc)(1)`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{fns + `compose(inc, fn(a, b) { a })`, "ERROR: functions passed to `compose` must take one argument, got 2"},
+		{fns + `pipe(inc, 1)`, "ERROR: argument to `pipe` must be a function, got INTEGER"},
+		{`compose()`, "ERROR: wrong number of arguments. got=0, want=at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	fib := `let calls = 0;
+let fib = memoize(fn(n) { calls += 1; if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fib + `fib(35)`, "9227465"},
+		// 0から35までをそれぞれ1回だけ計算する
+		{fib + `fib(35); fib(35); calls`, "36"},
+		{fib + `fib(35); len(keys(get_cache(fib)))`, "36"},
+		{fib + `fib(3); get_cache(fib)`, "{(1,): 1, (0,): 0, (2,): 1, (3,): 2}"},
+		{`let add = memoize(fn(a, b) { a + b }); add(1, 2); add(1, 2); add(2, 1); get_cache(add)`, "{(1, 2): 3, (2, 1): 3}"},
+		// 文字列と整数は別のキーになる
+		{`let f = memoize(fn(x) { type(x) }); [f(1), f("1")]`, "[INTEGER, STRING]"},
+		// キャッシュは関数ごとに持つ
+		{`let f = memoize(fn(x) { x }); let g = memoize(fn(x) { x }); f(1); get_cache(g)`, "{}"},
+		// ハッシュのキーにできない引数なら覚えずに呼び出す
+		{`let calls = 0; let f = memoize(fn(arr) { calls += 1; len(arr) }); f([1]); f([1]); [calls, get_cache(f)]`, "[2, {}]"},
+		{`memoize(len)("abc")`, "3"},
+		{`type(memoize(len))`, "MEMOIZED"},
+		{`let f = memoize(fn(x) { x }); get_cache(f).keys().len()`, "0"},
+		{`get_cache(fn(x) { x })`, "ERROR: argument to `get_cache` must be MEMOIZED, got FUNCTION"},
+		{`memoize(1)`, "ERROR: argument to `memoize` must be a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestOnce(t *testing.T) {
+	init := `let calls = 0; let init = once(fn() { calls += 1; calls * 10 });`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{init + `init()`, "10"},
+		{init + `[init(), init(), init()]`, "[10, 10, 10]"},
+		{init + `init(); init(); init(); calls`, "1"},
+		{init + `calls`, "0"},
+		// 2回目からは引数を無視する
+		{`let f = once(fn(x) { x * 2 }); [f(1), f(5)]`, "[2, 2]"},
+		{`let f = once(fn(x) { x * 2 }); let g = once(fn(x) { x * 2 }); [f(1), g(5)]`, "[2, 10]"},
+		{`let f = once(fn() { [] }); f() == f()`, "true"},
+		{`let f = once(partial(push, [1])); [f(2), f(3)]`, "[[1, 2], [1, 2]]"},
+		{`let f = once(fn() { f() }); f()`, "ERROR: once function called itself before returning"},
+		{`type(once(len))`, "ONCE"},
+		{`once(1)`, "ERROR: argument to `once` must be a function, got INTEGER"},
+		{`once()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMapFilterRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2], fn(x) { x * 10 })`, "[10, 20]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, 2], fn(x) { if (false) { 1 } })`, "[]"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(5, 0, -2)`, "[5, 3, 1]"},
+		{`range(0)`, "[]"},
+		{`range(1, 2, 0)`, "ERROR: range: step must not be 0"},
+		{`range("a")`, "ERROR: argument to `range` must be INTEGER, got STRING"},
+		{`map(1, fn(x) { x })`, "ERROR: argument to `map` must be ARRAY, got INTEGER"},
+		{`filter([1])`, "ERROR: wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCursors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let c = cursor([1, 2, 3]); cursor_next(c); cursor_next(c)`, "2"},
+		{`let c = cursor([1, 2]); cursor_peek(c); cursor_peek(c)`, "1"},
+		{`let c = cursor([1]); cursor_next(c); cursor_next(c)`, "null"},
+		{`let c = cursor([1]); cursor_next(c); cursor_peek(c)`, "null"},
+		{`let c = cursor([1, 2]); cursor_next(c); cursor_next(c); cursor_reset(c); cursor_next(c)`, "1"},
+		{`let c = cursor([1, 2, 3]); cursor_next(c); c`, "cursor(1/3)"},
+		{`let c = cursor("héllo"); cursor_next(c); cursor_next(c)`, "é"},
+		{`let c = cursor({"b": 2, "a": 1}); [cursor_next(c), cursor_next(c)]`, "[(b, 2), (a, 1)]"},
+		{`let c = cursor((1, 2)); cursor_next(c)`, "1"},
+		// 作ったときの要素を持つ
+		{`let a = [1]; let c = cursor(a); let a = push(a, 2); cursor_next(c); cursor_next(c)`, "null"},
+		// for-inは残りの要素だけを取り出す
+		{`let c = cursor([1, 2, 3]); cursor_next(c); let sum = 0; for (x in c) { sum += x }; sum`, "5"},
+		{`let c = cursor([1, 2]); for (x in c) { }; cursor_next(c)`, "null"},
+		// 次の要素を返せる値ならcursor_nextで進められる
+		{`fn* two() { yield 1; yield 2 }; let g = two(); cursor_next(g); cursor_next(g)`, "2"},
+		{`type(cursor([]))`, "CURSOR"},
+		{`cursor(1)`, "ERROR: argument to `cursor` must be ARRAY, TUPLE, STRING or HASH, got INTEGER"},
+		{`cursor_next([1])`, "ERROR: argument to `cursor_next` must be CURSOR, got ARRAY"},
+		{`cursor_peek(1)`, "ERROR: argument to `cursor_peek` must be CURSOR, got INTEGER"},
+		{`fn* g() { }; cursor_reset(g())`, "ERROR: argument to `cursor_reset` must be CURSOR, got GENERATOR"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`fn* counter(start) { let i = start; while (true) { yield i; i += 1 } };
+		let c = counter(5); next(c); next(c); next(c)`, 7},
+		{"fn* two() { yield 1; yield 2 }; let g = two(); next(g) + next(g)", 3},
+		{"fn* one() { yield 1 }; let g = one(); next(g); next(g)", nil},
+		{"fn* one() { yield 1 }; let g = one(); next(g); next(g); next(g)", nil},
+		{"fn* empty() { }; next(empty())", nil},
+		{`fn* counter(start) { let i = start; while (true) { yield i; i += 1 } };
+		let sum = 0; for (x in counter(1)) { if (x > 4) { break; } sum += x }; sum`, 10},
+		{"fn* lazy() { puts_missing(); yield 1 }; let g = lazy(); 1", 1},
+		{"fn* bad() { yield 1; 1 + true }; let g = bad(); next(g); next(g)", "type mismatch: INTEGER + BOOLEAN"},
+		{"yield 1", "yield outside generator"},
+		{"fn* g() { let f = fn() { yield 1 }; f() }; next(g())", "yield outside generator"},
+		{"next(1)", "argument to `next` must be GENERATOR, got INTEGER"},
+		{"type(fn*() { }())", "GENERATOR"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("wrong result. expected=%q, got=%q", expected, str.Value)
+				}
+				continue
+			}
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// ループを途中で抜けて捨てたジェネレータは、本体のゴルーチンを残さない
+func TestGeneratorGoroutines(t *testing.T) {
+	input := `fn* naturals() { let i = 0; while (true) { yield i; i += 1 } };
+	for (x in naturals()) { if (x == 2) { break; } }`
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		testEval(t, input)
+	}
+
+	after := 0
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		if after = runtime.NumGoroutine(); after <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("generator goroutines leaked. before=%d, after=%d", before, after)
+}
+
+func TestBreakContinueStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (true) { i = i + 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; let sum = 0; while (i < 5) { i = i + 1; if (i == 2) { continue; } sum = sum + i; }; sum", 13},
+		{"while (true) { break; }", nil},
+		{
+			`let i = 0; let n = 0;
+			outer: while (i < 3) {
+				i = i + 1;
+				let j = 0;
+				while (j < 3) {
+					j = j + 1;
+					if (j == 2) { continue outer; }
+					n = n + 1;
+				}
+			};
+			n`,
+			3,
+		},
+		{
+			`let i = 0;
+			outer: while (true) {
+				while (true) {
+					i = i + 1;
+					break outer;
+				}
+				i = i + 100;
+			};
+			i`,
+			1,
+		},
+		{"let f = fn() { while (true) { return 7; } }; f()", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBreakContinueErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "break outside loop"},
+		{"continue;", "continue outside loop"},
+		{"while (true) { break missing; }", "break label not found: missing"},
+		{"let i = 0; while (i < 1) { i = i + 1; continue missing; }", "continue label not found: missing"},
+		{"let f = fn() { break; }; while (true) { f(); }", "break outside loop"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		opts EvalOptions
+	}{
+		{EvalOptions{Timeout: 50 * time.Millisecond}},
+		{EvalOptions{MaxInstructions: 1000}},
+	}
+
+	for _, tt := range tests {
+		for _, input := range []string{"while (true) {}", "until (false) {}"} {
+			l := lexer.New(input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+
+			start := time.Now()
+			evaluated := NewWithOptions(tt.opts).Eval(program, object.NewEnvironment())
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("evaluation took too long: %s", elapsed)
+			}
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != "execution timeout" {
+				t.Errorf("wrong error message. got=%q", errObj.Message)
+			}
+		}
+	}
+}
+
+func TestExecutionLimitsResetPerEval(t *testing.T) {
+	e := NewWithOptions(EvalOptions{MaxInstructions: 100})
+	env := object.NewEnvironment()
+
+	for i := 0; i < 3; i++ {
+		l := lexer.New("let x = 1 + 2; x")
+		p := parser.New(l)
+		evaluated := e.Eval(p.ParseProgram(), env)
+		testIntegerObject(t, evaluated, 3)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		input   string
+		sandbox bool
+		errMsg  string
+	}{
+		{`puts("x")`, true, "identifier not found: puts"},
+		{`let p = fn() { puts("x") }; p()`, true, "identifier not found: puts"},
+		{`puts("x")`, false, ""},
+		{`len("x")`, true, ""},
+		{`file_read("x")`, true, "identifier not found: file_read"},
+		{`file_write("x", "y")`, true, "identifier not found: file_write"},
+		{`file_append("x", "y")`, true, "identifier not found: file_append"},
+		{`file_exists("x")`, true, "identifier not found: file_exists"},
+		{`os_args()`, true, "identifier not found: os_args"},
+		{`os_env("HOME")`, true, "identifier not found: os_env"},
+		{`exit(0)`, true, "identifier not found: exit"},
+		{`println("x")`, true, "identifier not found: println"},
+		{`eprint("x")`, true, "identifier not found: eprint"},
+		{`eprintln("x")`, true, "identifier not found: eprintln"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		evaluated := NewWithOptions(EvalOptions{Sandbox: tt.sandbox}).Eval(program, object.NewEnvironment())
+
+		errObj, isErr := evaluated.(*object.Error)
+		if tt.errMsg == "" {
+			if isErr {
+				t.Errorf("unexpected error for %q (sandbox=%t): %s", tt.input, tt.sandbox, errObj.Message)
+			}
+			continue
+		}
+		if !isErr {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.errMsg {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.errMsg, errObj.Message)
+		}
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.txt")
+	missing := filepath.Join(dir, "missing.txt")
+
+	env := object.NewEnvironment()
+	env.Set("path", &object.String{Value: path})
+	env.Set("missing", &object.String{Value: missing})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`file_exists(path)`, "false"},
+		{`file_write(path, "héllo ")`, "null"},
+		{`file_exists(path)`, "true"},
+		{`file_read(path)`, "héllo "},
+		{`file_append(path, "world")`, "null"},
+		{`file_read(path)`, "héllo world"},
+		{`file_write(path, "new")`, "null"},
+		{`file_read(path)`, "new"},
+		{`file_read(missing)`, "ERROR: file_read: open " + missing + ": no such file or directory"},
+		{`file_write(1, "x")`, "ERROR: argument to `file_write` must be STRING, got INTEGER"},
+		{`file_read()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		evaluated := Eval(p.ParseProgram(), env)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte{0xff, 0xfe}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l := lexer.New(`file_read(path)`)
+	p := parser.New(l)
+	evaluated := Eval(p.ParseProgram(), env)
+	if evaluated.Inspect() != "ERROR: file_read: "+path+" is not UTF-8 text" {
+		t.Errorf("binary file read returned %q", evaluated.Inspect())
+	}
+}
+
+func TestOSBuiltins(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`os_args()`, "[a, b c]"},
+		{`os_args()[0]`, "a"},
+		{`len(os_args())`, "2"},
+		{`os_env("MONKEY_TEST_VAR")`, "banana"},
+		{`os_env("MONKEY_TEST_UNSET_VAR")`, "null"},
+		{`os_env()["MONKEY_TEST_VAR"]`, "banana"},
+		{`os_args(1)`, "ERROR: wrong number of arguments. got=1, want=0"},
+		{`os_env(1)`, "ERROR: argument to `os_env` must be STRING, got INTEGER"},
+		{`os_env("a", "b")`, "ERROR: wrong number of arguments. got=2, want=0 or 1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		e := NewWithOptions(EvalOptions{Args: []string{"a", "b c"}})
+		evaluated := e.Eval(p.ParseProgram(), object.NewEnvironment())
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestPrintBuiltins(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedOut    string
+		expectedErrOut string
+	}{
+		{`puts("a", 1)`, "a\n1\n", ""},
+		{`println("a", 1)`, "a\n1\n", ""},
+		{`eprint("a", 1, [2])`, "", "a 1 [2]"},
+		{`eprint()`, "", ""},
+		{`eprintln("a", 1)`, "", "a\n1\n"},
+		{`println("out"); eprintln("err"); printf("%d", 3)`, "out\n3", "err\n"},
+	}
+
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		e := NewWithOptions(EvalOptions{Stdout: &out, Stderr: &errOut})
+		evaluated := e.Eval(p.ParseProgram(), object.NewEnvironment())
+		if evaluated != NULL {
+			t.Errorf("%s returned %+v, want NULL", tt.input, evaluated)
+		}
+		if out.String() != tt.expectedOut {
+			t.Errorf("wrong stdout for %s. expected=%q, got=%q", tt.input, tt.expectedOut, out.String())
+		}
+		if errOut.String() != tt.expectedErrOut {
+			t.Errorf("wrong stderr for %s. expected=%q, got=%q", tt.input, tt.expectedErrOut, errOut.String())
+		}
+	}
+}
+
+func TestExitBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`exit()`, 0},
+		{`exit(0)`, 0},
+		{`exit(1)`, 1},
+		{`exit(255)`, 255},
+		{`let x = 1; exit(x + 1); 100`, 2},
+		{`let f = fn() { exit(3); 1 }; [f(), 2]`, 3},
+		{`let i = 0; while (true) { if (i == 2) { exit(i) } i = i + 1; } i`, 2},
+		{`let g = fn() { defer fn() { recover() }(); exit(4) }; g(); 5`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		exit, ok := evaluated.(*object.ExitSignal)
+		if !ok {
+			t.Errorf("object is not ExitSignal. input=%q, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d", tt.input, tt.expected, exit.Code)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`exit(256)`, "exit code must be between 0 and 255, got 256"},
+		{`exit(-1)`, "exit code must be between 0 and 255, got -1"},
+		{`exit("1")`, "argument to `exit` must be INTEGER, got STRING"},
+		{`exit(1, 2)`, "wrong number of arguments. got=2, want=0 or 1"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. input=%q, got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestEvalBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`eval("1 + 2")`, 3},
+		{`let x = 10; eval("x * 2")`, 20},
+		{`let f = fn(a) { eval("a + 1") }; f(41)`, 42},
+		{`eval("let y = 5;"); y`, 5},
+		{`let run = eval; run("7")`, 7},
+		{`eval("let x = ")`, "eval: parser errors: no prefix parse function for EOF found"},
+		{`eval("1 + true")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`eval(1)`, "argument to `eval` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEvalBuiltinInSandbox(t *testing.T) {
+	l := lexer.New(`eval("1 + 2")`)
+	p := parser.New(l)
+
+	evaluated := NewWithOptions(EvalOptions{Sandbox: true}).Eval(p.ParseProgram(), object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "identifier not found: eval" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	evalWith := func(opts EvalOptions, input string) object.Object {
+		p := parser.New(lexer.New(input))
+		return NewWithOptions(opts).Eval(p.ParseProgram(), object.NewEnvironment())
+	}
+
+	// 同じ種からは同じ列が出る
+	sequence := `random_seed(42); [random_int(1, 6), random_int(1, 6), random_float(), random_choice(["a", "b", "c"])]`
+	first := evalWith(EvalOptions{}, sequence).Inspect()
+	if second := evalWith(EvalOptions{}, sequence).Inspect(); first != second {
+		t.Errorf("same seed gave different sequences. first=%s, second=%s", first, second)
+	}
+	reseeded := evalWith(EvalOptions{}, `random_seed(42); random_int(1, 6); random_seed(42); random_int(1, 6)`)
+	if expected := evalWith(EvalOptions{}, `random_seed(42); random_int(1, 6)`); reseeded.Inspect() != expected.Inspect() {
+		t.Errorf("reseeding did not restart the sequence. got=%s, want=%s", reseeded.Inspect(), expected.Inspect())
+	}
+
+	rolls := evalWith(EvalOptions{}, `random_seed(1); let rolls = []; repeat (600) { rolls = push(rolls, random_int(1, 6)) }; rolls`)
+	seen := map[int64]bool{}
+	for _, roll := range rolls.(*object.Array).Elements {
+		n := roll.(*object.Integer).Value
+		if n < 1 || n > 6 {
+			t.Fatalf("random_int(1, 6) out of range. got=%d", n)
+		}
+		seen[n] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("random_int(1, 6) did not produce every value. got=%v", seen)
+	}
+
+	floats := evalWith(EvalOptions{}, `random_seed(1); let fs = []; repeat (100) { fs = push(fs, random_float()) }; fs`)
+	for _, f := range floats.(*object.Array).Elements {
+		if v := f.(*object.Float).Value; v < 0 || v >= 1 {
+			t.Fatalf("random_float() out of range. got=%v", v)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`random_int(5, 5)`, "5"},
+		{`random_int(-3, -3)`, "-3"},
+		{`random_choice([7])`, "7"},
+		{`random_choice([])`, "null"},
+		{`random_seed(1)`, "null"},
+		{`random_int(6, 1)`, "ERROR: random_int: min must not be greater than max, got 6 and 1"},
+		{`random_int(1, "6")`, "ERROR: argument to `random_int` must be INTEGER, got STRING"},
+		{`random_float(1)`, "ERROR: wrong number of arguments. got=1, want=0"},
+		{`random_choice(1)`, "ERROR: argument to `random_choice` must be ARRAY, got INTEGER"},
+		{`random_seed("x")`, "ERROR: argument to `random_seed` must be INTEGER, got STRING"},
+	}
+	for _, tt := range tests {
+		if evaluated := evalWith(EvalOptions{}, tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// サンドボックスではAllowRandomがなければ使えない
+	if evaluated := evalWith(EvalOptions{Sandbox: true}, `random_int(1, 6)`); evaluated.Inspect() != "ERROR: identifier not found: random_int" {
+		t.Errorf("random_int should not be available in the sandbox. got=%s", evaluated.Inspect())
+	}
+	if evaluated := evalWith(EvalOptions{Sandbox: true, AllowRandom: true}, `random_int(3, 3)`); evaluated.Inspect() != "3" {
+		t.Errorf("random_int should be available with AllowRandom. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestUUIDBuiltins(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		evaluated := testEval(t, `uuid()`)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		id := str.Value
+		if len(id) != 36 || strings.Count(id, "-") != 4 {
+			t.Fatalf("wrong UUID format. got=%q", id)
+		}
+		for _, pos := range []int{8, 13, 18, 23} {
+			if id[pos] != '-' {
+				t.Fatalf("hyphen missing at %d. got=%q", pos, id)
+			}
+		}
+		if id != strings.ToLower(id) {
+			t.Errorf("UUID is not lowercase. got=%q", id)
+		}
+		if id[14] != '4' {
+			t.Errorf("wrong version. got=%q", id)
+		}
+		if !strings.ContainsRune("89ab", rune(id[19])) {
+			t.Errorf("wrong variant. got=%q", id)
+		}
+		if seen[id] {
+			t.Errorf("uuid() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`uuid_parse("550e8400-e29b-41d4-a716-446655440000")`, "550e8400-e29b-41d4-a716-446655440000"},
+		{`uuid_parse("550E8400-E29B-41D4-A716-446655440000")`, "550e8400-e29b-41d4-a716-446655440000"},
+		{`uuid_parse("550e8400e29b41d4a716446655440000")`, "550e8400-e29b-41d4-a716-446655440000"},
+		{`uuid_parse(uuid()).len()`, "36"},
+		{`uuid_parse("550e8400-e29b-41d4-a716-44665544000")`, `ERROR: uuid_parse: invalid UUID "550e8400-e29b-41d4-a716-44665544000"`},
+		{`uuid_parse("550e8400-e29b-41d4-a716-44665544000g")`, `ERROR: uuid_parse: invalid UUID "550e8400-e29b-41d4-a716-44665544000g"`},
+		{`uuid_parse("550e8400e-29b-41d4-a716-446655440000")`, `ERROR: uuid_parse: invalid UUID "550e8400e-29b-41d4-a716-446655440000"`},
+		{`uuid_parse("")`, `ERROR: uuid_parse: invalid UUID ""`},
+		{`uuid_parse(1)`, "ERROR: argument to `uuid_parse` must be STRING, got INTEGER"},
+		{`uuid(1)`, "ERROR: wrong number of arguments. got=1, want=0"},
+	}
+	for _, tt := range tests {
+		if evaluated := testEval(t, tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	p := parser.New(lexer.New(`uuid()`))
+	evaluated := NewWithOptions(EvalOptions{Sandbox: true}).Eval(p.ParseProgram(), object.NewEnvironment())
+	if evaluated.Inspect() != "ERROR: identifier not found: uuid" {
+		t.Errorf("uuid should not be available in the sandbox. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestBase64Builtins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`base64_encode("hello")`, "aGVsbG8="},
+		{`base64_decode("aGVsbG8=")`, "hello"},
+		{`base64_encode("")`, ""},
+		{`base64_decode("")`, ""},
+		{`base64_encode("hello", true)`, "aGVsbG8"},
+		{`base64_encode("hello", false)`, "aGVsbG8="},
+		{`base64_encode("hell")`, "aGVsbA=="},
+		{`base64_decode("aGVsbA")`, "hell"},
+		{`base64_encode("日本")`, "5pel5pys"},
+		{`base64_decode("5pel5pys")`, "日本"},
+		{`base64_encode(to_char(0) + "a" + to_char(0))`, "AGEA"},
+		{`base64_decode("AGEA").bytes()`, "[0, 97, 0]"},
+		{`base64_decode("/+8=").bytes()`, "[255, 239]"},
+		{`base64_encode(base64_decode("/+8="))`, "/+8="},
+		{`base64_url_encode(base64_decode("/+8="))`, "_-8="},
+		{`base64_url_encode(base64_decode("/+8="), true)`, "_-8"},
+		{`base64_url_decode("_-8").bytes()`, "[255, 239]"},
+		{`base64_url_decode("aGVsbG8=")`, "hello"},
+		{`base64_decode("_-8=")`, "ERROR: base64_decode: illegal base64 data at input byte 0"},
+		{`base64_url_decode("/+8=")`, "ERROR: base64_url_decode: illegal base64 data at input byte 0"},
+		{`base64_decode("aGVsbG8")`, "hello"},
+		{`base64_decode("aGVsbG8==")`, "ERROR: base64_decode: illegal base64 data at input byte 8"},
+		{`base64_decode("a")`, "ERROR: base64_decode: illegal base64 data at input byte 0"},
+		{`base64_decode("!!!!")`, "ERROR: base64_decode: illegal base64 data at input byte 0"},
+		{`base64_encode(1)`, "ERROR: argument to `base64_encode` must be STRING, got INTEGER"},
+		{`base64_decode([])`, "ERROR: argument to `base64_decode` must be STRING, got ARRAY"},
+		{`base64_encode("a", 1)`, "ERROR: no_padding passed to `base64_encode` must be BOOLEAN, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if evaluated := testEval(t, tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDigestBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sha256("")`, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{`sha256("hello")`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{`sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`sha256("日本").len()`, "64"},
+		{`md5("")`, "d41d8cd98f00b204e9800998ecf8427e"},
+		{`md5("hello")`, "5d41402abc4b2a76b9719d911017c592"},
+		{`md5("The quick brown fox jumps over the lazy dog")`, "9e107d9d372bb6826bd81d3542a419d6"},
+		{`sha256_bytes("").len()`, "32"},
+		{`sha256_bytes("")[0]`, "227"},
+		{`sha256_bytes("")[31]`, "85"},
+		{`sha256_bytes("hello").map(fn(b) { b.to_s(16).pad_left(2, "0") })[0]`, "2c"},
+		{`sha256(1)`, "ERROR: argument to `sha256` must be STRING, got INTEGER"},
+		{`sha256_bytes([])`, "ERROR: argument to `sha256_bytes` must be STRING, got ARRAY"},
+		{`md5(true)`, "ERROR: argument to `md5` must be STRING, got BOOLEAN"},
+		{`md5("a", "b")`, "ERROR: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		if evaluated := testEval(t, tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestURLBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`url_encode("hello world")`, "hello%20world"},
+		{`url_decode("hello%20world")`, "hello world"},
+		{`url_encode("a/b?c#d")`, "a%2Fb%3Fc%23d"},
+		{`url_encode("a&b=c")`, "a&b=c"},
+		{`url_encode("日本")`, "%E6%97%A5%E6%9C%AC"},
+		{`url_decode("%E6%97%A5%E6%9C%AC")`, "日本"},
+		{`url_decode("%e6%97%a5")`, "日"},
+		{`url_decode("a+b")`, "a+b"},
+		{`url_encode("")`, ""},
+		{`url_decode(url_encode("x y/z&=%"))`, "x y/z&=%"},
+		{`url_query_encode("hello world")`, "hello+world"},
+		{`url_query_encode("a&b=c/d")`, "a%26b%3Dc%2Fd"},
+		{`url_query_encode("日本")`, "%E6%97%A5%E6%9C%AC"},
+		{`url_query_decode("hello+world%21")`, "hello world!"},
+		{`url_query_decode(url_query_encode("x y&z=1"))`, "x y&z=1"},
+		{`url_decode("100%")`, `ERROR: url_decode: invalid URL escape "%"`},
+		{`url_decode("%zz")`, `ERROR: url_decode: invalid URL escape "%zz"`},
+		{`url_decode("%4")`, `ERROR: url_decode: invalid URL escape "%4"`},
+		{`url_query_decode("%g1")`, `ERROR: url_query_decode: invalid URL escape "%g1"`},
+		{`url_encode(1)`, "ERROR: argument to `url_encode` must be STRING, got INTEGER"},
+		{`url_decode([])`, "ERROR: argument to `url_decode` must be STRING, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		if evaluated := testEval(t, tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	sign := `let sign = fn(x) {
+		match x { case 0: "zero"; case n if n < 0: "negative"; default: "positive" }
+	};`
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{sign + `sign(0)`, "zero"},
+		{sign + `sign(-5)`, "negative"},
+		{sign + `sign(3)`, "positive"},
+		{`match "b" { case "a": 1; case "b": 2 }`, 2},
+		{`match true { case false: 1; case true: 2 }`, 2},
+		{`match 5 { case n: n * 2 }`, 10},
+		{`match 5 { case _: 1 }`, 1},
+		{`match 5 { case 1: 1; case 2: 2 }`, nil},
+		{`let n = 1; match 5 { case n: n }; n`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`:ok == :ok`, true},
+		{`:ok == :error`, false},
+		{`let f = fn() { :pending }; f() == :pending`, true},
+		{`type(:ok)`, "SYMBOL"},
+		{`str(:ok)`, ":ok"},
+		{`{:ok: 1, :error: 2}[:error]`, 2},
+		{`match :error { case :ok: 1; case :error: 2 }`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+
+	if testEval(t, `:ok`) != testEval(t, `:ok`) {
+		t.Errorf("symbols with the same name are not the same object")
+	}
+}
+
+func TestTuples(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`(1, "hello", true)`, `(1, hello, true)`},
+		{`()`, `()`},
+		{`(1,)`, `(1,)`},
+		{`(1)`, 1},
+		{`(1, 2 * 3)[1]`, 6},
+		{`(1, 2)[2]`, nil},
+		{`len((1, 2, 3))`, 3},
+		{`len(())`, 0},
+		{`type((1, 2))`, "TUPLE"},
+		{`first((1, 2))`, &object.Error{Message: "argument to `first` must be ARRAY, got TUPLE"}},
+		{`let h = {(1, 2): "a", (2, 1): "b"}; h[(2, 1)]`, "b"},
+		{`{(1, [2]): 1}`, &object.Error{Message: "unusable as hash key: TUPLE"}},
+		{`len(set([(1, 2), (1, 2), (2, 1)]))`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		case *object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected.Message {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`len(set([1, 2, 3, 2, 1]))`, 3},
+		{`len(set([]))`, 0},
+		{`type(set([]))`, "SET"},
+		{`set([3, 1, 2, 1])`, "set(1, 2, 3)"},
+		{`set_has(set([1, 2]), 2)`, true},
+		{`set_has(set([1, 2]), 5)`, false},
+		{`if (set_has(set([1]), 5)) { 1 } else { 2 }`, 2},
+		{`let s = set([1]); let t = set_add(s, 2); len(s) * 10 + len(t)`, 12},
+		{`set_remove(set([1, 2]), 1)`, "set(2)"},
+		{`set_union(set([1, 2]), set([2, 3]))`, "set(1, 2, 3)"},
+		{`set_intersection(set([1, 2]), set([2, 3]))`, "set(2)"},
+		{`set_difference(set([1, 2]), set([2, 3]))`, "set(1)"},
+		{`set([:ok, "ok", :ok])`, "set(:ok, ok)"},
+		{`set_add(set([]), [1])`, &object.Error{Message: "unusable as set element: ARRAY"}},
+		{`set([fn(x) { x }])`, &object.Error{Message: "unusable as set element: FUNCTION"}},
+		{`set_union(set([]), [1])`, &object.Error{Message: "argument to `set_union` must be SET, got ARRAY"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		case *object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected.Message {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+// 組み込み関数を追加したときに説明を書き忘れていないかを確認する
+func TestBuiltinDocs(t *testing.T) {
+	for _, name := range BuiltinNames() {
+		builtin, ok := LookupBuiltin(name)
+		if !ok {
+			t.Errorf("builtin %s listed but not found", name)
+			continue
+		}
+		if builtin.Name != name {
+			t.Errorf("builtin registered as %s has wrong Name. got=%q", name, builtin.Name)
+		}
+		if builtin.Doc == "" {
+			t.Errorf("builtin %s has no Doc", name)
+		}
+	}
+
+	for _, builtin := range object.Builtins {
+		if _, ok := LookupBuiltin(builtin.Name); !ok {
+			t.Errorf("builtin %s is not registered in the evaluator", builtin.Name)
+		}
+	}
+}
+
+func TestCopyBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		original string
+	}{
+		{`let a = [1, [2]]; let b = copy(a); b`, "a"},
+		{`let h = {"x": 1}; let c = copy(h); c`, "h"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		copied := Eval(p.ParseProgram(), env)
+		original, _ := env.Get(tt.original)
+
+		if copied == original {
+			t.Errorf("copy returned the same object for %s", tt.original)
+			continue
+		}
+		before := original.Inspect()
+
+		// コピーの方だけを書き換える
+		switch copied := copied.(type) {
+		case *object.Array:
+			if copied.Elements[1] != original.(*object.Array).Elements[1] {
+				t.Errorf("copy is not shallow")
+			}
+			copied.Elements[0] = &object.Integer{Value: 100}
+		case *object.Hash:
+			for _, pair := range copied.Pairs() {
+				key, _ := object.HashKeyOf(pair.Key)
+				copied.Set(key, object.HashPair{Key: pair.Key, Value: &object.Integer{Value: 100}})
+			}
+		default:
+			t.Fatalf("copy returned wrong type. got=%T", copied)
+		}
+
+		if original.Inspect() != before {
+			t.Errorf("original changed. before=%q, after=%q", before, original.Inspect())
+		}
+	}
+
+	testIntegerObject(t, testEval(t, `copy(5)`), 5)
+	testBooleanObject(t, testEval(t, `copy(true)`), true)
+}
+
+func TestSprintf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sprintf("Hello, %s! You are %d years old.", "Bob", 30)`, "Hello, Bob! You are 30 years old."},
+		{`sprintf("%s %v %v", [1, 2], "a", :ok)`, "[1, 2] a :ok"},
+		{`sprintf("%f|%.2f", 1, 2)`, "1.000000|2.00"},
+		{`sprintf("%t %t", true, 1 > 2)`, "true false"},
+		{`sprintf("100%%")`, "100%"},
+		{`sprintf("%5d|%-3s|", 42, "a")`, "   42|a  |"},
+		{`sprintf("%d", "x")`, "ERROR: sprintf: %d expects INTEGER, got STRING"},
+		{`sprintf("%t", 1)`, "ERROR: sprintf: %t expects BOOLEAN, got INTEGER"},
+		{`sprintf("%d %d", 1)`, "ERROR: sprintf: missing argument for %d"},
+		{`sprintf("%d", 1, 2)`, "ERROR: sprintf: too many arguments. got=2, want=1"},
+		{`sprintf("%x", 1)`, "ERROR: sprintf: unknown format verb %x"},
+		{`sprintf("50%")`, `ERROR: sprintf: incomplete format verb at end of "50%"`},
+		{`sprintf(1)`, "ERROR: argument to `sprintf` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello, {}! You are {} years old.".format("Bob", 30)`, "Hello, Bob! You are 30 years old."},
+		{`"Hello, {name}!".format({"name": "Alice"})`, "Hello, Alice!"},
+		{`"{greeting}, {name}!".format(record({"greeting": "Hi", "name": "Bob"}))`, "Hi, Bob!"},
+		{`"{1} {0} {1}".format("a", "b")`, "b a b"},
+		{`"{} {} {0}".format([1, 2], :ok)`, "[1, 2] :ok [1, 2]"},
+		{`"{{}} {{x}} }}".format()`, "{} {x} }"},
+		{`"[{}|{}|{5}|{x}]".format("a")`, "[a|||]"},
+		{`"{}".format("a", "b")`, "a"},
+		{`"{name}".format({"other": 1})`, ""},
+		{`"no braces".format()`, "no braces"},
+		{`format("{}-{}", 1, 2)`, "1-2"},
+		{`"Hello, {name".format({"name": "Alice"})`, "ERROR: format: unclosed { at offset 7 in \"Hello, {name\""},
+		{`format(1)`, "ERROR: argument to `format` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`scan("123 hello true", "%d %s %t")`, "[123, hello, true]"},
+		{`scan("123 hello true", "%d %s %t")[1].len()`, "5"},
+		{`scan("-7 +3", "%d %d")`, "[-7, 3]"},
+		{`scan("1.5 -2 3e2", "%f %f %f")`, "[1.5, -2.0, 300.0]"},
+		{`scan("false", "%t")`, "[false]"},
+		{`scan("x=10,y=20", "x=%d,y=%d")`, "[10, 20]"},
+		{`scan("  42   abc", "%d%s")`, "[42, abc]"},
+		{`scan("50% off", "%d%% %s")`, "[50, off]"},
+		{`scan("1 2 3 4", "%d %d")`, "[1, 2]"},
+		{`scan("", "")`, "[]"},
+		{`scan("hello", "%d")`, `ERROR: scan: %d does not match "hello"`},
+		{`scan("1.5", "%d %s")`, "[1, .5]"},
+		{`scan("1.5", "%d,%s")`, `ERROR: scan: input does not match format at ",%s"`},
+		{`scan("yes", "%t")`, `ERROR: scan: %t does not match "yes"`},
+		{`scan("abc", "%f")`, `ERROR: scan: %f does not match "abc"`},
+		{`scan("1 2", "%d %d %d")`, "ERROR: scan: expected %d but input exhausted"},
+		{`scan("", "%s")`, "ERROR: scan: expected %s but input exhausted"},
+		{`scan("x=1", "y=%d")`, `ERROR: scan: input does not match format at "y=%d"`},
+		{`scan("1", "%x")`, "ERROR: scan: unknown format verb %x"},
+		{`scan("1", "%")`, `ERROR: scan: incomplete format verb at end of "%"`},
+		{`scan(1, "%d")`, "ERROR: argument to `scan` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a,b,c".split(",")`, "[a, b, c]"},
+		{`"a, b,c,  d".split(regexp(",\s*"))`, "[a, b, c, d]"},
+		{`"a, b,c,  d".split(regexp(",\s*")).len()`, "4"},
+		{`"a1b22c".split(regexp("\d+"), 2)`, "[a, b22c]"},
+		{`"a,b,c,d".split(",", 3)`, "[a, b, c,d]"},
+		{`"a,b".split(",", 10)`, "[a, b]"},
+		{`"a,b".split(",", 1)`, "[a,b]"},
+		{`"abc".split("")`, "[a, b, c]"},
+		{`"héllo".split("")`, "[h, é, l, l, o]"},
+		{`"日本語".split("", 2)`, "[日, 本語]"},
+		{`"日本,語".split(",")`, "[日本, 語]"},
+		{"\"  foo   bar\tbaz\n \".split()", "[foo, bar, baz]"},
+		{"\"  foo   bar\tbaz\n \".split().len()", "3"},
+		{`"   ".split()`, "[]"},
+		{`"".split(",")`, "[]"},
+		{`"".split(",").len()`, "1"},
+		{`"a,,b".split(",").len()`, "3"},
+		{`split("a b")`, "[a, b]"},
+		{`"a".split(1)`, "ERROR: separator passed to `split` must be STRING or REGEX, got INTEGER"},
+		{`"a".split(",", "2")`, "ERROR: limit passed to `split` must be INTEGER, got STRING"},
+		{`"a".split(",", 0)`, "ERROR: split: limit must be positive, got 0"},
+		{`split(1, ",")`, "ERROR: argument to `split` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hi".pad_left(5)`, "   hi"},
+		{`"hi".pad_right(5, "-")`, "hi---"},
+		{`"hi".center(6, "*")`, "**hi**"},
+		{`"hi".center(5, "*")`, "*hi**"},
+		{`"hi".center(5)`, " hi  "},
+		{`"x".pad_left(6, "ab")`, "ababax"},
+		{`"x".pad_right(4, "abc")`, "xabc"},
+		{`"x".center(6, "ab")`, "abxaba"},
+		{`"hello".pad_left(5, "*")`, "hello"},
+		{`"hello".pad_right(3)`, "hello"},
+		{`"hello".center(0)`, "hello"},
+		{`"hi".pad_left(-1)`, "hi"},
+		{`"日本".pad_left(4, "・")`, "・・日本"},
+		{`"é".pad_right(3, "ü")`, "éüü"},
+		{`"日本".center(5, "ab").len()`, "5"},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`"hi".pad_left(5, "")`, "ERROR: pad_left: fill must not be empty"},
+		{`"hi".pad_right("5")`, "ERROR: width passed to `pad_right` must be INTEGER, got STRING"},
+		{`"hi".center(5, 0)`, "ERROR: fill passed to `center` must be STRING, got INTEGER"},
+		{`pad_left(1, 5)`, "ERROR: argument to `pad_left` must be STRING, got INTEGER"},
+		{`"hi".center()`, "ERROR: wrong number of arguments. got=1, want=2 or 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("[1, 2, 3]")`, "[1, 2, 3]"},
+		{`json_parse("[0, [true, null]]")[1]`, "[true, null]"},
+		{`json_parse("{}")`, "{}"},
+		{`json_parse("-42")`, "-42"},
+		{`json_stringify([1, "a", true, false])`, `[1,"a",true,false]`},
+		{`json_stringify({"b": 1, "a": {"c": [1, 2]}})`, `{"a":{"c":[1,2]},"b":1}`},
+		{`json_stringify((1, 2))`, "[1,2]"},
+		{`json_stringify(first([]))`, "null"},
+		{`json_stringify("<a&b>")`, `"<a&b>"`},
+		{`json_stringify({1: 2})`, "ERROR: json_stringify: hash key must be STRING, got INTEGER"},
+		{`json_stringify(fn() { 1 })`, "ERROR: json_stringify: FUNCTION has no JSON representation"},
+		{`json_stringify([:ok])`, "ERROR: json_stringify: SYMBOL has no JSON representation"},
+		{`fn* g() { }; json_stringify(g())`, "ERROR: json_stringify: GENERATOR has no JSON representation"},
+		{`json_parse("[1,")`, "ERROR: json_parse: unexpected EOF"},
+		{`json_parse("1.5")`, "1.5"},
+		{`json_parse("1e400")`, "ERROR: json_parse: unsupported number 1e400"},
+		{`json_stringify([2.5, 3.0])`, "[2.5,3]"},
+		{`json_parse("1 2")`, "ERROR: json_parse: unexpected data after top-level value"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		`[1,-2,"three",true,false,null]`,
+		`{"a":1,"b":"x","c":[{"d":null}],"e":{}}`,
+		`"quote \" and unicode é"`,
+		`[]`,
+	}
+
+	for _, input := range inputs {
+		env := object.NewEnvironment()
+		env.Set("input", &object.String{Value: input})
+		l := lexer.New(`json_stringify(json_parse(input))`)
+		p := parser.New(l)
+		evaluated := Eval(p.ParseProgram(), env)
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != input {
+			t.Errorf("round trip changed value. expected=%q, got=%q", input, str.Value)
+		}
+	}
+}
+
+// 循環した値はMonkeyのコードからは作れないので、直接組み立てる
+func TestJSONStringifyCircular(t *testing.T) {
+	arr := &object.Array{}
+	arr.Elements = []object.Object{arr}
+
+	result := object.GetBuiltinByName("json_stringify").Fn(arr)
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", result, result)
+	}
+	if errObj.Message != "json_stringify: circular reference" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	// 同じ配列を2回含むだけなら循環ではない
+	shared := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	result = object.GetBuiltinByName("json_stringify").Fn(&object.Array{Elements: []object.Object{shared, shared}})
+	if result.Inspect() != "[[1],[1]]" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+}
+
+func TestRegexpBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`regexp_match("^hello", "hello world")`, "true"},
+		{`regexp_match("^world", "hello world")`, "false"},
+		{`regexp_match("world$", "hello world")`, "true"},
+		{`regexp_find("\d+", "abc123def")`, "123"},
+		{`regexp_find("[0-9]+", "abc")`, "null"},
+		{`regexp_find("(a)(b)", "xaby")`, "ab"},
+		{`regexp_find_all("\d+", "1a2b3c")`, "[1, 2, 3]"},
+		{`regexp_find_all("\d+", "abc")`, "[]"},
+		{`regexp_replace("\d+", "X", "1a2b3c")`, "XaXbXc"},
+		{`regexp_replace("(\w+)@(\w+)", "$2 at $1", "me@home")`, "home at me"},
+		{`regexp_find("\p{Han}+", "abc日本語def")`, "日本語"},
+		{`regexp_match("^.{3}$", "日本語")`, "true"},
+		{`regexp_match("(", "x")`, "ERROR: regexp_match: error parsing regexp: missing closing ): `(`"},
+		{`regexp_find(1, "x")`, "ERROR: argument to `regexp_find` must be STRING, got INTEGER"},
+		{`regexp_replace("a", "b")`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`regexp("a+b")`, "/a+b/"},
+		{`regexp_find(regexp("\d+"), "ab12cd")`, "12"},
+		{`regexp_replace(regexp("o"), "0", "foo")`, "f00"},
+		{`regexp("(")`, "ERROR: regexp: error parsing regexp: missing closing ): `(`"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int64{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	input := `[1, 2 * 2, 3 + 3]`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong number of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input       string
+		length      int64
+		first, last string
+	}{
+		{"hello", 5, "h", "o"},
+		{"héllo", 5, "h", "o"},
+		{"日本語", 3, "日", "語"},
+		{"a😀b", 3, "a", "b"},
+		{"😀", 1, "😀", "😀"},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, `len("`+tt.input+`")`), tt.length)
+
+		for _, c := range []struct {
+			input    string
+			expected string
+		}{
+			{`"` + tt.input + `"[0]`, tt.first},
+			{`"` + tt.input + `"[-1]`, tt.last},
+			{`let s = ""; for (c in "` + tt.input + `") { s = s + c + "," }; s`, strings.Join(strings.Split(tt.input, ""), ",") + ","},
+		} {
+			evaluated := testEval(t, c.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != c.expected {
+				t.Errorf("wrong result for %s. expected=%q, got=%q", c.input, c.expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[-1]`, "o"},
+		{`let s = "hello"; s[-len(s)]`, "h"},
+		{`"héllo"[1]`, "é"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-6]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[2:]`, "llo"},
+		{`"hello"[:3]`, "hel"},
+		{`"hello"[:]`, "hello"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[:-1]`, "hell"},
+		{`"hello"[3:1]`, ""},
+		{`"hello"[-10:10]`, "hello"},
+		{`"héllo"[1:2]`, "é"},
+		{`let n = 2; "hello"[0:n]`, "he"},
+		{`[1, 2, 3, 4][1:3]`, "[2, 3]"},
+		{`[1, 2, 3][-2:]`, "[2, 3]"},
+		{`[1, 2, 3][5:]`, "[]"},
+		{`let a = [1, 2, 3]; let b = a[:]; push(b, 4); a`, "[1, 2, 3]"},
+		{`"hello"["a":]`, "ERROR: slice index must be INTEGER, got STRING"},
+		{`5[1:2]`, "ERROR: slice operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
+			2,
+		},
+		{
+			"[1, 2, 3][2]",
+			3,
+		},
+		{
+			"let i = 0; [1][i]",
+			1,
+		},
+		{
+			"[1, 2, 3][1 + 1]",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[2]",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2]",
+			6,
+		},
+		{
+			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+			2,
+		},
+		{
+			"[1, 2, 3][3]",
+			nil,
+		},
+		{
+			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"let a = [1, 2, 3]; a[-len(a)]",
+			1,
+		},
+		{
+			"let a = [1, 2, 3]; a[-len(a) - 1]",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
 		"one": 10 - 9,
 		two: 1 + 1,
 		"thr" + "ee": 6 / 2,
@@ -449,7 +3279,7 @@ func TestHashLiterals(t *testing.T) {
 		true: 5,
 		false: 6
 	}`
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
@@ -463,12 +3293,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong number of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong number of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -512,7 +3342,7 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -521,3 +3351,329 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+// 失敗したときは、表示されたシードを -roundtrip.seed に渡すと同じプログラムで再現できる
+var roundTripSeed = flag.Int64("roundtrip.seed", 1, "seed for the programs generated by TestEvalRoundTrip")
+
+// ランダムに組み立てたプログラムを評価し、どんなプログラムでも成り立つ性質を調べる
+func TestEvalRoundTrip(t *testing.T) {
+	config := &quick.Config{MaxCount: 1000, Rand: rand.New(rand.NewSource(*roundTripSeed))}
+
+	property := func(rp randomProgram) (ok bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("evaluation panicked: %v\nprogram: %s", r, rp.program.String())
+				ok = false
+			}
+		}()
+
+		result := Eval(rp.program, object.NewEnvironment())
+		// 結果は常にobject.Objectで、nilにはならない
+		if result == nil {
+			t.Errorf("result is nil\nprogram: %s", rp.program.String())
+			return false
+		}
+		// 評価器の内部で使うオブジェクトが外に出てこない
+		if !generatedResultTypes[result.Type()] {
+			t.Errorf("unexpected result type %s\nprogram: %s", result.Type(), rp.program.String())
+			return false
+		}
+		_ = result.Inspect()
+		return true
+	}
+
+	if err := quick.Check(property, config); err != nil {
+		t.Errorf("seed %d: %s", *roundTripSeed, err)
+	}
+}
+
+// 生成したプログラムの結果になりうる型。エラーは型の合わない演算などで起きる
+var generatedResultTypes = map[object.ObjectType]bool{
+	object.INTEGER_OBJ:  true,
+	object.BOOLEAN_OBJ:  true,
+	object.NULL_OBJ:     true,
+	object.FUNCTION_OBJ: true,
+	object.ERROR_OBJ:    true,
+}
+
+// 関数の定義を並べ、最後に式を1つ置いたプログラム
+// 関数の本体からは前に定義した関数だけを呼ぶので、評価は必ず終わる
+type randomProgram struct {
+	program *ast.Program
+}
+
+func (randomProgram) Generate(r *rand.Rand, size int) reflect.Value {
+	g := &programGenerator{rand: r}
+	program := &ast.Program{}
+
+	for i, n := 0, r.Intn(4); i < n; i++ {
+		name := fmt.Sprintf("f%d", i)
+		params := []*ast.Identifier{}
+		for j, n := 0, r.Intn(3); j < n; j++ {
+			params = append(params, g.identifier(fmt.Sprintf("p%d", j)))
+		}
+		g.vars = params
+		body := g.expression(size / 10)
+		g.vars = nil
+
+		fn := &ast.FunctionLiteral{
+			Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Parameters: params,
+			Body:       g.block(body),
+			Name:       name,
+		}
+		program.Statements = append(program.Statements, &ast.LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  g.identifier(name),
+			Value: fn,
+		})
+		g.funcs = append(g.funcs, fn)
+	}
+
+	program.Statements = append(program.Statements, &ast.ExpressionStatement{Expression: g.expression(size / 10)})
+	return reflect.ValueOf(randomProgram{program: program})
+}
+
+type programGenerator struct {
+	rand *rand.Rand
+	// 式から参照できる引数と、呼び出せる関数
+	vars  []*ast.Identifier
+	funcs []*ast.FunctionLiteral
+}
+
+var generatedOperators = []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+
+// depthが0になるまで入れ子の式を作る
+func (g *programGenerator) expression(depth int) ast.Expression {
+	if depth <= 0 {
+		return g.leaf()
+	}
+
+	switch g.rand.Intn(6) {
+	case 0:
+		op := "-"
+		if g.rand.Intn(2) == 0 {
+			op = "!"
+		}
+		return &ast.PrefixExpression{Token: token.Token{Literal: op}, Operator: op, Right: g.expression(depth - 1)}
+	case 1, 2:
+		op := generatedOperators[g.rand.Intn(len(generatedOperators))]
+		return &ast.InfixExpression{
+			Token:    token.Token{Literal: op},
+			Left:     g.expression(depth - 1),
+			Operator: op,
+			Right:    g.expression(depth - 1),
+		}
+	case 3:
+		exp := &ast.IfExpression{
+			Token:       token.Token{Type: token.IF, Literal: "if"},
+			Condition:   g.expression(depth - 1),
+			Consequence: g.block(g.expression(depth - 1)),
+		}
+		if g.rand.Intn(2) == 0 {
+			exp.Alternative = g.block(g.expression(depth - 1))
+		}
+		return exp
+	case 4:
+		if len(g.funcs) > 0 {
+			fn := g.funcs[g.rand.Intn(len(g.funcs))]
+			// 引数の数はときどき間違える
+			n := len(fn.Parameters)
+			if g.rand.Intn(10) == 0 {
+				n = g.rand.Intn(3)
+			}
+			args := []ast.Expression{}
+			for i := 0; i < n; i++ {
+				args = append(args, g.expression(depth-1))
+			}
+			return &ast.CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "("}, Function: g.identifier(fn.Name), Arguments: args}
+		}
+	}
+	return g.leaf()
+}
+
+func (g *programGenerator) leaf() ast.Expression {
+	switch g.rand.Intn(4) {
+	case 0:
+		return &ast.Boolean{Token: token.Token{Literal: strconv.FormatBool(g.rand.Intn(2) == 0)}, Value: g.rand.Intn(2) == 0}
+	case 1:
+		if len(g.vars) > 0 {
+			return g.identifier(g.vars[g.rand.Intn(len(g.vars))].Value)
+		}
+	}
+	// 0での割り算も起きるように、小さい整数を多めに出す
+	value := int64(g.rand.Intn(5))
+	if g.rand.Intn(4) == 0 {
+		value = g.rand.Int63()
+	}
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10)}, Value: value}
+}
+
+func (g *programGenerator) identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func (g *programGenerator) block(exp ast.Expression) *ast.BlockStatement {
+	return &ast.BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+		Statements: []ast.Statement{&ast.ExpressionStatement{Expression: exp}},
+	}
+}
+
+// ベンチマークの入力。新しいプログラムはここに足す
+// go test -bench=Eval ./evaluator
+var benchmarkPrograms = []struct {
+	name  string
+	input string
+}{
+	{"fib25", benchmarkFibonacci(25)},
+	{"collections", `
+let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}];
+let ages = [];
+for (p in people) { ages = push(ages, p["age"]); }
+let total = 0;
+for (let i = 0; i < len(ages); i += 1) { total += ages[i]; }
+[total, ages[1:], :ok];
+`},
+}
+
+func benchmarkFibonacci(n int) string {
+	return fmt.Sprintf(`
+let fibonacci = fn(x) {
+	if (x == 0) { return 0; }
+	if (x == 1) { return 1; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(%d);
+`, n)
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, bm := range benchmarkPrograms {
+		b.Run(bm.name, func(b *testing.B) {
+			benchmarkEval(b, bm.input)
+		})
+	}
+}
+
+// 再帰呼び出しのオーバーヘッドを測る。1回に数秒かかる
+func BenchmarkEvalFib35(b *testing.B) {
+	benchmarkEval(b, benchmarkFibonacci(35))
+}
+
+// 構文解析は計測に含めず、評価だけをb.N回繰り返す
+func benchmarkEval(b *testing.B, input string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		b.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := Eval(program, object.NewEnvironment())
+		if isError(result) {
+			b.Fatalf("evaluation failed: %s", result.Inspect())
+		}
+	}
+}
+
+func TestClockTimeAndSleep(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		input    string
+		sandbox  bool
+		expected string
+	}{
+		// 時計は読むたびに1.5秒進む。1回目はNewWithOptionsが読む
+		{`clock()`, false, "1500000000"},
+		{`let a = clock(); let b = clock(); b - a`, false, "1500000000"},
+		{`time()`, false, "1700000001"},
+		{`[time(), time()]`, false, "[1700000001, 1700000003]"},
+		{`sleep(1)`, false, "null"},
+		{`sleep(5)`, true, "null"},
+		{`sleep(1001)`, true, "ERROR: sleep: at most 1000ms is allowed in the sandbox, got 1001"},
+		{`sleep(-1)`, false, "ERROR: sleep: duration must not be negative, got -1"},
+		{`sleep("1")`, false, "ERROR: argument to `sleep` must be INTEGER, got STRING"},
+		{`clock(1)`, false, "ERROR: wrong number of arguments. got=1, want=0"},
+		{`time(1)`, false, "ERROR: wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		now := start
+		clock := func() time.Time {
+			current := now
+			now = now.Add(1500 * time.Millisecond)
+			return current
+		}
+		e := NewWithOptions(EvalOptions{Sandbox: tt.sandbox, ClockFunc: clock})
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := e.Eval(program, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSleepStopsAtTimeout(t *testing.T) {
+	e := NewWithOptions(EvalOptions{Timeout: 20 * time.Millisecond})
+	program := parser.New(lexer.New(`sleep(5000); 1`)).ParseProgram()
+
+	began := time.Now()
+	evaluated := e.Eval(program, object.NewEnvironment())
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("sleep did not stop at the timeout. took %s", elapsed)
+	}
+	if evaluated.Inspect() != "ERROR: execution timeout" {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestEnvSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.env")
+
+	var errOut bytes.Buffer
+	saver := NewWithOptions(EvalOptions{Stderr: &errOut})
+	input := `let n = 42; let s = "hello"; let ok = true;
+	let arr = [1, "two", [3]]; let h = {"a": 1, "b": [true]};
+	let f = fn(x) { x };
+	env_save("` + path + `")`
+	saved := saver.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if saved.Inspect() != "5" {
+		t.Fatalf("wrong number of saved bindings. got=%q", saved.Inspect())
+	}
+	if errOut.String() != "env_save: skipping f: FUNCTION has no JSON representation\n" {
+		t.Errorf("wrong warning. got=%q", errOut.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`env_load("` + path + `")`, "5"},
+		{`env_load("` + path + `"); [n, s, ok]`, "[42, hello, true]"},
+		{`env_load("` + path + `"); [arr, h["a"], h["b"]]`, "[[1, two, [3]], 1, [true]]"},
+		{`let n = 1; env_load("` + path + `"); n`, "42"},
+		{`env_load("` + path + `"); f`, "ERROR: identifier not found: f"},
+		{`env_load("` + filepath.Join(t.TempDir(), "missing.env") + `")`, "ERROR: env_load: open "},
+		{`env_save(1)`, "ERROR: argument to `env_save` must be STRING, got INTEGER"},
+		{`env_load()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || !strings.HasPrefix(evaluated.Inspect(), tt.expected) {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	// 関数の中から呼んでも、外側の束縛を含めて保存する
+	errOut.Reset()
+	nested := `let x = 1; let save = fn(y) { env_save("` + path + `") }; save(2)`
+	evaluated := saver.Eval(parser.New(lexer.New(nested)).ParseProgram(), object.NewEnvironment())
+	if evaluated.Inspect() != "2" {
+		t.Errorf("wrong number of saved bindings from a function. got=%q", evaluated.Inspect())
+	}
+}
@@ -0,0 +1,80 @@
+package evaluator
+
+import (
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/object"
+)
+
+// 型ごとに呼び出せるメソッドの名前。obj.name(args) は組み込み関数 name(obj, args) になる
+// ハッシュのnameに関数が入っていれば、そちらを先に使う
+var methods = map[object.ObjectType][]string{
+	object.ARRAY_OBJ: {
+		"len", "first", "last", "rest", "push", "copy",
+		"map", "filter", "sort", "min", "max", "cursor",
+		"zip", "flatten", "uniq", "count", "chunk", "partition",
+	},
+	object.STRING_OBJ:  {"len", "int", "float", "bigint", "cursor", "chars", "bytes", "codepoints", "format", "split", "pad_left", "pad_right", "center", "to_int"},
+	object.HASH_OBJ:    {"keys", "merge", "mixin", "copy", "cursor", "set_field", "map_values", "filter_keys"},
+	object.INTEGER_OBJ: {"str", "to_s", "to_char", "float", "bigint", "times", "upto", "downto"},
+}
+
+// 型のメソッドに対応する組み込み関数を返す。なければfalseを返す
+func lookupMethod(t object.ObjectType, name string) (*object.Builtin, bool) {
+	for _, method := range methods[t] {
+		if method == name {
+			return builtins[name], true
+		}
+	}
+	return nil, false
+}
+
+// レシーバを最初の引数にして、メソッドに対応する組み込み関数を呼び出す
+func (e *Evaluator) evalMethodCallExpression(node *ast.MethodCallExpression, env *object.Environment) object.Object {
+	receiver := e.eval(node.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	// モジュールの関数は、モジュールを引数に含めずに呼び出す
+	if module, ok := receiver.(*object.Module); ok {
+		fn := evalModuleMember(module, node.Method.Value)
+		if isError(fn) {
+			return fn
+		}
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return e.applyFunction(fn, args)
+	}
+
+	var fn object.Object
+	if hash, ok := receiver.(*object.Hash); ok {
+		fn = hashMethod(hash, node.Method.Value)
+	}
+	if fn == nil {
+		builtin, ok := lookupMethod(receiver.Type(), node.Method.Value)
+		if !ok {
+			return newError("undefined method %s on type %s", node.Method.Value, receiver.Type())
+		}
+		fn = builtin
+	}
+
+	args := e.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	return e.applyFunction(fn, append([]object.Object{receiver}, args...))
+}
+
+// ハッシュのnameに入っている関数を返す。関数でなければnilを返す
+func hashMethod(hash *object.Hash, name string) object.Object {
+	pair, ok := hash.Get((&object.String{Value: name}).HashKey())
+	if !ok {
+		return nil
+	}
+	if !isCallable(pair.Value) {
+		return nil
+	}
+	return pair.Value
+}
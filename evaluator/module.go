@@ -0,0 +1,125 @@
+package evaluator
+
+import (
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// モジュールを探すディレクトリを並べた環境変数。区切りはPATHと同じ
+const modulePathEnv = "MONKEY_PATH"
+
+// ファイルを読むので、サンドボックスでは使えない
+func (e *Evaluator) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if e.opts.Sandbox {
+		return newError("import is not allowed in the sandbox")
+	}
+
+	module := e.importModule(node.Path.Value)
+	if isError(module) {
+		return module
+	}
+	env.Set(node.Name(), module)
+	return nil
+}
+
+// モジュールを読み込んで評価する。一度読み込んだファイルは評価し直さずに同じモジュールを返す
+func (e *Evaluator) importModule(name string) object.Object {
+	path, ok := findModule(name)
+	if !ok {
+		return newError("module %s not found", name)
+	}
+	if module, ok := e.modules[path]; ok {
+		return module
+	}
+	if e.importing[path] {
+		return newError("circular import detected")
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return newError("import %s: %s", name, err)
+	}
+	p := parser.New(lexer.NewWithFile(string(src), path))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("import %s: %s", name, strings.Join(p.Errors(), "; "))
+	}
+
+	// モジュールは自分だけの環境で評価する
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded := ExpandMacros(program, env).(*ast.Program)
+
+	if e.importing == nil {
+		e.importing = map[string]bool{}
+	}
+	e.importing[path] = true
+	result := e.eval(expanded, env)
+	delete(e.importing, path)
+	if isError(result) {
+		return result
+	}
+
+	module := &object.Module{Name: name, Path: path, Env: env, Exports: exportedNames(expanded)}
+	if e.modules == nil {
+		e.modules = map[string]*object.Module{}
+	}
+	e.modules[path] = module
+	return module
+}
+
+// カレントディレクトリ、MONKEY_PATHのディレクトリの順にモジュールのファイルを探し、絶対パスを返す
+func findModule(name string) (string, bool) {
+	file := filepath.FromSlash(name)
+	if !strings.HasSuffix(file, ".monkey") {
+		file += ".monkey"
+	}
+
+	candidates := []string{file}
+	if !filepath.IsAbs(file) {
+		for _, dir := range filepath.SplitList(os.Getenv(modulePathEnv)) {
+			candidates = append(candidates, filepath.Join(dir, file))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if abs, err := filepath.Abs(candidate); err == nil {
+			return abs, true
+		}
+		return candidate, true
+	}
+	return "", false
+}
+
+// トップレベルでexportした名前を定義した順に返す
+func exportedNames(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Exported {
+			for _, name := range letNames(let) {
+				names = append(names, name.Value)
+			}
+		}
+	}
+	return names
+}
+
+// module.name の値。exportしていない名前は参照できない
+func evalModuleMember(module *object.Module, name string) object.Object {
+	if val, ok := module.Get(name); ok {
+		return val
+	}
+	if _, ok := module.Env.Get(name); ok {
+		return newError("%s is not exported by module %s", name, module.Name)
+	}
+	return newError("module %s has no member %s", module.Name, name)
+}
@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirにモジュールのファイルを書き、MONKEY_PATHをdirにする
+func writeModules(t *testing.T, modules map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range modules {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("MONKEY_PATH", dir)
+	return dir
+}
+
+func TestImport(t *testing.T) {
+	writeModules(t, map[string]string{
+		"math.monkey": `
+export let PI = 3;
+export let square = fn(x) { x * x };
+export fn cube(x) { x * square(x) }
+let secret = 42;
+export let area = fn(r) { PI * square(r) };
+`,
+		"lib/strings.monkey": `export let shout = fn(s) { s + "!" };`,
+		"counter.monkey": `
+export let loaded = fn() { loads };
+let loads = 0;
+loads += 1;
+`,
+		"uses_math.monkey": `
+import "math";
+export let twoPi = 2 * math.PI;
+`,
+		"a.monkey":      `import "b"; export let x = 1;`,
+		"b.monkey":      `import "a"; export let y = 2;`,
+		"self.monkey":   `import "self";`,
+		"broken.monkey": `let = 1;`,
+		"failing.monkey": `
+export let ok = 1;
+1 + true;
+`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math"; math.PI`, "3"},
+		{`import "math"; math.square(4)`, "16"},
+		{`import "math"; math.cube(2)`, "8"},
+		{`import "math"; math.area(2)`, "12"},
+		{`import "math"; math["PI"]`, "3"},
+		{`import "math"; let f = math.square; f(5)`, "25"},
+		{`import "math"; [1, 2].map(math.square)`, "[1, 4]"},
+		{`import "math" as m; m.square(3)`, "9"},
+		{`import "math" as m; math`, "ERROR: identifier not found: math"},
+		{`import "math"; math`, "module math"},
+		{`import "math"; type(math)`, "MODULE"},
+		{`import "math.monkey"; math.PI`, "3"},
+		{`import "lib/strings"; strings.shout("hi")`, "hi!"},
+		{`import "uses_math"; uses_math.twoPi`, "6"},
+		// 一度読み込んだモジュールは評価し直さない
+		{`import "counter"; import "counter" as again; [counter.loaded(), again.loaded()]`, "[1, 1]"},
+		{`let f = fn() { import "math"; math.PI }; f()`, "3"},
+		{`import "math"; math.secret`, "ERROR: secret is not exported by module math"},
+		{`import "math"; math.nope`, "ERROR: module math has no member nope"},
+		{`import "math"; math.nope(1)`, "ERROR: module math has no member nope"},
+		{`import "math"; secret`, "ERROR: identifier not found: secret"},
+		{`import "missing"`, "ERROR: module missing not found"},
+		{`import "a"`, "ERROR: circular import detected"},
+		{`import "self"`, "ERROR: circular import detected"},
+		{`import "failing"`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	broken := testEval(t, `import "broken"`)
+	if err, ok := broken.(*object.Error); !ok || err.Message == "" {
+		t.Errorf("importing a module with parser errors should fail. got=%+v", broken)
+	}
+}
+
+func TestImportFromCurrentDirectory(t *testing.T) {
+	pathDir := writeModules(t, map[string]string{"config.monkey": `export let where = "path";`})
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "config.monkey"), []byte(`export let where = "cwd";`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// カレントディレクトリをMONKEY_PATHより先に探す
+	if got := testEval(t, `import "config"; config.where`).Inspect(); got != "cwd" {
+		t.Errorf("wrong module imported. got=%q", got)
+	}
+
+	if err := os.Chdir(pathDir); err != nil {
+		t.Fatal(err)
+	}
+	if got := testEval(t, `import "config"; config.where`).Inspect(); got != "path" {
+		t.Errorf("wrong module imported. got=%q", got)
+	}
+}
+
+func TestImportInSandbox(t *testing.T) {
+	writeModules(t, map[string]string{"math.monkey": `export let PI = 3;`})
+
+	program := parser.New(lexer.New(`import "math"; math.PI`)).ParseProgram()
+	e := NewWithOptions(EvalOptions{Sandbox: true})
+	evaluated := e.Eval(program, object.NewEnvironment())
+	if evaluated.Inspect() != "ERROR: import is not allowed in the sandbox" {
+		t.Errorf("import should fail in the sandbox. got=%q", evaluated.Inspect())
+	}
+}
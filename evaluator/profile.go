@@ -0,0 +1,113 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ノードの種類ごとに、評価した回数とかかった時間を数える。EvalOptions.Profileに渡すと評価器が記録する
+// ゼロ値のまま使える
+type Profile struct {
+	mu      sync.Mutex
+	entries map[string]*ProfileEntry
+}
+
+type ProfileEntry struct {
+	NodeType string `json:"node_type"`
+	Count    int64  `json:"count"`
+	// この種類のノードを評価していた時間の合計。中で評価したノードの時間も含むが、
+	// 同じ種類のノードの中で評価した同じ種類のノードの時間は数えないので、再帰しても重複しない
+	TotalNanoseconds int64 `json:"total_ns"`
+}
+
+// nameの種類のノードを1回評価した記録を加える。elapsedはその評価で数える時間
+func (p *Profile) record(name string, elapsed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries == nil {
+		p.entries = map[string]*ProfileEntry{}
+	}
+	entry, ok := p.entries[name]
+	if !ok {
+		entry = &ProfileEntry{NodeType: name}
+		p.entries[name] = entry
+	}
+	entry.Count++
+	entry.TotalNanoseconds += elapsed
+}
+
+// nodeの評価を始める。同じ種類のノードを評価している途中でなければ、outermostがtrueになる
+func (e *Evaluator) profileEnter(node ast.Node) (name string, outermost bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.profileDepth == nil {
+		e.profileDepth = map[string]int{}
+	}
+	name = node.NodeType()
+	outermost = e.profileDepth[name] == 0
+	e.profileDepth[name]++
+	return name, outermost
+}
+
+// beganに始めた評価を終える。時間は一番外側の評価でだけ数える
+func (e *Evaluator) profileExit(name string, outermost bool, began time.Time) {
+	e.mu.Lock()
+	e.profileDepth[name]--
+	e.mu.Unlock()
+	var elapsed int64
+	if outermost {
+		elapsed = time.Since(began).Nanoseconds()
+	}
+	e.opts.Profile.record(name, elapsed)
+}
+
+// 時間の長い順に並べた記録。時間が同じなら種類の名前の順
+func (p *Profile) Entries() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := make([]ProfileEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TotalNanoseconds != entries[j].TotalNanoseconds {
+			return entries[i].TotalNanoseconds > entries[j].TotalNanoseconds
+		}
+		return entries[i].NodeType < entries[j].NodeType
+	})
+	return entries
+}
+
+// {"entries": [{"node_type": ..., "count": ..., "total_ns": ...}, ...]} の形で書く
+func (p *Profile) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(struct {
+		Entries []ProfileEntry `json:"entries"`
+	}{p.Entries()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// 時間の長い順にn件を、1行に1件ずつ書く
+func (p *Profile) WriteTop(w io.Writer, n int) error {
+	entries := p.Entries()
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	for _, entry := range entries {
+		_, err := fmt.Fprintf(w, "%-24s %10d calls %14s\n",
+			entry.NodeType, entry.Count, time.Duration(entry.TotalNanoseconds))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
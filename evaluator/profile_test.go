@@ -0,0 +1,137 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+	add(1, 2) + add(3, 4);`
+
+	profile := &Profile{}
+	e := NewWithOptions(EvalOptions{Profile: profile})
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+
+	var buf bytes.Buffer
+	if err := profile.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %s", err)
+	}
+
+	// スキーマを確かめるため、構造体ではなく汎用の値に読み込む
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("profile is not valid JSON: %s\n%s", err, buf.String())
+	}
+	if len(decoded) != 1 {
+		t.Errorf("profile has unexpected top-level keys: %v", decoded)
+	}
+	entries, ok := decoded["entries"].([]any)
+	if !ok {
+		t.Fatalf("entries is not an array. got=%T", decoded["entries"])
+	}
+
+	counts := map[string]float64{}
+	previous := -1.0
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok || len(entry) != 3 {
+			t.Fatalf("entry has wrong shape: %v", e)
+		}
+		nodeType, ok1 := entry["node_type"].(string)
+		count, ok2 := entry["count"].(float64)
+		total, ok3 := entry["total_ns"].(float64)
+		if !ok1 || !ok2 || !ok3 {
+			t.Fatalf("entry has wrong field types: %v", entry)
+		}
+		if previous >= 0 && total > previous {
+			t.Errorf("entries are not sorted by total_ns descending: %v", entries)
+		}
+		previous = total
+		counts[nodeType] = count
+	}
+
+	expected := map[string]float64{
+		"Program":         1,
+		"LetStatement":    1,
+		"CallExpression":  2,
+		"InfixExpression": 3,
+		"IntegerLiteral":  4,
+	}
+	for nodeType, count := range expected {
+		if counts[nodeType] != count {
+			t.Errorf("wrong count for %s. want=%v, got=%v", nodeType, count, counts[nodeType])
+		}
+	}
+
+	var top bytes.Buffer
+	if err := profile.WriteTop(&top, 2); err != nil {
+		t.Fatalf("WriteTop failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(top.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], profile.Entries()[0].NodeType) {
+		t.Errorf("wrong top hotspots:\n%s", top.String())
+	}
+}
+
+func TestProfileRecursion(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	fib(15);`
+
+	profile := &Profile{}
+	e := NewWithOptions(EvalOptions{Profile: profile})
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+
+	entries := profile.Entries()
+	var program ProfileEntry
+	for _, entry := range entries {
+		if entry.NodeType == "Program" {
+			program = entry
+		}
+	}
+	if program.Count != 1 {
+		t.Fatalf("Program was not recorded once. got=%+v", program)
+	}
+
+	// 再帰した呼び出しの時間を重ねて数えなければ、どの種類もプログラム全体より長くならない
+	for _, entry := range entries {
+		if entry.TotalNanoseconds > program.TotalNanoseconds {
+			t.Errorf("%s took longer than the whole program. got=%d, program=%d",
+				entry.NodeType, entry.TotalNanoseconds, program.TotalNanoseconds)
+		}
+		if entry.NodeType == "CallExpression" && entry.Count != 1973 {
+			t.Errorf("wrong count for CallExpression. want=1973, got=%d", entry.Count)
+		}
+	}
+}
+
+func TestProfileTailCall(t *testing.T) {
+	input := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };
+	f(100);`
+
+	profile := &Profile{}
+	e := NewWithOptions(EvalOptions{Profile: profile})
+	e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+
+	counts := map[string]int64{}
+	for _, entry := range profile.Entries() {
+		counts[entry.NodeType] = entry.Count
+	}
+
+	// 末尾の位置で評価したノードも数える
+	expected := map[string]int64{
+		"CallExpression": 101,
+		"IfExpression":   101,
+		"BlockStatement": 202,
+	}
+	for nodeType, count := range expected {
+		if counts[nodeType] != count {
+			t.Errorf("wrong count for %s. want=%d, got=%d", nodeType, count, counts[nodeType])
+		}
+	}
+}
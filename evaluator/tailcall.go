@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/object"
+	"time"
+)
+
+// 関数本体の末尾の位置にあるノードを評価する
+// 末尾の位置にある関数呼び出しは、関数を呼び出さずにThunkを返す。evalFunctionBodyがそれを呼び出す
+func (e *Evaluator) evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node.(type) {
+	case *ast.BlockStatement, *ast.ExpressionStatement, *ast.IfExpression,
+		*ast.LetExpression, *ast.ReturnStatement, *ast.CallExpression:
+	default:
+		return e.eval(node, env)
+	}
+
+	// evalと同じく、制限の確認とカバレッジ、プロファイルの記録をしてから評価する
+	if err := e.enter(node); err != nil {
+		return err
+	}
+	if e.opts.Profile != nil {
+		name, outermost := e.profileEnter(node)
+		defer e.profileExit(name, outermost, time.Now())
+	}
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return e.evalBlockStatements(node, env, true)
+	case *ast.ExpressionStatement:
+		return e.evalTail(node.Expression, env)
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env, true)
+	case *ast.LetExpression:
+		return e.evalLetExpression(node, env, true)
+	case *ast.ReturnStatement:
+		val := e.evalTail(node.ReturnValue, env)
+		if _, ok := val.(*object.Thunk); ok || isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	default:
+		return e.evalCallExpression(node.(*ast.CallExpression), env, true)
+	}
+}
@@ -0,0 +1,587 @@
+// Monkeyのソースコードを決まった形に整形する
+// ast.Node.String()はデバッグ用にすべての式を括弧で囲むが、ここでは読みやすいソースコードとして書き出す
+// 必要な括弧だけを付け、ブロックは改行してタブで字下げする
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/token"
+	"strings"
+)
+
+// ソースコードを構文解析して整形する。構文エラーがあればエラーを返す
+// 空でなければ、結果は改行で終わる
+func Source(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	pr := &printer{tokenLines: tokenLines(src)}
+	pr.statements(program.Statements)
+	if pr.out.Len() == 0 {
+		return "", nil
+	}
+	pr.out.WriteString("\n")
+	return pr.out.String(), nil
+}
+
+// トークンのある行を調べる。文の間の空行を残すのに使う
+func tokenLines(src string) map[int]bool {
+	lines := map[int]bool{}
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		lines[tok.Pos.Line] = true
+	}
+	return lines
+}
+
+type printer struct {
+	out        bytes.Buffer
+	indent     int
+	tokenLines map[int]bool
+	// letで束縛する値を書いている間はtrue。値の中のinは括弧で囲まないとlet式の区切りになる
+	noIn bool
+}
+
+func (pr *printer) sub() *printer {
+	return &printer{indent: pr.indent, tokenLines: pr.tokenLines}
+}
+
+// 文を1行ずつ書く。元のソースコードで文の間に空行があれば1行だけ残す
+func (pr *printer) statements(stmts []ast.Statement) {
+	texts := make([]string, len(stmts))
+	blockLike := make([]bool, len(stmts))
+	blank := make([]bool, len(stmts))
+	for i, stmt := range stmts {
+		// 文の直前の行が空なら、前の文との間に空行がある
+		line := stmt.Pos().Line
+		blank[i] = i > 0 && line-1 > stmts[i-1].Pos().Line && !pr.tokenLines[line-1]
+		texts[i], blockLike[i] = pr.sub().statement(stmt)
+	}
+
+	for i, text := range texts {
+		if i > 0 {
+			pr.out.WriteString("\n")
+			if blank[i] {
+				pr.out.WriteString("\n")
+			}
+			pr.writeIndent()
+		}
+		pr.out.WriteString(text)
+		// }で終わる式文にはセミコロンを付けないが、
+		// 次の文が ( [ - で始まると呼び出しや中置演算子として続けて読まれてしまうので付ける
+		if blockLike[i] && i+1 < len(texts) && strings.ContainsAny(texts[i+1][:1], "([-") {
+			pr.out.WriteString(";")
+		}
+	}
+}
+
+// 文を書き、それが}で終わる式文かどうかを返す
+func (pr *printer) statement(stmt ast.Statement) (string, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Exported {
+			pr.out.WriteString("export ")
+		}
+		// fn name() { } と macro name() { } の糖衣構文は、let文のトークンが値と同じ位置にある
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Recursive && stmt.Token.Pos == fn.Token.Pos {
+			pr.function(fn, false)
+			return pr.out.String(), true
+		}
+		if m, ok := stmt.Value.(*ast.MacroLiteral); ok && stmt.Token.Pos == m.Token.Pos {
+			pr.out.WriteString("macro " + stmt.Name.Value)
+			pr.params(m.Parameters)
+			pr.block(m.Body)
+			return pr.out.String(), true
+		}
+
+		pr.binding(stmt)
+		pr.out.WriteString(";")
+
+	case *ast.ThrowStatement:
+		pr.out.WriteString("throw ")
+		pr.expression(stmt.Value, lowest)
+		pr.out.WriteString(";")
+
+	case *ast.ReturnStatement:
+		pr.out.WriteString("return")
+		if stmt.ReturnValue != nil {
+			pr.out.WriteString(" ")
+			// return a, b のタプルは括弧を付けずに書く
+			if tuple, ok := stmt.ReturnValue.(*ast.TupleLiteral); ok && tuple.Token.Type == token.COMMA {
+				pr.expressions(tuple.Elements)
+			} else {
+				pr.expression(stmt.ReturnValue, lowest)
+			}
+		}
+		pr.out.WriteString(";")
+
+	case *ast.UnletStatement:
+		pr.out.WriteString("unlet " + stmt.Name.Value + ";")
+
+	case *ast.ImportStatement:
+		pr.out.WriteString(`import "` + stmt.Path.Value + `"`)
+		if stmt.Alias != nil {
+			pr.out.WriteString(" as " + stmt.Alias.Value)
+		}
+		pr.out.WriteString(";")
+
+	case *ast.DeferStatement:
+		pr.out.WriteString("defer ")
+		pr.expression(stmt.Call, lowest)
+		pr.out.WriteString(";")
+
+	case *ast.WhileStatement:
+		if cond, ok := stmt.Condition.(*ast.PrefixExpression); ok && stmt.Token.Type == token.UNTIL {
+			pr.out.WriteString("until (")
+			pr.expression(cond.Right, lowest)
+		} else {
+			pr.out.WriteString("while (")
+			pr.expression(stmt.Condition, lowest)
+		}
+		pr.out.WriteString(") ")
+		pr.block(stmt.Body)
+
+	case *ast.ForStatement:
+		pr.out.WriteString("for (")
+		pr.clause(stmt.Init)
+		pr.out.WriteString(";")
+		if stmt.Condition != nil {
+			pr.out.WriteString(" ")
+			pr.expression(stmt.Condition, lowest)
+		}
+		pr.out.WriteString(";")
+		if stmt.Post != nil {
+			pr.out.WriteString(" ")
+			pr.clause(stmt.Post)
+		}
+		pr.out.WriteString(") ")
+		pr.block(stmt.Body)
+
+	case *ast.DoWhileStatement:
+		pr.out.WriteString("do ")
+		pr.block(stmt.Body)
+		pr.out.WriteString(" while (")
+		pr.expression(stmt.Condition, lowest)
+		pr.out.WriteString(")")
+
+	case *ast.RepeatStatement:
+		pr.out.WriteString("repeat (")
+		pr.expression(stmt.Count, lowest)
+		pr.out.WriteString(") ")
+		pr.block(stmt.Body)
+
+	case *ast.TryCatchStatement:
+		pr.out.WriteString("try ")
+		pr.block(stmt.Body)
+		if stmt.Handler != nil {
+			pr.out.WriteString(" catch ")
+			if stmt.ErrorBinding != nil {
+				pr.out.WriteString("(" + stmt.ErrorBinding.Value + ") ")
+			}
+			pr.block(stmt.Handler)
+		}
+		if stmt.Finally != nil {
+			pr.out.WriteString(" finally ")
+			pr.block(stmt.Finally)
+		}
+
+	case *ast.ForInStatement:
+		pr.out.WriteString("for (" + stmt.Variable.Value + " in ")
+		pr.expression(stmt.Iterable, lowest)
+		pr.out.WriteString(") ")
+		pr.block(stmt.Body)
+
+	case *ast.BreakStatement:
+		pr.out.WriteString("break")
+		if stmt.Label != nil {
+			pr.out.WriteString(" " + stmt.Label.Value)
+		}
+		pr.out.WriteString(";")
+
+	case *ast.ContinueStatement:
+		pr.out.WriteString("continue")
+		if stmt.Label != nil {
+			pr.out.WriteString(" " + stmt.Label.Value)
+		}
+		pr.out.WriteString(";")
+
+	case *ast.LabeledStatement:
+		pr.out.WriteString(stmt.Label.Value + ": ")
+		_, blockLike := pr.statement(stmt.Statement)
+		return pr.out.String(), blockLike
+
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression, lowest)
+		if endsWithBlock(stmt.Expression) {
+			return pr.out.String(), true
+		}
+		pr.out.WriteString(";")
+
+	case *ast.BlockStatement:
+		pr.block(stmt)
+	}
+	return pr.out.String(), false
+}
+
+// for文の初期化文と後処理。末尾のセミコロンはfor文の側で書く
+func (pr *printer) clause(stmt ast.Statement) {
+	if stmt == nil {
+		return
+	}
+	text, _ := pr.sub().statement(stmt)
+	pr.out.WriteString(strings.TrimSuffix(text, ";"))
+}
+
+// 式文の最後が}で終わるか
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.FunctionLiteral, *ast.MacroLiteral, *ast.MatchExpression:
+		return true
+	}
+	return false
+}
+
+func (pr *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		pr.out.WriteString("{}")
+		return
+	}
+
+	pr.out.WriteString("{\n")
+	pr.indent++
+	pr.writeIndent()
+	pr.statements(block.Statements)
+	pr.indent--
+	pr.out.WriteString("\n")
+	pr.writeIndent()
+	pr.out.WriteString("}")
+}
+
+// 式の優先順位。構文解析器の優先順位と同じ並び
+const (
+	lowest = iota
+	assign
+	logicalOr
+	logicalAnd
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	index
+	// リテラルや識別子のように、括弧なしでどこにでも書ける式
+	primary
+)
+
+var infixPrecedences = map[string]int{
+	"||": logicalOr,
+	"&&": logicalAnd,
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"in": lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+	"%":  product,
+}
+
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.AssignExpression:
+		return assign
+	case *ast.InfixExpression:
+		if p, ok := infixPrecedences[exp.Operator]; ok {
+			return p
+		}
+		return lowest
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.MethodCallExpression:
+		return call
+	case *ast.IndexExpression, *ast.SliceExpression:
+		return index
+	case *ast.YieldExpression, *ast.LetExpression:
+		// yieldの値やlet式の本体は後ろの式をすべて含む
+		return lowest
+	}
+	return primary
+}
+
+// let文とlet式の let x = value の部分を書く
+func (pr *printer) binding(stmt *ast.LetStatement) {
+	pr.out.WriteString(stmt.Token.Literal + " ")
+	if len(stmt.Names) > 0 {
+		pr.identifiers(stmt.Names)
+	} else {
+		pr.out.WriteString(stmt.Name.Value)
+	}
+	pr.out.WriteString(" = ")
+	// let f = fn() { } の関数の名前はletの名前なので書かない
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Names == nil && fn.Name == stmt.Name.Value {
+		pr.function(fn, true)
+	} else {
+		noIn := pr.noIn
+		pr.noIn = true
+		pr.expression(stmt.Value, lowest)
+		pr.noIn = noIn
+	}
+}
+
+// 式を書く。式の優先順位がminより低ければ括弧で囲む
+func (pr *printer) expression(exp ast.Expression, min int) {
+	if exp == nil {
+		return
+	}
+	infix, isInfix := exp.(*ast.InfixExpression)
+	if precedence(exp) < min || pr.noIn && isInfix && infix.Operator == "in" {
+		noIn := pr.noIn
+		pr.noIn = false
+		pr.out.WriteString("(")
+		defer func() {
+			pr.out.WriteString(")")
+			pr.noIn = noIn
+		}()
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		pr.out.WriteString(exp.Value)
+	case *ast.IntegerLiteral:
+		pr.out.WriteString(exp.Token.Literal)
+	case *ast.FloatLiteral:
+		pr.out.WriteString(exp.Token.Literal)
+	case *ast.StringLiteral:
+		pr.out.WriteString(`"` + exp.Value + `"`)
+	case *ast.Boolean:
+		pr.out.WriteString(exp.Token.Literal)
+	case *ast.SymbolLiteral:
+		pr.out.WriteString(":" + exp.Value)
+
+	case *ast.PrefixExpression:
+		if exp.Token.Type == token.NOT {
+			pr.out.WriteString("not ")
+		} else {
+			pr.out.WriteString(exp.Operator)
+		}
+		pr.expression(exp.Right, prefix)
+
+	case *ast.InfixExpression:
+		p := precedence(exp)
+		pr.expression(exp.Left, p)
+		if exp.Token.Type == token.AND || exp.Token.Type == token.OR {
+			pr.out.WriteString(" " + exp.Token.Literal + " ")
+		} else {
+			pr.out.WriteString(" " + exp.Operator + " ")
+		}
+		// 左結合なので、右辺に同じ優先順位の式があれば括弧が要る
+		pr.expression(exp.Right, p+1)
+
+	case *ast.AssignExpression:
+		pr.out.WriteString(exp.Name.Value)
+		// x += y は構文解析で x = x + y になっているので、元の形に戻す
+		if infix, ok := exp.Value.(*ast.InfixExpression); ok && exp.Token.Type != token.ASSIGN && infix.Left == exp.Name {
+			pr.out.WriteString(" " + exp.Token.Literal + " ")
+			pr.expression(infix.Right, lowest)
+			break
+		}
+		pr.out.WriteString(" = ")
+		pr.expression(exp.Value, lowest)
+
+	case *ast.IfExpression:
+		if cond, ok := exp.Condition.(*ast.PrefixExpression); ok && exp.Token.Type == token.UNLESS {
+			pr.out.WriteString("unless (")
+			pr.expression(cond.Right, lowest)
+		} else {
+			pr.out.WriteString("if (")
+			pr.expression(exp.Condition, lowest)
+		}
+		pr.out.WriteString(") ")
+		pr.block(exp.Consequence)
+		if exp.Alternative != nil {
+			pr.out.WriteString(" else ")
+			pr.block(exp.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		pr.function(exp, false)
+
+	case *ast.MacroLiteral:
+		pr.out.WriteString("macro")
+		pr.params(exp.Parameters)
+		pr.block(exp.Body)
+
+	// 呼び出しと添字は左から続けて読まれるので、a(b)[c] や a[b](c) に括弧は要らない
+	case *ast.CallExpression:
+		pr.expression(exp.Function, call)
+		pr.out.WriteString("(")
+		pr.expressions(exp.Arguments)
+		pr.out.WriteString(")")
+
+	case *ast.MethodCallExpression:
+		pr.expression(exp.Object, call)
+		pr.out.WriteString(".")
+		pr.out.WriteString(exp.Method.Value)
+		pr.out.WriteString("(")
+		pr.expressions(exp.Arguments)
+		pr.out.WriteString(")")
+
+	case *ast.IndexExpression:
+		pr.expression(exp.Left, call)
+		if str, ok := exp.Index.(*ast.StringLiteral); ok && exp.Token.Type == token.DOT {
+			pr.out.WriteString("." + str.Value)
+			break
+		}
+		pr.out.WriteString("[")
+		pr.expression(exp.Index, lowest)
+		pr.out.WriteString("]")
+
+	case *ast.SliceExpression:
+		pr.expression(exp.Left, call)
+		pr.out.WriteString("[")
+		pr.expression(exp.Low, lowest)
+		pr.out.WriteString(":")
+		if exp.High != nil {
+			high := pr.sub()
+			high.expression(exp.High, lowest)
+			// a[:name] はシンボルの添字になるので、空白を挟んで a[: name] と書く
+			if exp.Low == nil && isIdentStart(high.out.String()[0]) {
+				pr.out.WriteString(" ")
+			}
+			pr.out.WriteString(high.out.String())
+		}
+		pr.out.WriteString("]")
+
+	case *ast.TupleLiteral:
+		pr.out.WriteString("(")
+		pr.expressions(exp.Elements)
+		if len(exp.Elements) == 1 {
+			pr.out.WriteString(",")
+		}
+		pr.out.WriteString(")")
+
+	case *ast.ArrayLiteral:
+		pr.out.WriteString("[")
+		pr.expressions(exp.Elements)
+		pr.out.WriteString("]")
+
+	case *ast.HashLiteral:
+		// structはキーを識別子のまま書く
+		isStruct := exp.Token.Type == token.STRUCT
+		if isStruct {
+			pr.out.WriteString("struct ")
+		}
+		pr.out.WriteString("{")
+		for i, key := range exp.Keys() {
+			if i > 0 {
+				pr.out.WriteString(", ")
+			}
+			if str, ok := key.(*ast.StringLiteral); ok && isStruct {
+				pr.out.WriteString(str.Value)
+			} else {
+				pr.expression(key, lowest)
+			}
+			pr.out.WriteString(": ")
+			pr.expression(exp.Pairs[key], lowest)
+		}
+		pr.out.WriteString("}")
+
+	case *ast.LetExpression:
+		pr.binding(exp.Binding)
+		pr.out.WriteString(" in ")
+		pr.expression(exp.Body, lowest)
+
+	case *ast.YieldExpression:
+		pr.out.WriteString("yield")
+		if exp.Value != nil {
+			pr.out.WriteString(" ")
+			pr.expression(exp.Value, lowest)
+		}
+
+	case *ast.MatchExpression:
+		pr.out.WriteString("match ")
+		pr.expression(exp.Subject, lowest)
+		pr.out.WriteString(" {\n")
+		pr.indent++
+		for _, arm := range exp.Arms {
+			pr.writeIndent()
+			pr.matchArm(arm)
+			pr.out.WriteString("\n")
+		}
+		pr.indent--
+		pr.writeIndent()
+		pr.out.WriteString("}")
+	}
+}
+
+// 分岐の本体の後ろが次の分岐のパターンに続けて読まれないように、セミコロンで区切る
+func (pr *printer) matchArm(arm *ast.MatchArm) {
+	if arm.Pattern == nil {
+		pr.out.WriteString("default")
+	} else {
+		pr.out.WriteString("case ")
+		pr.expression(arm.Pattern, lowest)
+	}
+	if arm.Guard != nil {
+		pr.out.WriteString(" if ")
+		pr.expression(arm.Guard, lowest)
+	}
+	pr.out.WriteString(": ")
+	pr.expression(arm.Body, lowest)
+	pr.out.WriteString(";")
+}
+
+// omitNameがtrueなら、関数の名前を書かない
+func (pr *printer) function(fn *ast.FunctionLiteral, omitName bool) {
+	pr.out.WriteString("fn")
+	if fn.Generator {
+		pr.out.WriteString("*")
+	}
+	if fn.Name != "" && !omitName {
+		pr.out.WriteString(" " + fn.Name)
+	}
+	pr.params(fn.Parameters)
+	pr.block(fn.Body)
+}
+
+func (pr *printer) params(params []*ast.Identifier) {
+	pr.out.WriteString("(")
+	pr.identifiers(params)
+	pr.out.WriteString(") ")
+}
+
+func (pr *printer) identifiers(idents []*ast.Identifier) {
+	for i, ident := range idents {
+		if i > 0 {
+			pr.out.WriteString(", ")
+		}
+		pr.out.WriteString(ident.Value)
+	}
+}
+
+func (pr *printer) expressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			pr.out.WriteString(", ")
+		}
+		pr.expression(exp, lowest)
+	}
+}
+
+func (pr *printer) writeIndent() {
+	pr.out.WriteString(strings.Repeat("\t", pr.indent))
+}
+
+func isIdentStart(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
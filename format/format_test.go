@@ -0,0 +1,128 @@
+package format
+
+import (
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/*.input を整形した結果が *.golden と一致するか
+func TestGoldenFiles(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden files")
+	}
+
+	for _, input := range inputs {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := os.ReadFile(strings.TrimSuffix(input, ".input") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		formatted, err := Source(string(src))
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+		if formatted != string(golden) {
+			t.Errorf("%s: wrong output.\n%s", input, Diff("golden", "formatted", string(golden), formatted))
+			continue
+		}
+
+		// 整形してもプログラムの意味は変わらない
+		if !ast.Equal(parse(t, string(src)), parse(t, formatted)) {
+			t.Errorf("%s: formatting changed the program", input)
+		}
+
+		// 整形済みのコードは変わらない
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != formatted {
+			t.Errorf("%s: formatting is not idempotent.\n%s", input, Diff("once", "twice", formatted, again))
+		}
+	}
+}
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, err := Source("let = 1;"); err == nil {
+		t.Errorf("expected an error for invalid input")
+	}
+
+	formatted, err := Source("  \n")
+	if err != nil || formatted != "" {
+		t.Errorf("empty input formatted to %q (err=%v)", formatted, err)
+	}
+}
+
+// }で終わる式文の後ろに ( や [ で始まる文が続くときは、セミコロンを残す
+func TestSemicolonBeforeParen(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (x) { 1 }; (1, 2)", "if (x) {\n\t1;\n};\n(1, 2);\n"},
+		{"if (x) { 1 }; [1]", "if (x) {\n\t1;\n};\n[1];\n"},
+		{"if (x) { 1 }; -1", "if (x) {\n\t1;\n};\n-1;\n"},
+		{"if (x) { 1 } let y = 1", "if (x) {\n\t1;\n}\nlet y = 1;\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+`
+	if got := Diff("old", "new", old, new); got != expected {
+		t.Errorf("wrong diff. want=\n%s\ngot=\n%s", expected, got)
+	}
+
+	if got := Diff("old", "new", old, old); got != "" {
+		t.Errorf("expected no diff for equal input, got %q", got)
+	}
+}
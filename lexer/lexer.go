@@ -1,16 +1,28 @@
 package lexer
 
-import "gomadoufu/monkey-interpreter-go/token"
+import (
+	"strings"
+
+	"gomadoufu/monkey-interpreter-go/token"
+)
 
 type Lexer struct {
 	input        string
-	position     int  // 入力における現在の位置(現在の文字を指し示す)
-	readPosition int  // これから読み込む位置(現在の文字の次)
-	ch           byte // 現在の検査中の文字
+	file         string // トークンの位置に付けるファイル名
+	position     int    // 入力における現在の位置(現在の文字を指し示す)
+	readPosition int    // これから読み込む位置(現在の文字の次)
+	ch           byte   // 現在の検査中の文字
+	line         int    // 現在の文字の行
+	lineStart    int    // 現在の行の先頭の位置
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile(input, "")
+}
+
+// fileから読んだinputを字句解析する。トークンの位置にファイル名が付く
+func NewWithFile(input, file string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
 	return l
 }
@@ -18,6 +30,11 @@ func New(input string) *Lexer {
 // 1文字読み込んで、chにセットする
 // NOTE: ASCIIのみに対応し、UTF-8の複数バイト文字には対応できていない。(Rustではやってみる)
 func (l *Lexer) readChar() {
+	// 改行を読み終えたら次の行に進む
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	//入力が終端に達したかのチェック
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
@@ -29,12 +46,20 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
-// chを見て、readCharを呼び、対応するトークンを返す
+// 空白を読み飛ばして次のトークンを読み、その先頭の位置を付けて返す
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	pos := token.Position{File: l.file, Line: l.line, Column: l.position - l.lineStart + 1}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+// chを見て、readCharを呼び、対応するトークンを返す
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -46,9 +71,9 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newOperatorToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newOperatorToken(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -59,9 +84,24 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.newOperatorToken(token.SLASH, token.SLASH_ASSIGN)
+	case '%':
+		tok = l.newOperatorToken(token.PERCENT, token.PERCENT_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newOperatorToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '&', '|':
+		// &と|は2つ続けたときだけ演算子になる
+		if l.peekChar() == l.ch {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LAND, Literal: literal}
+			if ch == '|' {
+				tok.Type = token.LOR
+			}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
@@ -70,6 +110,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -89,6 +131,13 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
+		// :の直後に空白を挟まず識別子が続けばシンボル
+		if isLetter(l.peekChar()) {
+			l.readChar()
+			tok.Type = token.COLON_IDENT
+			tok.Literal = l.readIdentifier()
+			return tok
+		}
 		tok = newToken(token.COLON, l.ch)
 	default:
 		if isLetter(l.ch) {
@@ -98,6 +147,22 @@ func (l *Lexer) NextToken() token.Token {
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			// 10進数の後に「.数字」が続けば浮動小数点数
+			if isDecimal(tok.Literal) && l.ch == '.' && isDigit(l.peekChar()) {
+				l.readChar()
+				fraction := l.readNumber()
+				tok.Type = token.FLOAT
+				tok.Literal += "." + fraction
+				if !validUnderscores(fraction) {
+					tok.Type = token.ILLEGAL
+				}
+			} else if len(tok.Literal) > 1 && tok.Literal[0] == '0' && (isDigit(tok.Literal[1]) || tok.Literal[1] == '_') {
+				// 010 は10進数とも8進数とも読めるので、基数の接頭辞なしに0から始まる整数は許さない
+				tok.Type = token.ILLEGAL
+			}
+			if !validUnderscores(strings.SplitN(tok.Literal, ".", 2)[0]) {
+				tok.Type = token.ILLEGAL
+			}
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -114,9 +179,10 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 }
 
 // 識別子を読み込む
+// 2文字目からは数字も使える
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -134,21 +200,54 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-// 数字を読み込む
+// 数字を読み込む。0x(16進数)・0o(8進数)・0b(2進数)の接頭辞と、区切りの_も読む
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for isDigit(l.ch) {
+	isNumberDigit := isDigit
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			isNumberDigit = isHexDigit
+			l.readChar()
+			l.readChar()
+		case 'o', 'O', 'b', 'B':
+			// 基数に合わない数字は構文解析器でエラーにする
+			l.readChar()
+			l.readChar()
+		}
+	}
+	for isNumberDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// _は数字と数字の間にだけ置ける。先頭・末尾・接頭辞の直後や、2つ続けて書くことはできない
+func validUnderscores(literal string) bool {
+	digits := literal
+	if !isDecimal(literal) {
+		digits = literal[2:]
+	}
+	if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") {
+		return false
+	}
+	return !strings.Contains(digits, "__")
+}
+
+// 基数の接頭辞が付いていないかどうか
+func isDecimal(literal string) bool {
+	return len(literal) < 2 || literal[0] != '0' || !strings.ContainsRune("xXoObB", rune(literal[1]))
+}
+
 // 数字かどうか判定する
-// NOTE: Monkey言語では整数値以外の数値をサポートしていない(Rustでは追加してみる)
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 // 1文字先に覗き見る(==や!=など、2文字で構成されるトークンを判定するために必要)
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
@@ -168,3 +267,13 @@ func (l *Lexer) readString() string {
 	}
 	return l.input[position:l.position] // "の前までを返す
 }
+
+// 後ろに'='が続けば複合代入のトークン、そうでなければ演算子のトークンを返す
+func (l *Lexer) newOperatorToken(op, assign token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(ch) + string(l.ch)}
+	}
+	return newToken(op, l.ch)
+}
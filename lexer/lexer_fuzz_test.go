@@ -0,0 +1,48 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+
+	"gomadoufu/monkey-interpreter-go/token"
+)
+
+// 字句解析の種になる入力。キーワード、長い識別子、閉じていない文字列、深い括弧など
+var fuzzSeeds = []string{
+	"",
+	"let five = 5; let add = fn(x, y) { x + y; };",
+	"letrec fn macro match case default defer while for in yield break continue return if else true false",
+	strings.Repeat("a", 4096),
+	`"unterminated`,
+	`"`,
+	"((((((((((((((((((((((((((((((((1))))))))))))))))))))))))))))))))",
+	strings.Repeat("[{(", 200),
+	":ok :: : :1 a[:b] {\"a\":b}",
+	"x += 1 -= 2 *= 3 /= 4 == != ! = ",
+	"héllo 世界 \x00 \xff\xfe",
+	"1234567890123456789012345678901234567890",
+	"\n\n\r\n\t ",
+	"@#$%^&~`?|\\",
+}
+
+// NextTokenはどんな入力でもパニックせず、有限回でEOFを返す
+func FuzzLex(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		// EOF以外のトークンは少なくとも1バイトを読むので、トークンの数は入力の長さ以下
+		for i := 0; i <= len(input); i++ {
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				return
+			}
+			if tok.Pos.Line < 1 || tok.Pos.Column < 1 {
+				t.Fatalf("invalid position %s for %q", tok.Pos, tok.Literal)
+			}
+		}
+		t.Fatalf("lexer did not reach EOF after %d tokens", len(input)+1)
+	})
+}
@@ -30,6 +30,17 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+defer f();
+while
+macro(x, y) { x + y; };
+match x { case _: 1; default: 2 }
+:ok {"a":b}
+break continue
+letrec
+for x += -= *= /=
+fn* in yield
+&& || and or & |
+base64_encode x1 2x :v2
 `
 
 	tests := []struct {
@@ -122,6 +133,66 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.DEFER, "defer"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.IDENT, "x"},
+		{token.LBRACE, "{"},
+		{token.CASE, "case"},
+		{token.IDENT, "_"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.DEFAULT, "default"},
+		{token.COLON, ":"},
+		{token.INT, "2"},
+		{token.RBRACE, "}"},
+		{token.COLON_IDENT, "ok"},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON_IDENT, "b"},
+		{token.RBRACE, "}"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.LETREC, "letrec"},
+		{token.FOR, "for"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.FUNCTION, "fn"},
+		{token.ASTERISK, "*"},
+		{token.IN, "in"},
+		{token.YIELD, "yield"},
+		{token.LAND, "&&"},
+		{token.LOR, "||"},
+		{token.AND, "and"},
+		{token.OR, "or"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "base64_encode"},
+		{token.IDENT, "x1"},
+		{token.INT, "2"},
+		{token.IDENT, "x"},
+		{token.COLON_IDENT, "v2"},
 		{token.EOF, ""},
 	}
 
@@ -143,3 +214,130 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNumberLiterals(t *testing.T) {
+	input := `0 0x1F 0o17 0b10 010 7 1_000 0xFF_00 1__0 1_ 0x_1 0_1 3.14 0.5 1_000.000_1 1_.5 1.5_ 0x1.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0"},
+		{token.INT, "0x1F"},
+		{token.INT, "0o17"},
+		{token.INT, "0b10"},
+		{token.ILLEGAL, "010"},
+		{token.INT, "7"},
+		{token.INT, "1_000"},
+		{token.INT, "0xFF_00"},
+		{token.ILLEGAL, "1__0"},
+		{token.ILLEGAL, "1_"},
+		{token.ILLEGAL, "0x_1"},
+		{token.ILLEGAL, "0_1"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1_000.000_1"},
+		{token.ILLEGAL, "1_.5"},
+		{token.ILLEGAL, "1.5_"},
+		// 16進数に小数部はない
+		{token.INT, "0x1"},
+		{token.DOT, "."},
+		{token.INT, "5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x += 10;
+:ok "héllo" y`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+=", 2, 5},
+		{"10", 2, 8},
+		{";", 2, 10},
+		{"ok", 3, 1},
+		{"héllo", 3, 5},
+		// 列はバイト単位で数える
+		{"y", 3, 14},
+		{"", 3, 15},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong for %q. expected=%d:%d, got=%s",
+				i, tt.expectedLiteral, tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+	}
+}
+
+// ベンチマークの入力。新しいプログラムはここに足す
+// go test -bench=Lexer ./lexer
+var benchmarkPrograms = []struct {
+	name  string
+	input string
+}{
+	{"fib25", `
+let fibonacci = fn(x) {
+	if (x == 0) { return 0; }
+	if (x == 1) { return 1; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(25);
+`},
+	{"collections", `
+let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}];
+let ages = [];
+for (p in people) { ages = push(ages, p["age"]); }
+let total = 0;
+for (let i = 0; i < len(ages); i += 1) { total += ages[i]; }
+[total, ages[1:], :ok];
+`},
+}
+
+func BenchmarkLexer(b *testing.B) {
+	for _, bm := range benchmarkPrograms {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.input)))
+			for i := 0; i < b.N; i++ {
+				l := New(bm.input)
+				for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package lsp
+
+import (
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/evaluator"
+	"gomadoufu/monkey-interpreter-go/token"
+	"sort"
+	"strings"
+)
+
+// 名前の束縛。valueはletで束縛した値の式で、引数などではnil
+type binding struct {
+	name  *ast.Identifier
+	kind  string
+	value ast.Expression
+}
+
+// 関数の本体やforループが作る変数のスコープ
+type scope struct {
+	bindings map[string]*binding
+	outer    *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{bindings: map[string]*binding{}, outer: outer}
+}
+
+func (s *scope) define(name *ast.Identifier, kind string, value ast.Expression) *binding {
+	b := &binding{name: name, kind: kind, value: value}
+	s.bindings[name.Value] = b
+	return b
+}
+
+func (s *scope) lookup(name string) (*binding, bool) {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// カーソル位置にあるノードと、そこから見える名前を調べる
+// 評価器と同じく、ifやwhileのブロックはスコープを作らず、関数の本体とforループだけが作る
+type analyzer struct {
+	cursor token.Position
+
+	// カーソル位置の葉ノード(識別子やリテラル)
+	leaf ast.Node
+	// leafが識別子のとき、その束縛
+	def *binding
+	// カーソル位置から見える束縛。内側のスコープが先
+	visible []*binding
+	// visibleを記録したかどうか。最も内側のブロックで記録したものを使う
+	recorded bool
+}
+
+func analyze(program *ast.Program, cursor token.Position) *analyzer {
+	a := &analyzer{cursor: cursor}
+	global := newScope(nil)
+	a.statements(program.Statements, global, true)
+	return a
+}
+
+// containsCursorはブロックがカーソルを含むかどうか
+// 含むなら、カーソルより後ろの最初の文に来たときに、その時点で見える名前を記録する
+func (a *analyzer) statements(stmts []ast.Statement, sc *scope, containsCursor bool) {
+	for _, stmt := range stmts {
+		if containsCursor && !a.recorded && before(a.cursor, stmt.Pos()) {
+			a.record(sc)
+		}
+		a.visit(stmt, sc)
+	}
+	if containsCursor && !a.recorded {
+		a.record(sc)
+	}
+}
+
+func (a *analyzer) block(block *ast.BlockStatement, sc *scope) {
+	if block == nil {
+		return
+	}
+	contains := !before(a.cursor, block.Token.Pos) && !before(block.End, a.cursor)
+	a.statements(block.Statements, sc, contains)
+}
+
+func (a *analyzer) record(sc *scope) {
+	a.recorded = true
+	seen := map[string]bool{}
+	for s := sc; s != nil; s = s.outer {
+		names := make([]string, 0, len(s.bindings))
+		for name := range s.bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				a.visible = append(a.visible, s.bindings[name])
+			}
+		}
+	}
+}
+
+func (a *analyzer) visit(node ast.Node, sc *scope) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		names := node.Names
+		if len(names) == 0 {
+			names = []*ast.Identifier{node.Name}
+		}
+		kind := "variable"
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			kind = "function"
+		}
+		// 関数は本体から自分自身を呼べるように、値より先に名前を定義する
+		if node.Recursive || isFunction {
+			a.declare(names, kind, node.Value, sc)
+			a.visit(node.Value, sc)
+		} else {
+			a.visit(node.Value, sc)
+			a.declare(names, kind, node.Value, sc)
+		}
+
+	case *ast.ExpressionStatement:
+		a.visit(node.Expression, sc)
+	case *ast.ReturnStatement:
+		a.visit(node.ReturnValue, sc)
+	case *ast.ThrowStatement:
+		a.visit(node.Value, sc)
+	case *ast.ImportStatement:
+		// asがなければ、モジュールの名前の位置で束縛する
+		name := node.Alias
+		if name == nil {
+			name = &ast.Identifier{Token: node.Path.Token, Value: node.Name()}
+		}
+		a.declare([]*ast.Identifier{name}, "module", nil, sc)
+	case *ast.UnletStatement:
+		// 取り除く前の束縛を指す
+		a.visit(node.Name, sc)
+		delete(sc.bindings, node.Name.Value)
+	case *ast.DeferStatement:
+		a.visit(node.Call, sc)
+	case *ast.LabeledStatement:
+		a.visit(node.Statement, sc)
+	case *ast.WhileStatement:
+		a.visit(node.Condition, sc)
+		a.block(node.Body, sc)
+	case *ast.DoWhileStatement:
+		a.block(node.Body, sc)
+		a.visit(node.Condition, sc)
+	case *ast.RepeatStatement:
+		a.visit(node.Count, sc)
+		a.block(node.Body, sc)
+	case *ast.TryCatchStatement:
+		a.block(node.Body, sc)
+		inner := newScope(sc)
+		a.declare([]*ast.Identifier{node.ErrorBinding}, "caught error", nil, inner)
+		a.block(node.Handler, inner)
+		a.block(node.Finally, sc)
+	case *ast.ForStatement:
+		inner := newScope(sc)
+		a.visit(node.Init, inner)
+		a.visit(node.Condition, inner)
+		a.visit(node.Post, inner)
+		a.block(node.Body, inner)
+	case *ast.ForInStatement:
+		a.visit(node.Iterable, sc)
+		inner := newScope(sc)
+		a.declare([]*ast.Identifier{node.Variable}, "loop variable", nil, inner)
+		a.block(node.Body, inner)
+	case *ast.BlockStatement:
+		a.block(node, sc)
+
+	case *ast.Identifier:
+		if a.covers(node.Token.Pos, len(node.Value)) {
+			a.leaf = node
+			a.def, _ = sc.lookup(node.Value)
+		}
+	case *ast.IntegerLiteral:
+		a.visitLeaf(node, len(node.Token.Literal))
+	case *ast.FloatLiteral:
+		a.visitLeaf(node, len(node.Token.Literal))
+	case *ast.StringLiteral:
+		a.visitLeaf(node, len(node.Value)+2)
+	case *ast.Boolean:
+		a.visitLeaf(node, len(node.Token.Literal))
+	case *ast.SymbolLiteral:
+		a.visitLeaf(node, len(node.Value)+1)
+
+	case *ast.PrefixExpression:
+		a.visit(node.Right, sc)
+	case *ast.InfixExpression:
+		a.visit(node.Left, sc)
+		a.visit(node.Right, sc)
+	case *ast.IfExpression:
+		a.visit(node.Condition, sc)
+		a.block(node.Consequence, sc)
+		a.block(node.Alternative, sc)
+	case *ast.LetExpression:
+		// 束縛はlet式の本体の中でだけ見える
+		inner := newScope(sc)
+		a.visit(node.Binding, inner)
+		a.visit(node.Body, inner)
+	case *ast.FunctionLiteral:
+		a.visitLeaf(node, len(node.Token.Literal))
+		inner := newScope(sc)
+		a.declare(node.Parameters, "parameter", nil, inner)
+		a.block(node.Body, inner)
+	case *ast.MacroLiteral:
+		inner := newScope(sc)
+		a.declare(node.Parameters, "parameter", nil, inner)
+		a.block(node.Body, inner)
+	case *ast.CallExpression:
+		a.visit(node.Function, sc)
+		for _, arg := range node.Arguments {
+			a.visit(arg, sc)
+		}
+	case *ast.MethodCallExpression:
+		a.visit(node.Object, sc)
+		for _, arg := range node.Arguments {
+			a.visit(arg, sc)
+		}
+	case *ast.TupleLiteral:
+		for _, e := range node.Elements {
+			a.visit(e, sc)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			a.visit(e, sc)
+		}
+	case *ast.HashLiteral:
+		for k, v := range node.Pairs {
+			a.visit(k, sc)
+			a.visit(v, sc)
+		}
+	case *ast.IndexExpression:
+		a.visit(node.Left, sc)
+		a.visit(node.Index, sc)
+	case *ast.SliceExpression:
+		a.visit(node.Left, sc)
+		a.visit(node.Low, sc)
+		a.visit(node.High, sc)
+	case *ast.AssignExpression:
+		a.visit(node.Name, sc)
+		a.visit(node.Value, sc)
+	case *ast.YieldExpression:
+		a.visit(node.Value, sc)
+	case *ast.MatchExpression:
+		a.visit(node.Subject, sc)
+		for _, arm := range node.Arms {
+			inner := newScope(sc)
+			// 識別子のパターンは値を束縛する。_は何も束縛しない
+			if ident, ok := arm.Pattern.(*ast.Identifier); ok {
+				if ident.Value != "_" {
+					a.declare([]*ast.Identifier{ident}, "variable", nil, inner)
+				}
+			} else {
+				a.visit(arm.Pattern, sc)
+			}
+			a.visit(arm.Guard, inner)
+			a.visit(arm.Body, inner)
+		}
+	}
+}
+
+// 名前を定義する。カーソルが定義している名前の上にあれば、その定義自身を結果にする
+func (a *analyzer) declare(names []*ast.Identifier, kind string, value ast.Expression, sc *scope) {
+	for _, name := range names {
+		if name == nil {
+			continue
+		}
+		b := sc.define(name, kind, value)
+		if a.covers(name.Token.Pos, len(name.Value)) {
+			a.leaf = name
+			a.def = b
+		}
+	}
+}
+
+func (a *analyzer) visitLeaf(node ast.Node, length int) {
+	if a.covers(node.Pos(), length) {
+		a.leaf = node
+	}
+}
+
+// posから始まる長さlengthのトークンがカーソルを含むか。トークンの直後にカーソルがあっても含むとする
+func (a *analyzer) covers(pos token.Position, length int) bool {
+	return pos.Line == a.cursor.Line && pos.Column <= a.cursor.Column && a.cursor.Column <= pos.Column+length
+}
+
+// aがbより前にあるか
+func before(a, b token.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+func (d *document) hover(pos Position) *Hover {
+	a := analyze(d.program, d.fromLSP(pos))
+	if a.leaf == nil {
+		return nil
+	}
+
+	var text string
+	switch leaf := a.leaf.(type) {
+	case *ast.Identifier:
+		if a.def != nil {
+			text = describeBinding(a.def)
+		} else if builtin, ok := evaluator.LookupBuiltin(leaf.Value); ok {
+			text = "(builtin) " + builtin.Doc
+		} else {
+			return nil
+		}
+	default:
+		text = literalType(a.leaf)
+	}
+
+	r := d.rangeOf(a.leaf)
+	return &Hover{Contents: MarkupContent{Kind: "plaintext", Value: text}, Range: &r}
+}
+
+func (d *document) definition(pos Position) *Location {
+	a := analyze(d.program, d.fromLSP(pos))
+	if a.def == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(a.def.name)}
+}
+
+// カーソル位置から見える名前と、組み込み関数・キーワードを返す
+func (d *document) completion(pos Position) []CompletionItem {
+	a := analyze(d.program, d.fromLSP(pos))
+
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	for _, b := range a.visible {
+		kind := completionVariable
+		if b.kind == "function" {
+			kind = completionFunction
+		}
+		seen[b.name.Value] = true
+		items = append(items, CompletionItem{Label: b.name.Value, Kind: kind, Detail: describeBinding(b)})
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		if seen[name] {
+			continue
+		}
+		builtin, _ := evaluator.LookupBuiltin(name)
+		items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: builtin.Doc})
+	}
+	for _, kw := range keywords {
+		items = append(items, CompletionItem{Label: kw, Kind: completionKeyword})
+	}
+	return items
+}
+
+var keywords = []string{
+	"let", "letrec", "unlet", "fn", "return", "if", "else", "while", "for", "in",
+	"break", "continue", "defer", "yield", "match", "case", "default", "macro", "struct", "import", "export", "not", "and", "or", "unless", "until", "do", "repeat", "try", "catch", "finally", "throw", "true", "false",
+}
+
+// ノードの範囲。識別子とリテラル以外は先頭のトークンだけを範囲にする
+func (d *document) rangeOf(node ast.Node) Range {
+	start := d.toLSP(node.Pos())
+	length := len(node.TokenLiteral())
+	switch node := node.(type) {
+	case *ast.StringLiteral:
+		length = utf16Len(node.Value) + 2
+	case *ast.SymbolLiteral:
+		length = len(node.Value) + 1
+	}
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + length}}
+}
+
+// (function) add(x, y) や (variable) x: INTEGER のような説明を返す
+func describeBinding(b *binding) string {
+	if fn, ok := b.value.(*ast.FunctionLiteral); ok {
+		params := []string{}
+		for _, p := range fn.Parameters {
+			params = append(params, p.Value)
+		}
+		return fmt.Sprintf("(function) %s(%s)", b.name.Value, strings.Join(params, ", "))
+	}
+	if b.value != nil {
+		if t := literalType(b.value); t != "" {
+			return fmt.Sprintf("(%s) %s: %s", b.kind, b.name.Value, t)
+		}
+	}
+	return fmt.Sprintf("(%s) %s", b.kind, b.name.Value)
+}
+
+// リテラルから分かる値の型。評価しないと分からなければ空文字列
+func literalType(node ast.Node) string {
+	switch node.(type) {
+	case *ast.IntegerLiteral:
+		return "INTEGER"
+	case *ast.FloatLiteral:
+		return "FLOAT"
+	case *ast.StringLiteral:
+		return "STRING"
+	case *ast.Boolean:
+		return "BOOLEAN"
+	case *ast.SymbolLiteral:
+		return "SYMBOL"
+	case *ast.ArrayLiteral:
+		return "ARRAY"
+	case *ast.HashLiteral:
+		return "HASH"
+	case *ast.TupleLiteral:
+		return "TUPLE"
+	case *ast.FunctionLiteral:
+		return "FUNCTION"
+	case *ast.MacroLiteral:
+		return "MACRO"
+	}
+	return ""
+}
@@ -0,0 +1,301 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// テスト用のLSPクライアント。サーバとはパイプでつながっている
+type fakeClient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newFakeClient(t *testing.T) *fakeClient {
+	t.Helper()
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	c := &fakeClient{t: t, w: clientOut, r: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		c.notify("exit", nil)
+		if err := <-c.done; err != nil {
+			t.Errorf("server returned error: %s", err)
+		}
+	})
+	return c
+}
+
+func (c *fakeClient) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.w, msg); err != nil {
+		c.t.Fatalf("write failed: %s", err)
+	}
+}
+
+func (c *fakeClient) notify(method string, params any) {
+	c.t.Helper()
+	body, _ := json.Marshal(params)
+	c.send(&message{Method: method, Params: body})
+}
+
+// リクエストを送ってレスポンスを待つ。途中で届いた通知は読み飛ばす
+func (c *fakeClient) request(method string, params any) *message {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strings.TrimSpace(string(mustMarshal(c.nextID))))
+	body, _ := json.Marshal(params)
+	c.send(&message{ID: id, Method: method, Params: body})
+
+	for {
+		msg := c.read()
+		if msg.Method == "" && string(msg.ID) == string(id) {
+			return msg
+		}
+	}
+}
+
+func (c *fakeClient) read() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("read failed: %s", err)
+	}
+	return msg
+}
+
+func mustMarshal(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (c *fakeClient) open(uri, text string) *PublishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+	})
+	return c.readDiagnostics()
+}
+
+func (c *fakeClient) readDiagnostics() *PublishDiagnosticsParams {
+	c.t.Helper()
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected publishDiagnostics, got %+v", msg)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return &params
+}
+
+func positionParams(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	c := newFakeClient(t)
+
+	resp := c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	if resp.Error != nil {
+		t.Fatalf("initialize failed: %s", resp.Error.Message)
+	}
+	var result InitializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	caps := result.Capabilities
+	if !caps.HoverProvider || !caps.DefinitionProvider || caps.TextDocumentSync.Change != 1 {
+		t.Errorf("wrong capabilities: %+v", caps)
+	}
+
+	resp = c.request("textDocument/formatting", map[string]any{})
+	if resp.Error == nil || resp.Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method did not return MethodNotFound. got=%+v", resp)
+	}
+
+	resp = c.request("shutdown", nil)
+	if resp.Error != nil || string(resp.Result) != "null" {
+		t.Errorf("wrong shutdown response: %+v", resp)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newFakeClient(t)
+	uri := "file:///test.monkey"
+
+	diags := c.open(uri, "let x = 1;\nlet = 2;")
+	if len(diags.Diagnostics) == 0 {
+		t.Fatalf("no diagnostics for a syntax error")
+	}
+	d := diags.Diagnostics[0]
+	if d.Message != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong message: %q", d.Message)
+	}
+	if d.Range.Start != (Position{Line: 1, Character: 4}) || d.Severity != severityError {
+		t.Errorf("wrong diagnostic: %+v", d)
+	}
+
+	// 修正して保存すると診断が消える
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": "let x = 1;\nlet y = 2;"}},
+	})
+	c.notify("textDocument/didSave", DidSaveTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	diags = c.readDiagnostics()
+	if diags.Diagnostics == nil || len(diags.Diagnostics) != 0 {
+		t.Errorf("diagnostics not cleared: %+v", diags.Diagnostics)
+	}
+}
+
+const source = `let total = 10;
+let add = fn(x, y) {
+  let sum = x + y;
+  sum
+};
+for (item in [1, 2]) { add(item, total) }
+"héllo" + len("a");`
+
+func TestHover(t *testing.T) {
+	c := newFakeClient(t)
+	uri := "file:///hover.monkey"
+	c.open(uri, source)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{0, 5, "(variable) total: INTEGER"},
+		{1, 5, "(function) add(x, y)"},
+		{2, 12, "(parameter) x"},
+		{3, 3, "(variable) sum"},
+		{5, 23, "(function) add(x, y)"},
+		{5, 28, "(loop variable) item"},
+		{5, 36, "(variable) total: INTEGER"},
+		{0, 13, "INTEGER"},
+		{6, 2, "STRING"},
+		{6, 12, "(builtin) len(val) — returns the number of elements in an Array, Set or Tuple, or characters (not bytes) in a String"},
+	}
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/hover", positionParams(uri, tt.line, tt.character))
+		var hover *Hover
+		if err := json.Unmarshal(resp.Result, &hover); err != nil {
+			t.Fatal(err)
+		}
+		if hover == nil {
+			t.Errorf("%d:%d: no hover", tt.line, tt.character)
+			continue
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("%d:%d: wrong hover. want=%q, got=%q", tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+
+	// 空白の上にはホバーがない
+	resp := c.request("textDocument/hover", positionParams(uri, 4, 5))
+	if string(resp.Result) != "null" {
+		t.Errorf("expected null hover, got %s", resp.Result)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := newFakeClient(t)
+	uri := "file:///def.monkey"
+	c.open(uri, source)
+
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		// sum の x は引数の x
+		{2, 12, &Range{Start: Position{Line: 1, Character: 13}, End: Position{Line: 1, Character: 14}}},
+		// add(item, total) の add
+		{5, 24, &Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 7}}},
+		// item はfor-inの変数
+		{5, 29, &Range{Start: Position{Line: 5, Character: 5}, End: Position{Line: 5, Character: 9}}},
+		// 定義の上ではその定義自身
+		{0, 6, &Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 9}}},
+		// 組み込み関数には定義がない
+		{6, 12, nil},
+	}
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/definition", positionParams(uri, tt.line, tt.character))
+		var loc *Location
+		if err := json.Unmarshal(resp.Result, &loc); err != nil {
+			t.Fatal(err)
+		}
+		if tt.expected == nil {
+			if loc != nil {
+				t.Errorf("%d:%d: expected no definition, got %+v", tt.line, tt.character, loc)
+			}
+			continue
+		}
+		if loc == nil {
+			t.Errorf("%d:%d: no definition", tt.line, tt.character)
+			continue
+		}
+		if loc.URI != uri || loc.Range != *tt.expected {
+			t.Errorf("%d:%d: wrong definition. want=%+v, got=%+v", tt.line, tt.character, *tt.expected, loc.Range)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newFakeClient(t)
+	uri := "file:///complete.monkey"
+	c.open(uri, source)
+
+	labels := func(line, character int) map[string]int {
+		resp := c.request("textDocument/completion", positionParams(uri, line, character))
+		var items []CompletionItem
+		if err := json.Unmarshal(resp.Result, &items); err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]int{}
+		for _, item := range items {
+			m[item.Label] = item.Kind
+		}
+		return m
+	}
+
+	// 関数の本体の中では、引数と外側の名前が見える
+	inBody := labels(3, 2)
+	for _, name := range []string{"x", "y", "sum", "total", "add", "len", "let"} {
+		if _, ok := inBody[name]; !ok {
+			t.Errorf("%q is not in completion inside the function body", name)
+		}
+	}
+	if inBody["add"] != completionFunction || inBody["total"] != completionVariable {
+		t.Errorf("wrong kinds: add=%d total=%d", inBody["add"], inBody["total"])
+	}
+
+	// 関数の外からは引数やローカル変数は見えない
+	outside := labels(6, 0)
+	for _, name := range []string{"x", "y", "sum", "item"} {
+		if _, ok := outside[name]; ok {
+			t.Errorf("%q should not be visible outside its scope", name)
+		}
+	}
+	if _, ok := outside["add"]; !ok {
+		t.Errorf("add is not visible at top level")
+	}
+}
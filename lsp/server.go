@@ -0,0 +1,257 @@
+// Monkeyのための言語サーバ。標準入出力でLanguage Server Protocolを話し、
+// 構文エラーの診断・ホバー・定義へのジャンプ・補完を提供する
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/token"
+	"io"
+	"strings"
+)
+
+// リクエストを1つずつ順に処理するので、並行には使わないこと
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+}
+
+// 開いているファイルの内容と、その構文解析の結果
+type document struct {
+	uri     string
+	lines   []string
+	program *ast.Program
+	errors  []parser.ParseError
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*document{},
+	}
+}
+
+// exit通知を受け取るか入力が終わるまでメッセージを処理する
+func (s *Server) Run() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		var rpcErr *responseError
+		if errors.As(err, &rpcErr) {
+			if err := s.reply(nil, nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	result, rpcErr := s.dispatch(msg)
+	// 通知にはレスポンスを返さない
+	if msg.ID == nil {
+		return nil
+	}
+	return s.reply(msg.ID, result, rpcErr)
+}
+
+// メソッドごとの処理を呼ぶ。返り値はレスポンスのresultになる
+func (s *Server) dispatch(msg *message) (any, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		result := InitializeResult{}
+		result.Capabilities = ServerCapabilities{
+			TextDocumentSync:   TextDocumentSyncOptions{OpenClose: true, Change: 1, Save: true},
+			HoverProvider:      true,
+			DefinitionProvider: true,
+		}
+		result.ServerInfo.Name = "monkey-lsp"
+		return result, nil
+
+	case "initialized", "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, s.publishDiagnostics(doc)
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didSave":
+		var params DidSaveTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if params.Text != nil {
+			doc, ok = s.update(params.TextDocument.URI, *params.Text), true
+		}
+		if !ok {
+			return nil, nil
+		}
+		return nil, s.publishDiagnostics(doc)
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+
+		switch msg.Method {
+		case "textDocument/hover":
+			return doc.hover(params.Position), nil
+		case "textDocument/definition":
+			return doc.definition(params.Position), nil
+		default:
+			return doc.completion(params.Position), nil
+		}
+	}
+
+	// 知らない通知は無視してよい
+	if msg.ID == nil {
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) update(uri, text string) *document {
+	p := parser.New(lexer.New(text))
+	doc := &document{
+		uri:     uri,
+		lines:   strings.Split(text, "\n"),
+		program: p.ParseProgram(),
+		errors:  p.ParseErrors(),
+	}
+	s.docs[uri] = doc
+	return doc
+}
+
+// 構文エラーを診断として送る。エラーがなければ空の配列を送って前の診断を消す
+func (s *Server) publishDiagnostics(doc *document) *responseError {
+	params := PublishDiagnosticsParams{URI: doc.uri, Diagnostics: []Diagnostic{}}
+	for _, e := range doc.errors {
+		start := doc.toLSP(e.Pos)
+		params.Diagnostics = append(params.Diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: Position{Line: start.Line, Character: start.Character + 1}},
+			Severity: severityError,
+			Source:   "monkey",
+			Message:  e.Message,
+		})
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	if err := writeMessage(s.out, &message{Method: "textDocument/publishDiagnostics", Params: body}); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *responseError) error {
+	msg := &message{ID: id, Error: rpcErr}
+	if id == nil {
+		msg.ID = json.RawMessage("null")
+	}
+	if rpcErr == nil {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = body
+	}
+	return writeMessage(s.out, msg)
+}
+
+// LSPの位置(0から数える行と、UTF-16で数える文字)に変換する
+func (d *document) toLSP(pos token.Position) Position {
+	if pos.Line < 1 || pos.Column < 1 {
+		return Position{}
+	}
+	line := pos.Line - 1
+	if line >= len(d.lines) {
+		return Position{Line: line}
+	}
+	text := d.lines[line]
+	offset := pos.Column - 1
+	if offset > len(text) {
+		offset = len(text)
+	}
+	return Position{Line: line, Character: utf16Len(text[:offset])}
+}
+
+// LSPの位置を、1から数える行とバイト単位の列に変換する
+func (d *document) fromLSP(pos Position) token.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return token.Position{Line: pos.Line + 1, Column: pos.Character + 1}
+	}
+	text := d.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return token.Position{Line: pos.Line + 1, Column: i + 1}
+		}
+		units += utf16Len(string(r))
+	}
+	return token.Position{Line: pos.Line + 1, Column: len(text) + 1}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -1,18 +1,301 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/compiler"
+	"gomadoufu/monkey-interpreter-go/cover"
+	"gomadoufu/monkey-interpreter-go/evaluator"
+	"gomadoufu/monkey-interpreter-go/format"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/lsp"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
 	"gomadoufu/monkey-interpreter-go/repl"
+	"gomadoufu/monkey-interpreter-go/token"
+	"gomadoufu/monkey-interpreter-go/vm"
+	"io"
 	"os"
 	"os/user"
+	"strings"
 )
 
+// --vm を付けると、評価器の代わりにコンパイラとVMでREPLを動かす
+var useVM = flag.Bool("vm", false, "use the bytecode compiler and VM instead of the tree-walking evaluator")
+
+// --cover を付けると、スクリプトを実行した後にカバレッジのレポートを標準エラー出力に書く
+var coverEnabled = flag.Bool("cover", false, "report which statements and expressions the script evaluated")
+var coverProfile = flag.String("coverprofile", "", "write the coverage report to `file` instead of stderr (implies --cover)")
+
+// --test を付けると、assert系の組み込み関数が失敗してもスクリプトを最後まで実行し、成功と失敗の数を報告する
+var testMode = flag.Bool("test", false, "run the script to the end and report how many assert, assert_eq and assert_ne calls passed and failed")
+
+// --profile を付けると、ノードの種類ごとの評価回数と時間を profile.json に書く
+var profileEnabled = flag.Bool("profile", false, "write evaluation counts and time per AST node type to profile.json")
+var profileTop = flag.Int("profile-top", 0, "print the `N` node types that took the most time to stderr")
+
+// --lsp を付けると、標準入出力で言語サーバを動かす
+var useLSP = flag.Bool("lsp", false, "run the language server over stdin and stdout")
+
+// --format を付けると、スクリプトを実行せずに整形する。ファイルがなければ標準入力を整形して標準出力に書く
+var formatMode = flag.Bool("format", false, "print a diff that formats the given files canonically (stdin to stdout if none)")
+var formatWrite = flag.Bool("write", false, "with --format, overwrite the files instead of printing a diff")
+var formatCheck = flag.Bool("check", false, "with --format, list files whose formatting would change and exit with status 1")
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [--vm] [--test] [--cover] [--coverprofile file] [--profile] [--profile-top N] [script [args...]]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s cover script [args...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s --format [--write | --check] [files...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s --lsp\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *useLSP {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *formatMode {
+		os.Exit(runFormat(flag.Args()))
+	}
+
+	// スクリプトが指定されていればREPLを起動せずに実行する
+	if flag.NArg() > 0 {
+		// cover サブコマンドは、実行した行に印を付けたソースコードを標準出力に書く
+		args := flag.Args()
+		annotate := args[0] == "cover" && len(args) > 1
+		if annotate {
+			args = args[1:]
+		}
+		// os_args()がスクリプト名の後ろの引数を返すように、os.Argsをスクリプト名から始める
+		os.Args = args
+		os.Exit(runScript(os.Args[0], annotate))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	if *useVM {
+		repl.StartVM(os.Stdin, os.Stdout)
+	} else {
+		repl.Start(os.Stdin, os.Stdout)
+	}
+}
+
+// スクリプトファイルを実行し、終了コードを返す。エラーは標準エラー出力に書く
+// annotateがtrueなら、実行後に印を付けたソースコードを標準出力に書く
+func runScript(path string, annotate bool) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	l := lexer.NewWithFile(string(src), path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "parser errors:\n\t%s\n", strings.Join(p.Errors(), "\n\t"))
+		return 1
+	}
+
+	measure := annotate || *coverEnabled || *coverProfile != ""
+	profiling := *profileEnabled || *profileTop > 0
+	if *useVM {
+		if measure {
+			fmt.Fprintln(os.Stderr, "coverage is not supported with --vm")
+			return 1
+		}
+		if *testMode {
+			fmt.Fprintln(os.Stderr, "--test is not supported with --vm")
+			return 1
+		}
+		if profiling {
+			fmt.Fprintln(os.Stderr, "profiling is not supported with --vm")
+			return 1
+		}
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(os.Stderr, "compilation failed: %s\n", err)
+			return 1
+		}
+		machine := vm.New(comp.Bytecode())
+		err := machine.Run()
+		if exit, ok := err.(*object.ExitSignal); ok {
+			return exit.Code
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "executing bytecode failed: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded := evaluator.ExpandMacros(program, macroEnv).(*ast.Program)
+
+	var hits map[token.Position]bool
+	if measure {
+		hits = map[token.Position]bool{}
+	}
+	var assertions *evaluator.Assertions
+	if *testMode {
+		assertions = &evaluator.Assertions{}
+	}
+	var profile *evaluator.Profile
+	if profiling {
+		profile = &evaluator.Profile{}
+	}
+	e := evaluator.NewWithOptions(evaluator.EvalOptions{Coverage: hits, Assertions: assertions, Profile: profile})
+	code := exitCode(e.Eval(expanded, object.NewEnvironment()))
+	if assertions != nil && reportAssertions(assertions) != 0 {
+		code = 1
+	}
+	if profile != nil {
+		if err := writeProfile(profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if measure {
+		if err := writeCoverage(cover.New(expanded, string(src), hits), annotate); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// 評価結果から終了コードを決める。エラーなら標準エラー出力に書く
+func exitCode(evaluated object.Object) int {
+	if exit, ok := evaluated.(*object.ExitSignal); ok {
+		return exit.Code
+	}
+	if evaluated != nil && (evaluated.Type() == object.ERROR_OBJ || evaluated.Type() == object.PANIC_OBJ) {
+		fmt.Fprintln(os.Stderr, evaluated.Inspect())
+		return 1
+	}
+	return 0
+}
+
+// 失敗したアサーションと成功・失敗の数を標準エラー出力に書く。失敗があれば1を返す
+func reportAssertions(assertions *evaluator.Assertions) int {
+	for _, failure := range assertions.Failures {
+		fmt.Fprintf(os.Stderr, "FAIL: %s\n", failure)
+	}
+	fmt.Fprintf(os.Stderr, "%d passed, %d failed\n", assertions.Passed, len(assertions.Failures))
+	if len(assertions.Failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// --profileならprofile.jsonに、--profile-topなら上位N件を標準エラー出力に書く
+func writeProfile(profile *evaluator.Profile) error {
+	if *profileTop > 0 {
+		if err := profile.WriteTop(os.Stderr, *profileTop); err != nil {
+			return err
+		}
+	}
+	if !*profileEnabled {
+		return nil
+	}
+
+	f, err := os.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	if err := profile.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeCoverage(profile *cover.Profile, annotate bool) error {
+	if annotate {
+		return profile.WriteAnnotated(os.Stdout)
+	}
+	if *coverProfile == "" {
+		return profile.WriteReport(os.Stderr)
+	}
+
+	f, err := os.Create(*coverProfile)
+	if err != nil {
+		return err
+	}
+	if err := profile.WriteReport(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ファイルを整形し、終了コードを返す
+// --writeなら上書きし、--checkなら整形が必要なファイルを書き出して1を返す。どちらもなければ差分を書く
+func runFormat(paths []string) int {
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := format.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", err)
+			return 1
+		}
+		if *formatCheck {
+			if formatted != string(src) {
+				fmt.Println("<stdin>")
+				return 1
+			}
+			return 0
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	code := 0
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		formatted, err := format.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			code = 1
+			continue
+		}
+		if formatted == string(src) {
+			continue
+		}
+
+		switch {
+		case *formatCheck:
+			fmt.Println(path)
+			code = 1
+		case *formatWrite:
+			if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+			}
+		default:
+			fmt.Print(format.Diff(path+".orig", path, string(src), formatted))
+		}
+	}
+	return code
 }
@@ -0,0 +1,152 @@
+// Goのプログラムに組み込んでMonkeyのコードを実行するためのAPI
+package monkey
+
+import (
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/evaluator"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"io"
+	"strings"
+)
+
+// 環境を保持するインタプリタ。Evalを呼ぶたびに同じ環境で評価するので、
+// 前のEvalで定義した変数や関数を次のEvalから参照できる
+type Interpreter struct {
+	env       *object.Environment
+	evaluator *evaluator.Evaluator
+}
+
+func NewInterpreter() *Interpreter {
+	return NewInterpreterWithIO(nil, nil)
+}
+
+// readlineの入力元をin、puts・println・printf・readlineの出力先をoutにしたインタプリタを作る
+// nilを渡した方は標準入出力を使う
+func NewInterpreterWithIO(in io.Reader, out io.Writer) *Interpreter {
+	return &Interpreter{
+		env:       object.NewEnvironment(),
+		evaluator: evaluator.NewWithOptions(evaluator.EvalOptions{Stdin: in, Stdout: out}),
+	}
+}
+
+// スクリプトがexit()を呼んだときにEvalが返すエラー
+// プロセスは終了しないので、終了するかどうかは埋め込む側で決める
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ソースコードを評価し、最後に評価した値を返す
+// 構文エラーや実行時エラーはerrorとして返す
+func (i *Interpreter) Eval(source string) (object.Object, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), ", "))
+	}
+
+	evaluated := i.evaluator.Eval(program, i.env)
+	if exit, ok := evaluated.(*object.ExitSignal); ok {
+		return nil, &ExitError{Code: exit.Code}
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", errObj.Message)
+	}
+	return evaluated, nil
+}
+
+// Goの値をMonkeyの値に変換して変数に束縛する
+// int64, string, bool と、それらを要素に持つ[]anyを受け付ける
+func (i *Interpreter) SetVar(name string, val any) error {
+	obj, err := toObject(val)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, obj)
+	return nil
+}
+
+// 変数の値をGoの値に変換して返す
+// Integerはint64、Stringはstring、Booleanはbool、Arrayは[]any、Nullはnilになる
+func (i *Interpreter) GetVar(name string) (any, error) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("identifier not found: %s", name)
+	}
+	return fromObject(obj)
+}
+
+// Goの関数を組み込み関数として登録する
+// 引数の数や型の検査は登録する関数の責任で、不正な場合は*object.Errorを返すこと
+func (i *Interpreter) RegisterFunc(name string, fn func(args ...object.Object) object.Object) error {
+	if fn == nil {
+		return fmt.Errorf("function %s is nil", name)
+	}
+	i.env.Set(name, &object.Builtin{Name: name, Fn: fn})
+	return nil
+}
+
+// 組み込む側で定義したオブジェクトの型に比較関数を登録し、sort・min・maxで並べられるようにする
+// 登録はすべてのインタプリタで共有される。object.Comparableを実装した型は登録しなくてよい
+func RegisterComparator(t object.ObjectType, fn object.CompareFunc) error {
+	if fn == nil {
+		return fmt.Errorf("comparator for %s is nil", t)
+	}
+	object.RegisterComparator(t, fn)
+	return nil
+}
+
+func toObject(val any) (object.Object, error) {
+	switch val := val.(type) {
+	case int64:
+		return &object.Integer{Value: val}, nil
+	case string:
+		return &object.String{Value: val}, nil
+	case bool:
+		return evaluator.NativeBoolToBooleanObject(val), nil
+	case []any:
+		elements := make([]object.Object, len(val))
+		for idx, v := range val {
+			elem, err := toObject(v)
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = elem
+		}
+		return &object.Array{Elements: elements}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Go type: %T", val)
+	}
+}
+
+func fromObject(obj object.Object) (any, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for idx, elem := range obj.Elements {
+			v, err := fromObject(elem)
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = v
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
@@ -0,0 +1,248 @@
+package monkey
+
+import (
+	"bytes"
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetVarAndGetVar(t *testing.T) {
+	i := NewInterpreter()
+
+	if err := i.SetVar("base", int64(10)); err != nil {
+		t.Fatalf("SetVar failed: %s", err)
+	}
+	if err := i.SetVar("items", []any{int64(1), "two", true}); err != nil {
+		t.Fatalf("SetVar failed: %s", err)
+	}
+
+	_, err := i.Eval(`
+	let addBase = fn(x) { x + base };
+	let result = addBase(len(items));
+	let flag = items[2] == true;
+	`)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected any
+	}{
+		{"result", int64(13)},
+		{"flag", true},
+		{"items", []any{int64(1), "two", true}},
+	}
+
+	for _, tt := range tests {
+		got, err := i.GetVar(tt.name)
+		if err != nil {
+			t.Errorf("GetVar(%q) failed: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("GetVar(%q) wrong. want=%#v, got=%#v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestEvalPersistsEnvironment(t *testing.T) {
+	i := NewInterpreter()
+
+	if _, err := i.Eval("let double = fn(x) { x * 2 };"); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	result, err := i.Eval(`double(21)`)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if result.Inspect() != "42" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	i := NewInterpreter()
+
+	err := i.RegisterFunc("square", func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args))}
+		}
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return &object.Error{Message: fmt.Sprintf("argument to `square` must be INTEGER, got %s", args[0].Type())}
+		}
+		return &object.Integer{Value: n.Value * n.Value}
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc failed: %s", err)
+	}
+
+	if _, err := i.Eval(`let result = square(3) + square(4);`); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	got, err := i.GetVar("result")
+	if err != nil {
+		t.Fatalf("GetVar failed: %s", err)
+	}
+	if got != int64(25) {
+		t.Errorf("wrong result. want=25, got=%#v", got)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`square(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`square("a")`, "argument to `square` must be INTEGER, got STRING"},
+	}
+	for _, tt := range errorTests {
+		_, err := i.Eval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	if err := i.RegisterFunc("broken", nil); err == nil {
+		t.Errorf("expected error for nil function")
+	}
+}
+
+// 組み込む側で定義したオブジェクト
+type version struct {
+	major, minor int64
+}
+
+func (v *version) Type() object.ObjectType { return "VERSION" }
+func (v *version) Inspect() string         { return fmt.Sprintf("v%d.%d", v.major, v.minor) }
+
+func TestRegisterComparator(t *testing.T) {
+	err := RegisterComparator("VERSION", func(a, b object.Object) (int, error) {
+		x, y := a.(*version), b.(*version)
+		if x.major != y.major {
+			return int(x.major - y.major), nil
+		}
+		return int(x.minor - y.minor), nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterComparator failed: %s", err)
+	}
+
+	i := NewInterpreter()
+	err = i.RegisterFunc("version", func(args ...object.Object) object.Object {
+		return &version{major: args[0].(*object.Integer).Value, minor: args[1].(*object.Integer).Value}
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc failed: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sort([version(1, 10), version(0, 9), version(1, 2)])`, "[v0.9, v1.2, v1.10]"},
+		{`max(version(2, 0), version(10, 1), version(3, 5))`, "v10.1"},
+	}
+	for _, tt := range tests {
+		result, err := i.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("Eval failed for %s: %s", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. want=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	_, err = i.Eval(`sort([version(1, 0), 1])`)
+	if err == nil || err.Error() != "sort: cannot compare INTEGER with VERSION" {
+		t.Errorf("wrong error for mixed types. got=%v", err)
+	}
+
+	if err := RegisterComparator("VERSION", nil); err == nil {
+		t.Errorf("expected error for nil comparator")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	i := NewInterpreter()
+
+	if _, err := i.Eval("let = 1;"); err == nil {
+		t.Errorf("expected parser error")
+	}
+	if _, err := i.Eval("1 + true"); err == nil || err.Error() != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+	if _, err := i.GetVar("missing"); err == nil {
+		t.Errorf("expected error for missing variable")
+	}
+	if err := i.SetVar("f", 1.5); err == nil {
+		t.Errorf("expected error for unsupported Go type")
+	}
+
+	i.Eval("let f = fn() { 1 };")
+	if _, err := i.GetVar("f"); err == nil {
+		t.Errorf("expected error for converting a function")
+	}
+}
+
+func TestReadlineWithInjectedIO(t *testing.T) {
+	in := strings.NewReader("Alice\r\nこんにちは\nlast")
+	var out bytes.Buffer
+	i := NewInterpreterWithIO(in, &out)
+
+	result, err := i.Eval(`
+	let name = readline("Enter your name: ");
+	puts("Hello, " + name);
+	let greeting = readline();
+	let last = readline("> ");
+	[name, greeting, len(greeting), last, readline()]
+	`)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+
+	expected := `[Alice, こんにちは, 5, last, null]`
+	if result.Inspect() != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, result.Inspect())
+	}
+	if out.String() != "Enter your name: Hello, Alice\n> " {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	// 入力の読み残しはEvalをまたいで保持される
+	result, err = i.Eval(`readline()`)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if result.Inspect() != "null" {
+		t.Errorf("readline after EOF returned %q", result.Inspect())
+	}
+}
+
+func TestExitReturnsExitError(t *testing.T) {
+	i := NewInterpreter()
+
+	result, err := i.Eval(`let x = 1; exit(3); x = 2;`)
+	if result != nil {
+		t.Errorf("result is not nil. got=%+v", result)
+	}
+	exitErr, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("err is not *ExitError. got=%T (%v)", err, err)
+	}
+	if exitErr.Code != 3 {
+		t.Errorf("wrong exit code. want=3, got=%d", exitErr.Code)
+	}
+
+	// exitの後の文は評価されない
+	x, err := i.GetVar("x")
+	if err != nil {
+		t.Fatalf("GetVar failed: %s", err)
+	}
+	if x != int64(1) {
+		t.Errorf("x was modified after exit. got=%v", x)
+	}
+}
@@ -0,0 +1,45 @@
+package object
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// base64_*の本体。encは=で埋める方のエンコーディングで、埋めない方はそこから作る
+
+// 文字列をエンコードする。2つ目の引数がtrueなら末尾の=を付けない
+func Base64Encode(name string, enc *base64.Encoding, args []Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	if len(args) == 2 {
+		noPadding, ok := args[1].(*Boolean)
+		if !ok {
+			return newError("no_padding passed to `%s` must be BOOLEAN, got %s", name, args[1].Type())
+		}
+		if noPadding.Value {
+			enc = enc.WithPadding(base64.NoPadding)
+		}
+	}
+	return &String{Value: enc.EncodeToString([]byte(str.Value))}
+}
+
+// 文字列をデコードする。末尾の=はあってもなくてもよいが、あるなら数が合っていること
+func Base64Decode(name string, enc *base64.Encoding, args []Object) Object {
+	str, err := stringArg(name, args)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(str, "=") {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	decoded, decodeErr := enc.Strict().DecodeString(str)
+	if decodeErr != nil {
+		return newError("%s: %s", name, decodeErr)
+	}
+	return &String{Value: string(decoded)}
+}
@@ -0,0 +1,1618 @@
+package object
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 組み込み関数の一覧。コンパイラはこのスライスのインデックスをOpGetBuiltinのオペランドにするので、
+// 既存の要素の順序は変えず、新しい組み込み関数は末尾に追加すること
+var Builtins = []*Builtin{
+	{
+		Name: "len",
+		Doc:  "len(val) — returns the number of elements in an Array, Set or Tuple, or characters (not bytes) in a String",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *String:
+				// バイト数ではなく文字数を返す
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Set:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Tuple:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	{
+		Name: "puts",
+		Doc:  "puts(args...) — prints each argument on its own line and returns null",
+		Fn: func(args ...Object) Object {
+			return Puts(os.Stdout, args)
+		},
+	},
+	{
+		Name: "first",
+		Doc:  "first(arr) — returns the first element of an Array, or null if it is empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return nil
+		},
+	},
+	{
+		Name: "last",
+		Doc:  "last(arr) — returns the last element of an Array, or null if it is empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+			return nil
+		},
+	},
+	{
+		Name: "rest",
+		Doc:  "rest(arr) — returns a new Array without the first element, or null if it is empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+			return nil
+		},
+	},
+	{
+		Name: "push",
+		Doc:  "push(arr, val) — returns a new Array with val appended to the end of arr",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+			return &Array{Elements: newElements}
+		},
+	},
+	{
+		Name: "type",
+		Doc:  "type(val) — returns the type of val as a String, such as \"INTEGER\" or \"SYMBOL\"",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return &String{Value: string(args[0].Type())}
+		},
+	},
+	{
+		Name: "str",
+		Doc:  "str(val) — returns the printed representation of val as a String",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if s, ok := args[0].(*String); ok {
+				return s
+			}
+			return &String{Value: args[0].Inspect()}
+		},
+	},
+	{
+		Name: "set",
+		Doc:  "set(arr) — returns a new Set containing the elements of arr without duplicates",
+		Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			set := NewSet()
+			if len(args) == 0 {
+				return set
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
+			}
+			for _, e := range arr.Elements {
+				if !set.Add(e) {
+					return newError("unusable as set element: %s", e.Type())
+				}
+			}
+			return set
+		},
+	},
+	{
+		Name: "set_add",
+		Doc:  "set_add(s, val) — returns a new Set with val added to s",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			s, ok := args[0].(*Set)
+			if !ok {
+				return newError("argument to `set_add` must be SET, got %s", args[0].Type())
+			}
+			set := s.Copy()
+			if !set.Add(args[1]) {
+				return newError("unusable as set element: %s", args[1].Type())
+			}
+			return set
+		},
+	},
+	{
+		Name: "set_remove",
+		Doc:  "set_remove(s, val) — returns a new Set with val removed from s",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			s, ok := args[0].(*Set)
+			if !ok {
+				return newError("argument to `set_remove` must be SET, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as set element: %s", args[1].Type())
+			}
+			set := s.Copy()
+			delete(set.Elements, key)
+			return set
+		},
+	},
+	{
+		Name: "set_has",
+		Doc:  "set_has(s, val) — returns true if val is an element of s",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			s, ok := args[0].(*Set)
+			if !ok {
+				return newError("argument to `set_has` must be SET, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as set element: %s", args[1].Type())
+			}
+			_, ok = s.Elements[key]
+			return nativeBool(ok)
+		},
+	},
+	{
+		Name: "set_union",
+		Doc:  "set_union(s1, s2) — returns a new Set with the elements of either s1 or s2",
+		Fn: func(args ...Object) Object {
+			s1, s2, err := twoSets("set_union", args)
+			if err != nil {
+				return err
+			}
+			set := s1.Copy()
+			for k, v := range s2.Elements {
+				set.Elements[k] = v
+			}
+			return set
+		},
+	},
+	{
+		Name: "set_intersection",
+		Doc:  "set_intersection(s1, s2) — returns a new Set with the elements of both s1 and s2",
+		Fn: func(args ...Object) Object {
+			s1, s2, err := twoSets("set_intersection", args)
+			if err != nil {
+				return err
+			}
+			set := NewSet()
+			for k, v := range s1.Elements {
+				if _, ok := s2.Elements[k]; ok {
+					set.Elements[k] = v
+				}
+			}
+			return set
+		},
+	},
+	{
+		Name: "set_difference",
+		Doc:  "set_difference(s1, s2) — returns a new Set with the elements of s1 that are not in s2",
+		Fn: func(args ...Object) Object {
+			s1, s2, err := twoSets("set_difference", args)
+			if err != nil {
+				return err
+			}
+			set := NewSet()
+			for k, v := range s1.Elements {
+				if _, ok := s2.Elements[k]; !ok {
+					set.Elements[k] = v
+				}
+			}
+			return set
+		},
+	},
+	{
+		Name: "copy",
+		Doc:  "copy(val) — returns a shallow copy of an Array, Hash or Set; other values are returned as is",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Array:
+				elements := make([]Object, len(arg.Elements))
+				copy(elements, arg.Elements)
+				return &Array{Elements: elements}
+			case *Hash:
+				return arg.Copy()
+			case *Set:
+				return arg.Copy()
+			default:
+				// 整数や文字列は変更できないので、コピーする必要がない
+				return arg
+			}
+		},
+	},
+	{
+		Name: "sprintf",
+		Doc:  "sprintf(format, args...) — returns format with %s, %d, %f, %t, %v and %% replaced by args",
+		Fn: func(args ...Object) Object {
+			str, err := Format("sprintf", args)
+			if err != nil {
+				return err
+			}
+			return &String{Value: str}
+		},
+	},
+	{
+		Name: "printf",
+		Doc:  "printf(format, args...) — prints format formatted like sprintf, without a trailing newline, and returns null",
+		Fn: func(args ...Object) Object {
+			return Printf(os.Stdout, args)
+		},
+	},
+	{
+		Name: "json_parse",
+		Doc:  "json_parse(str) — parses a JSON String into Hashes, Arrays, Integers, Strings, Booleans and null",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `json_parse` must be STRING, got %s", args[0].Type())
+			}
+			return jsonParse(str.Value)
+		},
+	},
+	{
+		Name: "json_stringify",
+		Doc:  "json_stringify(val) — returns the JSON representation of val as a String",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return jsonStringify(args[0])
+		},
+	},
+	{
+		Name: "regexp_match",
+		Doc:  "regexp_match(pattern, str) — returns true if str contains a match of the regular expression pattern",
+		Fn: func(args ...Object) Object {
+			re, strs, err := regexpArgs("regexp_match", args, 1)
+			if err != nil {
+				return err
+			}
+			return nativeBool(re.MatchString(strs[0]))
+		},
+	},
+	{
+		Name: "regexp_find",
+		Doc:  "regexp_find(pattern, str) — returns the leftmost match of pattern in str, or null if there is none",
+		Fn: func(args ...Object) Object {
+			re, strs, err := regexpArgs("regexp_find", args, 1)
+			if err != nil {
+				return err
+			}
+			loc := re.FindStringIndex(strs[0])
+			if loc == nil {
+				return nil
+			}
+			return &String{Value: strs[0][loc[0]:loc[1]]}
+		},
+	},
+	{
+		Name: "regexp_find_all",
+		Doc:  "regexp_find_all(pattern, str) — returns an Array of all non-overlapping matches of pattern in str",
+		Fn: func(args ...Object) Object {
+			re, strs, err := regexpArgs("regexp_find_all", args, 1)
+			if err != nil {
+				return err
+			}
+			elements := []Object{}
+			for _, m := range re.FindAllString(strs[0], -1) {
+				elements = append(elements, &String{Value: m})
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "regexp_replace",
+		Doc:  "regexp_replace(pattern, repl, str) — replaces every match of pattern in str with repl; $1 in repl refers to a group",
+		Fn: func(args ...Object) Object {
+			re, strs, err := regexpArgs("regexp_replace", args, 2)
+			if err != nil {
+				return err
+			}
+			return &String{Value: re.ReplaceAllString(strs[1], strs[0])}
+		},
+	},
+	{
+		Name: "readline",
+		Doc:  "readline(prompt) — prints prompt, reads a line from standard input and returns it without the newline, or null at end of input",
+		Fn: func(args ...Object) Object {
+			return ReadLine(nil, os.Stdout, args)
+		},
+	},
+	{
+		Name: "file_read",
+		Doc:  "file_read(path) — returns the contents of the UTF-8 text file at path as a String",
+		Fn: func(args ...Object) Object {
+			strs, err := stringArgs("file_read", args, 1)
+			if err != nil {
+				return err
+			}
+			data, readErr := os.ReadFile(strs[0])
+			if readErr != nil {
+				return newError("file_read: %s", readErr)
+			}
+			if !utf8.Valid(data) {
+				return newError("file_read: %s is not UTF-8 text", strs[0])
+			}
+			return &String{Value: string(data)}
+		},
+	},
+	{
+		Name: "file_write",
+		Doc:  "file_write(path, content) — replaces the contents of the file at path with content and returns null",
+		Fn: func(args ...Object) Object {
+			strs, err := stringArgs("file_write", args, 2)
+			if err != nil {
+				return err
+			}
+			if writeErr := os.WriteFile(strs[0], []byte(strs[1]), 0o644); writeErr != nil {
+				return newError("file_write: %s", writeErr)
+			}
+			return nil
+		},
+	},
+	{
+		Name: "file_append",
+		Doc:  "file_append(path, content) — appends content to the file at path, creating it if needed, and returns null",
+		Fn: func(args ...Object) Object {
+			strs, err := stringArgs("file_append", args, 2)
+			if err != nil {
+				return err
+			}
+			f, openErr := os.OpenFile(strs[0], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if openErr != nil {
+				return newError("file_append: %s", openErr)
+			}
+			_, writeErr := f.WriteString(strs[1])
+			closeErr := f.Close()
+			if writeErr != nil {
+				return newError("file_append: %s", writeErr)
+			}
+			if closeErr != nil {
+				return newError("file_append: %s", closeErr)
+			}
+			return nil
+		},
+	},
+	{
+		Name: "file_exists",
+		Doc:  "file_exists(path) — returns true if a file or directory exists at path",
+		Fn: func(args ...Object) Object {
+			strs, err := stringArgs("file_exists", args, 1)
+			if err != nil {
+				return err
+			}
+			_, statErr := os.Stat(strs[0])
+			return nativeBool(statErr == nil)
+		},
+	},
+	{
+		Name: "os_args",
+		Doc:  "os_args() — returns the command-line arguments after the script name as an Array of Strings",
+		Fn: func(args ...Object) Object {
+			return OSArgs(os.Args[1:], args)
+		},
+	},
+	{
+		Name: "os_env",
+		Doc:  "os_env([name]) — returns the environment variable name, or null if unset; with no argument, returns all variables as a Hash",
+		Fn: func(args ...Object) Object {
+			return OSEnv(args)
+		},
+	},
+	{
+		Name: "exit",
+		Doc:  "exit([code]) — stops the program with the exit code (0 to 255, default 0)",
+		Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 {
+				return &ExitSignal{Code: 0}
+			}
+			code, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+			}
+			if code.Value < 0 || code.Value > 255 {
+				return newError("exit code must be between 0 and 255, got %d", code.Value)
+			}
+			return &ExitSignal{Code: int(code.Value)}
+		},
+	},
+	{
+		Name: "println",
+		Doc:  "println(args...) — same as puts: prints each argument on its own line and returns null",
+		Fn: func(args ...Object) Object {
+			return Puts(os.Stdout, args)
+		},
+	},
+	{
+		Name: "eprint",
+		Doc:  "eprint(args...) — prints the arguments to stderr separated by spaces, without a newline",
+		Fn: func(args ...Object) Object {
+			return Print(os.Stderr, args)
+		},
+	},
+	{
+		Name: "eprintln",
+		Doc:  "eprintln(args...) — prints each argument to stderr on its own line and returns null",
+		Fn: func(args ...Object) Object {
+			return Puts(os.Stderr, args)
+		},
+	},
+	{
+		Name: "int",
+		Doc:  "int(val) — converts a Float (truncating toward zero), a BigInt that fits in 64 bits or a String to an Integer",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *BigInt:
+				if !arg.Value.IsInt64() {
+					return newError("int: %s overflows INTEGER", arg.Inspect())
+				}
+				return &Integer{Value: arg.Value.Int64()}
+			case *Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("int: cannot convert %s to INTEGER", arg.Inspect())
+				}
+				return &Integer{Value: int64(arg.Value)}
+			case *String:
+				i, err := strconv.ParseInt(arg.Value, 10, 64)
+				if err != nil {
+					return newError("int: could not parse %q as integer", arg.Value)
+				}
+				return &Integer{Value: i}
+			default:
+				return newError("argument to `int` must be INTEGER, BIGINT, FLOAT or STRING, got %s", arg.Type())
+			}
+		},
+	},
+	{
+		Name: "float",
+		Doc:  "float(val) — converts an Integer or a String to a Float",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Float:
+				return arg
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *String:
+				f, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError("float: could not parse %q as float", arg.Value)
+				}
+				return &Float{Value: f}
+			default:
+				return newError("argument to `float` must be INTEGER, FLOAT or STRING, got %s", arg.Type())
+			}
+		},
+	},
+	{
+		Name: "bigint",
+		Doc:  "bigint(val) — converts an Integer or a decimal String to an arbitrary-precision BigInt",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *BigInt:
+				return arg
+			case *Integer:
+				return &BigInt{Value: big.NewInt(arg.Value)}
+			case *String:
+				i, ok := new(big.Int).SetString(arg.Value, 10)
+				if !ok {
+					return newError("bigint: could not parse %q as integer", arg.Value)
+				}
+				return &BigInt{Value: i}
+			default:
+				return newError("argument to `bigint` must be INTEGER or STRING, got %s", arg.Type())
+			}
+		},
+	},
+	{
+		Name: "sort",
+		Doc:  "sort(arr) — returns a new Array with the elements of arr in ascending order; sort(arr, fn) orders them by fn(a, b), which returns a negative, zero or positive Integer",
+		Fn: func(args ...Object) Object {
+			if len(args) == 2 {
+				// 比較関数を呼び出すには評価器が必要
+				return newError("sort: comparator functions are not supported here")
+			}
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+			}
+			sorted, err := SortObjects(arr.Elements)
+			if err != nil {
+				return newError("sort: %s", err)
+			}
+			return &Array{Elements: sorted}
+		},
+	},
+	{
+		Name: "min",
+		Doc:  "min(arr) or min(a, b, ...) — returns the smallest of the elements",
+		Fn: func(args ...Object) Object {
+			return extreme("min", args, -1)
+		},
+	},
+	{
+		Name: "max",
+		Doc:  "max(arr) or max(a, b, ...) — returns the largest of the elements",
+		Fn: func(args ...Object) Object {
+			return extreme("max", args, 1)
+		},
+	},
+	{
+		Name: "cursor",
+		Doc:  "cursor(val) — returns a Cursor over the elements of an Array or Tuple, the characters of a String, or the (key, value) Tuples of a Hash",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			c, ok := NewCursor(args[0])
+			if !ok {
+				return newError("argument to `cursor` must be ARRAY, TUPLE, STRING or HASH, got %s", args[0].Type())
+			}
+			return c
+		},
+	},
+	{
+		Name: "cursor_next",
+		Doc:  "cursor_next(c) — returns the current element of a Cursor (or any iterator such as a Generator) and advances it, or null when it is exhausted",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			it, ok := args[0].(Iterator)
+			if !ok {
+				return newError("argument to `cursor_next` must be CURSOR, got %s", args[0].Type())
+			}
+			obj, ok := it.Next()
+			if !ok {
+				return NULL
+			}
+			return obj
+		},
+	},
+	{
+		Name: "cursor_peek",
+		Doc:  "cursor_peek(c) — returns the current element of a Cursor without advancing it, or null when it is exhausted",
+		Fn: func(args ...Object) Object {
+			c, err := cursorArg("cursor_peek", args)
+			if err != nil {
+				return err
+			}
+			obj, ok := c.Peek()
+			if !ok {
+				return NULL
+			}
+			return obj
+		},
+	},
+	{
+		Name: "cursor_reset",
+		Doc:  "cursor_reset(c) — moves a Cursor back to its first element and returns it",
+		Fn: func(args ...Object) Object {
+			c, err := cursorArg("cursor_reset", args)
+			if err != nil {
+				return err
+			}
+			c.Reset()
+			return c
+		},
+	},
+	{
+		Name: "keys",
+		Doc:  "keys(hash) — returns the keys of hash as an Array in insertion order",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+			}
+			keys := make([]Object, 0, hash.Len())
+			for _, pair := range hash.Pairs() {
+				keys = append(keys, pair.Key)
+			}
+			return &Array{Elements: keys}
+		},
+	},
+	{
+		Name: "merge",
+		Doc:  "merge(a, b, ...) — returns a new Hash with the pairs of a followed by the new keys of b and so on, from left to right; later values win",
+		Fn: func(args ...Object) Object {
+			if len(args) < 2 {
+				return newError("wrong number of arguments. got=%d, want=at least 2", len(args))
+			}
+			for _, arg := range args {
+				if _, ok := arg.(*Hash); !ok {
+					return newError("argument to `merge` must be HASH, got %s", arg.Type())
+				}
+			}
+			// 左のハッシュにあるキーは位置を保ったまま値だけを上書きし、新しいキーは末尾に足す
+			merged := args[0].(*Hash).Copy()
+			for _, arg := range args[1:] {
+				for _, pair := range arg.(*Hash).Pairs() {
+					key, _ := HashKeyOf(pair.Key)
+					merged.Set(key, pair)
+				}
+			}
+			return merged
+		},
+	},
+	{
+		Name: "range",
+		Doc:  "range(end), range(start, end) or range(start, end, step) — returns an Array of the Integers from start (default 0) up to but not including end",
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+			bounds := []int64{0, 0, 1}
+			for i, arg := range args {
+				n, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = n.Value
+			}
+			start, end, step := bounds[0], bounds[1], bounds[2]
+			if len(args) == 1 {
+				start, end = 0, bounds[0]
+			}
+			if step == 0 {
+				return newError("range: step must not be 0")
+			}
+
+			elements := []Object{}
+			for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+				elements = append(elements, &Integer{Value: i})
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "mixin",
+		Doc:  "mixin(base, extra, ...) — returns a new Hash with the pairs of base followed by those of each extra; later values win. The copy is shallow",
+		Fn: func(args ...Object) Object {
+			if len(args) < 2 {
+				return newError("wrong number of arguments. got=%d, want=at least 2", len(args))
+			}
+			for _, arg := range args {
+				if _, ok := arg.(*Hash); !ok {
+					return newError("argument to `mixin` must be HASH, got %s", arg.Type())
+				}
+			}
+			// mergeと同じく新しいハッシュに書き込むので、引数のハッシュは変わらない
+			mixed := args[0].(*Hash).Copy()
+			for _, arg := range args[1:] {
+				for _, pair := range arg.(*Hash).Pairs() {
+					key, _ := HashKeyOf(pair.Key)
+					mixed.Set(key, pair)
+				}
+			}
+			return mixed
+		},
+	},
+	{
+		Name: "clock",
+		Doc:  "clock() — returns the number of nanoseconds since the interpreter started; subtract two readings to time code",
+		Fn: func(args ...Object) Object {
+			return Clock(processStart, time.Now(), args)
+		},
+	},
+	{
+		Name: "time",
+		Doc:  "time() — returns the current Unix time in seconds",
+		Fn: func(args ...Object) Object {
+			return UnixTime(time.Now(), args)
+		},
+	},
+	{
+		Name: "sleep",
+		Doc:  "sleep(ms) — pauses execution for ms milliseconds; at most 1000 in the sandbox",
+		Fn: func(args ...Object) Object {
+			return Sleep(args, 0, nil)
+		},
+	},
+	{
+		Name: "chan",
+		Doc:  "chan() or chan(n) — returns a new channel; unbuffered, or buffered with capacity n",
+		Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 {
+				return NewChannel(0)
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `chan` must be INTEGER, got %s", args[0].Type())
+			}
+			if n.Value < 0 {
+				return newError("chan: capacity must not be negative, got %d", n.Value)
+			}
+			return NewChannel(int(n.Value))
+		},
+	},
+	{
+		Name: "chan_send",
+		Doc:  "chan_send(ch, val) — sends val on ch, blocking until it is received or buffered",
+		Fn: func(args ...Object) Object {
+			return ChanSend(args, nil)
+		},
+	},
+	{
+		Name: "chan_recv",
+		Doc:  "chan_recv(ch) — receives a value from ch, blocking until one arrives; returns null once ch is closed and drained",
+		Fn: func(args ...Object) Object {
+			return ChanRecv(args, nil)
+		},
+	},
+	{
+		Name: "chan_close",
+		Doc:  "chan_close(ch) — closes ch; later sends fail and receives return null once the buffer is drained",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			c, ok := args[0].(*Channel)
+			if !ok {
+				return newError("argument to `chan_close` must be CHANNEL, got %s", args[0].Type())
+			}
+			if err := c.Close(); err != nil {
+				return err
+			}
+			return NULL
+		},
+	},
+	{
+		Name: "record",
+		Doc:  "record(hash) — returns an immutable Record with the pairs of hash; records with equal pairs are == and can be hash keys",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return newError("argument to `record` must be HASH, got %s", args[0].Type())
+			}
+			return NewRecord(hash.Pairs())
+		},
+	},
+	{
+		Name: "record_update",
+		Doc:  "record_update(r, key, val) — returns a new Record like r but with key set to val; r itself is not changed and key must already be in r",
+		Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			r, ok := args[0].(*Record)
+			if !ok {
+				return newError("argument to `record_update` must be RECORD, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			// レコードの形は作ったときに決まる。キーを増やすときは新しくrecord()で作る
+			if _, ok := r.Get(key); !ok {
+				return newError("record_update: record has no key %s", args[1].Inspect())
+			}
+			return r.With(key, HashPair{Key: args[1], Value: args[2]})
+		},
+	},
+	{
+		Name: "set_field",
+		Doc:  "set_field(hash, key, val) — returns a new Hash like hash but with key set to val; hash itself is not changed",
+		Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return newError("argument to `set_field` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			// 既にあるキーは位置を保ったまま値だけを置き換える
+			updated := hash.Copy()
+			updated.Set(key, HashPair{Key: args[1], Value: args[2]})
+			return updated
+		},
+	},
+	{
+		Name: "self",
+		Doc:  "self(hash) — returns hash itself; ends a method body so that calls on the object can be chained",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if _, ok := args[0].(*Hash); !ok {
+				return newError("argument to `self` must be HASH, got %s", args[0].Type())
+			}
+			return args[0]
+		},
+	},
+	{
+		Name: "chars",
+		Doc:  "chars(str) — returns an Array of the characters of str, one String per Unicode code point",
+		Fn: func(args ...Object) Object {
+			str, err := stringArg("chars", args)
+			if err != nil {
+				return err
+			}
+			elements := []Object{}
+			for _, r := range str {
+				elements = append(elements, &String{Value: string(r)})
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "bytes",
+		Doc:  "bytes(str) — returns an Array of the UTF-8 bytes of str as Integers",
+		Fn: func(args ...Object) Object {
+			str, err := stringArg("bytes", args)
+			if err != nil {
+				return err
+			}
+			elements := make([]Object, len(str))
+			for i := 0; i < len(str); i++ {
+				elements[i] = &Integer{Value: int64(str[i])}
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "codepoints",
+		Doc:  "codepoints(str) — returns an Array of the Unicode code points of str as Integers",
+		Fn: func(args ...Object) Object {
+			str, err := stringArg("codepoints", args)
+			if err != nil {
+				return err
+			}
+			elements := []Object{}
+			for _, r := range str {
+				elements = append(elements, &Integer{Value: int64(r)})
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "zip",
+		Doc:  "zip(a, b, ...) — returns an Array of Arrays that pair up the elements of the arrays by index; stops at the shortest array",
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want=at least 1", len(args))
+			}
+			arrays := make([]*Array, len(args))
+			shortest := -1
+			for i, arg := range args {
+				arr, ok := arg.(*Array)
+				if !ok {
+					return newError("argument to `zip` must be ARRAY, got %s", arg.Type())
+				}
+				arrays[i] = arr
+				if shortest < 0 || len(arr.Elements) < shortest {
+					shortest = len(arr.Elements)
+				}
+			}
+
+			zipped := make([]Object, shortest)
+			for i := range zipped {
+				row := make([]Object, len(arrays))
+				for j, arr := range arrays {
+					row[j] = arr.Elements[i]
+				}
+				zipped[i] = &Array{Elements: row}
+			}
+			return &Array{Elements: zipped}
+		},
+	},
+	{
+		Name: "flatten",
+		Doc:  "flatten(arr) or flatten(arr, depth) — returns a new Array with the nested arrays in arr expanded in place, all the way down or only depth levels",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `flatten` must be ARRAY, got %s", args[0].Type())
+			}
+			// 深さを指定しなければ、入れ子をすべて展開する
+			depth := int64(-1)
+			if len(args) == 2 {
+				n, ok := args[1].(*Integer)
+				if !ok {
+					return newError("depth passed to `flatten` must be INTEGER, got %s", args[1].Type())
+				}
+				if n.Value < 0 {
+					return newError("flatten: depth must not be negative, got %d", n.Value)
+				}
+				depth = n.Value
+			}
+			return &Array{Elements: flattenElements([]Object{}, arr.Elements, depth)}
+		},
+	},
+	{
+		Name: "uniq",
+		Doc:  "uniq(arr) — returns a new Array with the duplicate elements of arr removed, keeping the first of each; values that can be hash keys are compared by value, others by identity",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `uniq` must be ARRAY, got %s", args[0].Type())
+			}
+
+			seen := map[HashKey]bool{}
+			// キーにできない値は同一性で比べるので、線形に探す
+			var others []Object
+			elements := []Object{}
+		outer:
+			for _, el := range arr.Elements {
+				if key, ok := HashKeyOf(el); ok {
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				} else {
+					for _, other := range others {
+						if other == el {
+							continue outer
+						}
+					}
+					others = append(others, el)
+				}
+				elements = append(elements, el)
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "chunk",
+		Doc:  "chunk(arr, size) — returns an Array of Arrays of size elements each, in order; the last one may be shorter",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `chunk` must be ARRAY, got %s", args[0].Type())
+			}
+			size, ok := args[1].(*Integer)
+			if !ok {
+				return newError("size passed to `chunk` must be INTEGER, got %s", args[1].Type())
+			}
+			if size.Value <= 0 {
+				return newError("chunk: size must be positive, got %d", size.Value)
+			}
+
+			chunks := []Object{}
+			for start := 0; start < len(arr.Elements); {
+				end := len(arr.Elements)
+				if int64(end-start) > size.Value {
+					end = start + int(size.Value)
+				}
+				elements := make([]Object, end-start)
+				copy(elements, arr.Elements[start:end])
+				chunks = append(chunks, &Array{Elements: elements})
+				start = end
+			}
+			return &Array{Elements: chunks}
+		},
+	},
+	{
+		Name: "format",
+		Doc:  "format(template, args...) — returns template with {} replaced by the next argument, {0} by the argument at that index and {name} by that key of a Hash first argument; {{ and }} are literal braces",
+		Fn: func(args ...Object) Object {
+			str, err := Template("format", args)
+			if err != nil {
+				return err
+			}
+			return &String{Value: str}
+		},
+	},
+	{
+		Name: "regexp",
+		Doc:  "regexp(pattern) — compiles the regular expression pattern into a Regex that split and regexp_* accept in place of a pattern String",
+		Fn: func(args ...Object) Object {
+			pattern, argErr := stringArg("regexp", args)
+			if argErr != nil {
+				return argErr
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return newError("regexp: %s", err)
+			}
+			return &Regex{Value: re}
+		},
+	},
+	{
+		Name: "split",
+		Doc:  "split(str, sep, limit) — splits str on the String or Regex sep into at most limit parts; \"\" splits into characters and no sep splits on runs of whitespace",
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+			}
+			str, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `split` must be STRING, got %s", args[0].Type())
+			}
+
+			limit := -1
+			if len(args) == 3 {
+				n, ok := args[2].(*Integer)
+				if !ok {
+					return newError("limit passed to `split` must be INTEGER, got %s", args[2].Type())
+				}
+				if n.Value <= 0 {
+					return newError("split: limit must be positive, got %d", n.Value)
+				}
+				if n.Value < int64(len(str.Value))+1 {
+					limit = int(n.Value)
+				}
+			}
+
+			var parts []string
+			switch {
+			case len(args) == 1:
+				// 区切りがなければ空白の並びで分け、前後の空白は捨てる
+				parts = strings.Fields(str.Value)
+			default:
+				switch sep := args[1].(type) {
+				case *String:
+					// 区切りが空文字列なら、UTF-8の1文字ずつに分ける
+					parts = strings.SplitN(str.Value, sep.Value, limit)
+				case *Regex:
+					parts = sep.Value.Split(str.Value, limit)
+				default:
+					return newError("separator passed to `split` must be STRING or REGEX, got %s", args[1].Type())
+				}
+			}
+
+			elements := make([]Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &String{Value: part}
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	{
+		Name: "pad_left",
+		Doc:  "pad_left(str, width, fill) — returns str padded on the left with fill (a space by default) to width characters",
+		Fn: func(args ...Object) Object {
+			str, width, fill, err := padArgs("pad_left", args)
+			if err != nil {
+				return err
+			}
+			return &String{Value: padding(fill, width-int64(utf8.RuneCountInString(str))) + str}
+		},
+	},
+	{
+		Name: "pad_right",
+		Doc:  "pad_right(str, width, fill) — returns str padded on the right with fill (a space by default) to width characters",
+		Fn: func(args ...Object) Object {
+			str, width, fill, err := padArgs("pad_right", args)
+			if err != nil {
+				return err
+			}
+			return &String{Value: str + padding(fill, width-int64(utf8.RuneCountInString(str)))}
+		},
+	},
+	{
+		Name: "center",
+		Doc:  "center(str, width, fill) — returns str padded on both sides with fill (a space by default) to width characters; an odd extra character goes on the right",
+		Fn: func(args ...Object) Object {
+			str, width, fill, err := padArgs("center", args)
+			if err != nil {
+				return err
+			}
+			total := width - int64(utf8.RuneCountInString(str))
+			if total <= 0 {
+				return &String{Value: str}
+			}
+			return &String{Value: padding(fill, total/2) + str + padding(fill, total-total/2)}
+		},
+	},
+	{
+		Name: "to_s",
+		Doc:  "to_s(n, base, upper) — returns the Integer n written in base (2 to 36, 10 by default); digits above 9 are uppercase if upper is true",
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `to_s` must be INTEGER, got %s", args[0].Type())
+			}
+			base := int64(10)
+			if len(args) >= 2 {
+				b, ok := args[1].(*Integer)
+				if !ok {
+					return newError("base passed to `to_s` must be INTEGER, got %s", args[1].Type())
+				}
+				if b.Value < 2 || b.Value > 36 {
+					return newError("to_s: base must be between 2 and 36, got %d", b.Value)
+				}
+				base = b.Value
+			}
+			upper := false
+			if len(args) == 3 {
+				u, ok := args[2].(*Boolean)
+				if !ok {
+					return newError("upper passed to `to_s` must be BOOLEAN, got %s", args[2].Type())
+				}
+				upper = u.Value
+			}
+
+			str := strconv.FormatInt(n.Value, int(base))
+			if upper {
+				str = strings.ToUpper(str)
+			}
+			return &String{Value: str}
+		},
+	},
+	{
+		Name: "to_char",
+		Doc:  "to_char(n) — returns the one-character String for the Unicode code point n",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `to_char` must be INTEGER, got %s", args[0].Type())
+			}
+			// サロゲートや範囲外の値は文字にできない
+			if n.Value < 0 || n.Value > utf8.MaxRune || !utf8.ValidRune(rune(n.Value)) {
+				return newError("to_char: invalid code point %d", n.Value)
+			}
+			return &String{Value: string(rune(n.Value))}
+		},
+	},
+	{
+		Name: "to_int",
+		Doc:  "to_int(str, base) — returns the code point of the first character of str, or str parsed as an Integer in base (2 to 36) if base is given",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			str, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `to_int` must be STRING, got %s", args[0].Type())
+			}
+
+			if len(args) == 1 {
+				if str.Value == "" {
+					return newError("to_int: empty string has no characters")
+				}
+				r, _ := utf8.DecodeRuneInString(str.Value)
+				return &Integer{Value: int64(r)}
+			}
+
+			base, ok := args[1].(*Integer)
+			if !ok {
+				return newError("base passed to `to_int` must be INTEGER, got %s", args[1].Type())
+			}
+			if base.Value < 2 || base.Value > 36 {
+				return newError("to_int: base must be between 2 and 36, got %d", base.Value)
+			}
+			n, err := strconv.ParseInt(str.Value, int(base.Value), 64)
+			if err != nil {
+				return newError("to_int: could not parse %q as base %d integer", str.Value, base.Value)
+			}
+			return &Integer{Value: n}
+		},
+	},
+	{
+		Name: "scan",
+		Doc:  "scan(input, format) — reads input following format, the inverse of sprintf, and returns an Array of the values for %d, %s, %t and %f",
+		Fn: func(args ...Object) Object {
+			strs, err := stringArgs("scan", args, 2)
+			if err != nil {
+				return err
+			}
+			values, err := Scan("scan", strs[0], strs[1])
+			if err != nil {
+				return err
+			}
+			return &Array{Elements: values}
+		},
+	},
+	{
+		Name: "random_seed",
+		Doc:  "random_seed(n) — seeds the random number generator with the Integer n so that later random_* calls repeat the same sequence",
+		Fn: func(args ...Object) Object {
+			return defaultRandom.Seed(args)
+		},
+	},
+	{
+		Name: "random_int",
+		Doc:  "random_int(min, max) — returns a uniformly distributed random Integer between min and max inclusive",
+		Fn: func(args ...Object) Object {
+			return defaultRandom.Int(args)
+		},
+	},
+	{
+		Name: "random_float",
+		Doc:  "random_float() — returns a random Float in [0.0, 1.0)",
+		Fn: func(args ...Object) Object {
+			return defaultRandom.Float(args)
+		},
+	},
+	{
+		Name: "random_choice",
+		Doc:  "random_choice(arr) — returns a random element of arr, or null if arr is empty",
+		Fn: func(args ...Object) Object {
+			return defaultRandom.Choice(args)
+		},
+	},
+	{
+		Name: "uuid",
+		Doc:  "uuid() — returns a new random UUID v4 as a lowercase hyphenated String",
+		Fn: func(args ...Object) Object {
+			return NewUUID(args)
+		},
+	},
+	{
+		Name: "uuid_parse",
+		Doc:  "uuid_parse(str) — checks that str is a UUID, in any case and with or without hyphens, and returns it lowercase and hyphenated",
+		Fn: func(args ...Object) Object {
+			return ParseUUID(args)
+		},
+	},
+	{
+		Name: "base64_encode",
+		Doc:  "base64_encode(str, no_padding) — returns str encoded in standard Base64; the trailing = padding is left out if no_padding is true",
+		Fn: func(args ...Object) Object {
+			return Base64Encode("base64_encode", base64.StdEncoding, args)
+		},
+	},
+	{
+		Name: "base64_decode",
+		Doc:  "base64_decode(str) — decodes the standard Base64 str, with or without padding, into a String",
+		Fn: func(args ...Object) Object {
+			return Base64Decode("base64_decode", base64.StdEncoding, args)
+		},
+	},
+	{
+		Name: "base64_url_encode",
+		Doc:  "base64_url_encode(str, no_padding) — returns str encoded in URL-safe Base64; the trailing = padding is left out if no_padding is true",
+		Fn: func(args ...Object) Object {
+			return Base64Encode("base64_url_encode", base64.URLEncoding, args)
+		},
+	},
+	{
+		Name: "base64_url_decode",
+		Doc:  "base64_url_decode(str) — decodes the URL-safe Base64 str, with or without padding, into a String",
+		Fn: func(args ...Object) Object {
+			return Base64Decode("base64_url_decode", base64.URLEncoding, args)
+		},
+	},
+	{
+		Name: "sha256",
+		Doc:  "sha256(str) — returns the SHA-256 digest of str as 64 lowercase hex digits",
+		Fn: func(args ...Object) Object {
+			return SHA256(args)
+		},
+	},
+	{
+		Name: "sha256_bytes",
+		Doc:  "sha256_bytes(str) — returns the SHA-256 digest of str as an Array of 32 Integers from 0 to 255",
+		Fn: func(args ...Object) Object {
+			return SHA256Bytes(args)
+		},
+	},
+	{
+		Name: "md5",
+		Doc:  "md5(str) — returns the MD5 digest of str as 32 lowercase hex digits; MD5 is not cryptographically secure and is only for compatibility",
+		Fn: func(args ...Object) Object {
+			return MD5(args)
+		},
+	},
+	{
+		Name: "url_encode",
+		Doc:  "url_encode(str) — percent-encodes str for use as a URL path segment; spaces become %20",
+		Fn: func(args ...Object) Object {
+			return URLEncode(args)
+		},
+	},
+	{
+		Name: "url_decode",
+		Doc:  "url_decode(str) — decodes the %XX sequences in str; + is left as is",
+		Fn: func(args ...Object) Object {
+			return URLDecode(args)
+		},
+	},
+	{
+		Name: "url_query_encode",
+		Doc:  "url_query_encode(str) — encodes str for use as a form query value; spaces become +",
+		Fn: func(args ...Object) Object {
+			return URLQueryEncode(args)
+		},
+	},
+	{
+		Name: "url_query_decode",
+		Doc:  "url_query_decode(str) — decodes a form query value, turning + into spaces",
+		Fn: func(args ...Object) Object {
+			return URLQueryDecode(args)
+		},
+	},
+}
+
+// uniqやcountの比べ方。ハッシュのキーにできる値は値で、それ以外は同一性で比べる
+func KeyEqual(a, b Object) bool {
+	ka, ok := HashKeyOf(a)
+	if !ok {
+		return a == b
+	}
+	kb, ok := HashKeyOf(b)
+	return ok && ka == kb
+}
+
+// elementsの配列をdepth段まで展開してdstに足す。depthが負なら最後まで展開する
+func flattenElements(dst, elements []Object, depth int64) []Object {
+	for _, el := range elements {
+		if inner, ok := el.(*Array); ok && depth != 0 {
+			dst = flattenElements(dst, inner.Elements, depth-1)
+			continue
+		}
+		dst = append(dst, el)
+	}
+	return dst
+}
+
+func stringArg(name string, args []Object) (string, *Error) {
+	if len(args) != 1 {
+		return "", newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	return str.Value, nil
+}
+
+// pad_left/pad_right/centerの引数を検査し、文字列と幅と詰める文字列を返す
+func padArgs(name string, args []Object) (string, int64, string, *Error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", 0, "", newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return "", 0, "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	width, ok := args[1].(*Integer)
+	if !ok {
+		return "", 0, "", newError("width passed to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+	fill := " "
+	if len(args) == 3 {
+		f, ok := args[2].(*String)
+		if !ok {
+			return "", 0, "", newError("fill passed to `%s` must be STRING, got %s", name, args[2].Type())
+		}
+		if f.Value == "" {
+			return "", 0, "", newError("%s: fill must not be empty", name)
+		}
+		fill = f.Value
+	}
+	return str.Value, width.Value, fill, nil
+}
+
+// fillを繰り返してn文字ちょうどにする。長すぎるfillは途中で切る
+func padding(fill string, n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	var out strings.Builder
+	for {
+		for _, r := range fill {
+			if n == 0 {
+				return out.String()
+			}
+			out.WriteRune(r)
+			n--
+		}
+	}
+}
+
+func cursorArg(name string, args []Object) (*Cursor, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	c, ok := args[0].(*Cursor)
+	if !ok {
+		return nil, newError("argument to `%s` must be CURSOR, got %s", name, args[0].Type())
+	}
+	return c, nil
+}
+
+// 配列1つか複数の引数の中から、Compareの結果の符号がsignになる側の値を選び続ける
+func extreme(name string, args []Object, sign int) Object {
+	elements := args
+	if len(args) == 1 {
+		arr, ok := args[0].(*Array)
+		if !ok {
+			return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+		}
+		elements = arr.Elements
+	}
+	if len(elements) == 0 {
+		return newError("%s: no elements", name)
+	}
+
+	result := elements[0]
+	for _, elem := range elements[1:] {
+		c, err := Compare(elem, result)
+		if err != nil {
+			return newError("%s: %s", name, err)
+		}
+		if c*sign > 0 {
+			result = elem
+		}
+	}
+	return result
+}
+
+// 引数がn個の文字列であることを確かめて、その値を返す
+func stringArgs(name string, args []Object, n int) ([]string, *Error) {
+	if len(args) != n {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	strs := make([]string, 0, n)
+	for _, arg := range args {
+		str, ok := arg.(*String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs = append(strs, str.Value)
+	}
+	return strs, nil
+}
+
+// regexp_*の引数を検査する。最初の引数をパターンとしてコンパイルし、残りn個の文字列を返す
+// 最初の引数がregexp()で作った正規表現なら、そのまま使う
+func regexpArgs(name string, args []Object, n int) (*regexp.Regexp, []string, *Error) {
+	if len(args) == n+1 {
+		if re, ok := args[0].(*Regex); ok {
+			strs, argErr := stringArgs(name, args[1:], n)
+			if argErr != nil {
+				return nil, nil, argErr
+			}
+			return re.Value, strs, nil
+		}
+	}
+
+	strs, argErr := stringArgs(name, args, n+1)
+	if argErr != nil {
+		return nil, nil, argErr
+	}
+
+	re, err := regexp.Compile(strs[0])
+	if err != nil {
+		return nil, nil, newError("%s: %s", name, err)
+	}
+	return re, strs[1:], nil
+}
+
+func twoSets(name string, args []Object) (*Set, *Set, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	s1, ok := args[0].(*Set)
+	if !ok {
+		return nil, nil, newError("argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+	s2, ok := args[1].(*Set)
+	if !ok {
+		return nil, nil, newError("argument to `%s` must be SET, got %s", name, args[1].Type())
+	}
+	return s1, s2, nil
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, builtin := range Builtins {
+		if builtin.Name == name {
+			return builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,95 @@
+package object
+
+import "sync"
+
+// chan()で作るチャネル。Goのチャネルで値を受け渡す
+// go()で起動した関数との間で値をやり取りするのに使う
+type Channel struct {
+	ch chan Object
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// capacityが0ならバッファなし
+func NewChannel(capacity int) *Channel {
+	return &Channel{ch: make(chan Object, capacity)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+// 受け手が受け取るかバッファに空きができるまで止まる。doneが閉じられたら送らずにエラーを返す
+// 閉じたチャネルには送れない
+func (c *Channel) Send(val Object, done <-chan struct{}) (err *Error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return newError("send on closed channel")
+	}
+
+	// 送信を待っている間に閉じられると、Goのチャネルはパニックする
+	defer func() {
+		if recover() != nil {
+			err = newError("send on closed channel")
+		}
+	}()
+	select {
+	case c.ch <- val:
+		return nil
+	case <-done:
+		return newError("execution timeout")
+	}
+}
+
+// 値が届くまで止まる。閉じられていて残りの値もなければNULLを返す
+// doneが閉じられたらエラーを返す
+func (c *Channel) Recv(done <-chan struct{}) Object {
+	select {
+	case val, ok := <-c.ch:
+		if !ok {
+			return NULL
+		}
+		return val
+	case <-done:
+		return newError("execution timeout")
+	}
+}
+
+func (c *Channel) Close() *Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return newError("close of closed channel")
+	}
+	c.closed = true
+	close(c.ch)
+	return nil
+}
+
+// chan_send・chan_recvの本体。評価器がタイムアウトを渡せるように、doneを受け取る
+func ChanSend(args []Object, done <-chan struct{}) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	c, ok := args[0].(*Channel)
+	if !ok {
+		return newError("argument to `chan_send` must be CHANNEL, got %s", args[0].Type())
+	}
+	if err := c.Send(args[1], done); err != nil {
+		return err
+	}
+	return NULL
+}
+
+func ChanRecv(args []Object, done <-chan struct{}) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	c, ok := args[0].(*Channel)
+	if !ok {
+		return newError("argument to `chan_recv` must be CHANNEL, got %s", args[0].Type())
+	}
+	return c.Recv(done)
+}
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 大小を比べられる値。sort・min・maxで使う
+// Compareはotherより小さければ負、等しければ0、大きければ正の値を返す
+// 比べられない値が渡されたらエラーを返す
+type Comparable interface {
+	Object
+	Compare(other Object) (int, error)
+}
+
+// 同じ型の2つの値を比べる関数。組み込む側で定義したオブジェクトの比較に使う
+type CompareFunc func(a, b Object) (int, error)
+
+var (
+	comparatorsMu sync.RWMutex
+	comparators   = map[ObjectType]CompareFunc{}
+)
+
+// Comparableを実装していない型の比較関数を登録する
+func RegisterComparator(t ObjectType, fn CompareFunc) {
+	comparatorsMu.Lock()
+	defer comparatorsMu.Unlock()
+	comparators[t] = fn
+}
+
+// 2つの値を比べる。Comparableを実装していればそれを使い、そうでなければ登録された比較関数を使う
+func Compare(a, b Object) (int, error) {
+	if c, ok := a.(Comparable); ok {
+		return c.Compare(b)
+	}
+
+	comparatorsMu.RLock()
+	fn, ok := comparators[a.Type()]
+	comparatorsMu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("%s is not comparable", a.Type())
+	}
+	if a.Type() != b.Type() {
+		return 0, mismatchError(a, b)
+	}
+	return fn(a, b)
+}
+
+// 要素を昇順に並べた新しいスライスを返す。同じ大きさの要素の順序は保つ
+func SortObjects(elements []Object) ([]Object, error) {
+	sorted := make([]Object, len(elements))
+	copy(sorted, elements)
+
+	var err error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		var c int
+		c, err = Compare(sorted[i], sorted[j])
+		return c < 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sorted, nil
+}
+
+func mismatchError(a, b Object) error {
+	return fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+}
+
+// 整数・多倍長整数・浮動小数点数は、演算と同じように型をそろえてから比べる
+func compareNumbers(a, b Object) (int, error) {
+	switch {
+	case a.Type() == FLOAT_OBJ || b.Type() == FLOAT_OBJ:
+		x, okA := floatValue(a)
+		y, okB := floatValue(b)
+		if !okA || !okB {
+			return 0, mismatchError(a, b)
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		x, okA := bigValue(a)
+		y, okB := bigValue(b)
+		if !okA || !okB {
+			return 0, mismatchError(a, b)
+		}
+		return x.Cmp(y), nil
+	}
+}
+
+func floatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+func bigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+func (i *Integer) Compare(other Object) (int, error) {
+	if o, ok := other.(*Integer); ok {
+		switch {
+		case i.Value < o.Value:
+			return -1, nil
+		case i.Value > o.Value:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return compareNumbers(i, other)
+}
+
+func (f *Float) Compare(other Object) (int, error) { return compareNumbers(f, other) }
+
+func (b *BigInt) Compare(other Object) (int, error) { return compareNumbers(b, other) }
+
+func (s *String) Compare(other Object) (int, error) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, mismatchError(s, other)
+	}
+	return strings.Compare(s.Value, o.Value), nil
+}
+
+// falseはtrueより小さい
+func (b *Boolean) Compare(other Object) (int, error) {
+	o, ok := other.(*Boolean)
+	if !ok {
+		return 0, mismatchError(b, other)
+	}
+	switch {
+	case b.Value == o.Value:
+		return 0, nil
+	case !b.Value:
+		return -1, nil
+	}
+	return 1, nil
+}
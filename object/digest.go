@@ -0,0 +1,44 @@
+package object
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// sha256・md5の本体。どれも文字列のバイト列のダイジェストを計算する
+
+// SHA-256のダイジェストを小文字の16進数で返す
+func SHA256(args []Object) Object {
+	str, err := stringArg("sha256", args)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(str))
+	return &String{Value: hex.EncodeToString(sum[:])}
+}
+
+// SHA-256のダイジェストを0から255の整数の配列で返す
+func SHA256Bytes(args []Object) Object {
+	str, err := stringArg("sha256_bytes", args)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(str))
+	elements := make([]Object, len(sum))
+	for i, b := range sum {
+		elements[i] = &Integer{Value: int64(b)}
+	}
+	return &Array{Elements: elements}
+}
+
+// MD5のダイジェストを小文字の16進数で返す
+// MD5は暗号学的に安全ではない。既存の形式との互換のためだけに使うこと
+func MD5(args []Object) Object {
+	str, err := stringArg("md5", args)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum([]byte(str))
+	return &String{Value: hex.EncodeToString(sum[:])}
+}
@@ -0,0 +1,66 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// env_save・env_loadの本体。環境の束縛を、名前をキーにしたJSONのオブジェクトとしてファイルに保存する
+// 値の変換はjson_stringify・json_parseと同じで、JSONで表せない値(関数など)は保存しない
+
+// envから見えるすべての束縛をpathに書き、保存した束縛の数を返す
+// 保存できなかった束縛は、その理由をerrOutに書いて飛ばす
+func SaveEnvironment(env *Environment, path string, errOut io.Writer) Object {
+	bindings := env.Bindings()
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]any, len(names))
+	for _, name := range names {
+		v, err := toJSONValue(bindings[name], map[Object]bool{})
+		if err != nil {
+			fmt.Fprintf(errOut, "env_save: skipping %s: %s\n", name, strings.TrimPrefix(err.Message, "json_stringify: "))
+			continue
+		}
+		values[name] = v
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return newError("env_save: %s", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return newError("env_save: %s", err)
+	}
+	return &Integer{Value: int64(len(values))}
+}
+
+// SaveEnvironmentで書いたファイルを読み、束縛をenvに加えて、その数を返す
+// 同じ名前の束縛があれば上書きする
+func LoadEnvironment(env *Environment, path string) Object {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newError("env_load: %s", err)
+	}
+
+	loaded := jsonParse(string(data))
+	if errObj, ok := loaded.(*Error); ok {
+		return newError("env_load: %s", strings.TrimPrefix(errObj.Message, "json_parse: "))
+	}
+	hash, ok := loaded.(*Hash)
+	if !ok {
+		return newError("env_load: %s does not contain a JSON object", path)
+	}
+
+	for _, pair := range hash.Pairs() {
+		env.Set(pair.Key.(*String).Value, pair.Value)
+	}
+	return &Integer{Value: int64(hash.Len())}
+}
@@ -1,5 +1,10 @@
 package object
 
+import (
+	"fmt"
+	"sync"
+)
+
 // 環境の拡張 環境を入れ子にする
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
@@ -7,19 +12,45 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// 関数呼び出し1回分の環境。deferした呼び出しはここに積まれる
+func NewFunctionEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.function = true
+	return env
+}
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
 	return &Environment{store: s}
 }
 
 type Environment struct {
+	// go()で起動した関数と同じ環境を読み書きすることがあるので、storeはmuで守る
+	mu    sync.RWMutex
 	store map[string]Object
 	// 外側の環境への参照
 	outer *Environment
+
+	// 関数呼び出しの環境かどうか
+	function bool
+	// deferされた呼び出し。関数を抜けるときに後ろから実行する
+	deferred []DeferredCall
+	// パニック中に実行されるdefer呼び出しの環境なら、そのパニック
+	panicking *Panic
+	// ジェネレータの本体を実行している環境なら、そのジェネレータのyieldの窓口
+	yielder *Yielder
+}
+
+// defer文で登録された呼び出し。関数と引数はdefer文の時点で評価しておく
+type DeferredCall struct {
+	Fn   Object
+	Args []Object
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
 	// 環境が見つからない場合は外側の環境を探す
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
@@ -28,6 +59,281 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
 	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// 今の環境から束縛を取り除き、束縛があったかどうかを返す
+// 外側の環境の束縛は取り除かない
+func (e *Environment) Delete(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.store[name]; !ok {
+		return false
+	}
+	delete(e.store, name)
+	return true
+}
+
+// この環境から見えるすべての束縛。外側と同じ名前の束縛があれば内側の値になる
+func (e *Environment) Bindings() map[string]Object {
+	bindings := map[string]Object{}
+	if e.outer != nil {
+		bindings = e.outer.Bindings()
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for name, val := range e.store {
+		bindings[name] = val
+	}
+	return bindings
+}
+
+// 外側の環境までたどって、束縛をすべて写した環境を作る
+// 配列やハッシュなど中身を持つ値は中身ごと写し、束縛された関数は捕まえている環境ごと写す。同じ値はどこから見ても同じ写しになる
+// カーソルとメモ化した関数は今の状態ごと写す。実行中の状態を持つジェネレータとonce関数は写せないので、エラーを返す
+// rebindがnilでなければ、写した関数ごとに呼ぶ。deferした呼び出しやパニック、ジェネレータの状態は写さない
+func (e *Environment) Snapshot(rebind func(*Function)) (*Environment, error) {
+	s := newEnvSnapshot(rebind)
+	copied := s.env(e)
+	return copied, s.err
+}
+
+// 値をEnvironment.Snapshotと同じように写す。関数は捕まえている環境ごと写し、rebindは写した関数ごとに呼ぶ
+func Snapshot(vals []Object, rebind func(*Function)) ([]Object, error) {
+	s := newEnvSnapshot(rebind)
+	copied := s.values(vals)
+	return copied, s.err
+}
+
+// 写した環境と値を覚えておき、同じものは一度だけ写す
+type envSnapshot struct {
+	envs   map[*Environment]*Environment
+	copies map[Object]Object
+	rebind func(*Function)
+	// 写せない値を最初に見つけたときのエラー
+	err error
+}
+
+func newEnvSnapshot(rebind func(*Function)) *envSnapshot {
+	return &envSnapshot{
+		envs:   map[*Environment]*Environment{},
+		copies: map[Object]Object{},
+		rebind: rebind,
+	}
+}
+
+func (s *envSnapshot) env(e *Environment) *Environment {
+	if copied, ok := s.envs[e]; ok {
+		return copied
+	}
+	copied := &Environment{store: map[string]Object{}, function: e.function}
+	// 関数は自分を定義した環境に束縛されていることがあるので、中身より先に覚える
+	s.envs[e] = copied
+	if e.outer != nil {
+		copied.outer = s.env(e.outer)
+	}
+
+	e.mu.RLock()
+	store := make(map[string]Object, len(e.store))
+	for name, val := range e.store {
+		store[name] = val
+	}
+	e.mu.RUnlock()
+
+	for name, val := range store {
+		copied.store[name] = s.value(val)
+	}
+	return copied
+}
+
+func (s *envSnapshot) value(val Object) Object {
+	if copied, ok := s.copies[val]; ok {
+		return copied
+	}
+
+	// 自分自身を含む値があるので、写した値は中身を写す前に覚える
+	switch val := val.(type) {
+	case *Function:
+		if val.Env == nil {
+			return val
+		}
+		copied := *val
+		s.copies[val] = &copied
+		copied.Env = s.env(val.Env)
+		if s.rebind != nil {
+			s.rebind(&copied)
+		}
+		return &copied
+	case *Array:
+		copied := &Array{}
+		s.copies[val] = copied
+		copied.Elements = s.values(val.Elements)
+		return copied
+	case *Tuple:
+		copied := &Tuple{}
+		s.copies[val] = copied
+		copied.Elements = s.values(val.Elements)
+		return copied
+	case *Hash:
+		copied := &Hash{}
+		s.copies[val] = copied
+		copied.OrderedHash = s.pairs(&val.OrderedHash)
+		return copied
+	case *Record:
+		copied := &Record{}
+		s.copies[val] = copied
+		copied.fields = s.pairs(&val.fields)
+		return copied
+	case *Cursor:
+		copied := &Cursor{pos: val.pos}
+		s.copies[val] = copied
+		copied.elements = s.values(val.elements)
+		return copied
+	case *Memoized:
+		copied := &Memoized{}
+		s.copies[val] = copied
+		copied.Fn = s.value(val.Fn)
+		copied.Cache = &Hash{OrderedHash: s.pairs(&val.Cache.OrderedHash)}
+		return copied
+	case *PartiallyApplied:
+		copied := &PartiallyApplied{}
+		s.copies[val] = copied
+		copied.Fn = s.value(val.Fn)
+		copied.Args = s.values(val.Args)
+		return copied
+	case *Curried:
+		copied := &Curried{Arity: val.Arity}
+		s.copies[val] = copied
+		copied.Fn = s.value(val.Fn)
+		copied.Args = s.values(val.Args)
+		return copied
+	case *Composed:
+		copied := &Composed{}
+		s.copies[val] = copied
+		copied.Fns = s.values(val.Fns)
+		return copied
+	case *Module:
+		copied := *val
+		s.copies[val] = &copied
+		copied.Env = s.env(val.Env)
+		return &copied
+	case *Generator, *Once:
+		if s.err == nil {
+			s.err = fmt.Errorf("cannot share %s with another task", val.Type())
+		}
+	}
 	return val
 }
+
+func (s *envSnapshot) values(vals []Object) []Object {
+	if vals == nil {
+		return nil
+	}
+	copied := make([]Object, len(vals))
+	for i, val := range vals {
+		copied[i] = s.value(val)
+	}
+	return copied
+}
+
+// キーはハッシュのキーにできる変わらない値なので、値だけを写す
+func (s *envSnapshot) pairs(o *OrderedHash) OrderedHash {
+	var copied OrderedHash
+	for _, pair := range o.Pairs() {
+		key, _ := HashKeyOf(pair.Key)
+		copied.Set(key, HashPair{Key: pair.Key, Value: s.value(pair.Value)})
+	}
+	return copied
+}
+
+// 既存の束縛を書き換える。束縛が見つかった環境の値を更新する
+// どの環境にも束縛がなければfalseを返す
+func (e *Environment) Assign(name string, val Object) bool {
+	e.mu.Lock()
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		e.mu.Unlock()
+		return true
+	}
+	e.mu.Unlock()
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+// パニック中に実行されるdefer呼び出しの環境を作る
+func NewDeferredEnvironment(outer *Environment, panicking *Panic) *Environment {
+	env := NewFunctionEnvironment(outer)
+	env.panicking = panicking
+	return env
+}
+
+// ジェネレータの本体を実行する環境を作る
+func NewGeneratorEnvironment(outer *Environment, yielder *Yielder) *Environment {
+	env := NewFunctionEnvironment(outer)
+	env.yielder = yielder
+	return env
+}
+
+// 最も近い関数呼び出しがジェネレータの本体なら、そのジェネレータのyieldの窓口を返す
+// そうでなければnilを返す
+func (e *Environment) Yielder() *Yielder {
+	if e.function {
+		return e.yielder
+	}
+	if e.outer != nil {
+		return e.outer.Yielder()
+	}
+	return nil
+}
+
+// 最も近い関数呼び出しの環境にdeferした呼び出しを登録する
+// 関数の外(トップレベル)ならfalseを返す
+func (e *Environment) Defer(call DeferredCall) bool {
+	if e.function {
+		e.deferred = append(e.deferred, call)
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Defer(call)
+	}
+	return false
+}
+
+// 最も近い関数呼び出しにdeferされた呼び出しがあればtrueを返す
+func (e *Environment) HasDeferred() bool {
+	if e.function {
+		return len(e.deferred) > 0
+	}
+	if e.outer != nil {
+		return e.outer.HasDeferred()
+	}
+	return false
+}
+
+// 登録されたdefer呼び出しを取り出す。取り出した呼び出しは環境から消える
+func (e *Environment) TakeDeferred() []DeferredCall {
+	deferred := e.deferred
+	e.deferred = nil
+	return deferred
+}
+
+// 最も近い関数呼び出しがパニック中のdefer呼び出しなら、パニックを止めてその値を返す
+// そうでなければnilを返す
+func (e *Environment) Recover() Object {
+	if !e.function {
+		if e.outer != nil {
+			return e.outer.Recover()
+		}
+		return nil
+	}
+	if e.panicking == nil || e.panicking.Recovered {
+		return nil
+	}
+	e.panicking.Recovered = true
+	return e.panicking.Value
+}
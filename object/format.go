@@ -0,0 +1,305 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sprintf/printfの書式を展開する。nameはエラーメッセージに使う組み込み関数の名前
+// 使える変換は %s %d %f %t %v %% で、%5d や %.2f のようにフラグ・幅・精度も書ける
+// %sと%vはどんな値も表示形式で埋め込む。%dと%fは整数、%tは真偽値だけを受け付ける
+func Format(name string, args []Object) (string, *Error) {
+	if len(args) == 0 {
+		return "", newError("wrong number of arguments. got=0, want at least 1")
+	}
+	format, ok := args[0].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	values := args[1:]
+
+	var out strings.Builder
+	used := 0
+	f := format.Value
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			out.WriteByte(f[i])
+			continue
+		}
+
+		// '%'から変換文字までを1つの指定として切り出す
+		start := i
+		i++
+		for i < len(f) && strings.IndexByte("-+ #0123456789.", f[i]) >= 0 {
+			i++
+		}
+		if i >= len(f) {
+			return "", newError("%s: incomplete format verb at end of %q", name, f)
+		}
+		spec := f[start : i+1]
+		verb := f[i]
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if used >= len(values) {
+			return "", newError("%s: missing argument for %s", name, spec)
+		}
+		arg := values[used]
+		used++
+
+		goValue, err := formatArgument(name, spec, verb, arg)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(fmt.Sprintf(spec, goValue))
+	}
+
+	if used < len(values) {
+		return "", newError("%s: too many arguments. got=%d, want=%d", name, len(values), used)
+	}
+	return out.String(), nil
+}
+
+// 変換に合わせて、引数をfmt.Sprintfに渡すGoの値にする
+func formatArgument(name, spec string, verb byte, arg Object) (any, *Error) {
+	switch verb {
+	case 's', 'v':
+		if str, ok := arg.(*String); ok {
+			return str.Value, nil
+		}
+		return arg.Inspect(), nil
+	case 'd':
+		switch arg := arg.(type) {
+		case *Integer:
+			return arg.Value, nil
+		case *BigInt:
+			return arg.Value, nil
+		}
+		return nil, newError("%s: %s expects INTEGER, got %s", name, spec, arg.Type())
+	case 'f':
+		switch arg := arg.(type) {
+		case *Integer:
+			return float64(arg.Value), nil
+		case *Float:
+			return arg.Value, nil
+		}
+		return nil, newError("%s: %s expects INTEGER or FLOAT, got %s", name, spec, arg.Type())
+	case 't':
+		if b, ok := arg.(*Boolean); ok {
+			return b.Value, nil
+		}
+		return nil, newError("%s: %s expects BOOLEAN, got %s", name, spec, arg.Type())
+	}
+	return nil, newError("%s: unknown format verb %s", name, spec)
+}
+
+// formatのテンプレートを展開する。{}は次の位置引数、{0}や{1}は番号で指定した位置引数、
+// {name}は最初の引数のハッシュのnameの値に置き換える。{{と}}はそれぞれ{と}になる
+// 足りない引数は空文字列にし、余った引数は無視する。閉じていない{だけはエラーにする
+func Template(name string, args []Object) (string, *Error) {
+	if len(args) == 0 {
+		return "", newError("wrong number of arguments. got=0, want at least 1")
+	}
+	template, ok := args[0].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	values := args[1:]
+
+	var out strings.Builder
+	next := 0
+	t := template.Value
+	for i := 0; i < len(t); i++ {
+		switch {
+		case t[i] == '{' && i+1 < len(t) && t[i+1] == '{':
+			out.WriteByte('{')
+			i++
+			continue
+		case t[i] == '}' && i+1 < len(t) && t[i+1] == '}':
+			out.WriteByte('}')
+			i++
+			continue
+		case t[i] != '{':
+			out.WriteByte(t[i])
+			continue
+		}
+
+		end := strings.IndexByte(t[i+1:], '}')
+		if end < 0 {
+			return "", newError("%s: unclosed { at offset %d in %q", name, i, t)
+		}
+		field := t[i+1 : i+1+end]
+		i += end + 1
+
+		var value Object
+		if field == "" {
+			if next < len(values) {
+				value = values[next]
+			}
+			next++
+		} else if index, ok := templateIndex(field); ok {
+			if index < len(values) {
+				value = values[index]
+			}
+		} else if len(values) > 0 {
+			value = templateField(values[0], field)
+		}
+		if value == nil {
+			continue
+		}
+		if str, ok := value.(*String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(value.Inspect())
+		}
+	}
+	return out.String(), nil
+}
+
+// {0}のように数字だけのフィールドなら、その番号を返す
+func templateIndex(field string) (int, bool) {
+	for i := 0; i < len(field); i++ {
+		if field[i] < '0' || field[i] > '9' {
+			return 0, false
+		}
+	}
+	index, err := strconv.Atoi(field)
+	if err != nil {
+		// intに収まらない番号は、どの引数も指さない
+		return math.MaxInt, true
+	}
+	return index, true
+}
+
+// 名前付きのフィールドをハッシュやレコードから探す。見つからなければnilを返す
+func templateField(obj Object, field string) Object {
+	key, _ := HashKeyOf(&String{Value: field})
+	var pair HashPair
+	var ok bool
+	switch obj := obj.(type) {
+	case *Hash:
+		pair, ok = obj.Get(key)
+	case *Record:
+		pair, ok = obj.Get(key)
+	}
+	if !ok {
+		return nil
+	}
+	return pair.Value
+}
+
+// scanの書式に沿って入力を読み、読んだ値を順に返す。sprintfの逆で、使える変換は %d %s %t %f %%
+// 書式の空白は入力の空白の並び(なくてもよい)に、それ以外の文字はその文字自身に一致する
+// 変換の前の空白は読み飛ばし、%sは次の空白までを読む。書式を読み終えた後の入力は無視する
+func Scan(name string, input, format string) ([]Object, *Error) {
+	values := []Object{}
+	in := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if isScanSpace(c) {
+			in = skipScanSpace(input, in)
+			continue
+		}
+		if c != '%' || (i+1 < len(format) && format[i+1] == '%') {
+			if c == '%' {
+				i++
+			}
+			if in >= len(input) || input[in] != c {
+				return nil, newError("%s: input does not match format at %q", name, format[i:])
+			}
+			in++
+			continue
+		}
+
+		if i+1 >= len(format) {
+			return nil, newError("%s: incomplete format verb at end of %q", name, format)
+		}
+		i++
+		spec := format[i-1 : i+1]
+
+		in = skipScanSpace(input, in)
+		if in >= len(input) {
+			return nil, newError("%s: expected %s but input exhausted", name, spec)
+		}
+
+		var value Object
+		var end int
+		switch format[i] {
+		case 'd':
+			end = scanNumber(input, in, false)
+			if n, err := strconv.ParseInt(input[in:end], 10, 64); err == nil {
+				value = &Integer{Value: n}
+			}
+		case 'f':
+			end = scanNumber(input, in, true)
+			if f, err := strconv.ParseFloat(input[in:end], 64); err == nil {
+				value = &Float{Value: f}
+			}
+		case 't':
+			end = in
+			for end < len(input) && (input[end] >= 'a' && input[end] <= 'z') {
+				end++
+			}
+			switch input[in:end] {
+			case "true":
+				value = &Boolean{Value: true}
+			case "false":
+				value = &Boolean{Value: false}
+			}
+		case 's':
+			end = scanWord(input, in)
+			value = &String{Value: input[in:end]}
+		default:
+			return nil, newError("%s: unknown format verb %s", name, spec)
+		}
+		if value == nil {
+			return nil, newError("%s: %s does not match %q", name, spec, input[in:scanWord(input, in)])
+		}
+		values = append(values, value)
+		in = end
+	}
+	return values, nil
+}
+
+func isScanSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func skipScanSpace(input string, i int) int {
+	for i < len(input) && isScanSpace(input[i]) {
+		i++
+	}
+	return i
+}
+
+// iから次の空白の手前までの位置を返す
+func scanWord(input string, i int) int {
+	for i < len(input) && !isScanSpace(input[i]) {
+		i++
+	}
+	return i
+}
+
+// iから数に使える文字が続く限り読んだ位置を返す。floatなら小数点と指数も読む
+func scanNumber(input string, i int, float bool) int {
+	if i < len(input) && (input[i] == '-' || input[i] == '+') {
+		i++
+	}
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c >= '0' && c <= '9':
+		case float && (c == '.' || c == 'e' || c == 'E'):
+		case float && (c == '-' || c == '+') && (input[i-1] == 'e' || input[i-1] == 'E'):
+		default:
+			return i
+		}
+		i++
+	}
+	return i
+}
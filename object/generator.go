@@ -0,0 +1,120 @@
+package object
+
+import (
+	"runtime"
+	"sync"
+)
+
+// fn*で定義した関数を呼び出すと返るジェネレータ
+// 本体はゴルーチンで実行し、yieldのたびにチャネルで値を受け渡して止まる
+// next()を呼ぶまで本体は実行されない
+// 途中で捨てられたジェネレータは、ガベージコレクションのときに本体のゴルーチンを終わらせる
+type Generator struct {
+	run func(y *Yielder) Object
+	// 本体のゴルーチンが使う側。ゴルーチンからGeneratorを参照しないよう分けておく
+	yielder *Yielder
+
+	// 複数のタスクから同時にnext()を呼んでも、本体を1つずつ進める
+	mu      sync.Mutex
+	started bool
+	done    bool
+}
+
+// ジェネレータの本体から値をyieldするための窓口
+type Yielder struct {
+	// next()からゴルーチンへ「続きを実行せよ」という合図を送る
+	resume chan struct{}
+	// ゴルーチンからnext()へyieldした値、または本体の終了を送る
+	yields chan generatorStep
+	// 閉じると、止まっている本体のゴルーチンが終わる
+	stop chan struct{}
+	// 本体のゴルーチンが終わると閉じる
+	exited chan struct{}
+}
+
+type generatorStep struct {
+	value Object
+	// 本体の実行が終わった。このときvalueは本体の評価結果
+	done bool
+}
+
+// runはジェネレータのゴルーチンの中で本体を評価し、その結果を返す関数
+func NewGenerator(run func(y *Yielder) Object) *Generator {
+	g := &Generator{
+		run: run,
+		yielder: &Yielder{
+			resume: make(chan struct{}),
+			yields: make(chan generatorStep),
+			stop:   make(chan struct{}),
+			exited: make(chan struct{}),
+		},
+	}
+	runtime.SetFinalizer(g, (*Generator).Close)
+	return g
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// 次にyieldされる値を返す。本体の実行が終わっていればfalseを返す
+// 本体がエラーやパニックで終わった場合は、一度だけそれを値として返す
+func (g *Generator) Next() (Object, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return nil, false
+	}
+	y := g.yielder
+	if !g.started {
+		g.started = true
+		run := g.run
+		go func() {
+			defer close(y.exited)
+			select {
+			case <-y.resume:
+			case <-y.stop:
+				return
+			}
+			result := run(y)
+			y.yields <- generatorStep{value: result, done: true}
+		}()
+	}
+
+	y.resume <- struct{}{}
+	step := <-y.yields
+	if !step.done {
+		return step.value, true
+	}
+
+	g.done = true
+	if step.value != nil {
+		if rt := step.value.Type(); rt == ERROR_OBJ || rt == PANIC_OBJ || rt == EXIT_SIGNAL_OBJ {
+			return step.value, true
+		}
+	}
+	return nil, false
+}
+
+// 本体のゴルーチンを終わらせ、以後のNextはfalseを返す。ゴルーチンが終わるまで待つ
+func (g *Generator) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.started && !g.done {
+		close(g.yielder.stop)
+		<-g.yielder.exited
+	}
+	g.done = true
+}
+
+// 本体からvalを渡して、次のNextが呼ばれるまで止まる。ジェネレータのゴルーチンの中から呼ぶ
+// 待っている間にジェネレータが閉じられたら、本体の評価を打ち切ってゴルーチンを終える
+func (y *Yielder) Yield(val Object) {
+	y.yields <- generatorStep{value: val}
+	select {
+	case <-y.resume:
+	case <-y.stop:
+		runtime.Goexit()
+	}
+}
@@ -0,0 +1,72 @@
+package object
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 入出力を行う組み込み関数の本体。評価器が出力先や入力元を差し替えられるように、
+// 書き込み先と読み込み元を引数で受け取る
+
+// readlineが標準入力から読むときに使うReader。呼び出しをまたいで読み残しを保持するため共有する
+var stdin = bufio.NewReader(os.Stdin)
+
+func Puts(out io.Writer, args []Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(out, arg.Inspect())
+	}
+	return nil
+}
+
+// 引数を空白で区切って書く。最後に改行は付けない
+func Print(out io.Writer, args []Object) Object {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.Inspect()
+	}
+	fmt.Fprint(out, strings.Join(strs, " "))
+	return nil
+}
+
+func Printf(out io.Writer, args []Object) Object {
+	str, err := Format("printf", args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, str)
+	return nil
+}
+
+// プロンプトを表示して1行読み、末尾の改行を除いて返す。入力が終わっていればnil(null)を返す
+// inがnilなら標準入力から読む
+func ReadLine(in *bufio.Reader, out io.Writer, args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 1 {
+		prompt, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `readline` must be STRING, got %s", args[0].Type())
+		}
+		fmt.Fprint(out, prompt.Value)
+	}
+
+	if in == nil {
+		in = stdin
+	}
+	// 最後の行に改行がなくても1行として返す
+	line, err := in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return newError("readline: %s", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &String{Value: line}
+}
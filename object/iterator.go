@@ -0,0 +1,124 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+)
+
+// for-in文で要素を1つずつ取り出すためのインターフェイス
+// 要素がなくなったらfalseを返す
+type Iterator interface {
+	Next() (Object, bool)
+}
+
+// objの要素を順に返すIteratorを返す。繰り返せない値ならfalseを返す
+// 文字列は1文字ずつ、ハッシュはキーを追加した順に返す。集合は順序が決まっていないので、
+// 表示の順に並べ替えて返す
+func Iterate(obj Object) (Iterator, bool) {
+	switch obj := obj.(type) {
+	case Iterator:
+		// ジェネレータやカーソルのように、自分で次の要素を返せる値はそのまま使う
+		return obj, true
+	case *Array:
+		return &sliceIterator{elements: obj.Elements}, true
+	case *Tuple:
+		return &sliceIterator{elements: obj.Elements}, true
+	case *String:
+		elements := []Object{}
+		for _, r := range obj.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+		return &sliceIterator{elements: elements}, true
+	case *Hash:
+		elements := []Object{}
+		for _, pair := range obj.Pairs() {
+			elements = append(elements, pair.Key)
+		}
+		return &sliceIterator{elements: elements}, true
+	case *Set:
+		elements := []Object{}
+		for _, e := range obj.Elements {
+			elements = append(elements, e)
+		}
+		return &sliceIterator{elements: sortByInspect(elements)}, true
+	}
+	return nil, false
+}
+
+// 配列などの要素を1つずつ取り出すカーソル。作ったときの要素を持つので、元の値を変えても影響しない
+type Cursor struct {
+	elements []Object
+	pos      int
+}
+
+// objの要素を順に返すカーソルを作る。繰り返せない値ならfalseを返す
+// 配列とタプルは要素、文字列は1文字ずつ、ハッシュは追加した順に(キー, 値)のタプルを返す
+func NewCursor(obj Object) (*Cursor, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return &Cursor{elements: obj.Elements}, true
+	case *Tuple:
+		return &Cursor{elements: obj.Elements}, true
+	case *String:
+		elements := []Object{}
+		for _, r := range obj.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+		return &Cursor{elements: elements}, true
+	case *Hash:
+		elements := []Object{}
+		for _, pair := range obj.Pairs() {
+			elements = append(elements, &Tuple{Elements: []Object{pair.Key, pair.Value}})
+		}
+		return &Cursor{elements: elements}, true
+	}
+	return nil, false
+}
+
+func (c *Cursor) Type() ObjectType { return CURSOR_OBJ }
+func (c *Cursor) Inspect() string {
+	return fmt.Sprintf("cursor(%d/%d)", c.pos, len(c.elements))
+}
+
+// 今の要素を返して1つ進める
+func (c *Cursor) Next() (Object, bool) {
+	obj, ok := c.Peek()
+	if ok {
+		c.pos++
+	}
+	return obj, ok
+}
+
+// 進めずに今の要素を返す
+func (c *Cursor) Peek() (Object, bool) {
+	if c.pos >= len(c.elements) {
+		return nil, false
+	}
+	return c.elements[c.pos], true
+}
+
+// 最初の要素に戻す
+func (c *Cursor) Reset() {
+	c.pos = 0
+}
+
+type sliceIterator struct {
+	elements []Object
+	pos      int
+}
+
+func (it *sliceIterator) Next() (Object, bool) {
+	if it.pos >= len(it.elements) {
+		return nil, false
+	}
+	obj := it.elements[it.pos]
+	it.pos++
+	return obj, true
+}
+
+func sortByInspect(elements []Object) []Object {
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].Inspect() < elements[j].Inspect()
+	})
+	return elements
+}
@@ -0,0 +1,153 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+)
+
+// JSON文字列をMonkeyの値にする
+// オブジェクトは文字列をキーにしたハッシュ、配列は配列、整数に収まる数値は整数、それ以外の数値は浮動小数点数になる
+func jsonParse(input string) Object {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	// 数値をfloat64にせず、整数として読めるか自分で確かめる
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return newError("json_parse: %s", err)
+	}
+	if decoder.More() {
+		return newError("json_parse: unexpected data after top-level value")
+	}
+	return fromJSONValue(value)
+}
+
+func fromJSONValue(value any) Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBool(value)
+	case string:
+		return &String{Value: value}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return &Integer{Value: i}
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return newError("json_parse: unsupported number %s", value)
+		}
+		return &Float{Value: f}
+	case []any:
+		elements := make([]Object, 0, len(value))
+		for _, v := range value {
+			obj := fromJSONValue(v)
+			if obj.Type() == ERROR_OBJ {
+				return obj
+			}
+			elements = append(elements, obj)
+		}
+		return &Array{Elements: elements}
+	case map[string]any:
+		// デコードしたmapには元の順序が残っていないので、キーの順に並べる
+		names := make([]string, 0, len(value))
+		for k := range value {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		hash := &Hash{}
+		for _, k := range names {
+			obj := fromJSONValue(value[k])
+			if obj.Type() == ERROR_OBJ {
+				return obj
+			}
+			key := &String{Value: k}
+			hash.Set(key.HashKey(), HashPair{Key: key, Value: obj})
+		}
+		return hash
+	}
+	return newError("json_parse: unsupported value %v", value)
+}
+
+// Monkeyの値をJSON文字列にする。ハッシュのキーは文字列でなければならない
+func jsonStringify(obj Object) Object {
+	value, err := toJSONValue(obj, map[Object]bool{})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return newError("json_stringify: %s", err)
+	}
+	return &String{Value: strings.TrimSuffix(buf.String(), "\n")}
+}
+
+// visitingは今たどっている途中の配列とハッシュ。もう一度出てきたら循環している
+func toJSONValue(obj Object, visiting map[Object]bool) (any, *Error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return nil, newError("json_stringify: unsupported number %s", obj.Inspect())
+		}
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		return toJSONArray(obj, obj.Elements, visiting)
+	case *Tuple:
+		return toJSONArray(obj, obj.Elements, visiting)
+	case *Hash:
+		if visiting[obj] {
+			return nil, newError("json_stringify: circular reference")
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		m := make(map[string]any, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return nil, newError("json_stringify: hash key must be STRING, got %s", pair.Key.Type())
+			}
+			v, err := toJSONValue(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		return m, nil
+	}
+	return nil, newError("json_stringify: %s has no JSON representation", obj.Type())
+}
+
+func toJSONArray(container Object, elements []Object, visiting map[Object]bool) (any, *Error) {
+	if visiting[container] {
+		return nil, newError("json_stringify: circular reference")
+	}
+	visiting[container] = true
+	defer delete(visiting, container)
+
+	values := make([]any, 0, len(elements))
+	for _, e := range elements {
+		v, err := toJSONValue(e, visiting)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,25 @@
+package object
+
+// importで読み込んだモジュール。トップレベルの環境のうち、exportした名前だけを外から参照できる
+type Module struct {
+	// importした側で束縛する名前ではなく、import文に書いた名前
+	Name string
+	// 読み込んだファイルのパス
+	Path string
+	Env  *Environment
+	// exportした名前。定義した順に並ぶ
+	Exports []string
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// exportした名前の値を返す。exportしていなければfalseを返す
+func (m *Module) Get(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
@@ -2,25 +2,59 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/code"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type ObjectType string
 
 const (
-	INTEGER_OBJ      = "INTEGER"
-	BOOLEAN_OBJ      = "BOOLEAN"
-	NULL_OBJ         = "NULL"
-	RETURN_VALUE_OBJ = "RETURN_VALUE"
-	ERROR_OBJ        = "ERROR"
-	FUNCTION_OBJ     = "FUNCTION"
-	STRING_OBJ       = "STRING"
-	BUILTIN_OBJ      = "BUILTIN"
-	ARRAY_OBJ        = "ARRAY"
-	HASH_OBJ         = "HASH"
+	INTEGER_OBJ         = "INTEGER"
+	FLOAT_OBJ           = "FLOAT"
+	BIGINT_OBJ          = "BIGINT"
+	BOOLEAN_OBJ         = "BOOLEAN"
+	NULL_OBJ            = "NULL"
+	RETURN_VALUE_OBJ    = "RETURN_VALUE"
+	ERROR_OBJ           = "ERROR"
+	PANIC_OBJ           = "PANIC"
+	QUOTE_OBJ           = "QUOTE"
+	MACRO_OBJ           = "MACRO"
+	SYMBOL_OBJ          = "SYMBOL"
+	SET_OBJ             = "SET"
+	TUPLE_OBJ           = "TUPLE"
+	GENERATOR_OBJ       = "GENERATOR"
+	CURSOR_OBJ          = "CURSOR"
+	PARTIAL_OBJ         = "PARTIAL"
+	CURRIED_OBJ         = "CURRIED"
+	COMPOSED_OBJ        = "COMPOSED"
+	MEMOIZED_OBJ        = "MEMOIZED"
+	ONCE_OBJ            = "ONCE"
+	THUNK_OBJ           = "THUNK"
+	MODULE_OBJ          = "MODULE"
+	CHANNEL_OBJ         = "CHANNEL"
+	RECORD_OBJ          = "RECORD"
+	REGEX_OBJ           = "REGEX"
+	BREAK_SIGNAL_OBJ    = "BREAK_SIGNAL"
+	CONTINUE_SIGNAL_OBJ = "CONTINUE_SIGNAL"
+	EXIT_SIGNAL_OBJ     = "EXIT_SIGNAL"
+	FUNCTION_OBJ        = "FUNCTION"
+	STRING_OBJ          = "STRING"
+	BUILTIN_OBJ         = "BUILTIN"
+	ARRAY_OBJ           = "ARRAY"
+	HASH_OBJ            = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
+	CLOSURE_OBJ           = "CLOSURE"
 )
 
 // この言語に出現するすべての値の表現
@@ -38,6 +72,36 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// 浮動小数点数型
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// 整数と区別できるように、小数部がなくても3.0のように書く
+// とても大きい数と小さい数だけ指数表記にする
+func (f *Float) Inspect() string {
+	format := byte('f')
+	if abs := math.Abs(f.Value); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'g'
+	}
+	s := strconv.FormatFloat(f.Value, format, -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// 多倍長整数型。int64に収まらない整数を表す
+// 演算のたびに新しいbig.Intを作り、Valueは書き換えない
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
 // 真偽値型
 type Boolean struct {
 	Value bool
@@ -52,6 +116,20 @@ type Null struct{}
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
 
+// 真偽値とnullは同一性で比較されるので、評価器・VM・組み込み関数で同じインスタンスを使う
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func nativeBool(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
 // 戻り値型
 type ReturnValue struct {
 	Value Object
@@ -60,6 +138,84 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// タプル。長さが固定で変更できない列。(1, "a", true) や return a, b で作られる
+// 関数が1つの値だけを返すときはタプルにしない
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range t.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("(")
+	out.WriteString(strings.Join(elements, ", "))
+	// 要素が1つのタプルは(x)と区別するために(x,)と書く
+	if len(t.Elements) == 1 {
+		out.WriteString(",")
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// 要素のHashKeyをつなげてハッシュ値を作る
+func (t *Tuple) hashKey() (HashKey, bool) {
+	h := fnv.New64a()
+	for _, e := range t.Elements {
+		key, ok := HashKeyOf(e)
+		if !ok {
+			return HashKey{}, false
+		}
+		h.Write([]byte(key.Type))
+		binary.Write(h, binary.LittleEndian, key.Value)
+	}
+	return HashKey{Type: t.Type(), Value: h.Sum64()}, true
+}
+
+// break文の評価結果。ReturnValueと同じくループまで伝播する
+// Labelが空なら最も内側のループ、そうでなければ同じラベルの付いたループが受け取る
+type BreakSignal struct {
+	Label string
+}
+
+func (bs *BreakSignal) Type() ObjectType { return BREAK_SIGNAL_OBJ }
+func (bs *BreakSignal) Inspect() string  { return strings.TrimSpace("break " + bs.Label) }
+
+// continue文の評価結果。受け取り方はBreakSignalと同じ
+type ContinueSignal struct {
+	Label string
+}
+
+func (cs *ContinueSignal) Type() ObjectType { return CONTINUE_SIGNAL_OBJ }
+func (cs *ContinueSignal) Inspect() string  { return strings.TrimSpace("continue " + cs.Label) }
+
+// exit()の評価結果。エラーと同じく評価を打ち切ってプログラムの外まで伝播する
+// プロセスを終了させるかどうかは、受け取った側(スクリプトの実行やREPL、埋め込み先)が決める
+// VMはerrorとして返すので、errorインターフェイスも満たす
+type ExitSignal struct {
+	Code int
+}
+
+func (es *ExitSignal) Type() ObjectType { return EXIT_SIGNAL_OBJ }
+func (es *ExitSignal) Inspect() string  { return fmt.Sprintf("exit(%d)", es.Code) }
+func (es *ExitSignal) Error() string    { return fmt.Sprintf("exit status %d", es.Code) }
+
+// panic()で発生したパニック。ReturnValueと同じく呼び出し元へ伝播し、
+// deferした関数の中でrecover()されるとRecoveredがtrueになって伝播が止まる
+type Panic struct {
+	Value     Object
+	Recovered bool
+}
+
+func (p *Panic) Type() ObjectType { return PANIC_OBJ }
+func (p *Panic) Inspect() string  { return "panic: " + p.Value.Inspect() }
+
 // エラーオブジェクト
 // エラーメッセージをラップしているだけ。プロダクションレベルであれば、行番号や列番号を返すかもしれない。
 type Error struct {
@@ -73,6 +229,10 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// fn* で定義した関数なら、呼び出すと本体を実行せずにジェネレータを返す
+	Generator bool
+	// 評価器が関数を作るときに設定する。__inspect__のように、評価器の外から関数を呼び出すときに使う
+	Call func(args ...Object) Object
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -85,6 +245,9 @@ func (f *Function) Inspect() string {
 	}
 
 	out.WriteString("fn")
+	if f.Generator {
+		out.WriteString("*")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -105,12 +268,86 @@ func (s *String) Inspect() string  { return s.Value }
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFunction
+	Name string
+	// REPLの:helpで表示する説明。「呼び出し形式 — 説明」の形で書く
+	Doc string
+	Fn  BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// partial()で先頭の引数を束縛した関数。呼び出すと、束縛した引数の後ろに渡した引数を続けてFnを呼び出す
+type PartiallyApplied struct {
+	Fn   Object
+	Args []Object
+}
+
+func (p *PartiallyApplied) Type() ObjectType { return PARTIAL_OBJ }
+func (p *PartiallyApplied) Inspect() string  { return "partial function" }
+
+// curry()でカリー化した関数。Arity個の引数がそろうまで、呼び出すたびに引数を足したCurriedを返す
+type Curried struct {
+	Fn    Object
+	Arity int
+	Args  []Object
+}
+
+func (c *Curried) Type() ObjectType { return CURRIED_OBJ }
+func (c *Curried) Inspect() string  { return "curried function" }
+
+// compose()やpipe()でつないだ関数。Fnsを先頭から順に呼び出し、前の関数の結果を次の関数に渡す
+type Composed struct {
+	Fns []Object
+}
+
+func (c *Composed) Type() ObjectType { return COMPOSED_OBJ }
+func (c *Composed) Inspect() string  { return "composed function" }
+
+// memoize()で結果を覚えるようにした関数。Cacheのキーは引数を並べたタプル
+type Memoized struct {
+	Fn    Object
+	Cache *Hash
+}
+
+func (m *Memoized) Type() ObjectType { return MEMOIZED_OBJ }
+func (m *Memoized) Inspect() string  { return "memoized function" }
+
+// 関数本体の末尾での関数呼び出し。評価器は呼び出し元に戻ってからFunctionを呼び出すので、Goのスタックが伸びない
+// 評価器の中だけで使い、言語の値としては現れない
+type Thunk struct {
+	Function *Function
+	Args     []Object
+}
+
+func (t *Thunk) Type() ObjectType { return THUNK_OBJ }
+func (t *Thunk) Inspect() string  { return "thunk" }
+
+// once()で一度しか呼び出せないようにした関数。2回目からは最初の呼び出しの結果を返す
+type Once struct {
+	Fn      Object
+	once    sync.Once
+	result  Object
+	running bool
+}
+
+func (o *Once) Type() ObjectType { return ONCE_OBJ }
+func (o *Once) Inspect() string  { return "once function" }
+
+// 最初の呼び出しだけcallを実行し、その結果を覚えておく
+// callの中から自分自身を呼び出すとsync.Onceが止まってしまうので、エラーにする
+func (o *Once) Do(call func() Object) Object {
+	if o.running {
+		return &Error{Message: "once function called itself before returning"}
+	}
+	o.once.Do(func() {
+		o.running = true
+		o.result = call()
+		o.running = false
+	})
+	return o.result
+}
+
 type Array struct {
 	Elements []Object
 }
@@ -162,17 +399,58 @@ type HashPair struct {
 	Value Object
 }
 
+// ペアは追加した順に並ぶので、表示や走査の順序は毎回同じになる
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	OrderedHash
+	// __inspect__を呼び出している間はtrue。__inspect__の中で自分自身を表示しても無限に再帰しない
+	// 複数のタスクから同時に表示しても競合しないよう、不可分に読み書きする
+	inspecting atomic.Bool
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
+// Inspectの結果を独自に決める値。GoのStringerにあたる
+type Stringer interface {
+	CustomInspect() (string, bool)
+}
+
+// __inspect__の値が引数のない関数なら、それを呼び出した結果で表示する
+// 呼び出せなかったり、エラーになったりしたらfalseを返し、ハッシュとして表示する
+func (h *Hash) CustomInspect() (string, bool) {
+	pair, ok := h.Get((&String{Value: "__inspect__"}).HashKey())
+	if !ok {
+		return "", false
+	}
+	fn, ok := pair.Value.(*Function)
+	if !ok || fn.Call == nil || len(fn.Parameters) != 0 {
+		return "", false
+	}
+
+	if !h.inspecting.CompareAndSwap(false, true) {
+		return "", false
+	}
+	result := fn.Call()
+	h.inspecting.Store(false)
+
+	switch result := result.(type) {
+	case *String:
+		return result.Value, true
+	case *Error, *Panic, *ExitSignal, nil:
+		return "", false
+	default:
+		return result.Inspect(), true
+	}
+}
+
 func (h *Hash) Inspect() string {
+	if custom, ok := h.CustomInspect(); ok {
+		return custom
+	}
+
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -186,3 +464,157 @@ func (h *Hash) Inspect() string {
 type Hashable interface {
 	HashKey() HashKey
 }
+
+// objをハッシュのキーにしたときのHashKeyを返す。キーにできない値ならfalseを返す
+// タプルは要素がすべてキーにできるときだけキーにできるので、Hashableの型アサーションではなくこれを使う
+func HashKeyOf(obj Object) (HashKey, bool) {
+	switch obj := obj.(type) {
+	case *Tuple:
+		return obj.hashKey()
+	case *Record:
+		return obj.hashKey()
+	case Hashable:
+		return obj.HashKey(), true
+	}
+	return HashKey{}, false
+}
+
+// 集合。要素はハッシュのキーと同じくHashableでなければならない
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+func NewSet() *Set {
+	return &Set{Elements: make(map[HashKey]Object)}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+
+// 要素の順序は決まっていないので、表示が毎回同じになるように並べ替える
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range s.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	sort.Strings(elements)
+
+	out.WriteString("set(")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// 要素を加える。ハッシュのキーにできない値ならfalseを返す
+func (s *Set) Add(obj Object) bool {
+	key, ok := HashKeyOf(obj)
+	if !ok {
+		return false
+	}
+	s.Elements[key] = obj
+	return true
+}
+
+func (s *Set) Copy() *Set {
+	set := NewSet()
+	for k, v := range s.Elements {
+		set.Elements[k] = v
+	}
+	return set
+}
+
+// コンパイル済みの関数。VMが実行する
+type CompiledFunction struct {
+	Instructions code.Instructions
+	// 引数を含むローカル変数の数。呼び出し時にスタック上にこの数だけスロットを確保する
+	NumLocals     int
+	NumParameters int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// クロージャ。コンパイル済みの関数と、生成時に捕捉した自由変数の組
+// VMは関数をすべてクロージャとして扱う
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// quote()で評価せずに包んだASTノード
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// マクロ。関数と同じく引数・本体・環境を持つが、引数は評価されずにQuoteとして渡される
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// シンボル。同じ名前のシンボルは常に同じインスタンスになる(InternSymbolで作ること)
+type Symbol struct {
+	Value string
+}
+
+func (s *Symbol) Type() ObjectType { return SYMBOL_OBJ }
+func (s *Symbol) Inspect() string  { return ":" + s.Value }
+
+func (s *Symbol) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+var (
+	symbols   = map[string]*Symbol{}
+	symbolsMu sync.Mutex
+)
+
+// 名前に対応するシンボルを返す。初めての名前なら作って登録する
+func InternSymbol(name string) *Symbol {
+	symbolsMu.Lock()
+	defer symbolsMu.Unlock()
+
+	if sym, ok := symbols[name]; ok {
+		return sym
+	}
+	sym := &Symbol{Value: name}
+	symbols[name] = sym
+	return sym
+}
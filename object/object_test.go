@@ -1,6 +1,60 @@
 package object
 
-import "testing"
+import (
+	"gomadoufu/monkey-interpreter-go/ast"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInternSymbol(t *testing.T) {
+	ok1 := InternSymbol("ok")
+	ok2 := InternSymbol("ok")
+	errSym := InternSymbol("error")
+
+	if ok1 != ok2 {
+		t.Errorf("symbols with same name are different objects")
+	}
+	if ok1 == errSym {
+		t.Errorf("symbols with different names are the same object")
+	}
+	if ok1.HashKey() != ok2.HashKey() {
+		t.Errorf("symbols with same name have different hash keys")
+	}
+	if ok1.HashKey() == errSym.HashKey() {
+		t.Errorf("symbols with different names have same hash keys")
+	}
+	if ok1.HashKey() == (&String{Value: "ok"}).HashKey() {
+		t.Errorf("symbol and string with same content have same hash keys")
+	}
+}
+
+func TestTupleHashKey(t *testing.T) {
+	pair1 := &Tuple{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	pair2 := &Tuple{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	swapped := &Tuple{Elements: []Object{&String{Value: "a"}, &Integer{Value: 1}}}
+	nested := &Tuple{Elements: []Object{pair1}}
+
+	key1, ok1 := HashKeyOf(pair1)
+	key2, ok2 := HashKeyOf(pair2)
+	swappedKey, ok3 := HashKeyOf(swapped)
+	if !ok1 || !ok2 || !ok3 {
+		t.Fatalf("tuples of hashable elements are not hashable")
+	}
+	if key1 != key2 {
+		t.Errorf("tuples with same elements have different hash keys")
+	}
+	if key1 == swappedKey {
+		t.Errorf("tuples with elements in different order have same hash keys")
+	}
+	if _, ok := HashKeyOf(nested); !ok {
+		t.Errorf("nested tuple of hashable elements is not hashable")
+	}
+	if _, ok := HashKeyOf(&Tuple{Elements: []Object{&Array{}}}); ok {
+		t.Errorf("tuple containing an array is hashable")
+	}
+}
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +71,263 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Object
+		expected int
+		err      string
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1, ""},
+		{&Integer{Value: 2}, &Float{Value: 1.5}, 1, ""},
+		{&Float{Value: 2}, &Integer{Value: 2}, 0, ""},
+		{&BigInt{Value: big.NewInt(7)}, &Integer{Value: 7}, 0, ""},
+		{&String{Value: "a"}, &String{Value: "b"}, -1, ""},
+		{FALSE, TRUE, -1, ""},
+		{TRUE, TRUE, 0, ""},
+		{&String{Value: "a"}, &Integer{Value: 1}, 0, "cannot compare STRING with INTEGER"},
+		{TRUE, &Integer{Value: 1}, 0, "cannot compare BOOLEAN with INTEGER"},
+		{NULL, NULL, 0, "NULL is not comparable"},
+	}
+
+	for _, tt := range tests {
+		got, err := Compare(tt.a, tt.b)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Compare(%s, %s) wrong error. want=%q, got=%v", tt.a.Inspect(), tt.b.Inspect(), tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Compare(%s, %s) failed: %s", tt.a.Inspect(), tt.b.Inspect(), err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a.Inspect(), tt.b.Inspect(), got, tt.expected)
+		}
+	}
+}
+
+func TestOrderedHash(t *testing.T) {
+	hash := &Hash{}
+	for _, name := range []string{"c", "a", "b"} {
+		key := &String{Value: name}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(len(name))}})
+	}
+	// 既にあるキーは値だけが変わり、位置はそのまま
+	a := &String{Value: "a"}
+	hash.Set(a.HashKey(), HashPair{Key: a, Value: &Integer{Value: 10}})
+
+	if hash.Len() != 3 {
+		t.Fatalf("wrong length. got=%d", hash.Len())
+	}
+	if hash.Inspect() != "{c: 1, a: 10, b: 1}" {
+		t.Errorf("wrong order. got=%s", hash.Inspect())
+	}
+	pair, ok := hash.Get(a.HashKey())
+	if !ok || pair.Value.Inspect() != "10" {
+		t.Errorf("wrong value for a. got=%v, %t", pair.Value, ok)
+	}
+	if _, ok := hash.Get((&String{Value: "z"}).HashKey()); ok {
+		t.Errorf("found a key that was never set")
+	}
+
+	copied := hash.Copy()
+	z := &String{Value: "z"}
+	copied.Set(z.HashKey(), HashPair{Key: z, Value: NULL})
+	if hash.Len() != 3 || copied.Inspect() != "{c: 1, a: 10, b: 1, z: null}" {
+		t.Errorf("copy shares pairs with the original. original=%s, copy=%s", hash.Inspect(), copied.Inspect())
+	}
+
+	var empty Hash
+	if empty.Len() != 0 || empty.Inspect() != "{}" {
+		t.Errorf("zero Hash is not empty. got=%s", empty.Inspect())
+	}
+}
+
+func TestHashCustomInspect(t *testing.T) {
+	inspect := &String{Value: "__inspect__"}
+	hash := &Hash{}
+	hash.Set(inspect.HashKey(), HashPair{Key: inspect, Value: &Function{
+		Body: &ast.BlockStatement{},
+		Call: func(args ...Object) Object { return &String{Value: "<" + hash.Inspect() + ">"} },
+	}})
+
+	// 複数のタスクから同時に表示しても競合しない。-raceで確かめる
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash.Inspect()
+		}()
+	}
+	wg.Wait()
+
+	custom, ok := hash.CustomInspect()
+	if !ok || !strings.HasPrefix(custom, "<{__inspect__: ") {
+		t.Errorf("wrong custom inspect. got=%q, %t", custom, ok)
+	}
+
+	// 空文字列を返す__inspect__も独自の表示として扱う
+	empty := &Hash{}
+	empty.Set(inspect.HashKey(), HashPair{Key: inspect, Value: &Function{
+		Body: &ast.BlockStatement{},
+		Call: func(args ...Object) Object { return &String{Value: ""} },
+	}})
+	if custom, ok := empty.CustomInspect(); !ok || custom != "" || empty.Inspect() != "" {
+		t.Errorf("empty __inspect__ fell back to the hash. got=%q, %t, %q", custom, ok, empty.Inspect())
+	}
+}
+
+func TestGeneratorClose(t *testing.T) {
+	finished := false
+	g := NewGenerator(func(y *Yielder) Object {
+		y.Yield(&Integer{Value: 1})
+		y.Yield(&Integer{Value: 2})
+		finished = true
+		return NULL
+	})
+
+	if val, ok := g.Next(); !ok || val.Inspect() != "1" {
+		t.Fatalf("wrong first value. got=%v, %t", val, ok)
+	}
+	// 閉じると本体は続きを実行せずに終わり、以後は値を返さない
+	g.Close()
+	if val, ok := g.Next(); ok {
+		t.Errorf("closed generator returned a value. got=%v", val)
+	}
+	if finished {
+		t.Errorf("generator body ran after Close")
+	}
+
+	// 始める前に閉じてもよい
+	unstarted := NewGenerator(func(y *Yielder) Object { return NULL })
+	unstarted.Close()
+	if _, ok := unstarted.Next(); ok {
+		t.Errorf("closed generator returned a value")
+	}
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 2})
+	inner.Set("y", &Integer{Value: 3})
+
+	if !inner.Delete("y") {
+		t.Errorf("Delete(y) returned false")
+	}
+	if _, ok := inner.Get("y"); ok {
+		t.Errorf("y is still bound after Delete")
+	}
+	if inner.Delete("y") {
+		t.Errorf("Delete(y) returned true twice")
+	}
+
+	// 内側の束縛を消すと、外側の束縛が見えるようになる
+	if !inner.Delete("x") {
+		t.Errorf("Delete(x) returned false")
+	}
+	if obj, ok := inner.Get("x"); !ok || obj.(*Integer).Value != 1 {
+		t.Errorf("outer x is not visible after Delete. got=%v", obj)
+	}
+	// 外側の束縛は消さない
+	if inner.Delete("x") {
+		t.Errorf("Delete removed a binding from the outer environment")
+	}
+}
+
+func TestEnvironmentSnapshot(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewFunctionEnvironment(outer)
+	inner.Set("y", &Integer{Value: 2})
+
+	copied, err := inner.Snapshot(nil)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	copied.Assign("x", &Integer{Value: 10})
+	copied.Set("y", &Integer{Value: 20})
+	inner.Set("z", &Integer{Value: 3})
+
+	if obj, _ := inner.Get("x"); obj.(*Integer).Value != 1 {
+		t.Errorf("assignment to the copy changed the outer environment. got=%v", obj)
+	}
+	if obj, _ := inner.Get("y"); obj.(*Integer).Value != 2 {
+		t.Errorf("set on the copy changed the original. got=%v", obj)
+	}
+	if obj, _ := copied.Get("x"); obj.(*Integer).Value != 10 {
+		t.Errorf("x in the copy is wrong. got=%v", obj)
+	}
+	if _, ok := copied.Get("z"); ok {
+		t.Errorf("binding made after Snapshot is visible in the copy")
+	}
+
+	// 写した環境に束縛された関数は、写した方の環境を捕まえる
+	fn := &Function{Env: outer}
+	outer.Set("f", fn)
+	rebound := 0
+	snapshot, err := inner.Snapshot(func(*Function) { rebound++ })
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	obj, _ := snapshot.Get("f")
+	copiedFn, ok := obj.(*Function)
+	if !ok || copiedFn == fn {
+		t.Fatalf("function was not copied. got=%v", obj)
+	}
+	if rebound != 1 {
+		t.Errorf("rebind called %d times, want 1", rebound)
+	}
+	copiedFn.Env.Assign("x", &Integer{Value: 30})
+	if obj, _ := snapshot.Get("x"); obj.(*Integer).Value != 30 {
+		t.Errorf("function env is not the copied environment. got=%v", obj)
+	}
+	if obj, _ := outer.Get("x"); obj.(*Integer).Value != 1 {
+		t.Errorf("function env still shares the original environment. got=%v", obj)
+	}
+}
+
+func TestSnapshotValues(t *testing.T) {
+	key := &String{Value: "k"}
+	hash := &Hash{}
+	hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 1}})
+	array := &Array{Elements: []Object{hash}}
+	cursor, _ := NewCursor(array)
+	cursor.Next()
+
+	copied, err := Snapshot([]Object{array, cursor, hash}, nil)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	copiedArray := copied[0].(*Array)
+	copiedCursor := copied[1].(*Cursor)
+	copiedHash := copied[2].(*Hash)
+
+	// 中身を持つ値は中身ごと写し、同じ値はどこからでも同じ写しになる
+	if copiedArray == array || copiedHash == hash || copiedArray.Elements[0] != copiedHash {
+		t.Errorf("containers were not copied once. array=%p, hash=%p", copiedArray, copiedHash)
+	}
+	copiedHash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 2}})
+	if hash.Inspect() != "{k: 1}" {
+		t.Errorf("changing the copy changed the original hash. got=%s", hash.Inspect())
+	}
+
+	// カーソルは今の位置ごと写し、写した方を進めても元は進まない
+	if copiedCursor == cursor || copiedCursor.Inspect() != "cursor(1/1)" {
+		t.Fatalf("cursor was not copied with its position. got=%s", copiedCursor.Inspect())
+	}
+	copiedCursor.Reset()
+	if cursor.Inspect() != "cursor(1/1)" {
+		t.Errorf("resetting the copy moved the original cursor. got=%s", cursor.Inspect())
+	}
+
+	for _, val := range []Object{NewGenerator(nil), &Once{}} {
+		if _, err := Snapshot([]Object{&Array{Elements: []Object{val}}}, nil); err == nil {
+			t.Errorf("Snapshot copied %s", val.Type())
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package object
+
+// キーを追加した順序を覚えているハッシュテーブル。Pythonのdictと同じく、追加した順に走査できる
+// キーの検索はmapで、走査はスライスで行う。ゼロ値はそのまま空のハッシュテーブルとして使える
+type OrderedHash struct {
+	pairs []HashPair
+	// キーからpairsの添字を引く
+	index map[HashKey]int
+}
+
+// キーに対応するペアを返す
+func (o *OrderedHash) Get(key HashKey) (HashPair, bool) {
+	i, ok := o.index[key]
+	if !ok {
+		return HashPair{}, false
+	}
+	return o.pairs[i], true
+}
+
+// ペアを追加する。すでにあるキーなら値だけを置き換え、順序は変えない
+func (o *OrderedHash) Set(key HashKey, pair HashPair) {
+	if i, ok := o.index[key]; ok {
+		o.pairs[i] = pair
+		return
+	}
+	if o.index == nil {
+		o.index = make(map[HashKey]int)
+	}
+	o.index[key] = len(o.pairs)
+	o.pairs = append(o.pairs, pair)
+}
+
+func (o *OrderedHash) Len() int { return len(o.pairs) }
+
+// ペアを追加した順に返す。返したスライスを書き換えてはいけない
+func (o *OrderedHash) Pairs() []HashPair { return o.pairs }
+
+// 同じペアを同じ順序で持つ新しいハッシュを返す。値そのものはコピーしない
+func (h *Hash) Copy() *Hash {
+	c := &Hash{}
+	c.pairs = make([]HashPair, len(h.pairs))
+	copy(c.pairs, h.pairs)
+	c.index = make(map[HashKey]int, len(h.index))
+	for k, i := range h.index {
+		c.index[k] = i
+	}
+	return c
+}
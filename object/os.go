@@ -0,0 +1,52 @@
+package object
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// コマンドライン引数と環境変数を読む組み込み関数の本体
+// 評価器がテストなどで引数を差し替えられるように、引数のリストを受け取る
+
+// argvをStringの配列にして返す。argvにはスクリプト名を含めない
+func OSArgs(argv []string, args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	elements := make([]Object, 0, len(argv))
+	for _, arg := range argv {
+		elements = append(elements, &String{Value: arg})
+	}
+	return &Array{Elements: elements}
+}
+
+// 引数があればその環境変数の値を、設定されていなければnil(null)を返す
+// 引数がなければすべての環境変数をハッシュにして返す
+func OSEnv(args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 1 {
+		name, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `os_env` must be STRING, got %s", args[0].Type())
+		}
+		value, ok := os.LookupEnv(name.Value)
+		if !ok {
+			return nil
+		}
+		return &String{Value: value}
+	}
+
+	// 環境変数は名前の順に並べる
+	environ := os.Environ()
+	sort.Strings(environ)
+	hash := &Hash{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		key := &String{Value: name}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: &String{Value: value}})
+	}
+	return hash
+}
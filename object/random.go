@@ -0,0 +1,107 @@
+package object
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 乱数を扱う組み込み関数の本体
+// 評価器ごとに種を固定できるように、乱数の生成器を引数で受け取る
+
+// random_*が使う乱数の生成器。go()で起動した関数と共有するのでロックで守る
+type Random struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func NewRandom(seed int64) *Random {
+	return &Random{r: rand.New(rand.NewSource(seed))}
+}
+
+// 評価器を通さずに呼ばれたときに使う生成器
+var defaultRandom = NewRandom(time.Now().UnixNano())
+
+// 引数の整数で種を設定し直す
+func (r *Random) Seed(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	seed, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `random_seed` must be INTEGER, got %s", args[0].Type())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.r.Seed(seed.Value)
+	return nil
+}
+
+// lo以上hi以下の整数を一様に返す
+func (r *Random) Int(args []Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	lo, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `random_int` must be INTEGER, got %s", args[0].Type())
+	}
+	hi, ok := args[1].(*Integer)
+	if !ok {
+		return newError("argument to `random_int` must be INTEGER, got %s", args[1].Type())
+	}
+	if lo.Value > hi.Value {
+		return newError("random_int: min must not be greater than max, got %d and %d", lo.Value, hi.Value)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 幅はuint64で数えるので、int64の全範囲でもあふれない
+	span := uint64(hi.Value) - uint64(lo.Value)
+	if span == ^uint64(0) {
+		return &Integer{Value: int64(r.r.Uint64())}
+	}
+	return &Integer{Value: lo.Value + int64(r.uint64n(span+1))}
+}
+
+// 0以上n未満の整数を偏りなく返す
+func (r *Random) uint64n(n uint64) uint64 {
+	if n&(n-1) == 0 {
+		return r.r.Uint64() & (n - 1)
+	}
+	// nの倍数に収まらない端の値は捨てて引き直す
+	limit := ^uint64(0) - ^uint64(0)%n
+	for {
+		v := r.r.Uint64()
+		if v < limit {
+			return v % n
+		}
+	}
+}
+
+// 0.0以上1.0未満の小数を返す
+func (r *Random) Float(args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Float{Value: r.r.Float64()}
+}
+
+// 配列から要素を1つ選んで返す。空ならnilを返す
+func (r *Random) Choice(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `random_choice` must be ARRAY, got %s", args[0].Type())
+	}
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return arr.Elements[r.uint64n(uint64(len(arr.Elements)))]
+}
@@ -0,0 +1,75 @@
+package object
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// record()で作る、作った後は変更できないハッシュ
+// 同じキーと値の組を持つレコードどうしは、作った場所が違っても等しい
+type Record struct {
+	// 書き換えるメソッドを外に出さないよう、埋め込まずに持つ
+	fields OrderedHash
+}
+
+// ハッシュのペアを写したレコードを作る。値そのものはコピーしない
+func NewRecord(pairs []HashPair) *Record {
+	r := &Record{}
+	for _, pair := range pairs {
+		key, _ := HashKeyOf(pair.Key)
+		r.fields.Set(key, pair)
+	}
+	return r
+}
+
+func (r *Record) Type() ObjectType { return RECORD_OBJ }
+func (r *Record) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range r.Pairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("record({")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("})")
+
+	return out.String()
+}
+
+func (r *Record) Get(key HashKey) (HashPair, bool) { return r.fields.Get(key) }
+func (r *Record) Len() int                         { return r.fields.Len() }
+
+// ペアを作った順に返す。返したスライスを書き換えてはいけない
+func (r *Record) Pairs() []HashPair { return r.fields.Pairs() }
+
+// keyの値だけを置き換えた新しいレコードを返す。元のレコードは変わらない
+func (r *Record) With(key HashKey, pair HashPair) *Record {
+	updated := NewRecord(r.Pairs())
+	updated.fields.Set(key, pair)
+	return updated
+}
+
+// キーと値の組ごとのハッシュ値を足し合わせる。足し算なので、ペアの順序によらず同じ値になる
+// 値がすべてキーにできるときだけキーにできる
+func (r *Record) hashKey() (HashKey, bool) {
+	var sum uint64
+	for _, pair := range r.Pairs() {
+		key, _ := HashKeyOf(pair.Key)
+		value, ok := HashKeyOf(pair.Value)
+		if !ok {
+			return HashKey{}, false
+		}
+		h := fnv.New64a()
+		h.Write([]byte(key.Type))
+		binary.Write(h, binary.LittleEndian, key.Value)
+		h.Write([]byte(value.Type))
+		binary.Write(h, binary.LittleEndian, value.Value)
+		sum += h.Sum64()
+	}
+	return HashKey{Type: r.Type(), Value: sum}, true
+}
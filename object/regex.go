@@ -0,0 +1,12 @@
+package object
+
+import "regexp"
+
+// regexp()で作る、コンパイル済みの正規表現
+// 文字列のパターンの代わりにsplitやregexp_*に渡せる
+type Regex struct {
+	Value *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+func (r *Regex) Inspect() string  { return "/" + r.Value.String() + "/" }
@@ -0,0 +1,52 @@
+package object
+
+import "time"
+
+// 時刻を扱う組み込み関数の本体
+// 評価器がテストで時計を差し替えられるように、現在時刻を引数で受け取る
+
+// インタプリタが起動した時刻。clockの基準になる
+var processStart = time.Now()
+
+// startからnowまでの経過時間をナノ秒で返す
+func Clock(start, now time.Time, args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &Integer{Value: now.Sub(start).Nanoseconds()}
+}
+
+// nowのUnix時間を秒で返す
+func UnixTime(now time.Time, args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &Integer{Value: now.Unix()}
+}
+
+// 引数のミリ秒だけ止まる。limitが正ならそれより長い指定はエラーにする
+// doneが閉じられたら、途中でも戻る
+func Sleep(args []Object, limit time.Duration, done <-chan struct{}) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ms, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+	}
+	if ms.Value < 0 {
+		return newError("sleep: duration must not be negative, got %d", ms.Value)
+	}
+	d := time.Duration(ms.Value) * time.Millisecond
+	if limit > 0 && d > limit {
+		return newError("sleep: at most %dms is allowed in the sandbox, got %d", limit.Milliseconds(), ms.Value)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package object
+
+import "net/url"
+
+// url_*の本体。net/urlのパーセントエンコーディングを包む
+
+// 文字列をパスの1区間としてエンコードする。空白は%20になる
+func URLEncode(args []Object) Object {
+	str, err := stringArg("url_encode", args)
+	if err != nil {
+		return err
+	}
+	return &String{Value: url.PathEscape(str)}
+}
+
+// %XXをデコードする。+はそのまま残す
+func URLDecode(args []Object) Object {
+	str, err := stringArg("url_decode", args)
+	if err != nil {
+		return err
+	}
+	decoded, unescapeErr := url.PathUnescape(str)
+	if unescapeErr != nil {
+		return newError("url_decode: %s", unescapeErr)
+	}
+	return &String{Value: decoded}
+}
+
+// 文字列をフォームのクエリの値としてエンコードする。空白は+になる
+func URLQueryEncode(args []Object) Object {
+	str, err := stringArg("url_query_encode", args)
+	if err != nil {
+		return err
+	}
+	return &String{Value: url.QueryEscape(str)}
+}
+
+// フォームのクエリの値をデコードする。+は空白になる
+func URLQueryDecode(args []Object) Object {
+	str, err := stringArg("url_query_decode", args)
+	if err != nil {
+		return err
+	}
+	decoded, unescapeErr := url.QueryUnescape(str)
+	if unescapeErr != nil {
+		return newError("url_query_decode: %s", unescapeErr)
+	}
+	return &String{Value: decoded}
+}
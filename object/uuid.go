@@ -0,0 +1,57 @@
+package object
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// OSの乱数源からUUID v4を作り、小文字のハイフン区切りで返す
+func NewUUID(args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return newError("uuid: %s", err)
+	}
+	// バージョン4とRFC 4122のバリアントのビットを立てる
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return &String{Value: formatUUID(b)}
+}
+
+// UUIDの文字列を検査し、小文字のハイフン区切りにそろえて返す
+// 大文字小文字は区別せず、ハイフンのない32桁の形も受け付ける
+func ParseUUID(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `uuid_parse` must be STRING, got %s", args[0].Type())
+	}
+
+	digits := str.Value
+	if len(digits) == 36 {
+		for _, i := range []int{8, 13, 18, 23} {
+			if digits[i] != '-' {
+				return newError("uuid_parse: invalid UUID %q", str.Value)
+			}
+		}
+		digits = strings.ReplaceAll(digits, "-", "")
+	}
+	var b [16]byte
+	if len(digits) != 32 {
+		return newError("uuid_parse: invalid UUID %q", str.Value)
+	}
+	if _, err := hex.Decode(b[:], []byte(digits)); err != nil {
+		return newError("uuid_parse: invalid UUID %q", str.Value)
+	}
+	return &String{Value: formatUUID(b)}
+}
+
+func formatUUID(b [16]byte) string {
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
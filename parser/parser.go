@@ -6,12 +6,16 @@ import (
 	"gomadoufu/monkey-interpreter-go/lexer"
 	"gomadoufu/monkey-interpreter-go/token"
 	"strconv"
+	"strings"
 )
 
 // 優先順位
 const (
 	_           int = iota
 	LOWEST          //最も低い優先順位
+	ASSIGN          // =
+	LOGICAL_OR      // || or or
+	LOGICAL_AND     // && or and
 	EQUALS          // ==
 	LESSGREATER     // > or <
 	SUM             // +
@@ -23,28 +27,48 @@ const (
 
 // 演算子優先順位テーブル
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.LOR:             LOGICAL_OR,
+	token.OR:              LOGICAL_OR,
+	token.LAND:            LOGICAL_AND,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.IN:              LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 type Parser struct {
 	// 字句解析機へのポインタ
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	errors      []string
+	parseErrors []ParseError
 
 	// 現在調べているトークン
 	curToken token.Token
 	// curTokenだけで判断がつかない時に見る、curTokenの次のトークン
 	peekToken token.Token
 
+	// 括弧の入れ子の深さ
+	depth int
+	// let x = v in ... のvを読んでいる間は、同じ深さのinをlet式の区切りとして残す
+	noIn      bool
+	noInDepth int
+
 	// curToken.Typeに関連づけられた構文解析関数を検索するためのマップ
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -58,7 +82,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRUCT, p.parseStructLiteral)
+	p.registerPrefix(token.LET, p.parseLetExpression)
+	p.registerPrefix(token.LETREC, p.parseLetExpression)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.NOT, p.parsePrefixExpression)
+	p.registerPrefix(token.UNLESS, p.parseUnlessExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
@@ -68,18 +99,35 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.COLON_IDENT, p.parseSymbolLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.LAND, p.parseInfixExpression)
+	p.registerInfix(token.LOR, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseDotExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 
 	//２つトークンを読み込む。curTokenとpeekTokenの両方がセットされる
 	p.nextToken()
@@ -110,25 +158,105 @@ func (p *Parser) ParseProgram() *ast.Program {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		p.depth++
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		p.depth--
+	}
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	// もし現在のトークンがLETなら、LetStatementを構文解析する
-	case token.LET:
+	case token.LET, token.LETREC:
 		return p.parseLetStatement()
 	// もし現在のトークンがRETURNなら、ReturnStatementを構文解析する
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.UNLET:
+		return p.parseUnletStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.DEFER:
+		return p.parseDeferStatement()
+	case token.WHILE, token.UNTIL:
+		return p.parseWhileStatement()
+	case token.DO:
+		return p.parseDoWhileStatement()
+	case token.REPEAT:
+		return p.parseRepeatStatement()
+	case token.TRY:
+		return p.parseTryCatchStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.COLON_IDENT) {
+			return p.parseLabeledStatement()
+		}
+		return p.parseExpressionStatement()
+	case token.FUNCTION:
+		return p.parseFunctionStatement()
+	// macro name(...) { } は let name = macro(...) { } の糖衣構文
+	case token.MACRO:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseMacroStatement()
+		}
+		return p.parseExpressionStatement()
 	// それ以外なら、式文を構文解析する
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+// let x = 5 in x * 2 なら、let式の式文にする
+func (p *Parser) parseLetStatement() ast.Statement {
+	stmt := p.parseLetBinding()
+	if stmt == nil || !p.peekTokenIs(token.IN) {
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
+	p.nextToken()
+	exp := &ast.ExpressionStatement{Token: stmt.Token, Expression: p.finishLetExpression(stmt)}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return exp
+}
+
+// 式の中に書いたletは、必ずinを続けるlet式になる
+func (p *Parser) parseLetExpression() ast.Expression {
+	binding := p.parseLetBinding()
+	if binding == nil || !p.expectPeek(token.IN) {
+		return nil
+	}
+	return p.finishLetExpression(binding)
+}
+
+// 現在のトークンがinのときに呼ぶ
+func (p *Parser) finishLetExpression(binding *ast.LetStatement) ast.Expression {
+	exp := &ast.LetExpression{Token: binding.Token, Binding: binding}
+	p.nextToken()
+	exp.Body = p.parseExpression(LOWEST)
+	return exp
+}
+
+// let x = 5 までをパースする。末尾のセミコロンは読まない
+func (p *Parser) parseLetBinding() *ast.LetStatement {
 	// LETトークンに基づいた、LetStatement ASTノードを構築
-	stmt := &ast.LetStatement{Token: p.curToken}
+	stmt := &ast.LetStatement{Token: p.curToken, Recursive: p.curTokenIs(token.LETREC)}
 
 	// 文法チェックをしつつ進める
 	// 識別子(変数名)を期待する
@@ -139,17 +267,33 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// 識別子ノードを構築
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	// let x, y = ... なら残りの識別子も読む
+	if p.peekTokenIs(token.COMMA) {
+		stmt.Names = []*ast.Identifier{stmt.Name}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		}
+	}
+
 	// 等号を期待する
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
 
+	noIn, noInDepth := p.noIn, p.noInDepth
+	p.noIn, p.noInDepth = true, p.depth
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	p.noIn, p.noInDepth = noIn, noInDepth
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	// 関数リテラルに束縛される名前を覚えさせておく
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Names == nil {
+		fl.Name = stmt.Name.Value
 	}
 
 	return stmt
@@ -179,25 +323,406 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Errorsと同じエラーを、見つけた位置と一緒に返す。エディタでエラーの場所を示すのに使う
+func (p *Parser) ParseErrors() []ParseError {
+	return p.parseErrors
+}
+
+// 構文エラー。Posはエラーの原因になったトークンの位置
+type ParseError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, msg)
+	p.parseErrors = append(p.parseErrors, ParseError{Pos: pos, Message: msg})
+}
+
 // expectPeek関数で期待した値が現れなかった時に呼ばれる
 // エラーメッセージをerrorsに追加することで、親オブジェクトにエラーを伝搬する
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
+}
+
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	// RETURNトークンに基づいた、ReturnStatement ASTノードを構築
+	stmt := &ast.ReturnStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	// return a, b は複数の値をタプルにまとめて返す
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &ast.TupleLiteral{Token: p.peekToken, Elements: []ast.Expression{stmt.ReturnValue}}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		stmt.ReturnValue = tuple
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseUnletStatement() ast.Statement {
+	stmt := &ast.UnletStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// asはキーワードではないので、import文の中でだけ識別子asとして読む
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// exportの後には、let文になる文(let・letrec・fn name・macro name)だけを書ける
+func (p *Parser) parseExportStatement() ast.Statement {
+	export := p.curToken
+	p.nextToken()
+
+	stmt, ok := p.parseStatement().(*ast.LetStatement)
+	if !ok {
+		p.addError(export.Pos, "export must be followed by a let statement")
+		return nil
+	}
+	if stmt != nil {
+		stmt.Exported = true
+	}
+	return stmt
+}
+
+// deferの後には関数呼び出しだけを書ける
+func (p *Parser) parseDeferStatement() ast.Statement {
+	stmt := &ast.DeferStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	call, ok := exp.(*ast.CallExpression)
+	if !ok {
+		if exp != nil {
+			p.addError(exp.Pos(), fmt.Sprintf("expression in defer must be function call, got %s", exp.String()))
+		}
+		return nil
+	}
+	stmt.Call = call
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	// until (cond) { ... } は while (!cond) { ... } の糖衣構文
+	if stmt.Token.Type == token.UNTIL {
+		stmt.Condition = &ast.PrefixExpression{Token: stmt.Token, Operator: "!", Right: stmt.Condition}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// do { ... } while (条件式) 末尾のセミコロンは省略できる
+func (p *Parser) parseDoWhileStatement() ast.Statement {
+	stmt := &ast.DoWhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.WHILE) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// repeat(回数) { ... }
+func (p *Parser) parseRepeatStatement() ast.Statement {
+	stmt := &ast.RepeatStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Count = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// try { ... } catch (err) { ... } finally { ... }
+// catchとfinallyの少なくとも一方が要る
+func (p *Parser) parseTryCatchStatement() ast.Statement {
+	stmt := &ast.TryCatchStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.ErrorBinding = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		stmt.Handler = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if stmt.Handler == nil && stmt.Finally == nil {
+		p.addError(p.peekToken.Pos, fmt.Sprintf("expected catch or finally after try block, got %s instead", p.peekToken.Type))
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// for (初期化文; 条件式; 後処理) { ... } どの部分も省略できる
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IN) {
+		return p.parseForInStatement(stmt.Token)
+	}
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseStatement()
+		// let文や式文は後ろのセミコロンまで読んでいることがある
+		if !p.curTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseStatement()
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// for (x in iterable) { ... } curTokenは変数名
+func (p *Parser) parseForInStatement(tok token.Token) ast.Statement {
+	stmt := &ast.ForInStatement{Token: tok}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.nextToken()
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	// RETURNトークンに基づいた、ReturnStatement ASTノードを構築
-	stmt := &ast.ReturnStatement{Token: p.curToken}
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	stmt.Label = p.parseOptionalLabel()
+	return stmt
+}
 
-	p.nextToken()
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	stmt.Label = p.parseOptionalLabel()
+	return stmt
+}
 
-	stmt.ReturnValue = p.parseExpression(LOWEST)
+// break/continueの後ろのラベルを読む。ラベルがなければnilを返す
+func (p *Parser) parseOptionalLabel() *ast.Identifier {
+	var label *ast.Identifier
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		label = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	return label
+}
+
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	stmt := &ast.LabeledStatement{Token: p.curToken}
+	stmt.Label = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectColon() {
+		return nil
+	}
 
+	stmt.Statement = p.parseStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
 	return stmt
 }
 
@@ -246,9 +771,10 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix()
 
 	//次のトークンの左結合力が現在の右結合力よりも高いかを判定する
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	// 左辺が読めなかったときは、中置演算子の構文解析関数にnilを渡さないようにそこでやめる
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
-		if infix == nil {
+		if infix == nil || p.peekTokenIs(token.IN) && p.noIn && p.depth == p.noInDepth {
 			return leftExp
 		}
 
@@ -271,11 +797,42 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// 整数リテラルのトークンに基づいた、IntegerLiteral ASTノードを構築
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	// リテラル値をint64に変換
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	// 字句解析器は0から始まる整数や、区切りの_の位置がおかしい整数をILLEGALにする
+	if p.curTokenIs(token.ILLEGAL) {
+		if strings.Contains(p.curToken.Literal, "_") {
+			kind := "integer"
+			if strings.Contains(p.curToken.Literal, ".") {
+				kind = "float"
+			}
+			msg := fmt.Sprintf("invalid %s literal %s: '_' must separate digits", kind, p.curToken.Literal)
+			p.addError(p.curToken.Pos, msg)
+		} else {
+			p.addError(p.curToken.Pos, leadingZeroMessage(p.curToken.Literal))
+		}
+		return nil
+	}
+
+	// 区切りの_を取り除いてから、リテラル値をint64に変換
+	digits := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	value, err := strconv.ParseInt(digits, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	digits := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	value, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.addError(p.curToken.Pos, msg)
 		return nil
 	}
 
@@ -283,11 +840,32 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// 整数に見えるILLEGALトークンは、0から始まる整数
+func (p *Parser) parseIllegal() ast.Expression {
+	if lit := p.curToken.Literal; lit != "" && '0' <= lit[0] && lit[0] <= '9' {
+		return p.parseIntegerLiteral()
+	}
+	p.noPrefixParseFnError(p.curToken.Type)
+	return nil
+}
+
+// 8進数として読める数字なら0oを使うように、そうでなければ0を取るように勧める
+func leadingZeroMessage(literal string) string {
+	digits := strings.TrimLeft(literal, "0")
+	if digits == "" {
+		return "integer literal may not have leading zero; use 0 for zero"
+	}
+	if strings.Trim(digits, "01234567") == "" {
+		return fmt.Sprintf("integer literal may not have leading zero; use 0o%s for octal", digits)
+	}
+	return fmt.Sprintf("integer literal may not have leading zero; use %s for decimal", digits)
+}
+
 // 見やすいエラーメッセージを出力するためのヘルパーメソッド
 // フォーマットしたエラーメッセージをerrorsフィールドに追加する
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
 }
 
 // 前置演算子用の構文解析関数。
@@ -298,6 +876,10 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
+	// notは!と同じ演算子にする。TokenはNOTのままにしておき、フォーマッタが元の書き方に戻せるようにする
+	if p.curToken.Type == token.NOT {
+		expression.Operator = "!"
+	}
 
 	// トークンを消費する
 	// ここで、p.curTokenは前置演算子のトークンになっている
@@ -306,6 +888,10 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	// こうすることで、"-5"のような式を正しくパースできる
 
 	expression.Right = p.parseExpression(PREFIX)
+	// 右辺が読めなければエラーは記録済み。右辺のないノードは作らない
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -340,6 +926,13 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		// parsePrefixExpressionと違い、中置演算子の左辺になる式を、left引数に渡す
 		Left: left,
 	}
+	// andとorは&&と||と同じ演算子にする。notと同じく、Tokenは元のまま残す
+	switch p.curToken.Type {
+	case token.AND:
+		expression.Operator = "&&"
+	case token.OR:
+		expression.Operator = "||"
+	}
 
 	// 現在のトークンである、中置演算子そのものの優先順位を保存しておく
 	precedence := p.curPrecedence()
@@ -347,6 +940,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	// parseInfixExpressionを再度呼び出し、ast.InfixExpressionのRightフィールドを埋める
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -359,10 +955,33 @@ func (p *Parser) parseBoolean() ast.Expression {
 // かっこ()で囲まれた(グループ化された）式をパースするための構文解析関数。
 // "トークンタイプに関数を関連づけるという考え方がここにきて本当に輝くんだ！"
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
+
+	// () は空のタプル
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return &ast.TupleLiteral{Token: lparen, Elements: []ast.Expression{}}
+	}
+
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
 
+	// カンマがあればグループ化ではなくタプル
+	if p.peekTokenIs(token.COMMA) {
+		tuple := &ast.TupleLiteral{Token: lparen, Elements: []ast.Expression{exp}}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			// (x,) のように最後のカンマの後ろは省略できる
+			if p.peekTokenIs(token.RPAREN) {
+				break
+			}
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		exp = tuple
+	}
+
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
@@ -406,6 +1025,40 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// unless (cond) { ... } は if (!cond) { ... } の糖衣構文。elseは書けない
+// TokenはUNLESSのままにしておき、フォーマッタが元の書き方に戻せるようにする
+func (p *Parser) parseUnlessExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Condition = &ast.PrefixExpression{
+		Token:    expression.Token,
+		Operator: "!",
+		Right:    p.parseExpression(LOWEST),
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.addError(p.peekToken.Pos, "unless cannot have an else branch, use if instead")
+		return nil
+	}
+
+	return expression
+}
+
 // { }で囲まれたブロックをパースするための構文解析関数。
 // parseIfExpressionとparseFunctionLiteralで使われる
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -422,6 +1075,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.End = p.curToken.Pos
 
 	return block
 }
@@ -432,6 +1086,47 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	// 関数リテラルのトークンに基づいた、FunctionLiteral ASTノードを構築
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	// fn* はジェネレータ関数
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		lit.Generator = true
+	}
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		lit.Name = p.curToken.Literal
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	exp := &ast.YieldExpression{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) {
+		return exp
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -447,6 +1142,49 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseMacroStatement() ast.Statement {
+	macroToken := p.curToken
+
+	p.nextToken()
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// 名前の後ろからはマクロリテラルと同じ形
+	p.curToken = macroToken
+	lit, ok := p.parseMacroLiteral().(*ast.MacroLiteral)
+	if !ok {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let", Pos: macroToken.Pos},
+		Name:  name,
+		Value: lit,
+	}
+}
+
+// fn name(...) { } は letrec name = fn(...) { } の糖衣構文
+// 名前のない関数リテラルはそのまま式文として読む
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := p.parseExpressionStatement()
+
+	lit, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok || lit.Name == "" {
+		return stmt
+	}
+
+	// 名前付き関数は自分自身を呼べるようにletrecとして束縛する
+	return &ast.LetStatement{
+		Token:     token.Token{Type: token.LETREC, Literal: "letrec", Pos: lit.Token.Pos},
+		Name:      &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: lit.Name, Pos: lit.Token.Pos}, Value: lit.Name},
+		Value:     lit,
+		Recursive: true,
+	}
+}
+
 // 関数の引数リストをパースするための構文解析関数。
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
@@ -483,6 +1221,28 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return exp
 }
 
+// メソッド呼び出し obj.method(args) と、プロパティの参照 obj.name をパースするための構文解析関数。
+// obj.name は obj["name"] の糖衣構文。Tokenを'.'にしておき、フォーマッタが元の書き方に戻せるようにする
+func (p *Parser) parseDotExpression(object ast.Expression) ast.Expression {
+	dot := p.curToken
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := p.curToken
+
+	if !p.peekTokenIs(token.LPAREN) {
+		key := &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: name.Literal, Pos: name.Pos}, Value: name.Literal}
+		return &ast.IndexExpression{Token: dot, Left: object, Index: key}
+	}
+
+	exp := &ast.MethodCallExpression{Token: dot, Object: object}
+	exp.Method = &ast.Identifier{Token: name, Value: name.Literal}
+	p.nextToken()
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	return exp
+}
+
 // 関数呼び出し時の引数リストをパースするための構文解析関数。
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
@@ -524,9 +1284,42 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
+	// a[:high]
+	// a[:name] はシンボルでの添字アクセスになるので、変数で終端を指定するなら a[0:name] か a[: name] と書く
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
 
+	// a[low:] a[low:high]
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.COLON_IDENT) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// curTokenが':'の位置から、スライスの残りを読む
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	if p.curTokenIs(token.COLON_IDENT) {
+		// a[low:high] の ':high' は1つのトークンになっているので、識別子として読み直す
+		p.curToken = symbolAsIdent(p.curToken)
+		exp.High = p.parseExpression(LOWEST)
+	} else if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -542,11 +1335,10 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		if !p.expectPeek(token.COLON) {
+		if !p.expectColon() {
 			return nil
 		}
 
-		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
@@ -561,3 +1353,170 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 	return hash
 }
+
+// struct { x: 1, y: 2 } は {"x": 1, "y": 2} の糖衣構文。キーには識別子しか書けない
+// TokenをSTRUCTにしておき、フォーマッタが元の書き方に戻せるようにする
+func (p *Parser) parseStructLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	fields := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name := p.curToken
+		if fields[name.Literal] {
+			p.addError(name.Pos, fmt.Sprintf("duplicate field %s in struct", name.Literal))
+			return nil
+		}
+		fields[name.Literal] = true
+
+		if !p.expectColon() {
+			return nil
+		}
+
+		key := &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: name.Literal, Pos: name.Pos}, Value: name.Literal}
+		hash.Pairs[key] = p.parseExpression(LOWEST)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+func (p *Parser) parseSymbolLiteral() ast.Expression {
+	return &ast.SymbolLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// :を読み、その次のトークンまで進める
+// COLON_IDENTトークンを、:の後ろの識別子(またはキーワード)のトークンにする
+func symbolAsIdent(tok token.Token) token.Token {
+	pos := tok.Pos
+	pos.Column++
+	return token.Token{Type: token.LookupIdent(tok.Literal), Literal: tok.Literal, Pos: pos}
+}
+
+// {"a":b} のように:の直後に識別子が続くとシンボルとして字句解析されるので、その場合は識別子として読み直す
+func (p *Parser) expectColon() bool {
+	if p.peekTokenIs(token.COLON_IDENT) {
+		p.nextToken()
+		p.curToken = symbolAsIdent(p.curToken)
+		return true
+	}
+
+	if !p.expectPeek(token.COLON) {
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return expression
+}
+
+// case パターン [if 条件式]: 本体 または default: 本体
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.CASE:
+		p.nextToken()
+		arm.Pattern = p.parseExpression(LOWEST)
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+	case token.DEFAULT:
+	default:
+		msg := fmt.Sprintf("expected case or default, got %s instead", p.curToken.Type)
+		p.addError(p.curToken.Pos, msg)
+		return nil
+	}
+
+	if !p.expectColon() {
+		return nil
+	}
+
+	arm.Body = p.parseExpression(LOWEST)
+
+	return arm
+}
+
+// 代入式をパースするための構文解析関数。
+// 右結合にするため、右辺はLOWESTでパースする(a = b = 1 は a = (b = 1))
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		msg := fmt.Sprintf("cannot assign to %s", left.String())
+		p.addError(left.Pos(), msg)
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: p.curToken, Name: name}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	if exp.Value == nil {
+		return nil
+	}
+
+	// x += y は x = x + y として扱う
+	if op, ok := compoundAssignOperators[exp.Token.Type]; ok {
+		exp.Value = &ast.InfixExpression{
+			Token:    token.Token{Type: op, Literal: string(op), Pos: exp.Token.Pos},
+			Operator: string(op),
+			Left:     name,
+			Right:    exp.Value,
+		}
+	}
+
+	return exp
+}
+
+// 複合代入の演算子と、対応する二項演算子
+var compoundAssignOperators = map[token.TokenType]token.TokenType{
+	token.PLUS_ASSIGN:     token.PLUS,
+	token.MINUS_ASSIGN:    token.MINUS,
+	token.ASTERISK_ASSIGN: token.ASTERISK,
+	token.SLASH_ASSIGN:    token.SLASH,
+	token.PERCENT_ASSIGN:  token.PERCENT,
+}
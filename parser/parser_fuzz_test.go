@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"strings"
+	"testing"
+)
+
+// 構文解析の種になる入力。途中で切れた文や深い入れ子など、エラーの経路を通るものを多めに入れる
+var fuzzSeeds = []string{
+	"",
+	"let five = 5; let add = fn(x, y) { x + y; }; add(five, 10);",
+	"letrec fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };",
+	"let a, b = (1, 2); return a, b;",
+	"fn* gen() { yield 1; yield; }",
+	"outer: for (let i = 0; i < 3; i += 1) { for (x in [1, 2]) { continue outer; } }",
+	"match x { case 0: 1; case n if n < 0: 2; default: 3 }",
+	"macro ifnot(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }",
+	`{"a": 1, :b: 2}[:b]; a[1:]; a[:2]; a[: n]; a[1:n]`,
+	"defer f(); defer 1;",
+	strings.Repeat("(", 300) + "1" + strings.Repeat(")", 300),
+	strings.Repeat("[", 300),
+	strings.Repeat("fn(", 100),
+	`let s = "unterminated`,
+	"let",
+	"let x",
+	"let x =",
+	"if (",
+	"for (;;",
+	"for (x in",
+	"match x {",
+	"a = b = ",
+	"1 = 2",
+	"while (true) { break",
+	"label:",
+	"x +=",
+	"A=#=",
+	"a = # = 1",
+}
+
+// ParseProgramはどんな入力でもパニックしない
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		// エラーがなければ、文字列にしてもパニックしない
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gomadoufu/monkey-interpreter-go/ast"
 	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/token"
 	"testing"
 )
 
@@ -41,6 +42,31 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestLetrecStatement(t *testing.T) {
+	input := "letrec f = fn(n) { f(n) };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.Recursive {
+		t.Errorf("stmt.Recursive is false")
+	}
+	if stmt.String() != "letrec f = fn<f>(n)f(n);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -77,6 +103,666 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestMultipleValueStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return a, b;", "return (a, b);"},
+		{"return 1, x + y, f(z)", "return (1, (x + y), f(z));"},
+		{"let x, y = swap(1, 2);", "let x, y = swap(1, 2);"},
+		{"fn swap(a, b) { return b, a; }", "letrec swap = fn<swap>(a, b)return (b, a);;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTupleLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedElements int
+		expected         string
+	}{
+		{"()", 0, "()"},
+		{"(1,)", 1, "(1,)"},
+		{"(1, a + b, true)", 3, "(1, (a + b), true)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		tuple, ok := stmt.Expression.(*ast.TupleLiteral)
+		if !ok {
+			t.Fatalf("exp not ast.TupleLiteral. got=%T", stmt.Expression)
+		}
+		if len(tuple.Elements) != tt.expectedElements {
+			t.Errorf("len(tuple.Elements) not %d. got=%d", tt.expectedElements, len(tuple.Elements))
+		}
+		if tuple.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, tuple.String())
+		}
+	}
+}
+
+func TestDeferStatements(t *testing.T) {
+	input := "defer add(1, 2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.DeferStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.DeferStatement. got=%T", program.Statements[0])
+	}
+	if stmt.TokenLiteral() != "defer" {
+		t.Fatalf("stmt.TokenLiteral not 'defer', got %q", stmt.TokenLiteral())
+	}
+	if !testIdentifier(t, stmt.Call.Function, "add") {
+		return
+	}
+	if len(stmt.Call.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(stmt.Call.Arguments))
+	}
+	if stmt.String() != "defer add(1, 2);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestDeferStatementRequiresCall(t *testing.T) {
+	l := lexer.New("defer x;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%v)", len(errors), errors)
+	}
+	if errors[0] != "expression in defer must be function call, got x" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestUntilStatement(t *testing.T) {
+	p := New(lexer.New(`until (x > y) { x }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	// 条件は!で反転したものになる
+	cond, ok := stmt.Condition.(*ast.PrefixExpression)
+	if !ok || cond.Operator != "!" {
+		t.Fatalf("stmt.Condition is not a ! prefix expression. got=%s", stmt.Condition)
+	}
+	testInfixExpression(t, cond.Right, "x", ">", "y")
+}
+
+func TestDoWhileStatement(t *testing.T) {
+	tests := []string{
+		`do { x } while (x < y)`,
+		`do { x } while (x < y);`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.DoWhileStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.DoWhileStatement. got=%T", program.Statements[0])
+		}
+		testInfixExpression(t, stmt.Condition, "x", "<", "y")
+		if len(stmt.Body.Statements) != 1 {
+			t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"do { x }", "expected next token to be WHILE, got EOF instead"},
+		{"do { x } while x", "expected next token to be (, got IDENT instead"},
+		{"do x while (y)", "expected next token to be {, got IDENT instead"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
+func TestRepeatStatement(t *testing.T) {
+	p := New(lexer.New(`repeat (n + 1) { x }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.RepeatStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.RepeatStatement. got=%T", program.Statements[0])
+	}
+	testInfixExpression(t, stmt.Count, "n", "+", 1)
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if stmt.String() != "repeat((n + 1)) x" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	// 本体の後ろのセミコロンは省略できる
+	p = New(lexer.New(`repeat (5) { x += 1 }; x`))
+	program = p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	if _, ok := program.Statements[0].(*ast.RepeatStatement); !ok {
+		t.Fatalf("stmt not *ast.RepeatStatement. got=%T", program.Statements[0])
+	}
+}
+
+func TestTryCatchStatement(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedBinding string
+		hasHandler      bool
+		hasFinally      bool
+	}{
+		{"try { x } catch (err) { y }", "err", true, false},
+		{"try { x } catch { y }", "", true, false},
+		{"try { x } finally { z }", "", false, true},
+		{"try { x } catch (e) { y } finally { z }", "e", true, true},
+		{"try { x } catch (e) { y };", "e", true, false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.TryCatchStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.TryCatchStatement. got=%T", program.Statements[0])
+		}
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+		}
+		if tt.expectedBinding == "" && stmt.ErrorBinding != nil {
+			t.Errorf("%q: ErrorBinding was not nil. got=%s", tt.input, stmt.ErrorBinding)
+		}
+		if tt.expectedBinding != "" && !testIdentifier(t, stmt.ErrorBinding, tt.expectedBinding) {
+			return
+		}
+		if (stmt.Handler != nil) != tt.hasHandler || (stmt.Finally != nil) != tt.hasFinally {
+			t.Errorf("%q: wrong blocks. handler=%v, finally=%v", tt.input, stmt.Handler, stmt.Finally)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { x }", "expected catch or finally after try block, got EOF instead"},
+		{"try { x }; 1", "expected catch or finally after try block, got ; instead"},
+		{"try { x } catch (1) { y }", "expected next token to be IDENT, got INT instead"},
+		{"try x catch { y }", "expected next token to be {, got IDENT instead"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "oops";`, `throw oops;`},
+		{`throw Error("oops")`, `throw Error(oops);`},
+		{`throw x + 1; y`, `throw (x + 1);y`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if _, ok := program.Statements[0].(*ast.ThrowStatement); !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("throw;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for throw without a value")
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	for _, input := range []string{`while (x < y) { x }`, `while (x < y) { x };`} {
+		testWhileStatement(t, input)
+	}
+}
+
+func testWhileStatement(t *testing.T, input string) {
+	t.Helper()
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+	body, ok := stmt.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", stmt.Body.Statements[0])
+	}
+	if !testIdentifier(t, body.Expression, "x") {
+		return
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { puts(i) }", "for (let i = 0; (i < 10); i = (i + 1)) puts(i)"},
+		{"for (i = 0; i < 10; i = i + 1) { i }", "for (i = 0; (i < 10); i = (i + 1)) i"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (; x;) { }", "for (; x; ) "},
+		{"for (;;) { break; };", "for (; ; ) break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestGeneratorParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn* counter(start) { yield start; }", "letrec counter = fn*<counter>(start)yield start;"},
+		{"let g = fn*() { yield; };", "let g = fn*<g>()yield;"},
+		{"for (x in counter(0)) { puts(x) }", "for (x in counter(0)) puts(x)"},
+		{"for (x in xs) { x };", "for (x in xs) x"},
+		{"fn(x) { x }(5)", "fn(x)x(5)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestBreakContinueStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedLabel string
+		isBreak       bool
+	}{
+		{"break;", "", true},
+		{"break outer;", "outer", true},
+		{"continue", "", false},
+		{"continue inner;", "inner", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		var label *ast.Identifier
+		switch stmt := program.Statements[0].(type) {
+		case *ast.BreakStatement:
+			if !tt.isBreak {
+				t.Fatalf("stmt is *ast.BreakStatement, want *ast.ContinueStatement")
+			}
+			label = stmt.Label
+		case *ast.ContinueStatement:
+			if tt.isBreak {
+				t.Fatalf("stmt is *ast.ContinueStatement, want *ast.BreakStatement")
+			}
+			label = stmt.Label
+		default:
+			t.Fatalf("stmt not break or continue statement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedLabel == "" {
+			if label != nil {
+				t.Errorf("label is not nil. got=%s", label)
+			}
+			continue
+		}
+		if !testIdentifier(t, label, tt.expectedLabel) {
+			return
+		}
+	}
+}
+
+func TestUnletStatement(t *testing.T) {
+	l := lexer.New("unlet x; unlet y")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	for i, name := range []string{"x", "y"} {
+		stmt, ok := program.Statements[i].(*ast.UnletStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.UnletStatement. got=%T", program.Statements[i])
+		}
+		if !testIdentifier(t, stmt.Name, name) {
+			return
+		}
+	}
+	if program.String() != "unlet x;unlet y;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	p = New(lexer.New("unlet 5;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "expected next token to be IDENT, got INT instead" {
+		t.Errorf("wrong errors for unlet without a name. got=%v", p.Errors())
+	}
+}
+
+func TestLabeledStatement(t *testing.T) {
+	input := `outer: while (true) { break outer; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LabeledStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LabeledStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Label, "outer") {
+		return
+	}
+	if _, ok := stmt.Statement.(*ast.WhileStatement); !ok {
+		t.Fatalf("stmt.Statement not *ast.WhileStatement. got=%T", stmt.Statement)
+	}
+	if stmt.String() != "outer: whiletrue break outer;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d", len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestNamedMacroStatement(t *testing.T) {
+	input := `macro expand(ast) { unquote(ast) }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "expand" {
+		t.Errorf("stmt.Name.Value not 'expand'. got=%s", stmt.Name.Value)
+	}
+
+	macro, ok := stmt.Value.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.MacroLiteral. got=%T", stmt.Value)
+	}
+	if len(macro.Parameters) != 1 {
+		t.Fatalf("macro literal parameters wrong. want 1, got=%d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "ast")
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match x { case 0: "zero"; case n if n < 0: "negative"; default: "positive" }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+	if len(exp.Arms) != 3 {
+		t.Fatalf("exp.Arms does not contain 3 arms. got=%d", len(exp.Arms))
+	}
+
+	if !testLiteralExpression(t, exp.Arms[0].Pattern, 0) {
+		return
+	}
+	if exp.Arms[0].Guard != nil {
+		t.Errorf("exp.Arms[0].Guard is not nil. got=%+v", exp.Arms[0].Guard)
+	}
+
+	if !testIdentifier(t, exp.Arms[1].Pattern, "n") {
+		return
+	}
+	if !testInfixExpression(t, exp.Arms[1].Guard, "n", "<", 0) {
+		return
+	}
+
+	if exp.Arms[2].Pattern != nil {
+		t.Errorf("default arm has pattern. got=%+v", exp.Arms[2].Pattern)
+	}
+	if exp.Arms[2].Body.String() != "positive" {
+		t.Errorf("default arm body wrong. got=%q", exp.Arms[2].Body.String())
+	}
+
+	expected := `match x { case 0: zero; case n if (n < 0): negative; default: positive }`
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. want=%q, got=%q", expected, exp.String())
+	}
+}
+
+func TestSymbolLiteralExpression(t *testing.T) {
+	input := `:ok;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	symbol, ok := stmt.Expression.(*ast.SymbolLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.SymbolLiteral. got=%T", stmt.Expression)
+	}
+	if symbol.Value != "ok" {
+		t.Errorf("symbol.Value not %q. got=%q", "ok", symbol.Value)
+	}
+	if symbol.String() != ":ok" {
+		t.Errorf("symbol.String() not %q. got=%q", ":ok", symbol.String())
+	}
+}
+
+func TestColonFollowedByIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a":b}`, `{a:b}`},
+		{`{:k:x + 1}`, `{:k:(x + 1)}`},
+		{`match x { case 1:y; default:z }`, `match x { case 1: y; default: z }`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -139,6 +825,104 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"0x10", 16},
+		{"0XfF", 255},
+		{"0o10", 8},
+		{"0b101", 5},
+		{"1_000_000", 1000000},
+		{"0xFF_00_FF", 16711935},
+		{"0o7_7", 63},
+		{"0b1010_1010", 170},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value for %q not %d. got=%d", tt.input, tt.expected, literal.Value)
+		}
+		// 元の書き方はそのまま残す
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"1_000.25", 1000.25},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value for %q not %g. got=%g", tt.input, tt.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
+func TestIntegerLiteralLeadingZero(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"010", "integer literal may not have leading zero; use 0o10 for octal"},
+		{"let x = 0755;", "integer literal may not have leading zero; use 0o755 for octal"},
+		{"09", "integer literal may not have leading zero; use 9 for decimal"},
+		{"00", "integer literal may not have leading zero; use 0 for zero"},
+		{"1__000", "invalid integer literal 1__000: '_' must separate digits"},
+		{"1000_", "invalid integer literal 1000_: '_' must separate digits"},
+		{"0x_FF", "invalid integer literal 0x_FF: '_' must separate digits"},
+		{"0b1_", "invalid integer literal 0b1_: '_' must separate digits"},
+		{"1_.5", "invalid float literal 1_.5: '_' must separate digits"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("wrong number of errors for %q. got=%d (%v)", tt.input, len(errors), errors)
+		}
+		if errors[0] != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. got=%q", tt.input, errors[0])
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -151,6 +935,9 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		// notは!と同じ演算子になる
+		{"not true;", "!", true},
+		{"not foobar;", "!", "foobar"},
 	}
 
 	for _, tt := range prefixTests {
@@ -199,6 +986,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
+		{"foobar in barfoo;", "foobar", "in", "barfoo"},
+		// and/orは&&/||と同じ演算子になる
+		{"true and false;", true, "&&", false},
+		{"true or false;", true, "||", false},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -242,12 +1035,56 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		expected string
 	}{
 		{
-			"-a * b",
-			"((-a) * b)",
+			"-a * b",
+			"((-a) * b)",
+		},
+		{
+			"!-a",
+			"(!(-a))",
+		},
+		{
+			"x in xs == true",
+			"((x in xs) == true)",
+		},
+		{
+			"a + b in c",
+			"((a + b) in c)",
+		},
+		{
+			"not x in xs and y in ys",
+			"(((!x) in xs) && (y in ys))",
+		},
+		{
+			"a or b and c",
+			"(a || (b && c))",
 		},
 		{
-			"!-a",
-			"(!(-a))",
+			"a && b || c and d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"x > 0 and x < 10",
+			"((x > 0) && (x < 10))",
+		},
+		{
+			"not a or b == c",
+			"((!a) || (b == c))",
+		},
+		{
+			"not not x",
+			"(!(!x))",
+		},
+		{
+			"not a == b",
+			"((!a) == b)",
+		},
+		{
+			"not f(x)",
+			"(!f(x))",
+		},
+		{
+			"if (not f(x)) { a }",
+			"if(!f(x)) a",
 		},
 		{
 			"a + b + c",
@@ -265,6 +1102,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
@@ -333,6 +1174,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + add(b * c) + d",
 			"((a + add((b * c))) + d)",
 		},
+		{
+			"-a.b(c) * d",
+			"((-a.b(c)) * d)",
+		},
+		{
+			"a.b(1).c()[0]",
+			"(a.b(1).c()[0])",
+		},
 		{
 			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
 			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
@@ -509,6 +1358,48 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestUnlessExpression(t *testing.T) {
+	input := `unless (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	// 条件は!で反転したものになる
+	cond, ok := exp.Condition.(*ast.PrefixExpression)
+	if !ok || cond.Operator != "!" {
+		t.Fatalf("exp.Condition is not a ! prefix expression. got=%s", exp.Condition)
+	}
+	if !testInfixExpression(t, cond.Right, "x", "<", "y") {
+		return
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"unless (x) { 1 } else { 2 }", "unless cannot have an else branch, use if instead"},
+		{"unless x { 1 }", "expected next token to be (, got IDENT instead"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -586,6 +1477,205 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestMethodCallExpressionParsing(t *testing.T) {
+	input := "arr.map(fn(x) { x * 2 }, 1)"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MethodCallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Object, "arr") {
+		return
+	}
+	if exp.Method.Value != "map" {
+		t.Errorf("exp.Method is not map. got=%s", exp.Method.Value)
+	}
+	if len(exp.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	if _, ok := exp.Arguments[0].(*ast.FunctionLiteral); !ok {
+		t.Errorf("first argument is not ast.FunctionLiteral. got=%T", exp.Arguments[0])
+	}
+	testIntegerLiteral(t, exp.Arguments[1], 1)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr.1()", "expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
+func TestImportAndExportParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		name     string
+	}{
+		{`import "math"`, `import "math";`, "math"},
+		{`import "math" as m;`, `import "math" as m;`, "m"},
+		{`import "lib/strings.monkey"`, `import "lib/strings.monkey";`, "strings"},
+		{`export let PI = 3;`, `export let PI = 3;`, ""},
+		{`export fn double(x) { x * 2 }`, `export letrec double = fn<double>(x)(x * 2);`, ""},
+		{`let as = 1; as`, `let as = 1;as`, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+		if imp, ok := program.Statements[0].(*ast.ImportStatement); ok && imp.Name() != tt.name {
+			t.Errorf("wrong module name for %q. expected=%q, got=%q", tt.input, tt.name, imp.Name())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`import math`, "expected next token to be STRING, got IDENT instead"},
+		{`import "math" as 1`, "expected next token to be IDENT, got INT instead"},
+		{`export 1 + 2`, "export must be followed by a let statement"},
+		{`export let x = 1 in x`, "export must be followed by a let statement"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
+func TestLetExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5 in x * 2", "(let x = 5 in (x * 2))"},
+		{"let x = 5 in x * 2;", "(let x = 5 in (x * 2))"},
+		{"1 + let x = 5 in x", "(1 + (let x = 5 in x))"},
+		{"f(let x = 5 in x, 2)", "f((let x = 5 in x), 2)"},
+		{"let x = 1 in let y = 2 in x + y", "(let x = 1 in (let y = 2 in (x + y)))"},
+		{"let x = let y = 1 in y in x", "(let x = (let y = 1 in y) in x)"},
+		{"let a, b = (1, 2) in a", "(let a, b = (1, 2) in a)"},
+		// 束縛する値の中では、括弧で囲まないinはlet式の区切りになる
+		{"let x = a in b", "(let x = a in b)"},
+		{"let x = (a in b) in x", "(let x = (a in b) in x)"},
+		{"let x = f(a in b) in x", "(let x = f((a in b)) in x)"},
+		{"let x = [a in b] in x", "(let x = [(a in b)] in x)"},
+		{"let x = 5 in x in xs", "(let x = 5 in (x in xs))"},
+		{"let x = 5; x", "let x = 5;x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("let x = 5 in x")).ParseProgram()
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.LetExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.LetExpression. got=%T", stmt.Expression)
+	}
+	if !testLetStatement(t, exp.Binding, "x") {
+		return
+	}
+	testIntegerLiteral(t, exp.Binding.Value, 5)
+	testIdentifier(t, exp.Body, "x")
+
+	p := New(lexer.New("1 + let x = 5"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "expected next token to be IN, got EOF instead" {
+		t.Errorf("wrong errors. got=%v", p.Errors())
+	}
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	input := "struct { x: 1, y: a }.x"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if index.Token.Type != token.DOT {
+		t.Errorf("index.Token.Type is not DOT. got=%q", index.Token.Type)
+	}
+	if !testStringLiteral(t, index.Index, "x") {
+		return
+	}
+
+	hash, ok := index.Left.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("index.Left is not ast.HashLiteral. got=%T", index.Left)
+	}
+	if hash.Token.Type != token.STRUCT {
+		t.Errorf("hash.Token.Type is not STRUCT. got=%q", hash.Token.Type)
+	}
+	keys := hash.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("hash has wrong number of fields. got=%d", len(keys))
+	}
+	testStringLiteral(t, keys[0], "x")
+	testIntegerLiteral(t, hash.Pairs[keys[0]], 1)
+	testStringLiteral(t, keys[1], "y")
+	testIdentifier(t, hash.Pairs[keys[1]], "a")
+
+	empty := New(lexer.New("struct {}")).ParseProgram()
+	hash, ok = empty.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok || len(hash.Pairs) != 0 {
+		t.Errorf("struct {} is not an empty hash literal. got=%s", empty.String())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x: 1, x: 2 }", "duplicate field x in struct"},
+		{"struct { 1: 2 }", "expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. got=%v", tt.input, p.Errors())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -883,6 +1973,36 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`s[1:3]`, "(s[1:3])"},
+		{`s[2:]`, "(s[2:])"},
+		{`s[:3]`, "(s[:3])"},
+		{`s[:]`, "(s[:])"},
+		{`s[i:j + 1]`, "(s[i:(j + 1)])"},
+		{`s[-2:n]`, "(s[(-2):n])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		if sliceExp.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, sliceExp.String())
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -975,3 +2095,256 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedName  string
+		expectedValue string
+	}{
+		{"x = 5;", "x", "5"},
+		{"x = y + 1;", "x", "(y + 1)"},
+		{"x = y = 1;", "x", "y = 1"},
+		{"x += 2;", "x", "(x + 2)"},
+		{"x -= y * 2;", "x", "(x - (y * 2))"},
+		{"x *= 3;", "x", "(x * 3)"},
+		{"x /= 4;", "x", "(x / 4)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, exp.Name, tt.expectedName) {
+			return
+		}
+		if exp.Value.String() != tt.expectedValue {
+			t.Errorf("exp.Value wrong. want=%q, got=%q", tt.expectedValue, exp.Value.String())
+		}
+	}
+}
+
+func TestAssignExpressionInvalidTarget(t *testing.T) {
+	l := lexer.New("1 = 2;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+	if errors[0] != "cannot assign to 1" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestASTEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		// 位置や空白の違いは無視する
+		{"let x = 1 + 2;", "let   x =\n 1+2", true},
+		{"fn(a, b) { a * b }", "fn(a,b){a*b;}", true},
+		{`{"a": 1, "b": [2, 3]}`, `{"b": [2, 3], "a": 1}`, true},
+		{"match x { case 1 if y: 2; default: 3 }", "match x { case 1 if y: 2; default: 3 }", true},
+		{"for (i in xs) { break; }", "for (i in xs) { break }", true},
+		{"if (a) { b } else { c }", "if (a) { b } else { c }", true},
+		{"do { x } while (y);", "do {x;} while(y)", true},
+		// 構造が違う
+		{"let x = 1 + 2;", "let x = 1 - 2;", false},
+		{"let x = 1 + 2;", "let y = 1 + 2;", false},
+		{"let x = 1;", "letrec x = 1;", false},
+		{"fn(a, b) { a * b }", "fn(a) { a * b }", false},
+		{"fn(a, b) { a * b }", "fn*(a, b) { a * b }", false},
+		{"if (a) { b }", "if (a) { b } else { c }", false},
+		{"(1, 2)", "[1, 2]", false},
+		{`{"a": 1}`, `{"a": 2}`, false},
+		{"a[1:]", "a[:1]", false},
+		{"do { x } while (y)", "while (y) { x }", false},
+		{"repeat (3) { x }", "repeat (4) { x }", false},
+		{"try { x } catch (e) { y } finally { z }", "try {x} catch(e){y} finally{z}", true},
+		{"try { x } catch (e) { y }", "try { x } catch (err) { y }", false},
+		{"try { x } catch { y }", "try { x } finally { y }", false},
+		{"outer: while (x) { break outer; }", "outer: while (x) { break; }", false},
+	}
+
+	for _, tt := range tests {
+		a := parseForEqual(t, tt.a)
+		b := parseForEqual(t, tt.b)
+		if ast.Equal(a, b) != tt.expected {
+			t.Errorf("ast.Equal(%q, %q) wrong. want=%t", tt.a, tt.b, tt.expected)
+		}
+		if !ast.Equal(a, a) {
+			t.Errorf("ast.Equal(%q, itself) returned false", tt.a)
+		}
+		if !ast.Equal(a, ast.Clone(a)) {
+			t.Errorf("ast.Clone(%q) is not equal to the original", tt.a)
+		}
+	}
+}
+
+func parseForEqual(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	return program
+}
+
+func TestParsedNodeTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;", "LetStatement"},
+		{"return 1;", "ReturnStatement"},
+		{"while (x) { }", "WhileStatement"},
+		{"for (;;) { }", "ForStatement"},
+		{"for (x in xs) { }", "ForInStatement"},
+		{"do { } while (x)", "DoWhileStatement"},
+		{"repeat (3) { }", "RepeatStatement"},
+		{"try { } catch { }", "TryCatchStatement"},
+		{`throw "x"`, "ThrowStatement"},
+		{"outer: while (x) { }", "LabeledStatement"},
+		{"break;", "BreakStatement"},
+		{"continue;", "ContinueStatement"},
+		{"x", "Identifier"},
+		{"1", "IntegerLiteral"},
+		{"-x", "PrefixExpression"},
+		{"x + 1", "InfixExpression"},
+		{"true", "Boolean"},
+		{"if (x) { 1 }", "IfExpression"},
+		{"fn(x) { x }", "FunctionLiteral"},
+		{"f(x)", "CallExpression"},
+		{`"a"`, "StringLiteral"},
+		{"(1, 2)", "TupleLiteral"},
+		{"[1, 2]", "ArrayLiteral"},
+		{"xs[0]", "IndexExpression"},
+		{"xs[1:]", "SliceExpression"},
+		{`{"a": 1}`, "HashLiteral"},
+		{"x = 1", "AssignExpression"},
+		{"macro(x) { x }", "MacroLiteral"},
+		{"match x { default: 1 }", "MatchExpression"},
+		{":ok", "SymbolLiteral"},
+	}
+
+	for _, tt := range tests {
+		program := parseForEqual(t, tt.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got=%d", tt.input, len(program.Statements))
+		}
+
+		var node ast.Node = program.Statements[0]
+		if stmt, ok := node.(*ast.ExpressionStatement); ok {
+			node = stmt.Expression
+		}
+		if node.NodeType() != tt.expected {
+			t.Errorf("%q: NodeType wrong. want=%q, got=%q", tt.input, tt.expected, node.NodeType())
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;", "test.monkey:1:1"},
+		{"  foo", "test.monkey:1:3"},
+		{"\n  1 + 2 * 3", "test.monkey:2:3"},
+		{"add(1, 2)", "test.monkey:1:1"},
+		{"xs[0][1]", "test.monkey:1:1"},
+		{"xs[1:]", "test.monkey:1:1"},
+		{"x += 1", "test.monkey:1:1"},
+		{"-x", "test.monkey:1:1"},
+		{"(1, 2)", "test.monkey:1:1"},
+		{"if (x) { 1 }", "test.monkey:1:1"},
+		{"fn(x) { x }(1)", "test.monkey:1:1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewWithFile(tt.input, "test.monkey"))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		var node ast.Node = program.Statements[0]
+		if ok {
+			node = stmt.Expression
+		}
+		if node.Pos().String() != tt.expected {
+			t.Errorf("%q: wrong position. want=%s, got=%s", tt.input, tt.expected, node.Pos())
+		}
+	}
+
+	// return a, b のタプルは最初の要素の位置
+	p := New(lexer.New("fn() { return  a, b }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	if ret.ReturnValue.Pos().String() != "1:16" {
+		t.Errorf("wrong tuple position. got=%s", ret.ReturnValue.Pos())
+	}
+}
+
+// ベンチマークの入力。新しいプログラムはここに足す
+// go test -bench=Parser ./parser
+var benchmarkPrograms = []struct {
+	name  string
+	input string
+}{
+	{"fib25", `
+let fibonacci = fn(x) {
+	if (x == 0) { return 0; }
+	if (x == 1) { return 1; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(25);
+`},
+	{"collections", `
+let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}];
+let ages = [];
+for (p in people) { ages = push(ages, p["age"]); }
+let total = 0;
+for (let i = 0; i < len(ages); i += 1) { total += ages[i]; }
+[total, ages[1:], :ok];
+`},
+}
+
+func BenchmarkParser(b *testing.B) {
+	for _, bm := range benchmarkPrograms {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.input)))
+			for i := 0; i < b.N; i++ {
+				p := New(lexer.New(bm.input))
+				p.ParseProgram()
+				if len(p.Errors()) != 0 {
+					b.Fatalf("parser errors: %v", p.Errors())
+				}
+			}
+		})
+	}
+}
+
+func testStringLiteral(t *testing.T, exp ast.Expression, value string) bool {
+	str, ok := exp.(*ast.StringLiteral)
+	if !ok {
+		t.Errorf("exp not *ast.StringLiteral. got=%T", exp)
+		return false
+	}
+	if str.Value != value {
+		t.Errorf("str.Value not %q. got=%q", value, str.Value)
+		return false
+	}
+	return true
+}
@@ -3,19 +3,25 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"gomadoufu/monkey-interpreter-go/compiler"
 	"gomadoufu/monkey-interpreter-go/evaluator"
 	"gomadoufu/monkey-interpreter-go/lexer"
 	"gomadoufu/monkey-interpreter-go/object"
 	"gomadoufu/monkey-interpreter-go/parser"
+	"gomadoufu/monkey-interpreter-go/vm"
 	"io"
+	"os"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-// NOTE: Rustでは:qでquitする機能つけたいね
+// :quit と入力するか exit() を評価するとREPLを終了する
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	e := evaluator.NewWithOptions(evaluator.EvalOptions{Stdout: out, Stderr: os.Stderr})
 
 	for {
 		fmt.Printf("%s", PROMPT)
@@ -25,6 +31,16 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if isQuit(line) {
+			return
+		}
+		if printHelp(out, line) {
+			continue
+		}
+		if runEnvCommand(out, os.Stderr, line, env) {
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -34,7 +50,13 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluator.DefineMacros(program, macroEnv)
+		expanded := evaluator.ExpandMacros(program, macroEnv)
+
+		evaluated := e.Eval(expanded, env)
+		if _, ok := evaluated.(*object.ExitSignal); ok {
+			return
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -42,6 +64,130 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+func isQuit(line string) bool {
+	return strings.TrimSpace(line) == ":quit"
+}
+
+// :help <name> なら組み込み関数の説明を、:help だけなら組み込み関数の一覧を表示する
+// REPLのコマンドとして処理した場合はtrueを返す
+func printHelp(out io.Writer, line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != ":help" {
+		return false
+	}
+
+	if len(fields) == 1 {
+		io.WriteString(out, "builtin functions:\n")
+		for _, name := range evaluator.BuiltinNames() {
+			io.WriteString(out, "\t"+name+"\n")
+		}
+		return true
+	}
+
+	builtin, ok := evaluator.LookupBuiltin(fields[1])
+	if !ok {
+		io.WriteString(out, "no builtin function named "+fields[1]+"\n")
+		return true
+	}
+	io.WriteString(out, builtin.Doc+"\n")
+	return true
+}
+
+// :save <file> なら環境の束縛をファイルに保存し、:restore <file> なら保存した束縛を読み込む
+// 保存できない束縛の警告はerrOutに書く。REPLのコマンドとして処理した場合はtrueを返す
+func runEnvCommand(out, errOut io.Writer, line string, env *object.Environment) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || (fields[0] != ":save" && fields[0] != ":restore") {
+		return false
+	}
+	if len(fields) != 2 {
+		io.WriteString(out, "usage: "+fields[0]+" <file>\n")
+		return true
+	}
+
+	var result object.Object
+	if fields[0] == ":save" {
+		result = object.SaveEnvironment(env, fields[1], errOut)
+	} else {
+		result = object.LoadEnvironment(env, fields[1])
+	}
+	if result.Type() == object.ERROR_OBJ {
+		io.WriteString(out, result.Inspect()+"\n")
+		return true
+	}
+
+	if fields[0] == ":save" {
+		fmt.Fprintf(out, "saved %s bindings to %s\n", result.Inspect(), fields[1])
+	} else {
+		fmt.Fprintf(out, "restored %s bindings from %s\n", result.Inspect(), fields[1])
+	}
+	return true
+}
+
+// 評価器の代わりにコンパイラとVMで実行するREPL
+// 定数プール・シンボル表・グローバル変数を入力をまたいで保持するので、前の行で定義した関数を次の行で呼び出せる
+func StartVM(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	for {
+		fmt.Printf("%s", PROMPT)
+		scanned := scanner.Scan()
+		if !scanned {
+			return
+		}
+
+		line := scanner.Text()
+		if isQuit(line) {
+			return
+		}
+		if printHelp(out, line) {
+			continue
+		}
+
+		l := lexer.New(line)
+		p := parser.New(l)
+
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			continue
+		}
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		err := comp.Compile(program)
+		if err != nil {
+			printErrors(out, "compilation failed", []string{err.Error()})
+			continue
+		}
+
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, globals)
+		err = machine.Run()
+		if _, ok := err.(*object.ExitSignal); ok {
+			return
+		}
+		if err != nil {
+			printErrors(out, "executing bytecode failed", []string{err.Error()})
+			continue
+		}
+
+		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped != nil {
+			io.WriteString(out, lastPopped.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
 const MONKEY_FACE = `
             __,__
    .--.  .-"     "-.  .--.
@@ -57,9 +203,13 @@ const MONKEY_FACE = `
 `
 
 func printParserErrors(out io.Writer, errors []string) {
+	printErrors(out, "parser errors", errors)
+}
+
+func printErrors(out io.Writer, title string, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
+	io.WriteString(out, " "+title+":\n")
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
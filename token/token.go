@@ -1,13 +1,13 @@
 package token
 
+import "fmt"
+
 // トークンタイプ = 識別子 | キーワード | 記号 | ILLEGAL | EOF
 // 識別子 = 数や変数名など、ユーザが決定するもの。字句解析や構文解析の段階では、識別子であることさえわかれば良い
 // キーワード = if, else, true, false, return, let, fn などの予約語。識別子に見えるが、実際は言語の一部であるもの
 // 記号 = +, -, *, /, =, ==, !=, <, >, !, (, ), {, }, ;, , などの記号
 type TokenType string
 
-// NOTE:ファイル名や行番号を付与するアイデアもある(Rustではやってみる)
-
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
@@ -15,7 +15,10 @@ const (
 	// 識別子 + リテラル
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
 	INT    = "INT"    // 1343456
+	FLOAT  = "FLOAT"  // 3.14
 	STRING = "STRING" // "foobar"
+	// シンボル。リテラルは:を除いた名前
+	COLON_IDENT = "COLON_IDENT" // :ok
 
 	// 演算子
 	ASSIGN   = "="
@@ -24,6 +27,7 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
 	LT = "<"
 	GT = ">"
@@ -31,6 +35,17 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	// 論理演算子。右辺は必要なときだけ評価する
+	LAND = "&&"
+	LOR  = "||"
+
+	// 複合代入 x += y は x = x + y
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -43,15 +58,43 @@ const (
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	LETREC   = "LETREC"
+	UNLET    = "UNLET"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	DEFER    = "DEFER"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	YIELD    = "YIELD"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	STRUCT   = "STRUCT"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	NOT      = "NOT"
+	AND      = "AND"
+	OR       = "OR"
+	UNLESS   = "UNLESS"
+	UNTIL    = "UNTIL"
+	DO       = "DO"
+	REPEAT   = "REPEAT"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 
 	LBRACKET = "["
 	RBRACKET = "]"
 	COLON    = ":"
+	DOT      = "."
 )
 
 // トークン = トークンタイプ + リテラル
@@ -59,16 +102,64 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
+	// トークンの先頭の位置
+	Pos Position
+}
+
+// ソースコード上の位置。行と列はどちらも1から数え、列はバイト単位
+// Fileはファイルから読んだときのファイル名で、それ以外は空
+// 字句解析器を通らずに作られたトークンはゼロ値を持つ
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// file:line:column の形で返す。ファイル名がなければ line:column
+func (p Position) String() string {
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"letrec":   LETREC,
+	"unlet":    UNLET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"defer":    DEFER,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"yield":    YIELD,
+	"macro":    MACRO,
+	"match":    MATCH,
+	"case":     CASE,
+	"default":  DEFAULT,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"struct":   STRUCT,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"not":      NOT,
+	"and":      AND,
+	"or":       OR,
+	"unless":   UNLESS,
+	"until":    UNTIL,
+	"do":       DO,
+	"repeat":   REPEAT,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 }
 
 // 渡された識別子がキーワードかどうかを判定する
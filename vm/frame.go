@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"gomadoufu/monkey-interpreter-go/code"
+	"gomadoufu/monkey-interpreter-go/object"
+)
+
+// 関数呼び出しごとの実行状態(コールフレーム)
+type Frame struct {
+	cl *object.Closure
+	// 命令ポインタ
+	ip int
+	// 呼び出し時のスタックポインタ。ここからNumLocals個のスロットがローカル変数の領域になる
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,656 @@
+package vm
+
+import (
+	"fmt"
+	"gomadoufu/monkey-interpreter-go/ast"
+	"gomadoufu/monkey-interpreter-go/compiler"
+	"gomadoufu/monkey-interpreter-go/evaluator"
+	"gomadoufu/monkey-interpreter-go/lexer"
+	"gomadoufu/monkey-interpreter-go/object"
+	"gomadoufu/monkey-interpreter-go/parser"
+	"io"
+	"os"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected any
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"4 / 2", 2},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!(if (false) { 5; })", true},
+		{":ok == :ok", true},
+		{":ok != :error", true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "a"`, false},
+		{"true && true", true},
+		{"true and false", false},
+		{"false || true", true},
+		{"false or false", false},
+		{"1 < 2 and 2 < 3", true},
+		{"true && false or true", true},
+		{"true and 5", true},
+		{"false or first([])", false},
+		{"let n = 0; false and (n = 1); true or (n = 2); n", 0},
+		{"let f = fn() { true and false or true }; f()", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (true) { }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"unless (false) { 1 }", 1},
+		{"unless (true) { 1 }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][99]", Null},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{:ok: 1, :error: 2}[:ok]", 1},
+		{"let p = struct { x: 1, y: 2 }; p.y", 2},
+		{"struct { a: struct { b: 3 } }.a.b", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    "let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();",
+			expected: 15,
+		},
+		{
+			input:    "let earlyExit = fn() { return 99; 100; }; earlyExit();",
+			expected: 99,
+		},
+		{
+			input:    "let noReturn = fn() { }; noReturn();",
+			expected: Null,
+		},
+		{
+			input:    "let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();",
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    "let one = fn() { let one = 1; one }; one();",
+			expected: 1,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let firstFoobar = fn() { let foobar = 50; foobar; };
+			let secondFoobar = fn() { let foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+			expected: 150,
+		},
+		{
+			input: `
+			let globalSeed = 50;
+			let minusOne = fn() { let num = 1; globalSeed - num; }
+			let minusTwo = fn() { let num = 2; globalSeed - num; }
+			minusOne() + minusTwo();
+			`,
+			expected: 97,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    "let identity = fn(a) { a; }; identity(4);",
+			expected: 4,
+		},
+		{
+			input:    "let sum = fn(a, b) { a + b; }; sum(1, 2);",
+			expected: 3,
+		},
+		{
+			input:    "let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);",
+			expected: 10,
+		},
+		{
+			input: `
+			let globalNum = 10;
+			let sum = fn(a, b) { let c = a + b; c + globalNum; };
+			let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+			outer() + globalNum;
+			`,
+			expected: 50,
+		},
+		{
+			input: `
+			let fibonacci = fn(x) {
+				if (x == 0) { return 0; }
+				if (x == 1) { return 1; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);
+			`,
+			expected: 610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"fn() { 1; }(1);", "1:1: wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "1:1: wrong number of arguments: want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "1:1: wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	program := parse("let f = fn(x) { 10 / x }; f(0);")
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	if err.Error() != "1:17: division by zero: 10 / 0" {
+		t.Fatalf("wrong VM error: want=%q, got=%q", "1:17: division by zero: 10 / 0", err)
+	}
+}
+
+func TestRuntimeErrorPosition(t *testing.T) {
+	input := `let f = fn(x) {
+	let y = x * 2;
+	y / x
+};
+let g = fn(x) { f(x) };
+g(0);`
+
+	l := lexer.NewWithFile(input, "main.mnk")
+	program := parser.New(l).ParseProgram()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("err is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Pos.File != "main.mnk" || runtimeErr.Pos.Line != 3 || runtimeErr.Pos.Column != 2 {
+		t.Errorf("wrong position. got=%s", runtimeErr.Pos)
+	}
+	if runtimeErr.Err.Error() != "division by zero: 0 / 0" {
+		t.Errorf("wrong error. got=%q", runtimeErr.Err)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newClosure = fn(a) { fn() { a; }; };
+			let closure = newClosure(99);
+			closure();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+		{
+			input: `
+			let makeCounter = fn() {
+				let count = 0;
+				fn() { count = count + 1; count }
+			};
+			let first = makeCounter();
+			let second = makeCounter();
+			first();
+			first();
+			second();
+			first() * 10 + second();
+			`,
+			expected: 32,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expected: 0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; let b = 1; a = b = 5; a + b", 10},
+		{"let f = fn() { let x = 1; x = x + 1; x }; f()", 2},
+		{"let a = 10; a += 5; a -= 3; a *= 2; a /= 4; a", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`copy([1, 2])`, []int{1, 2}},
+		{`puts("hello")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`len(1)`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`len("one", "two")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+		{`let f = fn(arr) { len(arr) }; f([1, 2])`, 2},
+		{`len(set([1, 2, 2]))`, 2},
+		{`set_has(set([1, 2]), 2) == true`, true},
+		{`len(chars("héllo"))`, 5},
+		{`flatten([1, [2, [3]]])`, []int{1, 2, 3}},
+		{`uniq([1, 2, 1, 3, 2])`, []int{1, 2, 3}},
+		{`chunk([1, 2, 3], 2)[1]`, []int{3}},
+		{`format("{}-{1}", 1, 2)`, "1-2"},
+		{`len(split("a,b,c", ",", 2))`, 2},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`to_s(255, 16)`, "ff"},
+		{`to_int(to_char(233))`, 233},
+		{`scan("3 4", "%d %d")`, []int{3, 4}},
+		{`random_int(2, 2)`, 2},
+		{`base64_decode(base64_encode("hi"))`, "hi"},
+		{`md5("")`, "d41d8cd98f00b204e9800998ecf8427e"},
+		{`url_encode("a b")`, "a%20b"},
+		{`len(zip([1, 2, 3], [4, 5]))`, 2},
+		{`bytes("é")`, []int{195, 169}},
+		{`codepoints("hé")`, []int{104, 233}},
+	}
+
+	runVmTests(t, tests)
+}
+
+// 組み込み関数の呼び出しが評価器とVMで同じ結果・同じ出力になることを確認する
+func TestBuiltinFunctionsMatchEvaluator(t *testing.T) {
+	inputs := []string{
+		`len([1, 2, 3])`,
+		`puts("hello")`,
+		`puts(1, [1, 2])`,
+		`printf("%s=%d\n", "x", 1)`,
+		`sprintf("%d%%", 5)`,
+	}
+
+	for _, input := range inputs {
+		program := parse(input)
+
+		var evaluated object.Object
+		evalOut := captureStdout(t, func() {
+			evaluated = evaluator.Eval(program, object.NewEnvironment())
+		})
+
+		var vmResult object.Object
+		vmOut := captureStdout(t, func() {
+			comp := compiler.New()
+			if err := comp.Compile(program); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			machine := New(comp.Bytecode())
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			vmResult = machine.LastPoppedStackElem()
+		})
+
+		if evaluated.Inspect() != vmResult.Inspect() {
+			t.Errorf("result differs for %q. eval=%q, vm=%q", input, evaluated.Inspect(), vmResult.Inspect())
+		}
+		if evalOut != vmOut {
+			t.Errorf("output differs for %q. eval=%q, vm=%q", input, evalOut, vmOut)
+		}
+	}
+}
+
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading output failed: %s", err)
+	}
+	return string(out)
+}
+
+func TestExitStopsVM(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let f = fn() { exit(7) }; f(); puts("unreachable")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	exit, ok := err.(*object.ExitSignal)
+	if !ok {
+		t.Fatalf("err is not *object.ExitSignal. got=%T (%v)", err, err)
+	}
+	if exit.Code != 7 {
+		t.Errorf("wrong exit code. want=7, got=%d", exit.Code)
+	}
+}
+
+func TestGlobalsStoreAcrossRuns(t *testing.T) {
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	inputs := []string{
+		"let double = fn(x) { x * 2 };",
+		"let four = double(2);",
+		"double(four)",
+	}
+
+	var machine *VM
+	for _, input := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine = NewWithGlobalsStore(bytecode, globals)
+		err = machine.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	testExpectedObject(t, 8, machine.LastPoppedStackElem())
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, expected any, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
+const benchmarkFibonacci = `
+let fibonacci = fn(x) {
+	if (x == 0) { return 0; }
+	if (x == 1) { return 1; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(20);
+`
+
+// 同じ入力をVMと評価器で実行して比較する
+// go test -bench=Fibonacci ./vm
+func BenchmarkFibonacci(b *testing.B) {
+	program := parse(benchmarkFibonacci)
+
+	b.Run("vm", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			comp := compiler.New()
+			if err := comp.Compile(program); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			machine := New(comp.Bytecode())
+			if err := machine.Run(); err != nil {
+				b.Fatalf("vm error: %s", err)
+			}
+		}
+	})
+
+	b.Run("eval", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			env := object.NewEnvironment()
+			evaluator.Eval(program, env)
+		}
+	})
+}